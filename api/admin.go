@@ -69,7 +69,7 @@ func AdminDeleteShare(c *gin.Context) {
 	c.JSON(200, res)
 }
 
-// AdminDeleteFile 删除数据库中相同md5码的所有文件，不删除云端文件
+// AdminDeleteFile 删除数据库中相同md5码的所有文件，云端文件不再被引用时按宽限期清理
 func AdminDeleteFile(c *gin.Context) {
 	var service admin.FileDeleteService
 	if err := c.ShouldBind(&service); err != nil {
@@ -95,3 +95,52 @@ func AdminGetFileStoreInfo(c *gin.Context) {
 	res := service.FileStoreGetInfo(userId)
 	c.JSON(200, res)
 }
+
+// AdminObjectCleanupReport 获取云端对象清理报告，开启清理前检查将被删除的对象
+func AdminObjectCleanupReport(c *gin.Context) {
+	var service admin.ObjectCleanupReportService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	res := service.ObjectCleanupReport()
+	c.JSON(200, res)
+}
+
+// AdminStartReconcile 创建存储桶与数据库的对账任务
+func AdminStartReconcile(c *gin.Context) {
+	var service admin.ReconcileService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	res := service.StartReconcile()
+	c.JSON(200, res)
+}
+
+// AdminGetReconcileJob 获取对账任务进度和发现的问题
+func AdminGetReconcileJob(c *gin.Context) {
+	var service admin.ReconcileJobService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	res := service.GetReconcileJob(c.Param("jobId"))
+	c.JSON(200, res)
+}
+
+// AdminCheckUserSizes 重新计算用户的文件夹大小和存储空间已用大小，可选修正不符的记录
+func AdminCheckUserSizes(c *gin.Context) {
+	var service admin.SizeCheckService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.Param("userId")
+	res := service.CheckUserSizes(userId)
+	c.JSON(200, res)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"go-cloud-disk/disk"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/archive"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadFileFolderArchive 将文件夹打包为ZIP或tar.gz后流式下载
+func DownloadFileFolderArchive(c *gin.Context) {
+	var service archive.FileFolderArchiveService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	jwtUser := c.MustGet("UserId").(string)
+	fileFolderId := c.Param("filefolderid")
+	zipArchive, res := service.GetFileFolderArchive(jwtUser, fileFolderId)
+	if zipArchive == nil {
+		c.JSON(200, res)
+		return
+	}
+	writeArchive(c, zipArchive)
+}
+
+// DownloadFileArchive 将多选的文件和文件夹打包为ZIP或tar.gz后流式下载
+func DownloadFileArchive(c *gin.Context) {
+	var service archive.FileArchiveService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	jwtUser := c.MustGet("UserId").(string)
+	zipArchive, res := service.GetFileArchive(jwtUser)
+	if zipArchive == nil {
+		c.JSON(200, res)
+		return
+	}
+	writeArchive(c, zipArchive)
+}
+
+// writeArchive 设置下载响应头并写出压缩包，开始写出后无法再返回JSON错误，只记录日志
+func writeArchive(c *gin.Context, zipArchive *archive.Archive) {
+	fileName := zipArchive.FileName()
+	c.Header("Content-Type", zipArchive.ContentType())
+	c.Header("Content-Disposition", disk.ContentDisposition(fileName))
+	c.Status(200)
+	if err := zipArchive.Stream(c.Writer); err != nil {
+		logger.Log().Error("[api.writeArchive] 写出压缩包失败: ", err)
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/batch"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BatchMoveFiles 批量移动文件和文件夹
+func BatchMoveFiles(c *gin.Context) {
+	var service batch.FileBatchTransferService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.MoveFiles(userId)
+	c.JSON(200, res)
+}
+
+// BatchCopyFiles 批量复制文件和文件夹
+func BatchCopyFiles(c *gin.Context) {
+	var service batch.FileBatchTransferService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.CopyFiles(userId)
+	c.JSON(200, res)
+}
+
+// BatchDeleteFiles 批量删除文件和文件夹，文件移到回收站
+func BatchDeleteFiles(c *gin.Context) {
+	var service batch.FileBatchService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.DeleteFiles(userId)
+	c.JSON(200, res)
+}
+
+// BatchRestoreFiles 批量从回收站恢复文件
+func BatchRestoreFiles(c *gin.Context) {
+	var service batch.FileBatchRestoreService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.RestoreFiles(userId)
+	c.JSON(200, res)
+}
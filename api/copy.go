@@ -0,0 +1,42 @@
+package api
+
+import (
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/batch"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CopyFile 复制文件到目标文件夹
+func CopyFile(c *gin.Context) {
+	var service batch.FileCopyService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.CopyFile(userId, c.Param("fileid"))
+	c.JSON(200, res)
+}
+
+// CopyFileFolder 复制文件夹到目标文件夹，文件夹较大时返回后台复制任务
+func CopyFileFolder(c *gin.Context) {
+	var service batch.FileCopyService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.CopyFileFolder(userId, c.Param("filefolderid"))
+	c.JSON(200, res)
+}
+
+// GetCopyJob 获取后台复制任务进度
+func GetCopyJob(c *gin.Context) {
+	var service batch.CopyJobService
+	userId := c.MustGet("UserId").(string)
+	res := service.GetCopyJob(userId, c.Param("jobid"))
+	c.JSON(200, res)
+}
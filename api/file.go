@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"mime/multipart"
+	"net/http"
 	"time"
 
 	"go-cloud-disk/serializer"
@@ -52,6 +53,36 @@ func GetDownloadURL(c *gin.Context) {
 	c.JSON(200, res)
 }
 
+// GetFileContent 通过签名URL代理下载文件内容，支持Range和条件请求
+func GetFileContent(c *gin.Context) {
+	var service file.FileStreamService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ErrorResponse(err))
+		return
+	}
+
+	fileId := c.Param("fileid")
+	stream, status, res := service.GetFileStream(fileId)
+	if stream == nil {
+		c.JSON(status, res)
+		return
+	}
+	stream.Serve(c.Writer, c.Request)
+}
+
+// InstantUploadFile 根据文件哈希秒传文件
+func InstantUploadFile(c *gin.Context) {
+	var service file.FileInstantUploadService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userIdInJWT := c.MustGet("UserId").(string)
+	res := service.InstantUploadFile(userIdInJWT)
+	c.JSON(200, res)
+}
+
 // getUploadFileParam 从请求中获取上传文件参数
 func getUploadFileParam(c *gin.Context) (userId string, file *multipart.FileHeader, dst string, err error) {
 	userId = c.MustGet("UserId").(string)
@@ -14,12 +14,9 @@ func InitChunkUpload(c *gin.Context) {
 		c.JSON(200, serializer.ErrorResponse(err))
 		return
 	}
-	userId, file, dst, err := getUploadFileParam(c)
-	if err != nil {
-		c.JSON(200, serializer.ErrorResponse(err))
-		return
-	}
-	res := service.InitChunkUpload(userId, file, dst)
+
+	userId := c.MustGet("UserId").(string)
+	res := service.InitChunkUpload(userId)
 	c.JSON(200, res)
 }
 
@@ -70,3 +67,35 @@ func CompleteChunkUpload(c *gin.Context) {
 	res := service.CompleteChunkUpload(userId)
 	c.JSON(200, res)
 }
+
+// RetryFileUpload 重试处理失败的分片上传
+func RetryFileUpload(c *gin.Context) {
+	var service chunk.UploadRetryService
+	userId := c.MustGet("UserId").(string)
+	res := service.RetryUpload(userId, c.Param("fileid"))
+	c.JSON(200, res)
+}
+
+// GetFileUploadStatus 查询分片上传的后台合并状态
+func GetFileUploadStatus(c *gin.Context) {
+	var service chunk.UploadStatusService
+	userId := c.MustGet("UserId").(string)
+	res := service.GetUploadStatus(userId, c.Param("fileid"))
+	c.JSON(200, res)
+}
+
+// ListChunkUploads 列出进行中的分片上传
+func ListChunkUploads(c *gin.Context) {
+	var service chunk.UploadSessionService
+	userId := c.MustGet("UserId").(string)
+	res := service.ListUploadSessions(userId)
+	c.JSON(200, res)
+}
+
+// AbortChunkUpload 取消分片上传
+func AbortChunkUpload(c *gin.Context) {
+	var service chunk.UploadSessionService
+	userId := c.MustGet("UserId").(string)
+	res := service.AbortUploadSession(userId, c.Param("uploadId"))
+	c.JSON(200, res)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/fspath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatFilePath 返回路径指向的文件或文件夹信息
+func StatFilePath(c *gin.Context) {
+	var service fspath.FilePathService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.Stat(userId)
+	c.JSON(200, res)
+}
+
+// ListFilePath 返回路径指向的文件夹中的子文件夹和文件
+func ListFilePath(c *gin.Context) {
+	var service fspath.FilePathService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.List(userId)
+	c.JSON(200, res)
+}
+
+// MkdirFilePath 逐级创建路径中不存在的文件夹
+func MkdirFilePath(c *gin.Context) {
+	var service fspath.FilePathService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.Mkdir(userId)
+	c.JSON(200, res)
+}
+
+// MoveFilePath 移动或重命名路径指向的文件或文件夹
+func MoveFilePath(c *gin.Context) {
+	var service fspath.FilePathMoveService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.Move(userId)
+	c.JSON(200, res)
+}
+
+// DeleteFilePath 删除路径指向的文件或文件夹
+func DeleteFilePath(c *gin.Context) {
+	var service fspath.FilePathService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.Delete(userId)
+	c.JSON(200, res)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/file"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListFileVersions 列出文件的历史版本
+func ListFileVersions(c *gin.Context) {
+	var service file.FileVersionService
+	userId := c.MustGet("UserId").(string)
+	res := service.ListFileVersions(userId, c.Param("fileid"))
+	c.JSON(200, res)
+}
+
+// GetFileVersionURL 返回历史版本的下载URL
+func GetFileVersionURL(c *gin.Context) {
+	var service file.FileVersionService
+	userId := c.MustGet("UserId").(string)
+	res := service.GetFileVersionURL(userId, c.Param("fileid"), c.Param("versionid"))
+	c.JSON(200, res)
+}
+
+// RestoreFileVersion 将历史版本恢复为当前内容
+func RestoreFileVersion(c *gin.Context) {
+	var service file.FileVersionService
+	userId := c.MustGet("UserId").(string)
+	res := service.RestoreFileVersion(userId, c.Param("fileid"), c.Param("versionid"))
+	c.JSON(200, res)
+}
+
+// DeleteFileVersion 删除历史版本
+func DeleteFileVersion(c *gin.Context) {
+	var service file.FileVersionService
+	userId := c.MustGet("UserId").(string)
+	res := service.DeleteFileVersion(userId, c.Param("fileid"), c.Param("versionid"))
+	c.JSON(200, res)
+}
+
+// GetFileVersionConfig 获取历史版本保留策略
+func GetFileVersionConfig(c *gin.Context) {
+	var service file.FileVersionService
+	userId := c.MustGet("UserId").(string)
+	res := service.GetFileVersionConfig(userId)
+	c.JSON(200, res)
+}
+
+// UpdateFileVersionConfig 更新历史版本保留策略
+func UpdateFileVersionConfig(c *gin.Context) {
+	var service file.FileVersionConfigService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	userId := c.MustGet("UserId").(string)
+	res := service.UpdateFileVersionConfig(userId)
+	c.JSON(200, res)
+}
@@ -73,3 +73,23 @@ func UpdateFileFolder(c *gin.Context) {
 	res := service.UpdateFileFolderInfo(jwtUser)
 	c.JSON(200, res)
 }
+
+// UploadFileFolder 上传整个目录树到指定文件夹，保留目录结构
+func UploadFileFolder(c *gin.Context) {
+	var service filefolder.FileFolderUploadService
+	if err := c.ShouldBind(&service); err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(200, serializer.ErrorResponse(err))
+		return
+	}
+
+	jwtUser := c.MustGet("UserId").(string)
+	fileFolderId := c.Param("filefolderid")
+	res := service.UploadFileFolder(jwtUser, fileFolderId, form.File["files"])
+	c.JSON(200, res)
+}
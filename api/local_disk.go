@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getLocalDiskObjectKey 校验本地磁盘预签名请求并返回对象键
+func getLocalDiskObjectKey(c *gin.Context) (*disk.LocalCloudDisk, string, bool) {
+	local, ok := disk.BaseCloudDisk.(*disk.LocalCloudDisk)
+	if !ok {
+		c.JSON(http.StatusNotFound, serializer.Err(serializer.CodeError, "当前云盘不支持本地对象访问", nil))
+		return nil, "", false
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	err := local.VerifyPresignedRequest(c.Request.Method, key, c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusForbidden, serializer.NotAuthErr(err.Error()))
+		return nil, "", false
+	}
+	return local, key, true
+}
+
+// LocalDiskGetObject 通过预签名URL下载本地磁盘对象
+func LocalDiskGetObject(c *gin.Context) {
+	local, key, ok := getLocalDiskObjectKey(c)
+	if !ok {
+		return
+	}
+
+	objectPath, err := local.ObjectPath(key)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamsErr("", err))
+		return
+	}
+	// 与S3和COS一致，通过已签名的查询参数覆盖响应头。总是作为附件下载并禁止浏览器探测类型，
+	// 避免用户上传的HTML等内容在本站域名下执行
+	disposition := c.Query("response-content-disposition")
+	if disposition == "" {
+		disposition = disk.ContentDisposition(path.Base(key))
+	}
+	c.Header("Content-Disposition", disposition)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if contentType := c.Query("response-content-type"); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.File(objectPath)
+}
+
+// LocalDiskPutObject 通过预签名URL上传本地磁盘对象
+func LocalDiskPutObject(c *gin.Context) {
+	local, key, ok := getLocalDiskObjectKey(c)
+	if !ok {
+		return
+	}
+
+	if err := local.PutObject(key, c.Request.Body); err != nil {
+		logger.Log().Error("[LocalDiskPutObject] 保存对象失败: ", err)
+		c.JSON(http.StatusInternalServerError, serializer.InternalErr("", err))
+		return
+	}
+	c.Status(http.StatusOK)
+}
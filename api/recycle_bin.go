@@ -10,7 +10,7 @@ import (
 // 逻辑删除文件（移到回收站）
 func LogicalDeleteFile(c *gin.Context) {
 	fileID := c.Param("fileid")
-	userID := c.MustGet("userId").(string)
+	userID := c.MustGet("UserId").(string)
 
 	var service file.FileRefCountService
 	res := service.LogicalDeleteFile(userID, fileID)
@@ -20,7 +20,7 @@ func LogicalDeleteFile(c *gin.Context) {
 // RestoreFile 从回收站恢复文件
 func RestoreFile(c *gin.Context) {
 	recycleBinID := c.Param("recycleBinId")
-	userID := c.MustGet("userId").(string)
+	userID := c.MustGet("UserId").(string)
 
 	var service file.FileRefCountService
 	res := service.RestoreFile(userID, recycleBinID)
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go-cloud-disk/service/file/chunk"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tus协议使用HTTP状态码和响应头表示结果，因此这些接口不返回serializer.Response
+
+// writeTusError 根据错误类型返回tus协议状态码
+func writeTusError(c *gin.Context, err error) {
+	var tusErr *chunk.TusError
+	if errors.As(err, &tusErr) {
+		c.String(tusErr.Status, tusErr.Msg)
+		return
+	}
+	logger.Log().Error("[Tus] 处理tus请求失败: ", err)
+	c.String(http.StatusInternalServerError, "InternalError")
+}
+
+// checkTusResumable 设置tus响应头并检查客户端协议版本
+func checkTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", chunk.TusVersion)
+	if c.GetHeader("Tus-Resumable") != chunk.TusVersion {
+		c.Header("Tus-Version", chunk.TusVersion)
+		c.Status(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// TusOptions 返回服务端支持的tus协议版本和扩展
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", chunk.TusVersion)
+	c.Header("Tus-Version", chunk.TusVersion)
+	c.Header("Tus-Extension", chunk.TusExtensions)
+	c.Header("Tus-Checksum-Algorithm", chunk.TusChecksumAlgorithms)
+	c.Status(http.StatusNoContent)
+}
+
+// TusCreateUpload 创建tus上传任务
+func TusCreateUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	uploadLength, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Upload-Length格式错误")
+		return
+	}
+
+	service := chunk.TusCreateService{
+		UploadLength:   uploadLength,
+		UploadMetadata: c.GetHeader("Upload-Metadata"),
+	}
+	userId := c.MustGet("UserId").(string)
+	uploadId, err := service.CreateUpload(userId)
+	if err != nil {
+		writeTusError(c, err)
+		return
+	}
+	c.Header("Location", c.Request.URL.Path+"/"+uploadId)
+	c.Status(http.StatusCreated)
+}
+
+// TusHeadUpload 查询tus上传任务的当前偏移量
+func TusHeadUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	userId := c.MustGet("UserId").(string)
+	offset, length, err := chunk.GetTusOffset(userId, c.Param("uploadId"))
+	if err != nil {
+		writeTusError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(length, 10))
+	c.Status(http.StatusOK)
+}
+
+// TusPatchUpload 向tus上传任务写入数据
+func TusPatchUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.String(http.StatusUnsupportedMediaType, "Content-Type必须为application/offset+octet-stream")
+		return
+	}
+	uploadOffset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Upload-Offset格式错误")
+		return
+	}
+
+	service := chunk.TusPatchService{
+		UploadOffset:   uploadOffset,
+		UploadChecksum: c.GetHeader("Upload-Checksum"),
+	}
+	userId := c.MustGet("UserId").(string)
+	offset, err := service.PatchUpload(userId, c.Param("uploadId"), c.Request.Body)
+	if err != nil {
+		writeTusError(c, err)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// TusTerminateUpload 终止tus上传任务
+func TusTerminateUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	userId := c.MustGet("UserId").(string)
+	if err := chunk.TerminateUpload(userId, c.Param("uploadId")); err != nil {
+		writeTusError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -7,6 +7,10 @@ const (
 	DailyRankKey = "rank:daily"
 	// EmptyShare 存储空分享键的集合
 	EmptyShare = "share:empty"
+	// ChunkUploadSessionKey 分片上传会话哈希，保存取消云端分片上传所需的信息，不随上传信息过期
+	ChunkUploadSessionKey = "chunk:session"
+	// ChunkUploadExpireKey 分片上传会话过期时间有序集合，成员为"用户ID:上传任务ID"，分数为过期时间戳
+	ChunkUploadExpireKey = "chunk:expire"
 )
 
 // ShareKey 使用ID构建缓存中的分享键
@@ -24,6 +28,11 @@ func FileInfoStoreKey(id string) string {
 	return fmt.Sprintf("file:cloud:%s", id)
 }
 
+// InstantUploadChallengeKey 秒传持有证明的校验信息键
+func InstantUploadChallengeKey(id string) string {
+	return fmt.Sprintf("instant:challenge:%s", id)
+}
+
 // EmailCodeKey 用于在缓存中存储确认码
 func EmailCodeKey(email string) string {
 	return fmt.Sprintf("email:%s", email)
@@ -38,3 +47,28 @@ func RecentSendUserKey(email string) string {
 func ChunkUploadInfoKey(uploadId string) string {
 	return fmt.Sprintf("chunk:upload:%s", uploadId)
 }
+
+// ChunkUploadUserKey 用户进行中的分片上传集合键
+func ChunkUploadUserKey(userId string) string {
+	return fmt.Sprintf("chunk:user:%s", userId)
+}
+
+// TusUploadLockKey tus上传写入锁键，防止同一上传任务并发PATCH
+func TusUploadLockKey(uploadId string) string {
+	return fmt.Sprintf("tus:lock:%s", uploadId)
+}
+
+// TusUploadDoneKey 已完成的tus上传信息键，用于完成后响应HEAD请求
+func TusUploadDoneKey(uploadId string) string {
+	return fmt.Sprintf("tus:done:%s", uploadId)
+}
+
+// TransferRateKey 用户传输限速键，保存令牌桶的理论到达时间，所有实例共享
+func TransferRateKey(userId string, direction string) string {
+	return fmt.Sprintf("transfer:rate:%s:%s", direction, userId)
+}
+
+// TransferDailyKey 用户每日传输流量键，direction为download或upload，day格式为20060102
+func TransferDailyKey(userId string, direction string, day string) string {
+	return fmt.Sprintf("transfer:%s:%s:%s", direction, userId, day)
+}
@@ -22,6 +22,16 @@ var (
 	BucketSecretID   string
 	BucketSecretKey  string
 	CloudDiskVersion string
+	LocalDiskRoot    string
+	LocalDiskURL     string
+	LocalDiskSecret  string
+	S3Endpoint       string
+	S3Region         string
+	S3Bucket         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3UseSSL         string
+	S3PathStyle      string
 	RedisAddr        string
 	RedisPassword    string
 	RedisDB          string
@@ -30,6 +40,16 @@ var (
 	RabbitMQPassword string
 	RabbitMQHost     string
 	RabbitMQPort     string
+
+	TransferRateInactive  string
+	TransferRateActive    string
+	TransferQuotaInactive string
+	TransferQuotaActive   string
+
+	ObjectGCEnable    string
+	ObjectGCGraceDays string
+
+	SizeCheckRepair string
 )
 
 func Init() {
@@ -54,6 +74,16 @@ func initEnv() {
 	BucketSecretID = os.Getenv("BUCKET_SECRET_ID")
 	BucketSecretKey = os.Getenv("BUCKET_SECRET_KEY")
 	CloudDiskVersion = os.Getenv("CLOUD_DISK_VERSION")
+	LocalDiskRoot = os.Getenv("LOCAL_DISK_ROOT")
+	LocalDiskURL = os.Getenv("LOCAL_DISK_URL")
+	LocalDiskSecret = os.Getenv("LOCAL_DISK_SECRET")
+	S3Endpoint = os.Getenv("S3_ENDPOINT")
+	S3Region = os.Getenv("S3_REGION")
+	S3Bucket = os.Getenv("S3_BUCKET")
+	S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	S3SecretKey = os.Getenv("S3_SECRET_KEY")
+	S3UseSSL = os.Getenv("S3_USE_SSL")
+	S3PathStyle = os.Getenv("S3_PATH_STYLE")
 	RedisAddr = os.Getenv("REDIS_ADDR")
 	RedisPassword = os.Getenv("REDIS_PASSWORD")
 	RedisDB = os.Getenv("REDIS_DB")
@@ -62,4 +92,11 @@ func initEnv() {
 	RabbitMQPassword = os.Getenv("RABBITMQ_PASSWORD")
 	RabbitMQHost = os.Getenv("RABBITMQ_HOST")
 	RabbitMQPort = os.Getenv("RABBITMQ_PORT")
+	TransferRateInactive = os.Getenv("TRANSFER_RATE_INACTIVE")
+	TransferRateActive = os.Getenv("TRANSFER_RATE_ACTIVE")
+	TransferQuotaInactive = os.Getenv("TRANSFER_QUOTA_INACTIVE")
+	TransferQuotaActive = os.Getenv("TRANSFER_QUOTA_ACTIVE")
+	ObjectGCEnable = os.Getenv("OBJECT_GC_ENABLE")
+	ObjectGCGraceDays = os.Getenv("OBJECT_GC_GRACE_DAYS")
+	SizeCheckRepair = os.Getenv("SIZE_CHECK_REPAIR")
 }
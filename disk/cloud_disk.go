@@ -1,6 +1,36 @@
 package disk
 
-import "go-cloud-disk/conf"
+import (
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"go-cloud-disk/conf"
+)
+
+// Part 分片上传中已上传分片的信息
+type Part struct {
+	PartNumber int    `json:"part_number"` // 分片序号，从1开始
+	ETag       string `json:"etag"`        // 云端返回的分片ETag
+}
+
+// ObjectInfo 云端对象的元信息
+type ObjectInfo struct {
+	Size         int64     // 对象大小
+	ETag         string    // 云端返回的对象ETag，不含引号
+	LastModified time.Time // 最后修改时间
+}
+
+// ListedObject 列举对象时返回的对象信息
+type ListedObject struct {
+	Key          string    // 对象的完整键
+	Size         int64     // 对象大小
+	LastModified time.Time // 最后修改时间
+}
+
+// listPageSize 列举对象时每页的对象数
+const listPageSize = 1000
 
 // CloudDisk 云盘接口定义，封装了云存储服务的基本操作
 // 支持文件上传、下载、删除和存在性检查等功能
@@ -13,8 +43,9 @@ type CloudDisk interface {
 	GetDownloadPresignedURL(userId string, filePath string, fileName string) (string, error)
 	// GetObjectURL 生成对象URL。用户可以使用URL查看文件。
 	GetObjectURL(userId string, filePath string, fileName string) (string, error)
-	// GetDownloadURL 根据文件路径生成下载链接(用于分享)
-	GetDownloadURL(filePath string, fileUUID string) (string, error)
+	// GetObjectDownloadURL 检查对象存在后生成下载预签名URL，
+	// 通过响应头覆盖让下载的文件使用原始文件名和正确的MIME类型
+	GetObjectDownloadURL(userId string, filePath string, fileName string, opt DownloadOptions) (string, error)
 	// DeleteObject 删除用户对象
 	DeleteObject(userId string, filePath string, items []string) error
 	// DeleteObjectFilefolder 删除用户对象文件夹
@@ -23,10 +54,46 @@ type CloudDisk interface {
 	IsObjectExist(userId string, filePath string, fileName string) (bool, error)
 	// UploadSimpleFile 上传小于1GB的文件到云端
 	UploadSimpleFile(localFilePath string, userId string, md5 string, fileSize int64) error
+	// InitMultipartUpload 初始化云端分片上传，返回云端分片上传ID
+	InitMultipartUpload(userId string, filePath string, fileName string) (string, error)
+	// UploadPart 上传单个分片到云端，返回分片ETag
+	UploadPart(userId string, filePath string, fileName string, uploadId string, partNumber int, reader io.Reader, size int64) (string, error)
+	// CompleteMultipartUpload 按分片序号合并云端分片，生成最终对象
+	CompleteMultipartUpload(userId string, filePath string, fileName string, uploadId string, parts []Part) error
+	// AbortMultipartUpload 取消云端分片上传并清理已上传的分片
+	AbortMultipartUpload(userId string, filePath string, fileName string, uploadId string) error
+	// GetObject 读取对象内容，调用方负责关闭返回的数据流
+	GetObject(userId string, filePath string, fileName string) (io.ReadCloser, error)
+	// StatObject 获取对象的大小、ETag和最后修改时间
+	StatObject(userId string, filePath string, fileName string) (ObjectInfo, error)
+	// GetObjectRange 从offset开始读取length字节的对象内容，length小于等于0时读到对象末尾，
+	// 调用方负责关闭返回的数据流
+	GetObjectRange(userId string, filePath string, fileName string, offset int64, length int64) (io.ReadCloser, error)
+	// ListObjects 按键的字典序分页列举键以prefix开头的对象，每页调用一次fn，fn返回错误时停止列举
+	ListObjects(prefix string, fn func(objects []ListedObject) error) error
+}
+
+// 确保各云盘实现了CloudDisk接口
+var (
+	_ CloudDisk = (*TencentCloudDisk)(nil)
+	_ CloudDisk = (*LocalCloudDisk)(nil)
+	_ CloudDisk = (*S3CloudDisk)(nil)
+	_ CloudDisk = (*MemoryCloudDisk)(nil)
+)
+
+// ObjectName 使用文件ID和后缀生成云端对象名，后缀为空时对象名不带点号，
+// 上传、下载、清理和对账都必须通过它生成对象名
+func ObjectName(fileUuid string, postfix string) string {
+	if postfix == "" {
+		return fileUuid
+	}
+	return fileUuid + "." + postfix
 }
 
-// 确保TencentCloudDisk实现了CloudDisk接口
-var _ CloudDisk = (*TencentCloudDisk)(nil)
+// localObjectName 根据本地临时文件的扩展名生成简单上传的对象名
+func localObjectName(md5 string, localFilePath string) string {
+	return ObjectName(md5, strings.TrimPrefix(path.Ext(localFilePath), "."))
+}
 
 // NewCloudDisk 云盘构造函数类型定义
 type NewCloudDisk func() CloudDisk
@@ -41,6 +108,8 @@ var NewCloudDiskMap map[string]NewCloudDisk
 func init() {
 	NewCloudDiskMap = make(map[string]NewCloudDisk)
 	NewCloudDiskMap["TENCENT"] = NewTencentCloudDisk
+	NewCloudDiskMap["LOCAL"] = NewLocalCloudDisk
+	NewCloudDiskMap["S3"] = NewS3CloudDisk
 	// todo 七牛
 	// NewCloudDiskMap["QINIU"]   = NewQiniuCloudDisk
 }
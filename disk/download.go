@@ -0,0 +1,109 @@
+package disk
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// sniffLength 探测MIME类型时读取的对象头部字节数
+const sniffLength = 512
+
+// DownloadOptions 下载预签名URL的响应头覆盖，使下载的文件使用用户可见的文件名而不是云端对象名
+type DownloadOptions struct {
+	FileName    string        // 下载时使用的文件名，写入Content-Disposition
+	ContentType string        // 响应的MIME类型，为空时使用云端保存的类型
+	Expire      time.Duration // URL有效期
+}
+
+// 覆盖响应头的查询参数名，S3和COS使用相同的参数名
+const (
+	responseContentDisposition = "response-content-disposition"
+	responseContentType        = "response-content-type"
+)
+
+// ContentDisposition 构建附件下载的Content-Disposition，
+// filename*按RFC 5987编码以支持中文文件名，filename为只含ASCII字符的引号字符串，供不支持的旧客户端使用
+func ContentDisposition(fileName string) string {
+	return "attachment; filename=\"" + asciiFileName(fileName) + "\"; filename*=UTF-8''" + rfc5987Escape(fileName)
+}
+
+// asciiFileName 将非ASCII字符、控制字符、引号和反斜杠替换为下划线，结果可直接放入引号字符串
+func asciiFileName(fileName string) string {
+	var builder strings.Builder
+	for _, r := range fileName {
+		if r < 0x20 || r >= 0x7f || r == '"' || r == '\\' {
+			builder.WriteByte('_')
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// rfc5987Escape 按RFC 5987的attr-char对文件名的UTF-8字节进行百分号编码
+func rfc5987Escape(fileName string) string {
+	const hex = "0123456789ABCDEF"
+	var builder strings.Builder
+	for i := 0; i < len(fileName); i++ {
+		c := fileName[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			builder.WriteByte(c)
+			continue
+		}
+		builder.WriteByte('%')
+		builder.WriteByte(hex[c>>4])
+		builder.WriteByte(hex[c&0x0f])
+	}
+	return builder.String()
+}
+
+// downloadQuery 构建覆盖响应头的查询参数
+func downloadQuery(opt DownloadOptions) url.Values {
+	query := url.Values{}
+	if opt.FileName != "" {
+		query.Set(responseContentDisposition, ContentDisposition(opt.FileName))
+	}
+	if opt.ContentType != "" {
+		query.Set(responseContentType, opt.ContentType)
+	}
+	return query
+}
+
+// ContentTypeByPostfix 根据文件后缀判断MIME类型，无法判断时返回application/octet-stream
+func ContentTypeByPostfix(postfix string) string {
+	if contentType := mime.TypeByExtension("." + postfix); postfix != "" && contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// DetectContentType 根据扩展名判断对象的MIME类型，无法判断时读取对象头部探测
+func DetectContentType(userId string, filePath string, fileName string) string {
+	if contentType := mime.TypeByExtension(path.Ext(fileName)); contentType != "" {
+		return contentType
+	}
+	reader, err := BaseCloudDisk.GetObjectRange(userId, filePath, fileName, 0, sniffLength)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer reader.Close()
+	head, err := io.ReadAll(io.LimitReader(reader, sniffLength))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(head)
+}
+
+// GetFileDownloadURL 生成文件的下载预签名URL，响应携带用户可见的文件名和探测出的MIME类型
+func GetFileDownloadURL(userId string, filePath string, fileName string, displayName string, expire time.Duration) (string, error) {
+	return BaseCloudDisk.GetObjectDownloadURL(userId, filePath, fileName, DownloadOptions{
+		FileName:    displayName,
+		ContentType: DetectContentType(userId, filePath, fileName),
+		Expire:      expire,
+	})
+}
@@ -0,0 +1,409 @@
+package disk
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cloud-disk/conf"
+	"go-cloud-disk/utils/sign"
+
+	"github.com/google/uuid"
+)
+
+// LocalObjectRoute 本地磁盘对象访问路由前缀，由Gin服务器提供预签名URL的上传与下载
+const LocalObjectRoute = "/api/v1/local/object/"
+
+// LocalCloudDisk 本地文件系统实现，将对象保存在服务器本地目录中
+// 适用于私有化部署或无法访问公有云的环境
+type LocalCloudDisk struct {
+	root    string // 本地存储根目录
+	baseURL string // 服务器对外访问地址
+	secret  string // 预签名URL的HMAC密钥
+}
+
+// NewLocalCloudDisk 创建新的本地磁盘实例
+func NewLocalCloudDisk() CloudDisk {
+	root := conf.LocalDiskRoot
+	if root == "" {
+		root = "./local_disk"
+	}
+	secret := conf.LocalDiskSecret
+	if secret == "" {
+		secret = conf.JwtKey
+	}
+	baseURL := conf.LocalDiskURL
+	if baseURL == "" {
+		baseURL = "http://127.0.0.1:" + conf.ServerPort
+	}
+	return &LocalCloudDisk{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}
+}
+
+// presignURL 为对象键生成带过期时间的HMAC签名URL，响应头覆盖参数一并签名，防止被篡改
+func (local *LocalCloudDisk) presignURL(method string, key string, expire time.Duration, overrides url.Values) string {
+	expires := strconv.FormatInt(time.Now().Add(expire).Unix(), 10)
+	query := url.Values{}
+	for name, values := range overrides {
+		query[name] = values
+	}
+	query.Set("expires", expires)
+	query.Set("signature", sign.HmacSign(local.secret, method, key, expires, overrides.Encode()))
+	return local.baseURL + LocalObjectRoute + key + "?" + query.Encode()
+}
+
+// VerifyPresignedRequest 校验预签名请求的签名和过期时间，签名覆盖查询参数中的响应头覆盖参数
+func (local *LocalCloudDisk) VerifyPresignedRequest(method string, key string, query url.Values) error {
+	expires := query.Get("expires")
+	expireUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("过期时间格式错误")
+	}
+	if time.Now().Unix() > expireUnix {
+		return fmt.Errorf("预签名URL已过期")
+	}
+	overrides := url.Values{}
+	for _, name := range []string{responseContentDisposition, responseContentType} {
+		if values, ok := query[name]; ok {
+			overrides[name] = values
+		}
+	}
+	if !sign.CheckHmacSign(local.secret, query.Get("signature"), method, key, expires, overrides.Encode()) {
+		return fmt.Errorf("预签名URL签名错误")
+	}
+	return nil
+}
+
+// ObjectPath 将对象键转换为本地文件路径，并防止路径穿越
+func (local *LocalCloudDisk) ObjectPath(key string) (string, error) {
+	cleanKey := path.Clean("/" + key)
+	if !strings.HasPrefix(cleanKey, "/user/") {
+		return "", fmt.Errorf("非法的对象键: %s", key)
+	}
+	return filepath.Join(local.root, filepath.FromSlash(cleanKey)), nil
+}
+
+// PutObject 将数据流写入本地对象，先写入临时文件再重命名保证原子性
+func (local *LocalCloudDisk) PutObject(key string, reader io.Reader) error {
+	dst, err := local.ObjectPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("创建对象目录失败: %v", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := io.Copy(tmpFile, reader); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("写入对象失败: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("写入对象失败: %v", err)
+	}
+	return os.Rename(tmpFile.Name(), dst)
+}
+
+// GetUploadPresignedURL 使用用户ID、文件路径、文件名生成上传预签名URL
+func (local *LocalCloudDisk) GetUploadPresignedURL(userId string, filePath string, fileName string) (string, error) {
+	key := fastBuildKey(userId, filePath, fileName)
+	return local.presignURL("PUT", key, time.Minute*15, nil), nil
+}
+
+// GetDownloadPresignedURL 使用用户ID、文件路径、文件名生成下载预签名URL
+func (local *LocalCloudDisk) GetDownloadPresignedURL(userId string, filePath string, fileName string) (string, error) {
+	key := fastBuildKey(userId, filePath, fileName)
+	return local.presignURL("GET", key, time.Hour, nil), nil
+}
+
+// GetObjectURL 检查对象存在后生成对象访问URL
+func (local *LocalCloudDisk) GetObjectURL(userId string, filePath string, fileName string) (string, error) {
+	ok, err := local.IsObjectExist(userId, filePath, fileName)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("此对象在云端不存在")
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	return local.presignURL("GET", key, time.Hour, nil), nil
+}
+
+// GetObjectDownloadURL 检查对象存在后生成下载预签名URL，响应头覆盖参数参与签名，由LocalDiskGetObject写入响应
+func (local *LocalCloudDisk) GetObjectDownloadURL(userId string, filePath string, fileName string, opt DownloadOptions) (string, error) {
+	ok, err := local.IsObjectExist(userId, filePath, fileName)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("此对象在云端不存在")
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	return local.presignURL("GET", key, opt.Expire, downloadQuery(opt)), nil
+}
+
+// DeleteObject 使用文件列表构建文件键并删除对象
+func (local *LocalCloudDisk) DeleteObject(userId string, filePath string, items []string) error {
+	for _, file := range items {
+		dst, err := local.ObjectPath(fastBuildKey(userId, filePath, file))
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除对象错误：%v", err)
+		}
+	}
+	return nil
+}
+
+// DeleteObjectFilefolder 删除用户在本地磁盘的文件夹
+func (local *LocalCloudDisk) DeleteObjectFilefolder(userId string, filePath string) error {
+	dir, err := local.ObjectPath(fastBuildKey(userId, filePath, ""))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// IsObjectExist 检查对象是否存在
+func (local *LocalCloudDisk) IsObjectExist(userId string, filePath string, fileName string) (bool, error) {
+	dst, err := local.ObjectPath(fastBuildKey(userId, filePath, fileName))
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(dst)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// UploadSimpleFile 将本地临时文件复制到存储目录
+func (local *LocalCloudDisk) UploadSimpleFile(localFilePath string, userId string, md5 string, fileSize int64) error {
+	objectName := localObjectName(md5, localFilePath)
+	ok, err := local.IsObjectExist(userId, "", objectName)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	src, err := os.Open(localFilePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return local.PutObject(fastBuildKey(userId, "", objectName), src)
+}
+
+// multipartDir 返回分片上传的本地暂存目录，uploadId必须是合法的uuid以防止路径穿越
+func (local *LocalCloudDisk) multipartDir(uploadId string) (string, error) {
+	if _, err := uuid.Parse(uploadId); err != nil {
+		return "", fmt.Errorf("非法的分片上传ID: %s", uploadId)
+	}
+	return filepath.Join(local.root, ".multipart", uploadId), nil
+}
+
+// InitMultipartUpload 初始化分片上传，在本地创建分片暂存目录
+func (local *LocalCloudDisk) InitMultipartUpload(userId string, filePath string, fileName string) (string, error) {
+	uploadId := uuid.New().String()
+	dir, err := local.multipartDir(uploadId)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("初始化分片上传错误：%v", err)
+	}
+	return uploadId, nil
+}
+
+// UploadPart 保存单个分片，返回分片内容的md5作为ETag
+func (local *LocalCloudDisk) UploadPart(userId string, filePath string, fileName string, uploadId string, partNumber int, reader io.Reader, size int64) (string, error) {
+	dir, err := local.multipartDir(uploadId)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("分片上传不存在：%s", uploadId)
+	}
+
+	tmpFile, err := os.CreateTemp(dir, ".part-*")
+	if err != nil {
+		return "", fmt.Errorf("上传分片%d错误：%v", partNumber, err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmpFile, hash), reader)
+	tmpFile.Close()
+	if err != nil {
+		return "", fmt.Errorf("上传分片%d错误：%v", partNumber, err)
+	}
+	if size >= 0 && written != size {
+		return "", fmt.Errorf("分片%d大小不一致：期望%d，实际%d", partNumber, size, written)
+	}
+	if err := os.Rename(tmpFile.Name(), filepath.Join(dir, strconv.Itoa(partNumber))); err != nil {
+		return "", fmt.Errorf("上传分片%d错误：%v", partNumber, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CompleteMultipartUpload 按分片序号合并分片并写入对象，完成后删除暂存目录
+func (local *LocalCloudDisk) CompleteMultipartUpload(userId string, filePath string, fileName string, uploadId string, parts []Part) error {
+	dir, err := local.multipartDir(uploadId)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		partFile, err := os.Open(filepath.Join(dir, strconv.Itoa(part.PartNumber)))
+		if err != nil {
+			return fmt.Errorf("分片%d不存在", part.PartNumber)
+		}
+		defer partFile.Close()
+		readers = append(readers, partFile)
+	}
+
+	if err := local.PutObject(fastBuildKey(userId, filePath, fileName), io.MultiReader(readers...)); err != nil {
+		return fmt.Errorf("完成分片上传错误：%v", err)
+	}
+	return os.RemoveAll(dir)
+}
+
+// AbortMultipartUpload 取消分片上传，删除暂存目录
+func (local *LocalCloudDisk) AbortMultipartUpload(userId string, filePath string, fileName string, uploadId string) error {
+	dir, err := local.multipartDir(uploadId)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("取消分片上传错误：%v", err)
+	}
+	return nil
+}
+
+// GetObject 读取对象内容
+func (local *LocalCloudDisk) GetObject(userId string, filePath string, fileName string) (io.ReadCloser, error) {
+	dst, err := local.ObjectPath(fastBuildKey(userId, filePath, fileName))
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(dst)
+	if err != nil {
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	return file, nil
+}
+
+// StatObject 获取对象元信息，本地文件没有ETag，使用修改时间和大小生成
+func (local *LocalCloudDisk) StatObject(userId string, filePath string, fileName string) (ObjectInfo, error) {
+	dst, err := local.ObjectPath(fastBuildKey(userId, filePath, fileName))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("获取对象信息错误：%v", err)
+	}
+	return ObjectInfo{
+		Size:         info.Size(),
+		ETag:         fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+// ListObjects 按键的字典序遍历本地目录列举对象，跳过写入中的临时文件
+func (local *LocalCloudDisk) ListObjects(prefix string, fn func(objects []ListedObject) error) error {
+	dir, err := local.ObjectPath("user/")
+	if err != nil {
+		return err
+	}
+	objects := make([]ListedObject, 0, listPageSize)
+	err = filepath.WalkDir(dir, func(name string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(local.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ListedObject{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		if len(objects) == listPageSize {
+			if err := fn(objects); err != nil {
+				return err
+			}
+			objects = make([]ListedObject, 0, listPageSize)
+		}
+		return nil
+	})
+	if err != nil || len(objects) == 0 {
+		return err
+	}
+	return fn(objects)
+}
+
+// localRangeReader 读取本地文件指定范围的数据流
+type localRangeReader struct {
+	io.Reader
+	file *os.File
+}
+
+// Close 关闭本地文件
+func (reader *localRangeReader) Close() error {
+	return reader.file.Close()
+}
+
+// GetObjectRange 读取对象的指定范围
+func (local *LocalCloudDisk) GetObjectRange(userId string, filePath string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	dst, err := local.ObjectPath(fastBuildKey(userId, filePath, fileName))
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(dst)
+	if err != nil {
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	if length <= 0 {
+		return file, nil
+	}
+	return &localRangeReader{Reader: io.LimitReader(file, length), file: file}, nil
+}
@@ -0,0 +1,77 @@
+package disk
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalDownloadURLSignsOverrides(t *testing.T) {
+	root := t.TempDir()
+	local := &LocalCloudDisk{root: root, baseURL: "http://disk.test", secret: "secret"}
+	key := "user/owner/object.html"
+	if err := os.MkdirAll(filepath.Join(root, "user", "owner"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(key)), []byte("<html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rawURL, err := local.GetObjectDownloadURL("owner", "", "object.html", DownloadOptions{
+		FileName:    "报告.html",
+		ContentType: "application/octet-stream",
+		Expire:      time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if err := local.VerifyPresignedRequest("GET", key, query); err != nil {
+		t.Fatalf("签名校验失败: %v", err)
+	}
+
+	// 篡改或添加响应头覆盖参数后签名失效
+	tampered := url.Values{}
+	for name, values := range query {
+		tampered[name] = values
+	}
+	tampered.Set("response-content-type", "text/html")
+	if err := local.VerifyPresignedRequest("GET", key, tampered); err == nil {
+		t.Fatal("篡改Content-Type后签名仍然有效")
+	}
+	tampered = url.Values{"expires": query["expires"], "signature": query["signature"]}
+	if err := local.VerifyPresignedRequest("GET", key, tampered); err == nil {
+		t.Fatal("去掉响应头覆盖参数后签名仍然有效")
+	}
+	plain, err := local.GetObjectURL("owner", "", "object.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(plain)
+	query = u.Query()
+	query.Set("response-content-disposition", "inline")
+	if err := local.VerifyPresignedRequest("GET", key, query); err == nil {
+		t.Fatal("添加响应头覆盖参数后签名仍然有效")
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	disposition := ContentDisposition("报告 \"v1\"\\.pdf")
+	if !strings.HasPrefix(disposition, "attachment; ") {
+		t.Fatalf("应作为附件下载: %s", disposition)
+	}
+	// filename只含ASCII字符且不会提前结束引号字符串
+	if !strings.Contains(disposition, `filename="__ _v1__.pdf"`) {
+		t.Fatalf("filename不符: %s", disposition)
+	}
+	if !strings.HasSuffix(disposition, "filename*=UTF-8''%E6%8A%A5%E5%91%8A%20%22v1%22%5C.pdf") {
+		t.Fatalf("filename*不符: %s", disposition)
+	}
+}
@@ -0,0 +1,392 @@
+package disk
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryCall 内存云盘的一次方法调用记录
+type MemoryCall struct {
+	Method string   // 调用的方法名
+	Args   []string // 调用参数
+}
+
+// MemoryCloudDisk 内存云盘实现，对象保存在内存中，
+// 记录每次调用并支持按方法注入错误，用于在没有云端凭证时测试服务
+type MemoryCloudDisk struct {
+	mu        sync.Mutex
+	objects   map[string][]byte         // 对象键 -> 对象内容
+	calls     []MemoryCall              // 调用日志
+	failures  map[string]error          // 方法名 -> 注入的错误
+	multipart map[string]map[int][]byte // 分片上传ID -> 分片序号 -> 分片内容
+	uploadSeq int                       // 分片上传ID序号
+}
+
+// NewMemoryCloudDisk 创建新的内存云盘实例
+func NewMemoryCloudDisk() CloudDisk {
+	return &MemoryCloudDisk{
+		objects:   make(map[string][]byte),
+		failures:  make(map[string]error),
+		multipart: make(map[string]map[int][]byte),
+	}
+}
+
+// UseMemoryCloudDisk 将内存云盘设置为全局云盘实例并返回，
+// 便于测试中替换 BaseCloudDisk 并检查调用日志
+func UseMemoryCloudDisk() *MemoryCloudDisk {
+	mem := NewMemoryCloudDisk().(*MemoryCloudDisk)
+	BaseCloudDisk = mem
+	return mem
+}
+
+// record 记录调用并返回该方法注入的错误
+func (mem *MemoryCloudDisk) record(method string, args ...string) error {
+	mem.calls = append(mem.calls, MemoryCall{Method: method, Args: args})
+	return mem.failures[method]
+}
+
+// FailOn 为指定方法注入错误，err为nil时取消注入
+func (mem *MemoryCloudDisk) FailOn(method string, err error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err == nil {
+		delete(mem.failures, method)
+		return
+	}
+	mem.failures[method] = err
+}
+
+// Calls 返回调用日志的副本
+func (mem *MemoryCloudDisk) Calls() []MemoryCall {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	calls := make([]MemoryCall, len(mem.calls))
+	copy(calls, mem.calls)
+	return calls
+}
+
+// CallCount 返回指定方法被调用的次数
+func (mem *MemoryCloudDisk) CallCount(method string) int {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	count := 0
+	for _, call := range mem.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// PutObject 直接写入对象，用于准备测试数据
+func (mem *MemoryCloudDisk) PutObject(key string, data []byte) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	mem.objects[key] = append([]byte(nil), data...)
+}
+
+// Object 读取对象内容
+func (mem *MemoryCloudDisk) Object(key string) ([]byte, bool) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	data, ok := mem.objects[key]
+	return data, ok
+}
+
+// Keys 返回所有对象键，按字典序排列
+func (mem *MemoryCloudDisk) Keys() []string {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	keys := make([]string, 0, len(mem.objects))
+	for key := range mem.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Reset 清空对象、调用日志和注入的错误
+func (mem *MemoryCloudDisk) Reset() {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	mem.objects = make(map[string][]byte)
+	mem.calls = nil
+	mem.failures = make(map[string]error)
+	mem.multipart = make(map[string]map[int][]byte)
+}
+
+// memoryURL 构建内存对象的伪URL
+func memoryURL(method string, key string) string {
+	return fmt.Sprintf("memory://%s?method=%s", key, method)
+}
+
+// GetUploadPresignedURL 生成上传伪URL
+func (mem *MemoryCloudDisk) GetUploadPresignedURL(userId string, filePath string, fileName string) (string, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("GetUploadPresignedURL", userId, filePath, fileName); err != nil {
+		return "", err
+	}
+	return memoryURL("PUT", fastBuildKey(userId, filePath, fileName)), nil
+}
+
+// GetDownloadPresignedURL 生成下载伪URL
+func (mem *MemoryCloudDisk) GetDownloadPresignedURL(userId string, filePath string, fileName string) (string, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("GetDownloadPresignedURL", userId, filePath, fileName); err != nil {
+		return "", err
+	}
+	return memoryURL("GET", fastBuildKey(userId, filePath, fileName)), nil
+}
+
+// GetObjectURL 检查对象存在后生成对象伪URL
+func (mem *MemoryCloudDisk) GetObjectURL(userId string, filePath string, fileName string) (string, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("GetObjectURL", userId, filePath, fileName); err != nil {
+		return "", err
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	if _, ok := mem.objects[key]; !ok {
+		return "", fmt.Errorf("此对象在云端不存在")
+	}
+	return memoryURL("GET", key), nil
+}
+
+// GetObjectDownloadURL 检查对象存在后生成带响应头覆盖参数的下载伪URL
+func (mem *MemoryCloudDisk) GetObjectDownloadURL(userId string, filePath string, fileName string, opt DownloadOptions) (string, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("GetObjectDownloadURL", userId, filePath, fileName, opt.FileName, opt.ContentType); err != nil {
+		return "", err
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	if _, ok := mem.objects[key]; !ok {
+		return "", fmt.Errorf("此对象在云端不存在")
+	}
+	return memoryURL("GET", key) + "&" + downloadQuery(opt).Encode(), nil
+}
+
+// DeleteObject 删除多个对象
+func (mem *MemoryCloudDisk) DeleteObject(userId string, filePath string, items []string) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	args := append([]string{userId, filePath}, items...)
+	if err := mem.record("DeleteObject", args...); err != nil {
+		return err
+	}
+	for _, item := range items {
+		delete(mem.objects, fastBuildKey(userId, filePath, item))
+	}
+	return nil
+}
+
+// DeleteObjectFilefolder 删除文件夹前缀下的所有对象
+func (mem *MemoryCloudDisk) DeleteObjectFilefolder(userId string, filePath string) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("DeleteObjectFilefolder", userId, filePath); err != nil {
+		return err
+	}
+	dir := fastBuildKey(userId, filePath, "")
+	for key := range mem.objects {
+		if strings.HasPrefix(key, dir) {
+			delete(mem.objects, key)
+		}
+	}
+	return nil
+}
+
+// IsObjectExist 检查对象是否存在
+func (mem *MemoryCloudDisk) IsObjectExist(userId string, filePath string, fileName string) (bool, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("IsObjectExist", userId, filePath, fileName); err != nil {
+		return false, err
+	}
+	_, ok := mem.objects[fastBuildKey(userId, filePath, fileName)]
+	return ok, nil
+}
+
+// UploadSimpleFile 读取本地文件并保存到内存
+func (mem *MemoryCloudDisk) UploadSimpleFile(localFilePath string, userId string, md5 string, fileSize int64) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("UploadSimpleFile", localFilePath, userId, md5); err != nil {
+		return err
+	}
+	key := fastBuildKey(userId, "", localObjectName(md5, localFilePath))
+	if _, ok := mem.objects[key]; ok {
+		return nil
+	}
+	data, err := os.ReadFile(localFilePath)
+	if err != nil {
+		return err
+	}
+	mem.objects[key] = data
+	return nil
+}
+
+// UploadCount 返回尚未完成或取消的分片上传数量
+func (mem *MemoryCloudDisk) UploadCount() int {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	return len(mem.multipart)
+}
+
+// InitMultipartUpload 初始化内存分片上传
+func (mem *MemoryCloudDisk) InitMultipartUpload(userId string, filePath string, fileName string) (string, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("InitMultipartUpload", userId, filePath, fileName); err != nil {
+		return "", err
+	}
+	mem.uploadSeq++
+	uploadId := "memory-upload-" + strconv.Itoa(mem.uploadSeq)
+	mem.multipart[uploadId] = make(map[int][]byte)
+	return uploadId, nil
+}
+
+// UploadPart 保存单个分片，返回分片内容的md5作为ETag
+func (mem *MemoryCloudDisk) UploadPart(userId string, filePath string, fileName string, uploadId string, partNumber int, reader io.Reader, size int64) (string, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("UploadPart", userId, filePath, fileName, uploadId, strconv.Itoa(partNumber)); err != nil {
+		return "", err
+	}
+	parts, ok := mem.multipart[uploadId]
+	if !ok {
+		return "", fmt.Errorf("分片上传不存在：%s", uploadId)
+	}
+	parts[partNumber] = data
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CompleteMultipartUpload 按分片序号合并分片并保存为对象
+func (mem *MemoryCloudDisk) CompleteMultipartUpload(userId string, filePath string, fileName string, uploadId string, parts []Part) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("CompleteMultipartUpload", userId, filePath, fileName, uploadId); err != nil {
+		return err
+	}
+	uploaded, ok := mem.multipart[uploadId]
+	if !ok {
+		return fmt.Errorf("分片上传不存在：%s", uploadId)
+	}
+
+	var buf bytes.Buffer
+	for _, part := range parts {
+		data, ok := uploaded[part.PartNumber]
+		if !ok {
+			return fmt.Errorf("分片%d不存在", part.PartNumber)
+		}
+		sum := md5.Sum(data)
+		if hex.EncodeToString(sum[:]) != part.ETag {
+			return fmt.Errorf("分片%d的ETag不匹配", part.PartNumber)
+		}
+		buf.Write(data)
+	}
+	mem.objects[fastBuildKey(userId, filePath, fileName)] = buf.Bytes()
+	delete(mem.multipart, uploadId)
+	return nil
+}
+
+// AbortMultipartUpload 取消内存分片上传
+func (mem *MemoryCloudDisk) AbortMultipartUpload(userId string, filePath string, fileName string, uploadId string) error {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("AbortMultipartUpload", userId, filePath, fileName, uploadId); err != nil {
+		return err
+	}
+	delete(mem.multipart, uploadId)
+	return nil
+}
+
+// GetObject 读取对象内容
+func (mem *MemoryCloudDisk) GetObject(userId string, filePath string, fileName string) (io.ReadCloser, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("GetObject", userId, filePath, fileName); err != nil {
+		return nil, err
+	}
+	data, ok := mem.objects[fastBuildKey(userId, filePath, fileName)]
+	if !ok {
+		return nil, fmt.Errorf("此对象在云端不存在")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// StatObject 获取对象元信息，ETag为对象内容的md5
+func (mem *MemoryCloudDisk) StatObject(userId string, filePath string, fileName string) (ObjectInfo, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("StatObject", userId, filePath, fileName); err != nil {
+		return ObjectInfo{}, err
+	}
+	data, ok := mem.objects[fastBuildKey(userId, filePath, fileName)]
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("此对象在云端不存在")
+	}
+	sum := md5.Sum(data)
+	return ObjectInfo{Size: int64(len(data)), ETag: hex.EncodeToString(sum[:])}, nil
+}
+
+// ListObjects 按键的字典序分页列举对象
+func (mem *MemoryCloudDisk) ListObjects(prefix string, fn func(objects []ListedObject) error) error {
+	mem.mu.Lock()
+	if err := mem.record("ListObjects", prefix); err != nil {
+		mem.mu.Unlock()
+		return err
+	}
+	var objects []ListedObject
+	for key, data := range mem.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ListedObject{Key: key, Size: int64(len(data))})
+		}
+	}
+	mem.mu.Unlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	for start := 0; start < len(objects); start += listPageSize {
+		if err := fn(objects[start:min(start+listPageSize, len(objects))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetObjectRange 读取对象的指定范围
+func (mem *MemoryCloudDisk) GetObjectRange(userId string, filePath string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+	if err := mem.record("GetObjectRange", userId, filePath, fileName, strconv.FormatInt(offset, 10), strconv.FormatInt(length, 10)); err != nil {
+		return nil, err
+	}
+	data, ok := mem.objects[fastBuildKey(userId, filePath, fileName)]
+	if !ok {
+		return nil, fmt.Errorf("此对象在云端不存在")
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
@@ -0,0 +1,380 @@
+package disk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"go-cloud-disk/conf"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3CloudDisk 通用S3协议实现，兼容MinIO、Ceph RGW以及AWS S3
+type S3CloudDisk struct {
+	endpoint  string // 服务地址，例如 127.0.0.1:9000
+	region    string // 区域
+	bucket    string // 存储桶名称
+	accessKey string // 访问密钥ID
+	secretKey string // 访问密钥
+	useSSL    bool   // 是否使用HTTPS
+	pathStyle bool   // 是否使用路径风格寻址
+
+	once      sync.Once
+	client    *minio.Client
+	clientErr error
+}
+
+// NewS3CloudDisk 创建新的S3云盘实例
+func NewS3CloudDisk() CloudDisk {
+	return &S3CloudDisk{
+		endpoint:  conf.S3Endpoint,
+		region:    conf.S3Region,
+		bucket:    conf.S3Bucket,
+		accessKey: conf.S3AccessKey,
+		secretKey: conf.S3SecretKey,
+		useSSL:    conf.S3UseSSL == "true",
+		pathStyle: conf.S3PathStyle == "true",
+	}
+}
+
+// getDefaultClient 获取S3客户端，客户端只创建一次
+func (cloud *S3CloudDisk) getDefaultClient() (*minio.Client, error) {
+	cloud.once.Do(func() {
+		lookup := minio.BucketLookupAuto
+		if cloud.pathStyle {
+			lookup = minio.BucketLookupPath
+		}
+		cloud.client, cloud.clientErr = minio.New(cloud.endpoint, &minio.Options{
+			Creds:        credentials.NewStaticV4(cloud.accessKey, cloud.secretKey, ""),
+			Secure:       cloud.useSSL,
+			Region:       cloud.region,
+			BucketLookup: lookup,
+		})
+		if cloud.clientErr != nil {
+			cloud.clientErr = fmt.Errorf("创建S3客户端失败: %v", cloud.clientErr)
+		}
+	})
+	return cloud.client, cloud.clientErr
+}
+
+// presignGetObject 根据对象键生成下载预签名URL，reqParams用于覆盖响应头
+func (cloud *S3CloudDisk) presignGetObject(key string, expire time.Duration, reqParams url.Values) (string, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return "", err
+	}
+	presignedURL, err := client.PresignedGetObject(context.Background(), cloud.bucket, key, expire, reqParams)
+	if err != nil {
+		return "", fmt.Errorf("创建下载预签名URL错误：%v", err)
+	}
+	return presignedURL.String(), nil
+}
+
+// GetUploadPresignedURL 使用用户ID、文件路径、文件名生成云盘键并获取上传预签名URL
+func (cloud *S3CloudDisk) GetUploadPresignedURL(userId string, filePath string, fileName string) (string, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return "", err
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	presignedURL, err := client.PresignedPutObject(context.Background(), cloud.bucket, key, time.Minute*15)
+	if err != nil {
+		return "", fmt.Errorf("创建上传预签名URL错误：%v", err)
+	}
+	return presignedURL.String(), nil
+}
+
+// GetDownloadPresignedURL 使用用户ID、文件路径、文件名生成云盘键并获取下载预签名URL
+func (cloud *S3CloudDisk) GetDownloadPresignedURL(userId string, filePath string, fileName string) (string, error) {
+	key := fastBuildKey(userId, filePath, fileName)
+	return cloud.presignGetObject(key, time.Hour, url.Values{})
+}
+
+// GetObjectURL 检查对象存在后生成对象访问URL，
+// S3存储桶通常为私有读，因此返回预签名URL
+func (cloud *S3CloudDisk) GetObjectURL(userId string, filePath string, fileName string) (string, error) {
+	key := fastBuildKey(userId, filePath, fileName)
+	ok, err := cloud.checkObjectIsExist(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("此对象在云端不存在")
+	}
+	return cloud.presignGetObject(key, time.Hour, url.Values{})
+}
+
+// GetObjectDownloadURL 检查对象存在后生成带响应头覆盖的下载预签名URL
+func (cloud *S3CloudDisk) GetObjectDownloadURL(userId string, filePath string, fileName string, opt DownloadOptions) (string, error) {
+	key := fastBuildKey(userId, filePath, fileName)
+	ok, err := cloud.checkObjectIsExist(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("此对象在云端不存在")
+	}
+	return cloud.presignGetObject(key, opt.Expire, downloadQuery(opt))
+}
+
+// deleteObject 在云端删除多个对象
+func (cloud *S3CloudDisk) deleteObject(keys []string) error {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return err
+	}
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, key := range keys {
+			objectsCh <- minio.ObjectInfo{Key: key}
+		}
+	}()
+
+	for removeErr := range client.RemoveObjects(context.Background(), cloud.bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		if removeErr.Err != nil {
+			err = fmt.Errorf("删除对象错误：%v", removeErr.Err)
+		}
+	}
+	return err
+}
+
+// DeleteObject 使用文件列表构建文件键并删除对象
+func (cloud *S3CloudDisk) DeleteObject(userId string, filePath string, items []string) error {
+	var keys []string
+	for _, file := range items {
+		keys = append(keys, fastBuildKey(userId, filePath, file))
+	}
+	return cloud.deleteObject(keys)
+}
+
+// DeleteObjectFilefolder 删除用户在云端的文件夹及其所有内容
+func (cloud *S3CloudDisk) DeleteObjectFilefolder(userId string, filePath string) error {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return err
+	}
+	dir := fastBuildKey(userId, filePath, "")
+	opt := minio.ListObjectsOptions{
+		Prefix:    dir,
+		Recursive: true,
+	}
+
+	var keys []string
+	for object := range client.ListObjects(context.Background(), cloud.bucket, opt) {
+		if object.Err != nil {
+			return object.Err
+		}
+		keys = append(keys, object.Key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return cloud.deleteObject(keys)
+}
+
+// checkObjectIsExist 检查对象是否存在
+func (cloud *S3CloudDisk) checkObjectIsExist(key string) (bool, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return false, err
+	}
+	_, err = client.StatObject(context.Background(), cloud.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).StatusCode == 404 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// IsObjectExist 检查对象是否存在
+func (cloud *S3CloudDisk) IsObjectExist(userId string, filePath string, fileName string) (bool, error) {
+	return cloud.checkObjectIsExist(fastBuildKey(userId, filePath, fileName))
+}
+
+// UploadSimpleFile 将本地文件上传到云端，对象已存在时跳过
+func (cloud *S3CloudDisk) UploadSimpleFile(localFilePath string, userId string, md5 string, fileSize int64) error {
+	objectName := localObjectName(md5, localFilePath)
+	key := fastBuildKey(userId, "", objectName)
+	ok, err := cloud.checkObjectIsExist(key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.FPutObject(context.Background(), cloud.bucket, key, localFilePath, minio.PutObjectOptions{
+		ContentDisposition: "attachment",
+	})
+	if err != nil {
+		return fmt.Errorf("上传文件到S3失败: %v", err)
+	}
+	return nil
+}
+
+// InitMultipartUpload 初始化云端分片上传
+func (cloud *S3CloudDisk) InitMultipartUpload(userId string, filePath string, fileName string) (string, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return "", err
+	}
+	core := minio.Core{Client: client}
+	key := fastBuildKey(userId, filePath, fileName)
+	uploadId, err := core.NewMultipartUpload(context.Background(), cloud.bucket, key, minio.PutObjectOptions{
+		ContentDisposition: "attachment",
+	})
+	if err != nil {
+		return "", fmt.Errorf("初始化分片上传错误：%v", err)
+	}
+	return uploadId, nil
+}
+
+// UploadPart 上传单个分片到云端
+func (cloud *S3CloudDisk) UploadPart(userId string, filePath string, fileName string, uploadId string, partNumber int, reader io.Reader, size int64) (string, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return "", err
+	}
+	core := minio.Core{Client: client}
+	key := fastBuildKey(userId, filePath, fileName)
+	part, err := core.PutObjectPart(context.Background(), cloud.bucket, key, uploadId, partNumber, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", fmt.Errorf("上传分片%d错误：%v", partNumber, err)
+	}
+	return part.ETag, nil
+}
+
+// CompleteMultipartUpload 合并云端分片
+func (cloud *S3CloudDisk) CompleteMultipartUpload(userId string, filePath string, fileName string, uploadId string, parts []Part) error {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return err
+	}
+	core := minio.Core{Client: client}
+	key := fastBuildKey(userId, filePath, fileName)
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	if _, err := core.CompleteMultipartUpload(context.Background(), cloud.bucket, key, uploadId, completeParts, minio.PutObjectOptions{}); err != nil {
+		return fmt.Errorf("完成分片上传错误：%v", err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload 取消云端分片上传
+func (cloud *S3CloudDisk) AbortMultipartUpload(userId string, filePath string, fileName string, uploadId string) error {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return err
+	}
+	core := minio.Core{Client: client}
+	key := fastBuildKey(userId, filePath, fileName)
+	if err := core.AbortMultipartUpload(context.Background(), cloud.bucket, key, uploadId); err != nil {
+		return fmt.Errorf("取消分片上传错误：%v", err)
+	}
+	return nil
+}
+
+// GetObject 读取对象内容
+func (cloud *S3CloudDisk) GetObject(userId string, filePath string, fileName string) (io.ReadCloser, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	object, err := client.GetObject(context.Background(), cloud.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	// GetObject 延迟发起请求，先获取对象信息以便及时返回对象不存在等错误
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	return object, nil
+}
+
+// StatObject 获取对象元信息
+func (cloud *S3CloudDisk) StatObject(userId string, filePath string, fileName string) (ObjectInfo, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	info, err := client.StatObject(context.Background(), cloud.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("获取对象信息错误：%v", err)
+	}
+	return ObjectInfo{Size: info.Size, ETag: info.ETag, LastModified: info.LastModified}, nil
+}
+
+// ListObjects 分页列举对象，SDK内部按页请求，这里每凑满1000个对象调用一次fn
+func (cloud *S3CloudDisk) ListObjects(prefix string, fn func(objects []ListedObject) error) error {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // fn返回错误提前结束时停止SDK的后台列举
+	opt := minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+		MaxKeys:   listPageSize,
+	}
+
+	objects := make([]ListedObject, 0, listPageSize)
+	for object := range client.ListObjects(ctx, cloud.bucket, opt) {
+		if object.Err != nil {
+			return fmt.Errorf("列举对象错误：%v", object.Err)
+		}
+		objects = append(objects, ListedObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+		if len(objects) == listPageSize {
+			if err := fn(objects); err != nil {
+				return err
+			}
+			objects = make([]ListedObject, 0, listPageSize)
+		}
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	return fn(objects)
+}
+
+// GetObjectRange 读取对象的指定范围
+func (cloud *S3CloudDisk) GetObjectRange(userId string, filePath string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	key := fastBuildKey(userId, filePath, fileName)
+	opt := minio.GetObjectOptions{}
+	// SetRange(offset, 0) 表示从offset读到末尾，但SetRange(0, 0)表示只读第一个字节，从头读到末尾时不设置范围
+	switch {
+	case length > 0:
+		err = opt.SetRange(offset, offset+length-1)
+	case offset > 0:
+		err = opt.SetRange(offset, 0)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("设置读取范围错误：%v", err)
+	}
+	object, err := client.GetObject(context.Background(), cloud.bucket, key, opt)
+	if err != nil {
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	return object, nil
+}
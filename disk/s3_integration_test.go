@@ -0,0 +1,185 @@
+//go:build integration
+
+// S3后端集成测试，需要可访问的MinIO或其他S3兼容服务：
+//
+//	S3_TEST_ENDPOINT=127.0.0.1:9000 S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin \
+//	S3_TEST_BUCKET=go-cloud-disk-test go test -tags integration ./disk/ -run TestS3
+package disk
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// newTestS3CloudDisk 按环境变量创建S3云盘，存储桶不存在时创建，未配置时跳过测试
+func newTestS3CloudDisk(t *testing.T) *S3CloudDisk {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("未设置S3_TEST_ENDPOINT，跳过S3集成测试")
+	}
+	cloud := &S3CloudDisk{
+		endpoint:  endpoint,
+		region:    os.Getenv("S3_TEST_REGION"),
+		bucket:    os.Getenv("S3_TEST_BUCKET"),
+		accessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		secretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		useSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+		pathStyle: true,
+	}
+	if cloud.bucket == "" {
+		cloud.bucket = "go-cloud-disk-test"
+	}
+	client, err := cloud.getDefaultClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exist, err := client.BucketExists(ctx, cloud.bucket)
+	if err != nil {
+		t.Fatalf("检查存储桶失败: %v", err)
+	}
+	if !exist {
+		if err := client.MakeBucket(ctx, cloud.bucket, minio.MakeBucketOptions{Region: cloud.region}); err != nil {
+			t.Fatalf("创建存储桶失败: %v", err)
+		}
+	}
+	return cloud
+}
+
+// putTestObject 以单个分片上传对象，测试结束后删除
+func putTestObject(t *testing.T, cloud *S3CloudDisk, userId string, fileName string, data []byte) {
+	t.Helper()
+	uploadId, err := cloud.InitMultipartUpload(userId, "", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := cloud.UploadPart(userId, "", fileName, uploadId, 1, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cloud.CompleteMultipartUpload(userId, "", fileName, uploadId, []Part{{PartNumber: 1, ETag: etag}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cloud.DeleteObject(userId, "", []string{fileName})
+	})
+}
+
+func readRange(t *testing.T, cloud *S3CloudDisk, userId string, fileName string, offset int64, length int64) string {
+	t.Helper()
+	reader, err := cloud.GetObjectRange(userId, "", fileName, offset, length)
+	if err != nil {
+		t.Fatalf("读取范围[%d, %d)失败: %v", offset, length, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("读取范围[%d, %d)失败: %v", offset, length, err)
+	}
+	return string(data)
+}
+
+func TestS3ObjectLifecycle(t *testing.T) {
+	cloud := newTestS3CloudDisk(t)
+	userId := uuid.NewString()
+	fileName := "object.txt"
+	data := []byte("0123456789abcdef")
+	putTestObject(t, cloud, userId, fileName, data)
+
+	exist, err := cloud.IsObjectExist(userId, "", fileName)
+	if err != nil || !exist {
+		t.Fatalf("上传后对象应存在: exist=%v, err=%v", exist, err)
+	}
+	info, err := cloud.StatObject(userId, "", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Fatalf("对象大小为%d，期望%d", info.Size, len(data))
+	}
+
+	reader, err := cloud.GetObject(userId, "", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(content, data) {
+		t.Fatalf("对象内容为%q，期望%q，err=%v", content, data, err)
+	}
+
+	var listed []ListedObject
+	if err := cloud.ListObjects("user/"+userId+"/", func(objects []ListedObject) error {
+		listed = append(listed, objects...)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].Key != fastBuildKey(userId, "", fileName) || listed[0].Size != int64(len(data)) {
+		t.Fatalf("列举结果不符: %+v", listed)
+	}
+
+	if err := cloud.DeleteObject(userId, "", []string{fileName}); err != nil {
+		t.Fatal(err)
+	}
+	if exist, err := cloud.IsObjectExist(userId, "", fileName); err != nil || exist {
+		t.Fatalf("删除后对象不应存在: exist=%v, err=%v", exist, err)
+	}
+	if _, err := cloud.GetObject(userId, "", fileName); err == nil {
+		t.Fatal("读取已删除的对象应返回错误")
+	}
+}
+
+func TestS3GetObjectRange(t *testing.T) {
+	cloud := newTestS3CloudDisk(t)
+	userId := uuid.NewString()
+	fileName := "range.txt"
+	putTestObject(t, cloud, userId, fileName, []byte("0123456789"))
+
+	cases := []struct {
+		name   string
+		offset int64
+		length int64
+		want   string
+	}{
+		{"指定长度", 2, 3, "234"},
+		{"从头读取一个字节", 0, 1, "0"},
+		{"长度为0读到末尾", 4, 0, "456789"},
+		{"长度为负读到末尾", 7, -1, "789"},
+		{"从头读到末尾", 0, 0, "0123456789"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := readRange(t, cloud, userId, fileName, c.offset, c.length); got != c.want {
+				t.Fatalf("读取范围offset=%d length=%d得到%q，期望%q", c.offset, c.length, got, c.want)
+			}
+		})
+	}
+}
+
+func TestS3AbortMultipartUpload(t *testing.T) {
+	cloud := newTestS3CloudDisk(t)
+	userId := uuid.NewString()
+	fileName := "aborted.txt"
+	uploadId, err := cloud.InitMultipartUpload(userId, "", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("partial")
+	if _, err := cloud.UploadPart(userId, "", fileName, uploadId, 1, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cloud.AbortMultipartUpload(userId, "", fileName, uploadId); err != nil {
+		t.Fatal(err)
+	}
+	if exist, err := cloud.IsObjectExist(userId, "", fileName); err != nil || exist {
+		t.Fatalf("取消上传后对象不应存在: exist=%v, err=%v", exist, err)
+	}
+}
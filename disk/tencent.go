@@ -3,10 +3,10 @@ package disk
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"path"
 	"strings"
 	"time"
 
@@ -109,6 +109,26 @@ func (cloud *TencentCloudDisk) GetObjectURL(userId string, filePath string, file
 	return objectURL, nil
 }
 
+// GetObjectDownloadURL 检查对象存在后生成带响应头覆盖的下载预签名URL
+func (cloud *TencentCloudDisk) GetObjectDownloadURL(userId string, filePath string, fileName string, opt DownloadOptions) (string, error) {
+	key := fastBuildKey(userId, filePath, fileName)
+	ok, err := cloud.checkObjectIsExist(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("此对象在云端不存在")
+	}
+	query := downloadQuery(opt)
+	client := cloud.getDefaultClient()
+	presignedURL, err := client.Object.GetPresignedURL(context.Background(), http.MethodGet, key,
+		cloud.secretId, cloud.secretKey, opt.Expire, &cos.PresignedURLOptions{Query: &query})
+	if err != nil {
+		return "", fmt.Errorf("创建下载预签名URL错误：%v", err)
+	}
+	return presignedURL.String(), nil
+}
+
 // deleteObject 在云端删除多个对象
 func (cloud *TencentCloudDisk) deleteObject(keys []string) error {
 	client := cloud.getDefaultClient()
@@ -214,8 +234,6 @@ func (cloud *TencentCloudDisk) uploadSimpleFile(localFilePath string, key string
 	return nil
 }
 
-// todo: 分片上传大文件（支持断点续传）
-
 // UploadSimpleFile 上传小于1GB的文件到云端
 func (cloud *TencentCloudDisk) UploadSimpleFile(localFilePath string, userId string, md5 string, fileSize int64) error {
 	if fileSize/1024/1024/1024 > 1 {
@@ -223,15 +241,15 @@ func (cloud *TencentCloudDisk) UploadSimpleFile(localFilePath string, userId str
 	}
 
 	// 检查文件是否已存在于云端
-	extend := path.Ext(localFilePath)
-	ok, err := cloud.IsObjectExist(userId, "", md5+extend)
+	objectName := localObjectName(md5, localFilePath)
+	ok, err := cloud.IsObjectExist(userId, "", objectName)
 	if err != nil {
 		return err
 	}
 
 	// 如果云端不存在，则上传文件
 	if !ok {
-		key := fastBuildKey(userId, "", md5+extend)
+		key := fastBuildKey(userId, "", objectName)
 		if err = cloud.uploadSimpleFile(localFilePath, key); err != nil {
 			return err
 		}
@@ -240,44 +258,58 @@ func (cloud *TencentCloudDisk) UploadSimpleFile(localFilePath string, userId str
 	return nil
 }
 
-// GetDownloadURL 根据文件路径生成预签名下载URL
-func (cloud *TencentCloudDisk) GetDownloadURL(filePath string, fileUUID string) (string, error) {
-	// 确保bucket url包含协议
-	bucketURL := cloud.bucketname
-	if !strings.HasPrefix(bucketURL, "http://") && !strings.HasPrefix(bucketURL, "https://") {
-		bucketURL = "https://" + bucketURL
+// InitMultipartUpload 初始化云端分片上传
+func (cloud *TencentCloudDisk) InitMultipartUpload(userId string, filePath string, fileName string) (string, error) {
+	client := cloud.getDefaultClient()
+	key := fastBuildKey(userId, filePath, fileName)
+	opt := &cos.InitiateMultipartUploadOptions{
+		ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{
+			ContentDisposition: "attachment",
+		},
 	}
-	// 拼接对象key
-	key := fmt.Sprintf("user/%s/%s.png", filePath, fileUUID)
-
-	u, err := url.Parse(bucketURL)
+	res, _, err := client.Object.InitiateMultipartUpload(context.Background(), key, opt)
 	if err != nil {
-		return "", nil
+		return "", fmt.Errorf("初始化分片上传错误：%v", err)
 	}
+	return res.UploadID, nil
+}
 
-	client := &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:  cloud.secretId,
-			SecretKey: cloud.secretKey,
-		},
+// UploadPart 上传单个分片到云端
+func (cloud *TencentCloudDisk) UploadPart(userId string, filePath string, fileName string, uploadId string, partNumber int, reader io.Reader, size int64) (string, error) {
+	client := cloud.getDefaultClient()
+	key := fastBuildKey(userId, filePath, fileName)
+	opt := &cos.ObjectUploadPartOptions{
+		ContentLength: size,
+	}
+	resp, err := client.Object.UploadPart(context.Background(), key, uploadId, partNumber, reader, opt)
+	if err != nil {
+		return "", fmt.Errorf("上传分片%d错误：%v", partNumber, err)
 	}
+	return resp.Header.Get("ETag"), nil
+}
 
-	cosClient := cos.NewClient(&cos.BaseURL{BucketURL: u}, client)
+// CompleteMultipartUpload 合并云端分片
+func (cloud *TencentCloudDisk) CompleteMultipartUpload(userId string, filePath string, fileName string, uploadId string, parts []Part) error {
+	client := cloud.getDefaultClient()
+	key := fastBuildKey(userId, filePath, fileName)
+	opt := &cos.CompleteMultipartUploadOptions{}
+	for _, part := range parts {
+		opt.Parts = append(opt.Parts, cos.Object{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	if _, _, err := client.Object.CompleteMultipartUpload(context.Background(), key, uploadId, opt); err != nil {
+		return fmt.Errorf("完成分片上传错误：%v", err)
+	}
+	return nil
+}
 
-	// 生成预签名下载URL，有效期24小时
-	presignedURL, err := cosClient.Object.GetPresignedURL(
-		context.Background(),
-		http.MethodGet,
-		key,
-		cloud.secretId,
-		cloud.secretKey,
-		24*time.Hour,
-		nil,
-	)
-	if err != nil {
-		return "", err
+// AbortMultipartUpload 取消云端分片上传
+func (cloud *TencentCloudDisk) AbortMultipartUpload(userId string, filePath string, fileName string, uploadId string) error {
+	client := cloud.getDefaultClient()
+	key := fastBuildKey(userId, filePath, fileName)
+	if _, err := client.Object.AbortMultipartUpload(context.Background(), key, uploadId); err != nil {
+		return fmt.Errorf("取消分片上传错误：%v", err)
 	}
-	return presignedURL.String(), nil
+	return nil
 }
 
 // fastBuildKey 使用用户ID、文件路径、文件名通过Builder生成文件键
@@ -304,3 +336,75 @@ func NewTencentCloudDisk() CloudDisk {
 		secretKey:  os.Getenv("BUCKET_SECRET_KEY"),
 	}
 }
+
+// GetObject 读取对象内容
+func (cloud *TencentCloudDisk) GetObject(userId string, filePath string, fileName string) (io.ReadCloser, error) {
+	client := cloud.getDefaultClient()
+	key := fastBuildKey(userId, filePath, fileName)
+	resp, err := client.Object.Get(context.Background(), key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	return resp.Body, nil
+}
+
+// StatObject 获取对象元信息
+func (cloud *TencentCloudDisk) StatObject(userId string, filePath string, fileName string) (ObjectInfo, error) {
+	client := cloud.getDefaultClient()
+	key := fastBuildKey(userId, filePath, fileName)
+	resp, err := client.Object.Head(context.Background(), key, nil)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("获取对象信息错误：%v", err)
+	}
+	lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ObjectInfo{
+		Size:         resp.ContentLength,
+		ETag:         strings.Trim(resp.Header.Get("ETag"), "\""),
+		LastModified: lastModified,
+	}, nil
+}
+
+// ListObjects 分页列举对象，每页最多1000个
+func (cloud *TencentCloudDisk) ListObjects(prefix string, fn func(objects []ListedObject) error) error {
+	client := cloud.getDefaultClient()
+	opt := &cos.BucketGetOptions{
+		Prefix:  prefix,
+		MaxKeys: listPageSize,
+	}
+
+	isTruncated := true // 是否有更多内容需要处理
+	for isTruncated {
+		v, _, err := client.Bucket.Get(context.Background(), opt) // 分页获取对象列表
+		if err != nil {
+			return fmt.Errorf("列举对象错误：%v", err)
+		}
+		objects := make([]ListedObject, 0, len(v.Contents))
+		for _, content := range v.Contents {
+			lastModified, _ := time.Parse(time.RFC3339, content.LastModified)
+			objects = append(objects, ListedObject{Key: content.Key, Size: content.Size, LastModified: lastModified})
+		}
+		if len(objects) > 0 {
+			if err := fn(objects); err != nil {
+				return err
+			}
+		}
+		isTruncated = v.IsTruncated
+		opt.Marker = v.NextMarker
+	}
+	return nil
+}
+
+// GetObjectRange 读取对象的指定范围
+func (cloud *TencentCloudDisk) GetObjectRange(userId string, filePath string, fileName string, offset int64, length int64) (io.ReadCloser, error) {
+	client := cloud.getDefaultClient()
+	key := fastBuildKey(userId, filePath, fileName)
+	opt := &cos.ObjectGetOptions{Range: fmt.Sprintf("bytes=%d-", offset)}
+	if length > 0 {
+		opt.Range = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	resp, err := client.Object.Get(context.Background(), key, opt)
+	if err != nil {
+		return nil, fmt.Errorf("读取对象错误：%v", err)
+	}
+	return resp.Body, nil
+}
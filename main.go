@@ -51,6 +51,9 @@ func loadingScript() {
 	go script.SendConfirmEmailSync(ctx)
 	go script.AutoTagSync(ctx)
 	go script.FileCleanSync(ctx)
+	go script.FileCopySync(ctx)
+	go script.FileReconcileSync(ctx)
+	go script.FileUploadSync(ctx)
 }
 
 func main() {
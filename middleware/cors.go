@@ -13,7 +13,13 @@ func Cors() gin.HandlerFunc {
 	config := cors.DefaultConfig()
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
 	// 允许客户端请求时携带的请求头
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Cookie", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Cookie", "Authorization",
+		"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset", "Upload-Checksum",
+		"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+	// 允许客户端读取的响应头，tus协议通过响应头返回上传状态，代理下载通过响应头返回范围和缓存信息
+	config.ExposeHeaders = []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension",
+		"Tus-Checksum-Algorithm", "Upload-Offset", "Upload-Length",
+		"Accept-Ranges", "Content-Range", "Content-Disposition", "ETag", "Last-Modified"}
 	if gin.Mode() == gin.ReleaseMode {
 		// 生产环境，严格指定允许跨域的域名（前端域名）
 		config.AllowOrigins = []string{conf.FrontWeb}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"errors"
+
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/throttle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransferLimit 传输限速中间件，按用户状态限制上传请求体或下载响应体的速率，
+// 并检查和统计每日传输流量，需要在JWTAuth之后使用
+func TransferLimit(direction throttle.Direction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.MustGet("UserId").(string)
+		limit := throttle.GetLimit(c.MustGet("Status").(string))
+		if limit.Unlimited() {
+			c.Next()
+			return
+		}
+
+		// 上传时请求体大小已知，提前拒绝超出流量的请求
+		var size int64
+		if direction == throttle.Upload && c.Request.ContentLength > 0 {
+			size = c.Request.ContentLength
+		}
+		if err := throttle.CheckQuota(userId, limit, direction, size); err != nil {
+			if errors.Is(err, throttle.ErrDailyQuotaExceeded) {
+				c.JSON(200, serializer.ParamsErr("DailyTransferQuotaExceeded", nil))
+			} else {
+				logger.Log().Error("[TransferLimit] 检查传输流量失败: ", err)
+				c.JSON(200, serializer.InternalErr("", err))
+			}
+			c.Abort()
+			return
+		}
+
+		if direction == throttle.Upload {
+			reader := throttle.NewReader(c.Request.Body, userId, limit, direction)
+			defer reader.Done()
+			c.Request.Body = reader
+		} else {
+			writer := throttle.NewResponseWriter(c.Writer, userId, limit, direction)
+			defer writer.Done()
+			c.Writer = writer
+		}
+		c.Next()
+	}
+}
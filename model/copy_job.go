@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 后台复制任务状态
+const (
+	CopyJobPending = "pending" // 等待执行
+	CopyJobRunning = "running" // 文件夹已创建，正在分批写入文件记录
+	CopyJobDone    = "done"    // 复制完成
+	CopyJobSkipped = "skipped" // 目标位置已有同名文件夹，按skip策略未复制
+	CopyJobFailed  = "failed"  // 复制失败，已复制的内容被删除
+)
+
+// CopyJob 后台复制文件夹的任务，子树较大时通过消息队列异步执行并记录进度
+type CopyJob struct {
+	Uuid            string `gorm:"primarykey"`
+	Owner           string `gorm:"not null;index"`
+	FileFolderId    string // 被复制的文件夹ID
+	TargetId        string // 目标文件夹ID
+	Conflict        string // 同名冲突策略
+	Status          string `gorm:"size:16;not null"`
+	NewFileFolderId string // 复制生成的文件夹ID
+	TotalFiles      int64  // 需要复制的文件数
+	CopiedFiles     int64  // 已复制的文件数
+	Error           string // 失败原因
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// BeforeCreate 在插入数据库前创建uuid
+func (job *CopyJob) BeforeCreate(tx *gorm.DB) (err error) {
+	if job.Uuid == "" {
+		job.Uuid = uuid.New().String()
+	}
+	return
+}
+
+// Finished 任务是否已结束
+func (job *CopyJob) Finished() bool {
+	return job.Status == CopyJobDone || job.Status == CopyJobSkipped || job.Status == CopyJobFailed
+}
@@ -2,26 +2,42 @@ package model
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"time"
 
 	"go-cloud-disk/cache"
+	"go-cloud-disk/disk"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// 文件状态
+const (
+	FileStatusPending   = "pending"   // 云端对象尚未就绪，分片正在后台合并
+	FileStatusAvailable = "available" // 可以下载和分享
+	FileStatusFailed    = "failed"    // 后台合并失败或对账发现云端对象缺失、大小不符
+)
+
+// ErrFileNotAvailable 文件不是available状态，不能下载或分享
+var ErrFileNotAvailable = errors.New("文件尚未就绪或处理失败")
+
 type File struct {
 	Uuid           string `gorm:"primarykey"`
 	Owner          string // 文件所有者，如果文件被删除则所有者为空
-	FileName       string // 真实文件名
+	FileName       string `gorm:"size:255;index:idx_file_parent_name,priority:2"` // 真实文件名
 	FilePostfix    string
-	FileUuid       string `gorm:"unique;not null"` // 云端文件使用md5作为名称
+	FileUuid       string `gorm:"index;not null"` // 云端文件使用md5作为名称，秒传时多个文件记录共享同一云端对象
 	FilePath       string // 云端文件的文件夹路径，用于保存分享文件
-	ParentFolderId string
-	Size           int64 // 文件大小
-	RefCount       int64 `gorm:"default:1"` // 文件引用计数,默认为1 // 这个字段废弃
-	IsDeleted      int   `gorm:"default:0"` // 逻辑删除标记 // 这个字段也废弃
+	ParentFolderId string `gorm:"size:64;index:idx_file_parent_name,priority:1"` // 所在文件夹ID，与文件名组成索引用于按路径查找和同名检查
+	Size           int64  // 文件大小
+	Hash           string `gorm:"index;size:64"`                            // 文件内容的SHA-256，用于秒传去重
+	RefCount       int64  `gorm:"default:1"`                                // 文件引用计数,默认为1 // 这个字段废弃
+	IsDeleted      int    `gorm:"default:0"`                                // 逻辑删除标记 // 这个字段也废弃
+	RecycleBinId   string `gorm:"index"`                                    // 所在的回收站条目ID，随文件夹一起删除时为文件夹的条目，未删除时为空
+	Status         string `gorm:"size:16;not null;default:available;index"` // 文件状态
 }
 
 // BeforeCreate 在插入数据库前创建uuid
@@ -29,15 +45,49 @@ func (file *File) BeforeCreate(tx *gorm.DB) (err error) {
 	if file.Uuid == "" {
 		file.Uuid = uuid.New().String()
 	}
+	if file.Status == "" {
+		file.Status = FileStatusAvailable
+	}
 	return
 }
 
+// Available 文件是否可以下载和分享
+func (file *File) Available() bool {
+	return file.Status == FileStatusAvailable
+}
+
+// DisplayName 返回用户可见的文件名
+func (file *File) DisplayName() string {
+	if file.FilePostfix == "" {
+		return file.FileName
+	}
+	return file.FileName + "." + file.FilePostfix
+}
+
+// DownloadURL 生成文件的下载预签名URL，下载时使用用户可见的文件名而不是云端对象名，
+// 文件不是available状态时返回ErrFileNotAvailable
+func (file *File) DownloadURL(expire time.Duration) (string, error) {
+	if !file.Available() {
+		return "", ErrFileNotAvailable
+	}
+	return disk.GetFileDownloadURL(file.FilePath, "", file.Object().Name(), file.DisplayName(), expire)
+}
+
 // GetFileInfoFromRedis 从Redis获取文件上传路径
 func GetFileInfoFromRedis(md5 string) string {
 	filePath := cache.RedisClient.Get(context.Background(), cache.FileInfoStoreKey(md5)).Val()
 	return filePath
 }
 
+// GetFileByHash 根据内容哈希、文件大小和后缀查找已上传的文件，用于秒传，优先返回userId自己的文件。
+// 云端对象名包含后缀，因此只复用后缀相同的对象，云端对象尚未就绪或处理失败的文件不复用
+func GetFileByHash(userId string, hash string, size int64, postfix string) (File, error) {
+	var file File
+	err := DB.Where("hash = ? and size = ? and file_postfix = ? and status = ?", hash, size, postfix, FileStatusAvailable).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "owner = ? desc", Vars: []interface{}{userId}}}).Take(&file).Error
+	return file, err
+}
+
 // SaveFileUploadInfoToRedis 保存文件路径到Redis
 func (file *File) SaveFileUploadInfoToRedis() {
 	randTime := time.Hour*12 + time.Minute*time.Duration(rand.Intn(60))
@@ -1,29 +1,162 @@
 package model
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// MaxFileFolderDepth 文件夹的最大层级，主目录为第1层，受物化路径的长度限制
+const MaxFileFolderDepth = 64
+
+var (
+	// ErrFileFolderCycle 不能把文件夹移动到自身或其子孙文件夹中
+	ErrFileFolderCycle = errors.New("cannot move folder into itself")
+	// ErrFileFolderTooDeep 文件夹层级超过MaxFileFolderDepth
+	ErrFileFolderTooDeep = errors.New("folder too deep")
+)
+
 type FileFolder struct {
-	Uuid           string `gorm:"primarykey"` // 主键，自动生成
-	FileFolderName string // 文件夹名称
-	ParentFolderID string // 父文件ID，支持层级结构
+	Uuid           string `gorm:"primarykey"`                                            // 主键，自动生成
+	FileFolderName string `gorm:"size:255;index:idx_file_folder_parent_name,priority:2"` // 文件夹名称
+	ParentFolderID string `gorm:"size:64;index:idx_file_folder_parent_name,priority:1"`  // 父文件ID，支持层级结构，与名称组成索引用于按路径逐级查找
 	FileStoreID    string // 关联的存储空间
 	OwnerID        string // 所有者
 	Size           int64  // 文件夹大小
+	// 物化路径，从主目录到自身的文件夹ID，形如 /主目录ID/子文件夹ID/，祖先和子树查询都只需一条语句
+	TreePath     string `gorm:"type:varchar(2400) CHARACTER SET ascii;not null;default:'';index"`
+	RecycleBinId string `gorm:"index"` // 随文件夹移入回收站时所属的回收站条目ID，未删除时为空
 }
 
-// BeforeCreate 在插入数据库前创建uuid
+// BeforeCreate 在插入数据库前创建uuid，未指定物化路径时根据父文件夹的路径生成
 func (fileFolder *FileFolder) BeforeCreate(tx *gorm.DB) (err error) {
 	if fileFolder.Uuid == "" {
 		fileFolder.Uuid = uuid.New().String()
 	}
+	if fileFolder.TreePath == "" {
+		if fileFolder.ParentFolderID == "root" {
+			fileFolder.TreePath = "/" + fileFolder.Uuid + "/"
+		} else {
+			var parent FileFolder
+			if err := tx.Session(&gorm.Session{NewDB: true}).Select("uuid", "tree_path").
+				Where("uuid = ?", fileFolder.ParentFolderID).Find(&parent).Error; err != nil {
+				return err
+			}
+			if parent.TreePath == "" {
+				return fmt.Errorf("父文件夹%s不存在或缺少路径", fileFolder.ParentFolderID)
+			}
+			fileFolder.TreePath = parent.TreePath + fileFolder.Uuid + "/"
+		}
+	}
+	if fileFolder.Depth() > MaxFileFolderDepth {
+		return ErrFileFolderTooDeep
+	}
 	return
 }
 
+// Depth 返回文件夹的层级，主目录为1
+func (fileFolder *FileFolder) Depth() int {
+	return strings.Count(fileFolder.TreePath, "/") - 1
+}
+
+// AncestorIds 返回从主目录到文件夹自身的所有文件夹ID
+func (fileFolder *FileFolder) AncestorIds() []string {
+	if fileFolder.TreePath == "" {
+		return []string{fileFolder.Uuid}
+	}
+	return strings.Split(strings.Trim(fileFolder.TreePath, "/"), "/")
+}
+
+// IsDescendantOf 判断文件夹是否为ancestor自身或其子孙文件夹
+func (fileFolder *FileFolder) IsDescendantOf(ancestor FileFolder) bool {
+	if ancestor.TreePath == "" {
+		return fileFolder.Uuid == ancestor.Uuid
+	}
+	return strings.HasPrefix(fileFolder.TreePath, ancestor.TreePath)
+}
+
+// NamePath 返回文件夹从主目录开始的名称路径，例如 /main/reports，只需一条查询
+func (fileFolder *FileFolder) NamePath(t *gorm.DB) (string, error) {
+	ids := fileFolder.AncestorIds()
+	var ancestors []FileFolder
+	if err := t.Select("uuid", "file_folder_name").Where("uuid in ?", ids).Find(&ancestors).Error; err != nil {
+		return "", err
+	}
+	names := make(map[string]string, len(ancestors))
+	for _, ancestor := range ancestors {
+		names[ancestor.Uuid] = ancestor.FileFolderName
+	}
+	var path strings.Builder
+	for _, id := range ids {
+		path.WriteString("/")
+		path.WriteString(names[id])
+	}
+	return path.String(), nil
+}
+
+// SubtreeFileFolders 返回查询文件夹自身及其所有子孙文件夹的语句，可用作子查询或直接删除
+func SubtreeFileFolders(t *gorm.DB, fileFolder FileFolder) *gorm.DB {
+	// 缺少物化路径时只匹配自身，避免空前缀匹配所有文件夹
+	if fileFolder.TreePath == "" {
+		return t.Model(&FileFolder{}).Where("uuid = ?", fileFolder.Uuid)
+	}
+	return t.Model(&FileFolder{}).Where("tree_path like ?", escapeLike(fileFolder.TreePath)+"%")
+}
+
+// MoveFileFolder 把文件夹移动到parentId下并改名为name，同时更新整个子树的物化路径。
+// 目标是文件夹自身或其子孙文件夹时返回ErrFileFolderCycle，移动后超过最大层级时返回ErrFileFolderTooDeep，
+// 文件夹大小由调用方更新
+func MoveFileFolder(t *gorm.DB, fileFolderId string, parentId string, name string) error {
+	var fileFolders []FileFolder
+	if err := t.Select("uuid", "tree_path").Where("uuid in ?", []string{fileFolderId, parentId}).Find(&fileFolders).Error; err != nil {
+		return err
+	}
+	var fileFolder, parent FileFolder
+	for _, f := range fileFolders {
+		if f.Uuid == fileFolderId {
+			fileFolder = f
+		}
+		if f.Uuid == parentId {
+			parent = f
+		}
+	}
+	if fileFolder.Uuid == "" || parent.Uuid == "" {
+		return gorm.ErrRecordNotFound
+	}
+	if parent.IsDescendantOf(fileFolder) {
+		return ErrFileFolderCycle
+	}
+
+	oldPath := fileFolder.TreePath
+	newPath := parent.TreePath + fileFolder.Uuid + "/"
+	if oldPath != newPath {
+		// 子树中最深的文件夹移动后不能超过最大层级
+		var maxSlashes int
+		if err := SubtreeFileFolders(t, fileFolder).
+			Select("COALESCE(MAX(LENGTH(tree_path) - LENGTH(REPLACE(tree_path, '/', ''))), 0)").Scan(&maxSlashes).Error; err != nil {
+			return err
+		}
+		if parent.Depth()+1+maxSlashes-strings.Count(oldPath, "/") > MaxFileFolderDepth {
+			return ErrFileFolderTooDeep
+		}
+	}
+
+	if err := t.Model(&FileFolder{}).Where("uuid = ?", fileFolderId).Updates(map[string]interface{}{
+		"parent_folder_id": parentId,
+		"file_folder_name": name,
+	}).Error; err != nil {
+		return err
+	}
+	if oldPath == newPath || oldPath == "" {
+		return nil
+	}
+	return SubtreeFileFolders(t, fileFolder).
+		Update("tree_path", gorm.Expr("CONCAT(?, SUBSTR(tree_path, ?))", newPath, len(oldPath)+1)).Error
+}
+
 // CreateBaseFileFolder 为用户创建文件夹，使用fileStoreId和ownerId，
 // 并返回其uuid或错误
 func CreateBaseFileFolder(ownerId string, fileStoreId string) (string, error) {
@@ -45,60 +178,53 @@ func (fileFolder *FileFolder) SubSize(size int64) error {
 	return nil
 }
 
-// AddFileFolderSize 增加文件夹大小并为父文件夹增加大小（事务保证）
+// AddFileFolderSize 增加文件夹及其所有祖先文件夹的大小（事务保证）
 func (fileFolder *FileFolder) AddFileFolderSize(t *gorm.DB, appendSize int64) (err error) {
-	// 为文件夹增加大小
 	fileFolder.Size += appendSize
-	parentId := fileFolder.ParentFolderID
-	if err := t.Save(fileFolder).Error; err != nil {
-		return fmt.Errorf("增加文件大小时保存文件夹出错 %v", err)
-	}
-
-	// 为父文件夹增加大小（循环处理）
-	for parentId != "root" && parentId != "" {
-		var nowFileFolder FileFolder
-		if err = t.Where("uuid = ?", parentId).Find(&nowFileFolder).Error; err != nil {
-			return fmt.Errorf("增加文件大小时查找文件夹出错 %v", err)
-		}
-		// 没有找到父文件夹
-		if nowFileFolder.Uuid == "" {
-			break
-		}
-		nowFileFolder.Size += appendSize
-		if err = t.Save(&nowFileFolder).Error; err != nil {
-			return fmt.Errorf("增加文件大小时保存文件夹出错 %v", err)
-		}
-		parentId = nowFileFolder.ParentFolderID
-	}
-
-	return
+	return AddFileFoldersSize(t, map[string]int64{fileFolder.Uuid: appendSize})
 }
 
-// SubFileFolderSize 减少文件夹大小并为父文件夹减少大小（事务保证）
+// SubFileFolderSize 减少文件夹及其所有祖先文件夹的大小（事务保证）
 func (fileFolder *FileFolder) SubFileFolderSize(t *gorm.DB, size int64) (err error) {
-	// 为文件夹减少大小
 	fileFolder.SubSize(size)
-	parentId := fileFolder.ParentFolderID
+	return AddFileFoldersSize(t, map[string]int64{fileFolder.Uuid: -size})
+}
 
-	if err = t.Save(fileFolder).Error; err != nil {
-		return fmt.Errorf("减少文件大小时保存文件夹出错 %v", err)
+// AddFileFoldersSize 批量增加多个文件夹的大小，按物化路径汇总每个文件夹及其祖先的增量，
+// 增量相同的文件夹合并为一条更新语句，大小不会减到0以下（事务保证）
+func AddFileFoldersSize(t *gorm.DB, deltas map[string]int64) error {
+	ids := make([]string, 0, len(deltas))
+	for id, delta := range deltas {
+		if delta != 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var fileFolders []FileFolder
+	if err := t.Select("uuid", "tree_path").Where("uuid in ?", ids).Find(&fileFolders).Error; err != nil {
+		return fmt.Errorf("增加文件大小时查找文件夹出错 %v", err)
 	}
 
-	// 为父文件夹减少大小
-	for parentId != "root" && parentId != "" {
-		var nowFileFolder FileFolder
-		if err = t.Where("uuid = ?", parentId).Find(&nowFileFolder).Error; err != nil {
-			return fmt.Errorf("减少文件大小时查找文件夹出错 %v", err)
+	total := make(map[string]int64)
+	for _, fileFolder := range fileFolders {
+		for _, id := range fileFolder.AncestorIds() {
+			total[id] += deltas[fileFolder.Uuid]
 		}
-		if nowFileFolder.Uuid == "" {
-			break
-		}
-		nowFileFolder.SubSize(size)
-		if err = t.Save(&nowFileFolder).Error; err != nil {
-			return fmt.Errorf("减少文件大小时保存文件夹出错 %v", err)
+	}
+	groups := make(map[int64][]string)
+	for id, delta := range total {
+		if delta != 0 {
+			groups[delta] = append(groups[delta], id)
 		}
-		parentId = nowFileFolder.ParentFolderID
 	}
 
-	return
+	for delta, ids := range groups {
+		if err := t.Model(&FileFolder{}).Where("uuid in ?", ids).
+			Update("size", gorm.Expr("CASE WHEN size + ? < 0 THEN 0 ELSE size + ? END", delta, delta)).Error; err != nil {
+			return fmt.Errorf("增加文件大小时保存文件夹出错 %v", err)
+		}
+	}
+	return nil
 }
@@ -1,12 +1,15 @@
 package model
 
 import (
-	"fmt"
+	"errors"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrExceedStoreLimit 超过用户存储空间限制
+var ErrExceedStoreLimit = errors.New("超过用户存储空间限制")
+
 type FileStore struct {
 	Uuid        string `gorm:"primarykey"`
 	OwnerID     string `gorm:"column:owner_id"`
@@ -22,10 +25,10 @@ func (fileStore *FileStore) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
-// AddCurrentSize 增加当前存储大小
+// AddCurrentSize 增加当前存储大小，超过最大存储容量时返回ErrExceedStoreLimit
 func (fileStore *FileStore) AddCurrentSize(size int64) (err error) {
 	if fileStore.CurrentSize+size > fileStore.MaxSize {
-		return fmt.Errorf("添加大小超过最大存储容量")
+		return ErrExceedStoreLimit
 	}
 	fileStore.CurrentSize += size
 	return nil
@@ -0,0 +1,252 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"go-cloud-disk/disk"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultMaxFileVersions 默认每个文件保留的历史版本数
+	DefaultMaxFileVersions = 10
+	// DefaultFileVersionDays 默认历史版本保留天数
+	DefaultFileVersionDays = 30
+)
+
+// FileVersion 文件历史版本，同一文件夹中上传同名文件时保存被覆盖的内容
+type FileVersion struct {
+	Uuid        string    `gorm:"primarykey" json:"version_id"`
+	FileId      string    `gorm:"not null;index" json:"file_id"` // 所属文件ID
+	Owner       string    `gorm:"not null;index" json:"-"`       // 文件所有者
+	FileUuid    string    `gorm:"index;not null" json:"-"`       // 云端对象名
+	FilePostfix string    `json:"filetype"`                      // 文件后缀
+	FilePath    string    `json:"-"`                             // 云端文件的文件夹路径
+	Size        int64     `json:"size"`                          // 文件大小
+	Hash        string    `gorm:"size:64" json:"hash"`           // 文件内容的SHA-256
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`       // 成为历史版本的时间
+}
+
+// FileVersionConfig 用户的历史版本保留策略
+type FileVersionConfig struct {
+	ID          string    `gorm:"primarykey" json:"id"`
+	UserID      string    `gorm:"unique;not null" json:"user_id"` // 用户ID
+	MaxVersions int       `json:"max_versions"`                   // 每个文件保留的历史版本数，0表示不保留
+	KeepDays    int       `json:"keep_days"`                      // 历史版本保留天数
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BeforeCreate 在插入数据库前创建uuid
+func (version *FileVersion) BeforeCreate(tx *gorm.DB) (err error) {
+	if version.Uuid == "" {
+		version.Uuid = uuid.New().String()
+	}
+	return
+}
+
+// BeforeCreate 在插入数据库前创建uuid
+func (config *FileVersionConfig) BeforeCreate(tx *gorm.DB) (err error) {
+	if config.ID == "" {
+		config.ID = uuid.New().String()
+	}
+	return
+}
+
+// ObjectName 返回历史版本的云端对象名
+func (version *FileVersion) ObjectName() string {
+	return disk.ObjectName(version.FileUuid, version.FilePostfix)
+}
+
+// GetFileVersionConfig 获取用户的历史版本保留策略，用户未设置时返回默认策略
+func GetFileVersionConfig(t *gorm.DB, userId string) (FileVersionConfig, error) {
+	var config FileVersionConfig
+	err := t.Where("user_id = ?", userId).First(&config).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return FileVersionConfig{
+			UserID:      userId,
+			MaxVersions: DefaultMaxFileVersions,
+			KeepDays:    DefaultFileVersionDays,
+		}, nil
+	}
+	return config, err
+}
+
+// SaveFileWithVersion 保存上传的文件。同一文件夹中已存在同名文件时，将旧内容保存为历史版本，
+// 并把新内容及其状态写入原文件记录，file会回填为原文件记录。
+// 返回文件夹大小的变化量和用户存储空间的变化量，历史版本计入存储空间但不计入文件夹大小
+func SaveFileWithVersion(t *gorm.DB, file *File) (folderDelta int64, storeDelta int64, err error) {
+	// 锁定同名文件，同名文件不存在时锁定索引间隙，避免并发上传同名文件时重复创建记录或丢失历史版本
+	var current File
+	if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner = ? and parent_folder_id = ? and file_name = ? and file_postfix = ?",
+		file.Owner, file.ParentFolderId, file.FileName, file.FilePostfix).Limit(1).Find(&current).Error; err != nil {
+		return 0, 0, err
+	}
+	if current.Uuid == "" {
+		if err := t.Save(file).Error; err != nil {
+			return 0, 0, err
+		}
+		return file.Size, file.Size, nil
+	}
+
+	// 旧内容转为历史版本
+	version := FileVersion{
+		FileId:      current.Uuid,
+		Owner:       current.Owner,
+		FileUuid:    current.FileUuid,
+		FilePostfix: current.FilePostfix,
+		FilePath:    current.FilePath,
+		Size:        current.Size,
+		Hash:        current.Hash,
+	}
+	if err := t.Create(&version).Error; err != nil {
+		return 0, 0, err
+	}
+
+	folderDelta = file.Size - current.Size
+	current.FileUuid = file.FileUuid
+	current.FilePath = file.FilePath
+	current.Size = file.Size
+	current.Hash = file.Hash
+	current.Status = file.Status
+	if current.Status == "" {
+		current.Status = FileStatusAvailable
+	}
+	if err := t.Save(&current).Error; err != nil {
+		return 0, 0, err
+	}
+	*file = current
+
+	// 按保留策略清理多余的历史版本
+	config, err := GetFileVersionConfig(t, current.Owner)
+	if err != nil {
+		return 0, 0, err
+	}
+	freed, err := PruneFileVersions(t, current.Uuid, config.MaxVersions)
+	if err != nil {
+		return 0, 0, err
+	}
+	return folderDelta, file.Size - freed, nil
+}
+
+// CreateFile 在事务中保存用户文件并增加用户存储空间，file会回填生成的uuid，userStore须由调用方在同一事务中加锁读取。
+// 按conflict处理同名冲突，覆盖时旧内容转为历史版本，跳过时file替换为已有文件且skipped为true。
+// 超过存储空间限制时返回ErrExceedStoreLimit，返回文件夹大小的变化量，调用方负责更新文件夹大小
+func CreateFile(t *gorm.DB, file *File, userStore *FileStore, conflict string) (folderDelta int64, skipped bool, err error) {
+	existing, err := ResolveFileName(t, file, conflict)
+	if err != nil {
+		return 0, false, err
+	}
+	if existing != nil && conflict == ConflictSkip {
+		*file = *existing
+		return 0, true, nil
+	}
+
+	// 保存文件信息到数据库
+	folderDelta, storeDelta, err := SaveFileWithVersion(t, file)
+	if err != nil {
+		return 0, false, err
+	}
+	// 增加用户文件存储容量，预留过期或最大容量被调低时可能超出
+	if err := userStore.AddCurrentSize(storeDelta); err != nil {
+		return 0, false, err
+	}
+	if err := t.Save(userStore).Error; err != nil {
+		return 0, false, err
+	}
+	return folderDelta, false, nil
+}
+
+// PruneFileVersions 只保留文件最新的keep个历史版本，返回释放的存储空间，调用方负责更新用户存储空间
+func PruneFileVersions(t *gorm.DB, fileId string, keep int) (int64, error) {
+	// MySQL不支持没有LIMIT的OFFSET，查询全部版本后跳过最新的keep个
+	var versions []FileVersion
+	if err := t.Where("file_id = ?", fileId).Order("created_at desc").Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	if len(versions) <= keep {
+		return 0, nil
+	}
+	return deleteFileVersions(t, versions[keep:])
+}
+
+// DeleteFileVersions 删除文件的所有历史版本，返回释放的存储空间，用于彻底删除文件
+func DeleteFileVersions(t *gorm.DB, fileId string) (int64, error) {
+	var versions []FileVersion
+	if err := t.Where("file_id = ?", fileId).Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	return deleteFileVersions(t, versions)
+}
+
+// DeleteFilesVersions 删除多个文件的所有历史版本，返回释放的存储空间，用于批量彻底删除文件
+func DeleteFilesVersions(t *gorm.DB, fileIds []string) (int64, error) {
+	if len(fileIds) == 0 {
+		return 0, nil
+	}
+	var versions []FileVersion
+	if err := t.Where("file_id in ?", fileIds).Find(&versions).Error; err != nil {
+		return 0, err
+	}
+	return deleteFileVersions(t, versions)
+}
+
+// deleteFileVersions 删除历史版本记录，云端对象可能被秒传的其他文件共享，不再被引用时才登记为待清理
+func deleteFileVersions(t *gorm.DB, versions []FileVersion) (int64, error) {
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, 0, len(versions))
+	objects := make([]StoredObject, 0, len(versions))
+	var freed int64
+	for _, version := range versions {
+		ids = append(ids, version.Uuid)
+		objects = append(objects, version.Object())
+		freed += version.Size
+	}
+	if err := t.Where("uuid in ?", ids).Delete(&FileVersion{}).Error; err != nil {
+		return 0, err
+	}
+	if err := ReleaseObjects(t, objects); err != nil {
+		return 0, err
+	}
+	return freed, nil
+}
+
+// CleanExpiredFileVersions 按各用户的保留天数删除过期的历史版本，并更新用户存储空间
+func CleanExpiredFileVersions() error {
+	var owners []string
+	if err := DB.Model(&FileVersion{}).Distinct().Pluck("owner", &owners).Error; err != nil {
+		return err
+	}
+	for _, owner := range owners {
+		config, err := GetFileVersionConfig(DB, owner)
+		if err != nil {
+			return err
+		}
+		expireAt := time.Now().AddDate(0, 0, -config.KeepDays)
+		err = DB.Transaction(func(t *gorm.DB) error {
+			var versions []FileVersion
+			if err := t.Where("owner = ? and created_at < ?", owner, expireAt).Find(&versions).Error; err != nil {
+				return err
+			}
+			freed, err := deleteFileVersions(t, versions)
+			if err != nil || freed == 0 {
+				return err
+			}
+			return t.Model(&FileStore{}).Where("owner_id = ?", owner).
+				Update("current_size", gorm.Expr("GREATEST(current_size - ?, 0)", freed)).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FolderCopy 复制文件夹子树的计划，先创建全部文件夹并确定大小，文件记录可一次或分批写入
+type FolderCopy struct {
+	Root   FileFolder // 复制生成的顶层文件夹，Size为整个子树的大小
+	Files  []File     // 子树中待复制的原文件
+	tree   *FolderTree
+	source FileFolder
+	sizes  map[string]int64  // 原文件夹ID -> 副本大小
+	newIds map[string]string // 原文件夹ID -> 新文件夹ID
+}
+
+// PlanFolderCopy 查询source子树中的所有文件并自底向上计算副本各文件夹的大小，
+// root为已确定名称和父文件夹的副本顶层文件夹，副本超过最大层级时返回ErrFileFolderTooDeep
+func PlanFolderCopy(t *gorm.DB, tree *FolderTree, source FileFolder, root FileFolder) (*FolderCopy, error) {
+	folderIds := tree.Descendants(source.Uuid)
+	target, _ := tree.Get(root.ParentFolderID)
+	for _, id := range folderIds {
+		fileFolder, _ := tree.Get(id)
+		if target.Depth()+1+fileFolder.Depth()-source.Depth() > MaxFileFolderDepth {
+			return nil, ErrFileFolderTooDeep
+		}
+	}
+
+	var files []File
+	if err := t.Where("parent_folder_id in ? and owner = ?", folderIds, source.OwnerID).Find(&files).Error; err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64, len(folderIds))
+	for _, file := range files {
+		sizes[file.ParentFolderId] += file.Size
+	}
+	for i := len(folderIds) - 1; i > 0; i-- {
+		child, _ := tree.Get(folderIds[i])
+		sizes[child.ParentFolderID] += sizes[child.Uuid]
+	}
+	root.Size = sizes[source.Uuid]
+
+	return &FolderCopy{
+		Root:   root,
+		Files:  files,
+		tree:   tree,
+		source: source,
+		sizes:  sizes,
+		newIds: make(map[string]string, len(folderIds)),
+	}, nil
+}
+
+// CreateFolders 按广度优先顺序创建副本的所有文件夹，保证父文件夹先于子文件夹创建，不更新祖先文件夹的大小
+func (c *FolderCopy) CreateFolders(t *gorm.DB) error {
+	if err := t.Create(&c.Root).Error; err != nil {
+		return err
+	}
+	c.newIds[c.source.Uuid] = c.Root.Uuid
+	newPaths := map[string]string{c.Root.Uuid: c.Root.TreePath}
+	descendants := c.tree.Descendants(c.source.Uuid)[1:]
+	newChildren := make([]FileFolder, 0, len(descendants))
+	for _, id := range descendants {
+		child, _ := c.tree.Get(id)
+		parentId := c.newIds[child.ParentFolderID]
+		newId := uuid.New().String()
+		newChildren = append(newChildren, FileFolder{
+			Uuid:           newId,
+			FileFolderName: child.FileFolderName,
+			ParentFolderID: parentId,
+			FileStoreID:    c.Root.FileStoreID,
+			OwnerID:        c.Root.OwnerID,
+			Size:           c.sizes[id],
+			TreePath:       newPaths[parentId] + newId + "/",
+		})
+		c.newIds[id] = newId
+		newPaths[newId] = newPaths[parentId] + newId + "/"
+	}
+	if len(newChildren) == 0 {
+		return nil
+	}
+	// 路径已预先生成，子文件夹可以批量写入
+	return t.CreateInBatches(newChildren, 200).Error
+}
+
+// NewFileFolderId 返回原文件夹对应的副本文件夹ID，须在CreateFolders之后调用
+func (c *FolderCopy) NewFileFolderId(fileFolderId string) string {
+	return c.newIds[fileFolderId]
+}
+
+// CreateFiles 为files创建副本记录，新记录复用原文件的云端对象，大小已计入CreateFolders创建的文件夹
+func (c *FolderCopy) CreateFiles(t *gorm.DB, files []File) error {
+	if len(files) == 0 {
+		return nil
+	}
+	newFiles := make([]File, 0, len(files))
+	for _, file := range files {
+		newFiles = append(newFiles, File{
+			Owner:          c.Root.OwnerID,
+			FileName:       file.FileName,
+			FilePostfix:    file.FilePostfix,
+			FileUuid:       file.FileUuid,
+			FilePath:       file.FilePath,
+			ParentFolderId: c.newIds[file.ParentFolderId],
+			Size:           file.Size,
+			Hash:           file.Hash,
+			Status:         file.Status,
+		})
+	}
+	return t.CreateInBatches(newFiles, 200).Error
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// FolderTree 用户的文件夹树，一次查询加载用户的所有文件夹后在内存中查找，避免逐级查询数据库
+type FolderTree struct {
+	Root     FileFolder              // 用户主目录
+	folders  map[string]FileFolder   // 文件夹ID -> 文件夹
+	children map[string][]FileFolder // 父文件夹ID -> 子文件夹
+}
+
+// LoadFolderTree 加载用户的所有文件夹
+func LoadFolderTree(t *gorm.DB, userId string) (*FolderTree, error) {
+	var fileFolders []FileFolder
+	if err := t.Where("owner_id = ?", userId).Order("file_folder_name").Find(&fileFolders).Error; err != nil {
+		return nil, err
+	}
+	tree := &FolderTree{
+		folders:  make(map[string]FileFolder, len(fileFolders)),
+		children: make(map[string][]FileFolder),
+	}
+	for _, fileFolder := range fileFolders {
+		tree.Add(fileFolder)
+	}
+	return tree, nil
+}
+
+// Add 将新建的文件夹加入树中
+func (tree *FolderTree) Add(fileFolder FileFolder) {
+	tree.folders[fileFolder.Uuid] = fileFolder
+	if fileFolder.ParentFolderID == "root" {
+		tree.Root = fileFolder
+		return
+	}
+	tree.children[fileFolder.ParentFolderID] = append(tree.children[fileFolder.ParentFolderID], fileFolder)
+}
+
+// Move 在树中把文件夹移动到新的父文件夹下并更新子树的物化路径，数据库中的移动由调用方完成
+func (tree *FolderTree) Move(fileFolderId string, parentId string, name string) {
+	fileFolder, ok := tree.folders[fileFolderId]
+	parent, parentOk := tree.folders[parentId]
+	if !ok || !parentOk {
+		return
+	}
+	tree.detach(fileFolder)
+	fileFolder.ParentFolderID = parentId
+	fileFolder.FileFolderName = name
+	tree.Add(fileFolder)
+
+	oldPath := fileFolder.TreePath
+	newPath := parent.TreePath + fileFolder.Uuid + "/"
+	for _, id := range tree.Descendants(fileFolderId) {
+		descendant := tree.folders[id]
+		descendant.TreePath = newPath + strings.TrimPrefix(descendant.TreePath, oldPath)
+		tree.replace(descendant)
+	}
+}
+
+// replace 更新树中已有文件夹的信息，父文件夹不变
+func (tree *FolderTree) replace(fileFolder FileFolder) {
+	tree.folders[fileFolder.Uuid] = fileFolder
+	siblings := tree.children[fileFolder.ParentFolderID]
+	for i, child := range siblings {
+		if child.Uuid == fileFolder.Uuid {
+			siblings[i] = fileFolder
+			return
+		}
+	}
+}
+
+// Remove 从树中移除文件夹及其所有子孙文件夹，数据库中的删除由调用方完成
+func (tree *FolderTree) Remove(fileFolderId string) {
+	fileFolder, ok := tree.folders[fileFolderId]
+	if !ok {
+		return
+	}
+	tree.detach(fileFolder)
+	for _, id := range tree.Descendants(fileFolderId) {
+		delete(tree.folders, id)
+		delete(tree.children, id)
+	}
+}
+
+// detach 从父文件夹的子文件夹列表中移除文件夹
+func (tree *FolderTree) detach(fileFolder FileFolder) {
+	siblings := tree.children[fileFolder.ParentFolderID]
+	for i, child := range siblings {
+		if child.Uuid == fileFolder.Uuid {
+			tree.children[fileFolder.ParentFolderID] = append(siblings[:i:i], siblings[i+1:]...)
+			return
+		}
+	}
+}
+
+// Get 根据ID获取文件夹
+func (tree *FolderTree) Get(fileFolderId string) (FileFolder, bool) {
+	fileFolder, ok := tree.folders[fileFolderId]
+	return fileFolder, ok
+}
+
+// Children 获取文件夹的直接子文件夹
+func (tree *FolderTree) Children(fileFolderId string) []FileFolder {
+	return tree.children[fileFolderId]
+}
+
+// Child 按名称查找子文件夹，存在同名文件夹时返回名称排序后的第一个
+func (tree *FolderTree) Child(parentId string, name string) (FileFolder, bool) {
+	for _, child := range tree.children[parentId] {
+		if child.FileFolderName == name {
+			return child, true
+		}
+	}
+	return FileFolder{}, false
+}
+
+// Descendants 广度优先返回文件夹自身及其所有子孙文件夹的ID
+func (tree *FolderTree) Descendants(fileFolderId string) []string {
+	ids := []string{fileFolderId}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range tree.children[ids[i]] {
+			ids = append(ids, child.Uuid)
+		}
+	}
+	return ids
+}
+
+// IsDescendant 判断fileFolderId是否为ancestorId自身或其子孙文件夹
+func (tree *FolderTree) IsDescendant(fileFolderId string, ancestorId string) bool {
+	for fileFolderId != "" && fileFolderId != "root" {
+		if fileFolderId == ancestorId {
+			return true
+		}
+		fileFolder, ok := tree.folders[fileFolderId]
+		if !ok {
+			return false
+		}
+		fileFolderId = fileFolder.ParentFolderID
+	}
+	return false
+}
+
+// Path 返回文件夹从主目录开始的路径，例如 /main/reports
+func (tree *FolderTree) Path(fileFolderId string) string {
+	var names []string
+	for fileFolderId != "" && fileFolderId != "root" {
+		fileFolder, ok := tree.folders[fileFolderId]
+		if !ok {
+			break
+		}
+		names = append(names, fileFolder.FileFolderName)
+		fileFolderId = fileFolder.ParentFolderID
+	}
+	var path strings.Builder
+	for i := len(names) - 1; i >= 0; i-- {
+		path.WriteString("/")
+		path.WriteString(names[i])
+	}
+	return path.String()
+}
@@ -2,22 +2,71 @@ package model
 
 import (
 	"go-cloud-disk/conf"
+	loglog "go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
 )
 
 // migration 数据库迁移
 func migration() {
 	_ = DB.AutoMigrate(&User{})
+	migrateFileUuidUnique()
 	_ = DB.AutoMigrate(&File{})
 	_ = DB.AutoMigrate(&FileFolder{})
+	migrateFileFolderTreePath()
 	_ = DB.AutoMigrate(&FileStore{})
 	_ = DB.AutoMigrate(&Share{})
 	_ = DB.AutoMigrate(&Tag{})
 	_ = DB.AutoMigrate(&FileTag{})
 	_ = DB.AutoMigrate(&RecycleBin{})
 	_ = DB.AutoMigrate(&RecycleBinConfig{})
+	_ = DB.AutoMigrate(&UploadReservation{})
+	_ = DB.AutoMigrate(&FileVersion{})
+	_ = DB.AutoMigrate(&FileVersionConfig{})
+	_ = DB.AutoMigrate(&CopyJob{})
+	_ = DB.AutoMigrate(&ObjectCleanup{})
+	_ = DB.AutoMigrate(&ReconcileJob{})
+	_ = DB.AutoMigrate(&ReconcileIssue{})
+	_ = DB.AutoMigrate(&UploadJob{})
 	initSuperAdmin()
 }
 
+// migrateFileUuidUnique 将file_uuid的唯一约束替换为普通索引，
+// 秒传和转存需要多个文件记录共享同一云端对象。先建普通索引，避免标签外键失去索引导致删除约束失败
+func migrateFileUuidUnique() {
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&File{}) {
+		return
+	}
+	if !migrator.HasIndex(&File{}, "idx_files_file_uuid") {
+		_ = migrator.CreateIndex(&File{}, "FileUuid")
+	}
+	if migrator.HasConstraint(&File{}, "uni_files_file_uuid") {
+		_ = migrator.DropConstraint(&File{}, "uni_files_file_uuid")
+	}
+}
+
+// migrateFileFolderTreePath 为缺少物化路径的文件夹生成路径，先处理主目录，再逐层处理父文件夹已有路径的文件夹。
+// 父文件夹缺失或形成环的文件夹无法生成路径，保持为空
+func migrateFileFolderTreePath() {
+	if err := DB.Model(&FileFolder{}).Where("parent_folder_id = ? and tree_path = ''", "root").
+		Update("tree_path", gorm.Expr("CONCAT('/', uuid, '/')")).Error; err != nil {
+		loglog.Log().Error("[migrateFileFolderTreePath] 生成主目录路径失败: ", err)
+		return
+	}
+	for depth := 2; depth <= MaxFileFolderDepth; depth++ {
+		result := DB.Exec("UPDATE file_folders AS c JOIN file_folders AS p ON c.parent_folder_id = p.uuid " +
+			"SET c.tree_path = CONCAT(p.tree_path, c.uuid, '/') WHERE c.tree_path = '' AND p.tree_path <> ''")
+		if result.Error != nil {
+			loglog.Log().Error("[migrateFileFolderTreePath] 生成文件夹路径失败: ", result.Error)
+			return
+		}
+		if result.RowsAffected == 0 {
+			return
+		}
+	}
+}
+
 func initSuperAdmin() {
 	// 创建超级管理员
 	var count int64
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 同一文件夹内文件和子文件夹名称唯一，写入时按以下策略处理同名冲突
+const (
+	ConflictFail      = "fail"      // 返回ErrNameConflict
+	ConflictRename    = "rename"    // 自动重命名为 name (1).ext
+	ConflictOverwrite = "overwrite" // 覆盖同名文件，仅适用于文件
+	ConflictSkip      = "skip"      // 保留已存在的同名文件或文件夹，不写入
+)
+
+// ErrNameConflict 文件夹中已存在同名文件或文件夹
+var ErrNameConflict = errors.New("name conflict")
+
+// ResolveFileName 按冲突策略确定文件在目标文件夹中的名称，文件根据Owner、ParentFolderId、FileName和FilePostfix定位，
+// 移动已有文件时按Uuid排除自身。策略为rename时会修改file.FileName。
+// 返回同名的已有文件：策略为skip时调用方保留已有文件，策略为overwrite时调用方用新内容覆盖已有文件。
+// 与同名子文件夹冲突时无法覆盖或跳过，除rename外均返回ErrNameConflict
+func ResolveFileName(t *gorm.DB, file *File, conflict string) (*File, error) {
+	var existing File
+	if err := t.Where("owner = ? and parent_folder_id = ? and file_name = ? and file_postfix = ? and uuid <> ?",
+		file.Owner, file.ParentFolderId, file.FileName, file.FilePostfix, file.Uuid).Limit(1).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	folderTaken, err := fileFolderNameTaken(t, file.Owner, file.ParentFolderId, joinFileName(file.FileName, file.FilePostfix))
+	if err != nil {
+		return nil, err
+	}
+	if existing.Uuid == "" && !folderTaken {
+		return nil, nil
+	}
+
+	switch {
+	case conflict == ConflictRename:
+		taken, err := takenNames(t, file.Owner, file.ParentFolderId, file.FileName)
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; ; i++ {
+			name := fmt.Sprintf("%s (%d)", file.FileName, i)
+			if !taken[joinFileName(name, file.FilePostfix)] {
+				file.FileName = name
+				return nil, nil
+			}
+		}
+	case (conflict == ConflictOverwrite || conflict == ConflictSkip) && !folderTaken:
+		return &existing, nil
+	default:
+		return nil, ErrNameConflict
+	}
+}
+
+// ResolveFileFolderName 按冲突策略确定文件夹在父文件夹中的名称，文件夹根据OwnerID、ParentFolderID和FileFolderName定位，
+// 移动已有文件夹时按Uuid排除自身。策略为rename时会修改fileFolder.FileFolderName。
+// 返回同名的已有文件夹，策略为skip时调用方保留已有文件夹；文件夹不支持覆盖，overwrite按fail处理
+func ResolveFileFolderName(t *gorm.DB, fileFolder *FileFolder, conflict string) (*FileFolder, error) {
+	var existing FileFolder
+	if err := t.Where("owner_id = ? and parent_folder_id = ? and file_folder_name = ? and uuid <> ?",
+		fileFolder.OwnerID, fileFolder.ParentFolderID, fileFolder.FileFolderName, fileFolder.Uuid).Limit(1).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	filename, extend := splitFileName(fileFolder.FileFolderName)
+	var fileCount int64
+	if err := t.Model(&File{}).Where("owner = ? and parent_folder_id = ? and file_name = ? and file_postfix = ?",
+		fileFolder.OwnerID, fileFolder.ParentFolderID, filename, extend).Count(&fileCount).Error; err != nil {
+		return nil, err
+	}
+	if existing.Uuid == "" && fileCount == 0 {
+		return nil, nil
+	}
+
+	switch {
+	case conflict == ConflictRename:
+		taken, err := takenNames(t, fileFolder.OwnerID, fileFolder.ParentFolderID, fileFolder.FileFolderName)
+		if err != nil {
+			return nil, err
+		}
+		for i := 1; ; i++ {
+			name := fmt.Sprintf("%s (%d)", fileFolder.FileFolderName, i)
+			if !taken[name] {
+				fileFolder.FileFolderName = name
+				return nil, nil
+			}
+		}
+	case conflict == ConflictSkip && fileCount == 0:
+		return &existing, nil
+	default:
+		return nil, ErrNameConflict
+	}
+}
+
+// fileFolderNameTaken 判断父文件夹中是否存在指定名称的子文件夹
+func fileFolderNameTaken(t *gorm.DB, ownerId string, parentId string, name string) (bool, error) {
+	var count int64
+	if err := t.Model(&FileFolder{}).Where("owner_id = ? and parent_folder_id = ? and file_folder_name = ?",
+		ownerId, parentId, name).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// takenNames 一次查询父文件夹中以prefix开头的文件和子文件夹名称，用于生成不冲突的新名称
+func takenNames(t *gorm.DB, ownerId string, parentId string, prefix string) (map[string]bool, error) {
+	pattern := escapeLike(prefix) + "%"
+	var files []File
+	if err := t.Select("file_name", "file_postfix").
+		Where("owner = ? and parent_folder_id = ? and file_name like ?", ownerId, parentId, pattern).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	var folderNames []string
+	if err := t.Model(&FileFolder{}).Where("owner_id = ? and parent_folder_id = ? and file_folder_name like ?", ownerId, parentId, pattern).
+		Pluck("file_folder_name", &folderNames).Error; err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool, len(files)+len(folderNames))
+	for _, file := range files {
+		taken[file.DisplayName()] = true
+	}
+	for _, name := range folderNames {
+		taken[name] = true
+	}
+	return taken, nil
+}
+
+// joinFileName 拼接文件名和扩展名
+func joinFileName(filename string, extend string) string {
+	if extend == "" {
+		return filename
+	}
+	return filename + "." + extend
+}
+
+// splitFileName 将名称拆分为文件名和扩展名，与utils.SplitFilename规则一致
+func splitFileName(name string) (string, string) {
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return name, ""
+	}
+	return name[:i], name[i+1:]
+}
+
+// escapeLike 转义LIKE模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,174 @@
+package model
+
+import (
+	"strconv"
+	"time"
+
+	"go-cloud-disk/conf"
+	"go-cloud-disk/disk"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultObjectCleanupGraceDays 云端对象不再被引用后默认保留的天数
+const DefaultObjectCleanupGraceDays = 7
+
+// 云端对象清理状态
+const (
+	ObjectCleanupPending = "pending" // 宽限期中，到期后提交到清理队列
+	ObjectCleanupQueued  = "queued"  // 已提交到清理队列
+	ObjectCleanupDeleted = "deleted" // 云端对象已删除
+	ObjectCleanupKept    = "kept"    // 宽限期内重新被引用，不再删除
+)
+
+// StoredObject 云端对象，秒传、复制、转存和历史版本会让多条记录共享同一对象
+type StoredObject struct {
+	FilePath    string // 云端文件的文件夹路径
+	FileUuid    string // 云端对象名
+	FilePostfix string // 文件后缀
+	Size        int64  // 对象大小
+}
+
+// Name 返回云端对象的文件名
+func (object StoredObject) Name() string {
+	return disk.ObjectName(object.FileUuid, object.FilePostfix)
+}
+
+// Key 返回云端对象的完整键
+func (object StoredObject) Key() string {
+	return "user/" + object.FilePath + "/" + object.Name()
+}
+
+// Object 返回文件引用的云端对象
+func (file *File) Object() StoredObject {
+	return StoredObject{FilePath: file.FilePath, FileUuid: file.FileUuid, FilePostfix: file.FilePostfix, Size: file.Size}
+}
+
+// Object 返回历史版本引用的云端对象
+func (version *FileVersion) Object() StoredObject {
+	return StoredObject{FilePath: version.FilePath, FileUuid: version.FileUuid, FilePostfix: version.FilePostfix, Size: version.Size}
+}
+
+// ObjectCleanup 不再被任何文件记录或历史版本引用的云端对象，宽限期结束后通过清理队列删除
+type ObjectCleanup struct {
+	Uuid        string    `gorm:"primarykey" json:"id"`
+	ObjectKey   string    `gorm:"size:255;not null;uniqueIndex" json:"object_key"` // 云端对象的完整键
+	FilePath    string    `json:"-"`
+	FileUuid    string    `json:"-"`
+	FilePostfix string    `json:"-"`
+	Size        int64     `json:"size"`
+	Status      string    `gorm:"size:16;not null;index" json:"status"`
+	ReleasedAt  time.Time `json:"released_at"`           // 最后一个引用被删除的时间
+	CleanAt     time.Time `gorm:"index" json:"clean_at"` // 宽限期结束时间
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BeforeCreate 在插入数据库前创建uuid
+func (cleanup *ObjectCleanup) BeforeCreate(tx *gorm.DB) (err error) {
+	if cleanup.Uuid == "" {
+		cleanup.Uuid = uuid.New().String()
+	}
+	return
+}
+
+// Object 返回待清理的云端对象
+func (cleanup *ObjectCleanup) Object() StoredObject {
+	return StoredObject{FilePath: cleanup.FilePath, FileUuid: cleanup.FileUuid, FilePostfix: cleanup.FilePostfix, Size: cleanup.Size}
+}
+
+// ObjectCleanupEnabled 是否真正删除云端对象，关闭时只登记待清理的对象，管理员可先查看清理报告
+func ObjectCleanupEnabled() bool {
+	return conf.ObjectGCEnable == "true"
+}
+
+// ObjectCleanupGrace 返回云端对象不再被引用后的保留时间
+func ObjectCleanupGrace() time.Duration {
+	days, err := strconv.Atoi(conf.ObjectGCGraceDays)
+	if err != nil || days < 0 {
+		days = DefaultObjectCleanupGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// CountObjectRefs 统计引用云端对象的文件记录和历史版本数，回收站中的文件也计入
+func CountObjectRefs(t *gorm.DB, object StoredObject) (int64, error) {
+	var files, versions int64
+	if err := t.Model(&File{}).Where("file_uuid = ? and file_path = ? and file_postfix = ?",
+		object.FileUuid, object.FilePath, object.FilePostfix).Count(&files).Error; err != nil {
+		return 0, err
+	}
+	if err := t.Model(&FileVersion{}).Where("file_uuid = ? and file_path = ? and file_postfix = ?",
+		object.FileUuid, object.FilePath, object.FilePostfix).Count(&versions).Error; err != nil {
+		return 0, err
+	}
+	return files + versions, nil
+}
+
+// ReleaseObjects 在删除文件记录或历史版本后调用，把不再被引用的云端对象登记为待清理，
+// 已登记的对象重新计算宽限期。须与删除记录在同一事务中调用
+func ReleaseObjects(t *gorm.DB, objects []StoredObject) error {
+	pending := make(map[string]StoredObject, len(objects))
+	for _, object := range objects {
+		if object.FileUuid != "" {
+			pending[object.Key()] = object
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// 按对象名分批查询仍有引用的对象
+	fileUuids := make([]string, 0, len(pending))
+	for _, object := range pending {
+		fileUuids = append(fileUuids, object.FileUuid)
+	}
+	for start := 0; start < len(fileUuids); start += 500 {
+		chunk := fileUuids[start:min(start+500, len(fileUuids))]
+		var referenced []StoredObject
+		if err := t.Model(&File{}).Select("file_path", "file_uuid", "file_postfix").
+			Where("file_uuid in ?", chunk).Find(&referenced).Error; err != nil {
+			return err
+		}
+		var versions []StoredObject
+		if err := t.Model(&FileVersion{}).Select("file_path", "file_uuid", "file_postfix").
+			Where("file_uuid in ?", chunk).Find(&versions).Error; err != nil {
+			return err
+		}
+		for _, object := range append(referenced, versions...) {
+			delete(pending, object.Key())
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	cleanups := make([]ObjectCleanup, 0, len(pending))
+	for key, object := range pending {
+		cleanups = append(cleanups, ObjectCleanup{
+			ObjectKey:   key,
+			FilePath:    object.FilePath,
+			FileUuid:    object.FileUuid,
+			FilePostfix: object.FilePostfix,
+			Size:        object.Size,
+			Status:      ObjectCleanupPending,
+			ReleasedAt:  now,
+			CleanAt:     now.Add(ObjectCleanupGrace()),
+		})
+	}
+	return t.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "object_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"size", "status", "released_at", "clean_at", "updated_at"}),
+	}).CreateInBatches(cleanups, 200).Error
+}
+
+// DueObjectCleanups 返回宽限期已结束、等待提交到清理队列的对象
+func DueObjectCleanups(t *gorm.DB, now time.Time, limit int) ([]ObjectCleanup, error) {
+	var cleanups []ObjectCleanup
+	err := t.Where("status = ? and clean_at <= ?", ObjectCleanupPending, now).
+		Order("clean_at").Limit(limit).Find(&cleanups).Error
+	return cleanups, err
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 对账任务状态
+const (
+	ReconcileJobPending = "pending" // 等待执行
+	ReconcileJobRunning = "running" // 正在列举云端对象和核对记录
+	ReconcileJobDone    = "done"    // 对账完成
+	ReconcileJobFailed  = "failed"  // 对账失败
+)
+
+// 对账任务的修复模式
+const (
+	ReconcileRepairNone   = "none"           // 只报告问题
+	ReconcileRepairOrphan = "delete_orphans" // 删除孤立对象
+	ReconcileRepairMark   = "mark_failed"    // 将对象缺失或大小不符的文件记录标记为失败状态
+	ReconcileRepairAll    = "all"            // 删除孤立对象并标记文件记录
+)
+
+// 对账发现的问题类型
+const (
+	ReconcileOrphan       = "orphan"        // 云端对象没有被任何文件记录或历史版本引用
+	ReconcileMissing      = "missing"       // 文件记录或历史版本引用的云端对象不存在
+	ReconcileSizeMismatch = "size_mismatch" // 云端对象大小与记录不符
+)
+
+// 对账问题涉及的记录类型
+const (
+	ReconcileRecordFile    = "file"
+	ReconcileRecordVersion = "file_version"
+)
+
+// ReconcileJob 存储桶与数据库的对账任务，列举 user/ 下的所有对象并与文件记录和历史版本核对
+type ReconcileJob struct {
+	Uuid           string `gorm:"primarykey"`
+	Repair         string `gorm:"size:16;not null"` // 修复模式
+	Status         string `gorm:"size:16;not null"`
+	ScannedObjects int64  // 已列举的云端对象数
+	ScannedRecords int64  // 已核对的文件记录和历史版本数
+	Orphans        int64  // 孤立对象数
+	Missing        int64  // 对象缺失的记录数
+	SizeMismatches int64  // 大小不符的记录数
+	Repaired       int64  // 已修复的问题数
+	Error          string // 失败原因
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// ReconcileIssue 对账任务发现的一个问题
+type ReconcileIssue struct {
+	Uuid       string `gorm:"primarykey"`
+	JobId      string `gorm:"not null;index"`
+	Kind       string `gorm:"size:16;not null"`
+	ObjectKey  string // 云端对象的完整键
+	RecordType string `gorm:"size:16"` // 孤立对象为空
+	RecordId   string // 文件ID或历史版本ID，孤立对象为空
+	ObjectSize int64  // 云端对象大小，对象缺失时为0
+	RecordSize int64  // 记录中的大小，孤立对象为0
+	Repaired   int    `gorm:"default:0"` // 是否已修复
+	CreatedAt  time.Time
+}
+
+// BeforeCreate 在插入数据库前创建uuid
+func (job *ReconcileJob) BeforeCreate(tx *gorm.DB) (err error) {
+	if job.Uuid == "" {
+		job.Uuid = uuid.New().String()
+	}
+	return
+}
+
+// BeforeCreate 在插入数据库前创建uuid
+func (issue *ReconcileIssue) BeforeCreate(tx *gorm.DB) (err error) {
+	if issue.Uuid == "" {
+		issue.Uuid = uuid.New().String()
+	}
+	return
+}
+
+// Finished 任务是否已结束
+func (job *ReconcileJob) Finished() bool {
+	return job.Status == ReconcileJobDone || job.Status == ReconcileJobFailed
+}
+
+// DeleteOrphans 是否删除孤立对象
+func (job *ReconcileJob) DeleteOrphans() bool {
+	return job.Repair == ReconcileRepairOrphan || job.Repair == ReconcileRepairAll
+}
+
+// MarkFailed 是否将对象缺失或大小不符的文件记录标记为失败状态
+func (job *ReconcileJob) MarkFailed() bool {
+	return job.Repair == ReconcileRepairMark || job.Repair == ReconcileRepairAll
+}
+
+// ParseObjectKey 从 user/文件路径/对象名.后缀 形式的键解析云端对象，没有扩展名的文件对象名不带后缀，
+// 键不符合格式时返回false
+func ParseObjectKey(key string) (StoredObject, bool) {
+	rest, ok := strings.CutPrefix(key, "user/")
+	if !ok {
+		return StoredObject{}, false
+	}
+	slash := strings.LastIndex(rest, "/")
+	if slash <= 0 {
+		return StoredObject{}, false
+	}
+	fileUuid, postfix, _ := strings.Cut(rest[slash+1:], ".")
+	if fileUuid == "" {
+		return StoredObject{}, false
+	}
+	return StoredObject{FilePath: rest[:slash], FileUuid: fileUuid, FilePostfix: postfix}, true
+}
@@ -1,25 +1,42 @@
 package model
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// DefaultRecycleBinDays 回收站中文件的默认保留天数
+const DefaultRecycleBinDays = 30
+
+// 回收站条目类型
+const (
+	RecycleBinItemFile       = "file"        // 单个文件
+	RecycleBinItemFileFolder = "file_folder" // 文件夹及其整个子树
+)
+
+// ErrRecycleBinFileMissing 回收站记录对应的文件或文件夹已不存在
+var ErrRecycleBinFileMissing = errors.New("recycle bin file missing")
+
 // RecycleBin 回收站模型
 type RecycleBin struct {
-	ID               string    `gorm:"primarykey" json:"id"`
-	UserID           string    `gorm:"not null;index" json:"user_id"`      // 用户ID
-	FileID           string    `gorm:"not null;index" json:"file_id"`      // 文件ID
-	OriginalFileName string    `gorm:"not null" json:"original_file_name"` // 原始文件名
-	OriginalPath     string    `gorm:"not null" json:"original_path"`      // 原始路径
-	Size             int64     `gorm:"not null" json:"size"`               // 文件大小
-	DeletedAt        time.Time `gorm:"not null;index" json:"deleted_at"`   // 删除时间
-	ExpireAt         time.Time `gorm:"not null;index" json:"expire_at"`    // 过期时间
-	IsRestored       int       `gorm:"default:0" json:"is_restored"`       // 是否已恢复
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               string `gorm:"primarykey" json:"id"`
+	UserID           string `gorm:"not null;index" json:"user_id"`                    // 用户ID
+	ItemType         string `gorm:"size:16;not null;default:'file'" json:"item_type"` // 条目类型：file 或 file_folder
+	FileID           string `gorm:"not null;index" json:"file_id"`                    // 文件ID，文件夹条目为文件夹ID
+	OriginalFileName string `gorm:"not null" json:"original_file_name"`               // 原始文件名或文件夹名
+	OriginalPath     string `gorm:"not null" json:"original_path"`                    // 原始路径
+	// 删除时所在文件夹从主目录开始的路径，例如 /main/reports，原文件夹不存在时按此路径重建
+	OriginalFolderPath string    `json:"original_folder_path"`
+	Size               int64     `gorm:"not null" json:"size"`             // 文件大小，文件夹条目为整个子树的大小
+	DeletedAt          time.Time `gorm:"not null;index" json:"deleted_at"` // 删除时间
+	ExpireAt           time.Time `gorm:"not null;index" json:"expire_at"`  // 过期时间
+	IsRestored         int       `gorm:"default:0" json:"is_restored"`     // 是否已恢复
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
 }
 
 // RecycleBinConfig 回收站配置模型
@@ -49,3 +66,258 @@ func (rbc *RecycleBinConfig) BeforeCreate(tx *gorm.DB) (err error) {
 	}
 	return
 }
+
+// TrashFile 将文件移到回收站：清空文件所有者并创建回收站记录，folderPath为文件所在文件夹从主目录开始的路径。
+// 不修改文件夹大小和用户存储空间，由调用方汇总后统一更新
+func TrashFile(t *gorm.DB, file File, folderPath string, now time.Time) (RecycleBin, error) {
+	recycleBin := RecycleBin{
+		ID:                 uuid.New().String(),
+		UserID:             file.Owner,
+		ItemType:           RecycleBinItemFile,
+		FileID:             file.Uuid,
+		OriginalFileName:   file.DisplayName(),
+		OriginalPath:       file.ParentFolderId,
+		OriginalFolderPath: folderPath,
+		Size:               file.Size,
+		DeletedAt:          now,
+		ExpireAt:           now.AddDate(0, 0, DefaultRecycleBinDays),
+	}
+	if err := t.Model(&file).Updates(map[string]interface{}{
+		"is_deleted":     1,
+		"owner":          "", // 清空所有者信息
+		"recycle_bin_id": recycleBin.ID,
+	}).Error; err != nil {
+		return RecycleBin{}, err
+	}
+	if err := t.Create(&recycleBin).Error; err != nil {
+		return RecycleBin{}, err
+	}
+	return recycleBin, nil
+}
+
+// TrashFileFolder 将文件夹及其整个子树作为一个条目移到回收站：子树中的文件夹和文件清空所有者并记录条目ID，
+// 已在回收站中的文件和子文件夹保留各自的条目。folderPath为父文件夹从主目录开始的路径。
+// 不修改文件夹大小和用户存储空间，由调用方按fileFolder.Size统一更新
+func TrashFileFolder(t *gorm.DB, fileFolder FileFolder, folderPath string, now time.Time) (RecycleBin, error) {
+	recycleBin := RecycleBin{
+		ID:                 uuid.New().String(),
+		UserID:             fileFolder.OwnerID,
+		ItemType:           RecycleBinItemFileFolder,
+		FileID:             fileFolder.Uuid,
+		OriginalFileName:   fileFolder.FileFolderName,
+		OriginalPath:       fileFolder.ParentFolderID,
+		OriginalFolderPath: folderPath,
+		Size:               fileFolder.Size,
+		DeletedAt:          now,
+		ExpireAt:           now.AddDate(0, 0, DefaultRecycleBinDays),
+	}
+
+	// 先处理文件，子查询依赖文件夹的所有者尚未清空
+	subtree := SubtreeFileFolders(t, fileFolder).Where("owner_id = ?", fileFolder.OwnerID).Select("uuid")
+	if err := t.Model(&File{}).Where("parent_folder_id in (?) and owner = ?", subtree, fileFolder.OwnerID).
+		Updates(map[string]interface{}{
+			"is_deleted":     1,
+			"owner":          "",
+			"recycle_bin_id": recycleBin.ID,
+		}).Error; err != nil {
+		return RecycleBin{}, err
+	}
+	if err := SubtreeFileFolders(t, fileFolder).Where("owner_id = ?", fileFolder.OwnerID).
+		Updates(map[string]interface{}{
+			"owner_id":       "",
+			"recycle_bin_id": recycleBin.ID,
+		}).Error; err != nil {
+		return RecycleBin{}, err
+	}
+	if err := t.Create(&recycleBin).Error; err != nil {
+		return RecycleBin{}, err
+	}
+	return recycleBin, nil
+}
+
+// RestoreRecycleBinFile 将回收站中的文件恢复到原文件夹，原文件夹已不存在时在root下按删除时的路径重建，
+// 目标文件夹中已有同名文件时自动重命名。不修改文件夹大小和用户存储空间，由调用方汇总后统一更新
+func RestoreRecycleBinFile(t *gorm.DB, recycleBin RecycleBin, root FileFolder) (File, error) {
+	var file File
+	if err := t.Where("uuid = ? and owner = ''", recycleBin.FileID).Limit(1).Find(&file).Error; err != nil {
+		return File{}, err
+	}
+	if file.Uuid == "" {
+		return File{}, ErrRecycleBinFileMissing
+	}
+
+	parent, err := restoreTarget(t, recycleBin, root)
+	if err != nil {
+		return File{}, err
+	}
+	file.ParentFolderId = parent.Uuid
+	file.Owner = recycleBin.UserID
+	file.IsDeleted = 0
+	file.RecycleBinId = ""
+	if _, err := ResolveFileName(t, &file, ConflictRename); err != nil {
+		return File{}, err
+	}
+
+	if err := t.Save(&file).Error; err != nil {
+		return File{}, err
+	}
+	if err := t.Model(&recycleBin).Update("is_restored", 1).Error; err != nil {
+		return File{}, err
+	}
+	return file, nil
+}
+
+// RestoreRecycleBinFileFolder 将回收站中的文件夹及其整个子树恢复到原文件夹，原文件夹已不存在时在root下按删除时的路径重建，
+// 同名时自动重命名，并更新子树的物化路径。不修改文件夹大小和用户存储空间，由调用方按返回文件夹的Size统一更新
+func RestoreRecycleBinFileFolder(t *gorm.DB, recycleBin RecycleBin, root FileFolder) (FileFolder, error) {
+	var fileFolder FileFolder
+	if err := t.Where("uuid = ? and recycle_bin_id = ?", recycleBin.FileID, recycleBin.ID).Limit(1).Find(&fileFolder).Error; err != nil {
+		return FileFolder{}, err
+	}
+	if fileFolder.Uuid == "" {
+		return FileFolder{}, ErrRecycleBinFileMissing
+	}
+
+	parent, err := restoreTarget(t, recycleBin, root)
+	if err != nil {
+		return FileFolder{}, err
+	}
+	oldPath := fileFolder.TreePath
+	newPath := parent.TreePath + fileFolder.Uuid + "/"
+	var maxSlashes int
+	if err := t.Model(&FileFolder{}).Where("recycle_bin_id = ?", recycleBin.ID).
+		Select("COALESCE(MAX(LENGTH(tree_path) - LENGTH(REPLACE(tree_path, '/', ''))), 0)").Scan(&maxSlashes).Error; err != nil {
+		return FileFolder{}, err
+	}
+	if parent.Depth()+1+maxSlashes-strings.Count(oldPath, "/") > MaxFileFolderDepth {
+		return FileFolder{}, ErrFileFolderTooDeep
+	}
+
+	fileFolder.ParentFolderID = parent.Uuid
+	fileFolder.OwnerID = recycleBin.UserID
+	if _, err := ResolveFileFolderName(t, &fileFolder, ConflictRename); err != nil {
+		return FileFolder{}, err
+	}
+
+	if err := t.Model(&FileFolder{}).Where("uuid = ?", fileFolder.Uuid).Updates(map[string]interface{}{
+		"parent_folder_id": fileFolder.ParentFolderID,
+		"file_folder_name": fileFolder.FileFolderName,
+	}).Error; err != nil {
+		return FileFolder{}, err
+	}
+	if err := t.Model(&FileFolder{}).Where("recycle_bin_id = ?", recycleBin.ID).Updates(map[string]interface{}{
+		"owner_id":       recycleBin.UserID,
+		"recycle_bin_id": "",
+		"tree_path":      gorm.Expr("CONCAT(?, SUBSTR(tree_path, ?))", newPath, len(oldPath)+1),
+	}).Error; err != nil {
+		return FileFolder{}, err
+	}
+	if err := t.Model(&File{}).Where("recycle_bin_id = ?", recycleBin.ID).Updates(map[string]interface{}{
+		"is_deleted":     0,
+		"owner":          recycleBin.UserID,
+		"recycle_bin_id": "",
+	}).Error; err != nil {
+		return FileFolder{}, err
+	}
+	if err := t.Model(&recycleBin).Update("is_restored", 1).Error; err != nil {
+		return FileFolder{}, err
+	}
+	fileFolder.TreePath = newPath
+	fileFolder.RecycleBinId = ""
+	return fileFolder, nil
+}
+
+// restoreTarget 返回恢复条目的目标文件夹：原文件夹仍存在时直接使用，
+// 否则从root开始按删除时记录的路径逐级查找同名文件夹，不存在的文件夹重新创建
+func restoreTarget(t *gorm.DB, recycleBin RecycleBin, root FileFolder) (FileFolder, error) {
+	var parent FileFolder
+	if err := t.Where("uuid = ? and owner_id = ?", recycleBin.OriginalPath, recycleBin.UserID).Limit(1).Find(&parent).Error; err != nil {
+		return FileFolder{}, err
+	}
+	if parent.Uuid != "" {
+		return parent, nil
+	}
+
+	// 路径的第一段是主目录
+	names := strings.Split(strings.Trim(recycleBin.OriginalFolderPath, "/"), "/")
+	parent = root
+	for _, name := range names[1:] {
+		if name == "" {
+			continue
+		}
+		var child FileFolder
+		if err := t.Where("parent_folder_id = ? and file_folder_name = ? and owner_id = ?", parent.Uuid, name, root.OwnerID).
+			Limit(1).Find(&child).Error; err != nil {
+			return FileFolder{}, err
+		}
+		if child.Uuid == "" {
+			child = FileFolder{
+				FileFolderName: name,
+				ParentFolderID: parent.Uuid,
+				FileStoreID:    root.FileStoreID,
+				OwnerID:        root.OwnerID,
+			}
+			// 同名位置已有文件时重命名重建的文件夹
+			if _, err := ResolveFileFolderName(t, &child, ConflictRename); err != nil {
+				return FileFolder{}, err
+			}
+			if err := t.Create(&child).Error; err != nil {
+				return FileFolder{}, err
+			}
+		}
+		parent = child
+	}
+	return parent, nil
+}
+
+// PurgeRecycleBins 彻底删除用户的回收站条目及其中的文件、文件夹记录和文件的历史版本，不再被引用的云端对象登记为待清理。
+// 条目中的文件和文件夹在移入回收站时已从存储空间中扣除，这里只扣除历史版本释放的空间
+func PurgeRecycleBins(t *gorm.DB, userId string, recycleBins []RecycleBin) error {
+	if len(recycleBins) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(recycleBins))
+	var trashedFileIds []string
+	for _, recycleBin := range recycleBins {
+		ids = append(ids, recycleBin.ID)
+		if recycleBin.ItemType != RecycleBinItemFileFolder {
+			trashedFileIds = append(trashedFileIds, recycleBin.FileID)
+		}
+	}
+
+	// 单个文件条目按文件ID查找，兼容没有记录条目ID的旧数据
+	var files []File
+	if err := t.Where("owner = '' and (recycle_bin_id in ? or uuid in ?)", ids, trashedFileIds).
+		Find(&files).Error; err != nil {
+		return err
+	}
+	fileIds := make([]string, 0, len(files))
+	objects := make([]StoredObject, 0, len(files))
+	for _, file := range files {
+		fileIds = append(fileIds, file.Uuid)
+		objects = append(objects, file.Object())
+	}
+	freed, err := DeleteFilesVersions(t, fileIds)
+	if err != nil {
+		return err
+	}
+	if len(fileIds) > 0 {
+		if err := t.Where("uuid in ?", fileIds).Delete(&File{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := ReleaseObjects(t, objects); err != nil {
+		return err
+	}
+	if err := t.Where("recycle_bin_id in ? and owner_id = ''", ids).Delete(&FileFolder{}).Error; err != nil {
+		return err
+	}
+	if err := t.Where("id in ?", ids).Delete(&RecycleBin{}).Error; err != nil {
+		return err
+	}
+	if freed == 0 {
+		return nil
+	}
+	return t.Model(&FileStore{}).Where("owner_id = ?", userId).
+		Update("current_size", gorm.Expr("GREATEST(current_size - ?, 0)", freed)).Error
+}
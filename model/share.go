@@ -2,16 +2,19 @@ package model
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 
 	"go-cloud-disk/cache"
-	"go-cloud-disk/disk"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrShareFileDeleted 分享的文件已被删除
+var ErrShareFileDeleted = errors.New("分享的文件已被删除")
+
 type Share struct {
 	Uuid        string `gorm:"primarykey"`
 	Owner       string
@@ -46,18 +49,19 @@ func (file *Share) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
-// DownloadURL 获取分享下载链接
-func (share *Share) DownloadURL() (string, error) {
+// SharedFile 获取分享的文件，文件已删除时返回ErrShareFileDeleted，尚未就绪或处理失败时返回ErrFileNotAvailable
+func (share *Share) SharedFile() (File, error) {
 	var file File
 	if err := DB.Where("uuid = ?", share.FileId).Find(&file).Error; err != nil {
-		return "", fmt.Errorf("构建下载链接时查找用户文件失败 %v", err)
+		return File{}, fmt.Errorf("查找分享的文件失败 %v", err)
 	}
-
-	url, err := disk.BaseCloudDisk.GetObjectURL(file.FilePath, "", file.FileUuid+"."+file.FilePostfix)
-	if err != nil {
-		return "", fmt.Errorf("获取分享下载链接时获取对象URL失败，%v", err)
+	if file.Uuid == "" {
+		return File{}, ErrShareFileDeleted
+	}
+	if !file.Available() {
+		return file, ErrFileNotAvailable
 	}
-	return url, nil
+	return file, nil
 }
 
 // ViewCount 从Redis获取分享查看次数
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SizeDiff 记录的大小与重新计算的大小不符的文件夹或存储空间
+type SizeDiff struct {
+	Id       string // 文件夹ID或存储空间ID
+	Name     string // 文件夹名称，存储空间为空
+	Recorded int64  // 记录的大小
+	Actual   int64  // 重新计算的大小
+}
+
+// SizeCheck 用户文件夹大小和存储空间已用大小的检查结果
+type SizeCheck struct {
+	UserId      string
+	Folders     int        // 检查的文件夹数
+	FolderDiffs []SizeDiff // 大小不符的文件夹
+	StoreDiff   *SizeDiff  // 存储空间已用大小不符时非空
+	Repaired    bool       // 是否已修正不符的记录
+}
+
+// Consistent 文件夹大小和存储空间已用大小是否都与重新计算的结果一致
+func (check *SizeCheck) Consistent() bool {
+	return len(check.FolderDiffs) == 0 && check.StoreDiff == nil
+}
+
+// CheckUserSizes 按用户的文件和子文件夹自底向上重新计算每个文件夹的大小，按用户的文件和历史版本
+// 重新计算存储空间已用大小，历史版本计入存储空间但不计入文件夹大小。repair为true时修正不符的记录。
+// 回收站中的文件夹和文件不计入，回收站中的文件夹保留放入回收站时的大小，不检查。
+// 须在事务中调用，锁定用户的存储空间以避免与上传、删除等修改大小的操作交错，用户没有存储空间时返回gorm.ErrRecordNotFound
+func CheckUserSizes(t *gorm.DB, userId string, repair bool) (SizeCheck, error) {
+	check := SizeCheck{UserId: userId}
+	var store FileStore
+	if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", userId).First(&store).Error; err != nil {
+		return check, err
+	}
+
+	var fileFolders []FileFolder
+	if err := t.Select("uuid", "file_folder_name", "parent_folder_id", "size").
+		Where("owner_id = ?", userId).Find(&fileFolders).Error; err != nil {
+		return check, err
+	}
+	var fileSizes []struct {
+		ParentFolderId string
+		Size           int64
+	}
+	if err := t.Model(&File{}).Select("parent_folder_id, COALESCE(SUM(size), 0) as size").
+		Where("owner = ?", userId).Group("parent_folder_id").Scan(&fileSizes).Error; err != nil {
+		return check, err
+	}
+
+	// 从父文件夹不存在的文件夹（通常为主目录）开始广度优先排序，逆序累加保证子文件夹先于父文件夹计算
+	sizes := make(map[string]int64, len(fileFolders))
+	for _, fileSize := range fileSizes {
+		sizes[fileSize.ParentFolderId] = fileSize.Size
+	}
+	byId := make(map[string]FileFolder, len(fileFolders))
+	children := make(map[string][]string)
+	for _, fileFolder := range fileFolders {
+		byId[fileFolder.Uuid] = fileFolder
+		children[fileFolder.ParentFolderID] = append(children[fileFolder.ParentFolderID], fileFolder.Uuid)
+	}
+	order := make([]string, 0, len(fileFolders))
+	for _, fileFolder := range fileFolders {
+		if _, ok := byId[fileFolder.ParentFolderID]; !ok {
+			order = append(order, fileFolder.Uuid)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		order = append(order, children[order[i]]...)
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		fileFolder := byId[order[i]]
+		if _, ok := byId[fileFolder.ParentFolderID]; ok {
+			sizes[fileFolder.ParentFolderID] += sizes[fileFolder.Uuid]
+		}
+	}
+
+	check.Folders = len(order)
+	for _, id := range order {
+		fileFolder := byId[id]
+		if fileFolder.Size != sizes[id] {
+			check.FolderDiffs = append(check.FolderDiffs, SizeDiff{
+				Id:       id,
+				Name:     fileFolder.FileFolderName,
+				Recorded: fileFolder.Size,
+				Actual:   sizes[id],
+			})
+		}
+	}
+
+	var filesSize, versionsSize int64
+	if err := t.Model(&File{}).Where("owner = ?", userId).
+		Select("COALESCE(SUM(size), 0)").Row().Scan(&filesSize); err != nil {
+		return check, err
+	}
+	if err := t.Model(&FileVersion{}).Where("owner = ?", userId).
+		Select("COALESCE(SUM(size), 0)").Row().Scan(&versionsSize); err != nil {
+		return check, err
+	}
+	if store.CurrentSize != filesSize+versionsSize {
+		check.StoreDiff = &SizeDiff{Id: store.Uuid, Recorded: store.CurrentSize, Actual: filesSize + versionsSize}
+	}
+
+	if !repair || check.Consistent() {
+		return check, nil
+	}
+	for _, diff := range check.FolderDiffs {
+		if err := t.Model(&FileFolder{}).Where("uuid = ?", diff.Id).Update("size", diff.Actual).Error; err != nil {
+			return check, err
+		}
+	}
+	if check.StoreDiff != nil {
+		if err := t.Model(&FileStore{}).Where("uuid = ?", store.Uuid).Update("current_size", check.StoreDiff.Actual).Error; err != nil {
+			return check, err
+		}
+	}
+	check.Repaired = true
+	return check, nil
+}
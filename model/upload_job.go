@@ -0,0 +1,140 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-cloud-disk/disk"
+
+	"gorm.io/gorm"
+)
+
+// 分片合并任务状态
+const (
+	UploadJobPending = "pending" // 等待提交到合并队列，合并失败等待重试时也回到此状态
+	UploadJobQueued  = "queued"  // 已提交到合并队列
+	UploadJobDone    = "done"    // 合并完成，文件已可用
+	UploadJobFailed  = "failed"  // 多次重试仍失败或校验不通过，文件标记为失败
+)
+
+const (
+	// UploadJobMaxAttempts 合并任务自动重试的最大次数，超过后文件标记为失败，用户可手动重试
+	UploadJobMaxAttempts = 5
+	// UploadJobQueueTimeout 提交到合并队列或开始执行后超过此时间仍未结束的任务视为消息丢失或执行进程已退出，
+	// 重新提交。需要大于合并并校验最大文件的耗时
+	UploadJobQueueTimeout = 30 * time.Minute
+	// uploadJobRetryDelay 合并失败后首次重试的等待时间，之后每次加倍
+	uploadJobRetryDelay = time.Minute
+)
+
+// UploadJob 完成分片上传后在云端合并分片的任务。文件记录先以pending状态创建，
+// 合并和校验在后台执行，完成后引用该对象的文件记录变为available，失败时变为failed
+type UploadJob struct {
+	Uuid          string    `gorm:"primarykey"`     // 上传任务ID，也是云端对象名
+	FileId        string    `gorm:"not null;index"` // 完成上传时创建的文件记录ID
+	Owner         string    `gorm:"not null;index"` // 上传用户
+	FilePath      string    // 云端文件的文件夹路径
+	FilePostfix   string    // 文件后缀
+	CloudUploadId string    // 云端分片上传ID
+	Parts         string    `gorm:"type:text"` // 按分片序号排序的分片列表，JSON格式
+	ExpectedHash  string    `gorm:"size:64"`   // 客户端声明的SHA-256，为空时合并后计算
+	Status        string    `gorm:"size:16;not null;index"`
+	Attempts      int       // 已执行的次数
+	RetryAt       time.Time `gorm:"index"` // 等待状态下提交到合并队列的时间
+	Error         string    // 最近一次失败的原因
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// NewUploadJob 创建合并任务，parts为按分片序号排序的分片列表
+func NewUploadJob(t *gorm.DB, file File, cloudUploadId string, parts []disk.Part, expectedHash string) (*UploadJob, error) {
+	partsJSON, err := json.Marshal(parts)
+	if err != nil {
+		return nil, err
+	}
+	job := UploadJob{
+		Uuid:          file.FileUuid,
+		FileId:        file.Uuid,
+		Owner:         file.Owner,
+		FilePath:      file.FilePath,
+		FilePostfix:   file.FilePostfix,
+		CloudUploadId: cloudUploadId,
+		Parts:         string(partsJSON),
+		ExpectedHash:  expectedHash,
+		Status:        UploadJobPending,
+		RetryAt:       time.Now(),
+	}
+	if err := t.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Object 返回合并生成的云端对象
+func (job *UploadJob) Object() StoredObject {
+	return StoredObject{FilePath: job.FilePath, FileUuid: job.Uuid, FilePostfix: job.FilePostfix}
+}
+
+// PartList 返回按分片序号排序的分片列表
+func (job *UploadJob) PartList() ([]disk.Part, error) {
+	var parts []disk.Part
+	err := json.Unmarshal([]byte(job.Parts), &parts)
+	return parts, err
+}
+
+// Finished 任务是否已结束
+func (job *UploadJob) Finished() bool {
+	return job.Status == UploadJobDone || job.Status == UploadJobFailed
+}
+
+// Retryable 合并失败后能否重新执行，校验不通过或文件已被删除的任务不能重试
+func (job *UploadJob) Retryable() bool {
+	return job.Status == UploadJobFailed && job.Error != "FileChecksumMismatch" && job.Error != "FileDeleted"
+}
+
+// ClaimUploadJob 开始执行前领取已提交的任务并增加执行次数，同一任务的重复消息只有一个能领取成功。
+// 领取时刷新更新时间，执行中的任务在超时前不会被重新提交
+func ClaimUploadJob(t *gorm.DB, job *UploadJob) (bool, error) {
+	now := time.Now()
+	result := t.Model(&UploadJob{}).Where("uuid = ? and status = ? and attempts = ?", job.Uuid, UploadJobQueued, job.Attempts).
+		Updates(map[string]interface{}{"attempts": job.Attempts + 1, "updated_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	job.Attempts++
+	job.UpdatedAt = now
+	return true, nil
+}
+
+// ScheduleRetry 合并失败后回到等待状态，等待时间随已执行次数加倍
+func (job *UploadJob) ScheduleRetry(now time.Time, reason string) {
+	job.Status = UploadJobPending
+	job.RetryAt = now.Add(uploadJobRetryDelay << max(job.Attempts-1, 0))
+	job.Error = reason
+}
+
+// SetObjectFilesStatus 更新引用云端对象且处于from状态的所有文件记录的状态，
+// 秒传、复制和转存的文件与原文件共享对象，随原文件一起变化。hash不为空时同时更新内容哈希
+func SetObjectFilesStatus(t *gorm.DB, object StoredObject, from string, to string, hash string) error {
+	updates := map[string]interface{}{"status": to}
+	if hash != "" {
+		updates["hash"] = hash
+	}
+	return t.Model(&File{}).Where("file_uuid = ? and file_path = ? and file_postfix = ? and status = ?",
+		object.FileUuid, object.FilePath, object.FilePostfix, from).Updates(updates).Error
+}
+
+// ResetStaleUploadJobs 将超过UploadJobQueueTimeout仍处于已提交状态的任务恢复为等待状态，由定时任务重新提交
+func ResetStaleUploadJobs(t *gorm.DB, now time.Time) (int64, error) {
+	result := t.Model(&UploadJob{}).Where("status = ? and updated_at < ?", UploadJobQueued, now.Add(-UploadJobQueueTimeout)).
+		Updates(map[string]interface{}{"status": UploadJobPending, "retry_at": now})
+	return result.RowsAffected, result.Error
+}
+
+// DueUploadJobs 返回等待提交到合并队列且已到重试时间的任务
+func DueUploadJobs(t *gorm.DB, now time.Time, limit int) ([]UploadJob, error) {
+	var jobs []UploadJob
+	err := t.Where("status = ? and retry_at <= ?", UploadJobPending, now).
+		Order("retry_at").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UploadReservation 分片上传的容量预留，上传初始化时预留空间，
+// 上传完成、取消或过期后释放，防止并发上传同时通过容量检查
+type UploadReservation struct {
+	Uuid      string    `gorm:"primarykey"` // 上传任务ID
+	OwnerID   string    `gorm:"index"`      // 用户ID
+	Size      int64     // 预留大小
+	ExpiresAt time.Time `gorm:"index"` // 过期时间，过期后不再占用容量
+	CreatedAt time.Time
+}
+
+// GetReservedSize 获取用户未过期的预留容量总和
+func GetReservedSize(t *gorm.DB, ownerId string) (int64, error) {
+	var reserved int64
+	err := t.Model(&UploadReservation{}).
+		Where("owner_id = ? and expires_at > ?", ownerId, time.Now()).
+		Select("COALESCE(SUM(size), 0)").Scan(&reserved).Error
+	return reserved, err
+}
+
+// ReserveUploadSize 锁定用户存储空间后检查容量并预留空间，容量不足时返回false
+func ReserveUploadSize(ownerId string, uploadId string, size int64, expiresAt time.Time) (bool, error) {
+	ok := false
+	err := DB.Transaction(func(t *gorm.DB) error {
+		var store FileStore
+		if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", ownerId).First(&store).Error; err != nil {
+			return err
+		}
+		reserved, err := GetReservedSize(t, ownerId)
+		if err != nil {
+			return err
+		}
+		if store.CurrentSize+reserved+size > store.MaxSize {
+			return nil
+		}
+		ok = true
+		return t.Create(&UploadReservation{
+			Uuid:      uploadId,
+			OwnerID:   ownerId,
+			Size:      size,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+	return ok, err
+}
+
+// ReleaseUploadReservation 释放上传任务的预留容量
+func ReleaseUploadReservation(t *gorm.DB, uploadId string) error {
+	return t.Where("uuid = ?", uploadId).Delete(&UploadReservation{}).Error
+}
+
+// CleanExpiredUploadReservations 删除已过期的预留记录
+func CleanExpiredUploadReservations() error {
+	return DB.Where("expires_at <= ?", time.Now()).Delete(&UploadReservation{}).Error
+}
@@ -12,9 +12,12 @@ import (
 var RabbitMq *amqp.Connection
 
 var (
-	RabbitMqSendEmailQueue = "send-email-queue"
-	RabbitMqAutoTagQueue   = "auto-tag-queue"
-	RabbitMqFileCleanQueue = "file-clean-queue"
+	RabbitMqSendEmailQueue  = "send-email-queue"
+	RabbitMqAutoTagQueue    = "auto-tag-queue"
+	RabbitMqFileCleanQueue  = "file-clean-queue"
+	RabbitMqFileCopyQueue   = "file-copy-queue"
+	RabbitMqReconcileQueue  = "file-reconcile-queue"
+	RabbitMqFileUploadQueue = "file-upload-queue"
 )
 
 func InitRabbitMq() {
@@ -2,6 +2,7 @@ package rabbitMQ
 
 import (
 	"context"
+	"errors"
 
 	"go-cloud-disk/utils/logger"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -9,6 +10,9 @@ import (
 
 // 发送消息到MQ
 func SendMessageToMQ(ctx context.Context, queueName string, body []byte) (err error) {
+	if RabbitMq == nil {
+		return errors.New("RabbitMQ未连接")
+	}
 	ch, err := RabbitMq.Channel()
 	if err != nil {
 		logger.Log().Error("[SendMessageToMQ] 打开通道失败: %s", err)
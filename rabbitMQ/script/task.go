@@ -27,3 +27,24 @@ func FileCleanSync(ctx context.Context) {
 		logger.Log().Error("[FileCleanSync] 文件清理服务失败: ", err)
 	}
 }
+
+func FileCopySync(ctx context.Context) {
+	err := task.RunFileCopyService(ctx)
+	if err != nil {
+		logger.Log().Error("[FileCopySync] 文件夹复制服务失败: ", err)
+	}
+}
+
+func FileReconcileSync(ctx context.Context) {
+	err := task.RunFileReconcileService(ctx)
+	if err != nil {
+		logger.Log().Error("[FileReconcileSync] 存储桶对账服务失败: ", err)
+	}
+}
+
+func FileUploadSync(ctx context.Context) {
+	err := task.RunFileUploadService(ctx)
+	if err != nil {
+		logger.Log().Error("[FileUploadSync] 分片合并服务失败: ", err)
+	}
+}
@@ -0,0 +1,275 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/rabbitMQ"
+	"go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// copyJobChunkSize 后台复制任务每个事务写入的文件记录数
+const copyJobChunkSize = 500
+
+type FileCopyRequest struct {
+	JobId string `json:"job_id"`
+}
+
+func RunFileCopyService(ctx context.Context) error {
+	msgs, err := rabbitMQ.ConsumerMessage(ctx, rabbitMQ.RabbitMqFileCopyQueue)
+	if err != nil {
+		return err
+	}
+	forever := make(chan struct{})
+
+	go func() {
+		for msg := range msgs {
+			logger.Log().Info("[RunFileCopyService] 收到消息: ", string(msg.Body))
+
+			fileCopyReq := FileCopyRequest{}
+			err = json.Unmarshal(msg.Body, &fileCopyReq)
+			if err != nil {
+				logger.Log().Error("[RunFileCopyService] 解析消息错误: ", err)
+				msg.Nack(false, false) // 拒绝消息，不重新入队
+				continue
+			}
+
+			err = processFileCopy(fileCopyReq.JobId)
+			if err != nil {
+				logger.Log().Error("[RunFileCopyService] 处理复制任务失败: ", err)
+				msg.Nack(false, true) // 拒绝消息，重新入队
+			} else {
+				msg.Ack(false) // 确认消息
+			}
+		}
+	}()
+
+	logger.Log().Info("文件夹复制服务已启动")
+	<-forever
+	return nil
+}
+
+// processFileCopy 执行后台复制任务：先在一个事务中检查容量、创建全部文件夹并计入文件夹大小和存储空间，
+// 再分批写入文件记录并更新进度。写入失败时删除已复制的内容并回退大小，任务标记为失败。
+// 返回错误时消息重新入队，任务状态保证重复执行是安全的
+func processFileCopy(jobId string) error {
+	var job model.CopyJob
+	if err := model.DB.Where("uuid = ?", jobId).Find(&job).Error; err != nil {
+		return err
+	}
+	if job.Uuid == "" || job.Finished() {
+		return nil
+	}
+
+	// 上次执行中断后消息会重新投递，先清理已复制的部分再重新开始
+	if job.Status == model.CopyJobRunning {
+		if err := cleanupFileCopy(&job); err != nil {
+			return err
+		}
+	}
+
+	plan, err := startFileCopy(&job)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return nil
+	}
+
+	for start := 0; start < len(plan.Files); start += copyJobChunkSize {
+		files := plan.Files[start:min(start+copyJobChunkSize, len(plan.Files))]
+		if err := copyFileChunk(&job, plan, files); err != nil {
+			logger.Log().Error("[processFileCopy] 写入文件记录失败: ", err)
+			if err := cleanupFileCopy(&job); err != nil {
+				return err
+			}
+			return finishFileCopy(model.DB, &job, model.CopyJobFailed, "CopyFailed")
+		}
+	}
+
+	return finishFileCopy(model.DB, &job, model.CopyJobDone, "")
+}
+
+// startFileCopy 检查任务的源文件夹、目标文件夹、同名冲突和容量，创建副本的全部文件夹，
+// 并按整个子树的大小增加目标文件夹及其祖先的大小和用户存储空间。任务无法执行时标记结束并返回nil
+func startFileCopy(job *model.CopyJob) (*model.FolderCopy, error) {
+	var plan *model.FolderCopy
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		tree, err := model.LoadFolderTree(t, job.Owner)
+		if err != nil {
+			return err
+		}
+		var store model.FileStore
+		if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", job.Owner).First(&store).Error; err != nil {
+			return err
+		}
+
+		source, ok := tree.Get(job.FileFolderId)
+		if !ok {
+			return finishFileCopy(t, job, model.CopyJobFailed, "FileFolderNotFound")
+		}
+		target, ok := tree.Get(job.TargetId)
+		if !ok {
+			return finishFileCopy(t, job, model.CopyJobFailed, "TargetNotFound")
+		}
+		if tree.IsDescendant(target.Uuid, source.Uuid) {
+			return finishFileCopy(t, job, model.CopyJobFailed, "CannotCopyIntoItself")
+		}
+
+		root := model.FileFolder{
+			FileFolderName: source.FileFolderName,
+			ParentFolderID: target.Uuid,
+			FileStoreID:    target.FileStoreID,
+			OwnerID:        job.Owner,
+		}
+		existing, err := model.ResolveFileFolderName(t, &root, job.Conflict)
+		if errors.Is(err, model.ErrNameConflict) {
+			return finishFileCopy(t, job, model.CopyJobFailed, "NameConflict")
+		}
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return finishFileCopy(t, job, model.CopyJobSkipped, "")
+		}
+
+		copyPlan, err := model.PlanFolderCopy(t, tree, source, root)
+		if errors.Is(err, model.ErrFileFolderTooDeep) {
+			return finishFileCopy(t, job, model.CopyJobFailed, "FileFolderTooDeep")
+		}
+		if err != nil {
+			return err
+		}
+		reserved, err := model.GetReservedSize(t, job.Owner)
+		if err != nil {
+			return err
+		}
+		if store.CurrentSize+reserved+copyPlan.Root.Size > store.MaxSize {
+			return finishFileCopy(t, job, model.CopyJobFailed, "ExceedStoreLimit")
+		}
+
+		if err := copyPlan.CreateFolders(t); err != nil {
+			return err
+		}
+		if err := model.AddFileFoldersSize(t, map[string]int64{target.Uuid: copyPlan.Root.Size}); err != nil {
+			return err
+		}
+		store.CurrentSize += copyPlan.Root.Size
+		if err := t.Save(&store).Error; err != nil {
+			return err
+		}
+
+		job.Status = model.CopyJobRunning
+		job.NewFileFolderId = copyPlan.Root.Uuid
+		job.TotalFiles = int64(len(copyPlan.Files))
+		job.CopiedFiles = 0
+		if err := t.Save(job).Error; err != nil {
+			return err
+		}
+		plan = copyPlan
+		return nil
+	})
+	return plan, err
+}
+
+// copyFileChunk 在一个事务中写入一批文件记录并更新任务进度，
+// 复制期间被用户删除的副本文件夹中的文件不再写入，其大小已随文件夹一起扣除
+func copyFileChunk(job *model.CopyJob, plan *model.FolderCopy, files []model.File) error {
+	return model.DB.Transaction(func(t *gorm.DB) error {
+		parentIds := make([]string, 0, len(files))
+		for _, file := range files {
+			parentIds = append(parentIds, plan.NewFileFolderId(file.ParentFolderId))
+		}
+		var existingIds []string
+		if err := t.Model(&model.FileFolder{}).Where("uuid in ?", parentIds).Pluck("uuid", &existingIds).Error; err != nil {
+			return err
+		}
+		exists := make(map[string]bool, len(existingIds))
+		for _, id := range existingIds {
+			exists[id] = true
+		}
+
+		pending := make([]model.File, 0, len(files))
+		for _, file := range files {
+			if exists[plan.NewFileFolderId(file.ParentFolderId)] {
+				pending = append(pending, file)
+			}
+		}
+		if err := plan.CreateFiles(t, pending); err != nil {
+			return err
+		}
+
+		job.CopiedFiles += int64(len(files))
+		return t.Model(&model.CopyJob{}).Where("uuid = ?", job.Uuid).Update("copied_files", job.CopiedFiles).Error
+	})
+}
+
+// cleanupFileCopy 删除任务已复制的文件夹和文件，回退开始时计入的文件夹大小和存储空间，任务回到等待状态。
+// 副本文件夹的大小包含复制期间用户上传到其中的文件，这些文件随副本一起删除，因此按副本当前大小回退
+func cleanupFileCopy(job *model.CopyJob) error {
+	return model.DB.Transaction(func(t *gorm.DB) error {
+		if job.NewFileFolderId != "" {
+			var root model.FileFolder
+			if err := t.Where("uuid = ? and owner_id = ?", job.NewFileFolderId, job.Owner).Find(&root).Error; err != nil {
+				return err
+			}
+			if root.Uuid != "" {
+				var files []model.File
+				if err := t.Where("parent_folder_id in (?) and owner = ?",
+					model.SubtreeFileFolders(t, root).Select("uuid"), job.Owner).Find(&files).Error; err != nil {
+					return err
+				}
+				fileIds := make([]string, 0, len(files))
+				objects := make([]model.StoredObject, 0, len(files))
+				for _, file := range files {
+					fileIds = append(fileIds, file.Uuid)
+					objects = append(objects, file.Object())
+				}
+				freed, err := model.DeleteFilesVersions(t, fileIds)
+				if err != nil {
+					return err
+				}
+				if len(fileIds) > 0 {
+					if err := t.Where("uuid in ?", fileIds).Delete(&model.File{}).Error; err != nil {
+						return err
+					}
+				}
+				// 副本复用原文件的云端对象，复制期间上传到副本中的文件可能不再被引用
+				if err := model.ReleaseObjects(t, objects); err != nil {
+					return err
+				}
+				if err := model.SubtreeFileFolders(t, root).Delete(&model.FileFolder{}).Error; err != nil {
+					return err
+				}
+				if err := model.AddFileFoldersSize(t, map[string]int64{root.ParentFolderID: -root.Size}); err != nil {
+					return err
+				}
+				var store model.FileStore
+				if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", job.Owner).First(&store).Error; err != nil {
+					return err
+				}
+				_ = store.SubCurrentSize(root.Size + freed)
+				if err := t.Save(&store).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		job.Status = model.CopyJobPending
+		job.NewFileFolderId = ""
+		job.CopiedFiles = 0
+		return t.Save(job).Error
+	})
+}
+
+// finishFileCopy 结束任务并记录失败原因
+func finishFileCopy(t *gorm.DB, job *model.CopyJob, status string, reason string) error {
+	job.Status = status
+	job.Error = reason
+	return t.Save(job).Error
+}
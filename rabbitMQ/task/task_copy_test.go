@@ -0,0 +1,83 @@
+package task
+
+import (
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/test"
+)
+
+func TestProcessFileCopy(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	docs := test.CreateFolder(t, root, "docs")
+	sub := test.CreateFolder(t, docs, "sub")
+	backup := test.CreateFolder(t, root, "backup")
+	test.CreateFile(t, docs, "a", 3)
+	for i := 0; i < copyJobChunkSize+1; i++ {
+		test.CreateFile(t, sub, "b", 1)
+	}
+
+	job := model.CopyJob{Owner: user.Uuid, FileFolderId: docs.Uuid, TargetId: backup.Uuid, Conflict: model.ConflictRename, Status: model.CopyJobPending}
+	if err := model.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := processFileCopy(job.Uuid); err != nil {
+		t.Fatalf("执行复制任务失败: %v", err)
+	}
+	if err := model.DB.Where("uuid = ?", job.Uuid).First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	total := int64(copyJobChunkSize + 2)
+	if job.Status != model.CopyJobDone || job.TotalFiles != total || job.CopiedFiles != total {
+		t.Fatalf("复制任务状态不符: %+v", job)
+	}
+	size := int64(copyJobChunkSize + 4)
+	if folder := test.Folder(t, job.NewFileFolderId); folder.Size != size || folder.ParentFolderID != backup.Uuid {
+		t.Fatalf("复制的文件夹不符: %+v", folder)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != 2*size {
+		t.Fatalf("存储空间已用%d，期望%d", store.CurrentSize, 2*size)
+	}
+	test.CheckSizes(t, user.Uuid)
+
+	// 已结束的任务重复投递时不再执行
+	if err := processFileCopy(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	test.CheckSizes(t, user.Uuid)
+}
+
+func TestProcessFileCopyInterrupted(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	docs := test.CreateFolder(t, root, "docs")
+	test.CreateFile(t, docs, "a", 3)
+
+	// 上次执行只创建了副本文件夹就中断，重新投递时先清理再复制
+	job := model.CopyJob{Owner: user.Uuid, FileFolderId: docs.Uuid, TargetId: root.Uuid, Conflict: model.ConflictRename, Status: model.CopyJobPending}
+	if err := model.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	plan, err := startFileCopy(&job)
+	if err != nil || plan == nil {
+		t.Fatalf("开始复制任务失败: %v", err)
+	}
+	if err := processFileCopy(job.Uuid); err != nil {
+		t.Fatalf("执行复制任务失败: %v", err)
+	}
+
+	var folders []model.FileFolder
+	if err := model.DB.Where("parent_folder_id = ?", root.Uuid).Find(&folders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 2 {
+		t.Fatalf("中断后重新执行应只保留一个副本: %+v", folders)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != 6 {
+		t.Fatalf("存储空间已用%d，期望6", store.CurrentSize)
+	}
+	test.CheckSizes(t, user.Uuid)
+}
@@ -0,0 +1,333 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/rabbitMQ"
+	"go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
+)
+
+// reconcileMinAge 最近修改的对象可能属于进行中的上传，文件记录尚未创建，对账时不视为孤立对象
+const reconcileMinAge = time.Hour
+
+type FileReconcileRequest struct {
+	JobId string `json:"job_id"`
+}
+
+func RunFileReconcileService(ctx context.Context) error {
+	msgs, err := rabbitMQ.ConsumerMessage(ctx, rabbitMQ.RabbitMqReconcileQueue)
+	if err != nil {
+		return err
+	}
+	forever := make(chan struct{})
+
+	go func() {
+		for msg := range msgs {
+			logger.Log().Info("[RunFileReconcileService] 收到消息: ", string(msg.Body))
+
+			reconcileReq := FileReconcileRequest{}
+			err = json.Unmarshal(msg.Body, &reconcileReq)
+			if err != nil {
+				logger.Log().Error("[RunFileReconcileService] 解析消息错误: ", err)
+				msg.Nack(false, false) // 拒绝消息，不重新入队
+				continue
+			}
+
+			err = processFileReconcile(reconcileReq.JobId)
+			if err != nil {
+				logger.Log().Error("[RunFileReconcileService] 处理对账任务失败: ", err)
+				msg.Nack(false, true) // 拒绝消息，重新入队
+			} else {
+				msg.Ack(false) // 确认消息
+			}
+		}
+	}()
+
+	logger.Log().Info("存储桶对账服务已启动")
+	<-forever
+	return nil
+}
+
+// processFileReconcile 执行对账任务：先分页列举云端对象，核对引用它们的记录和大小，
+// 再遍历文件记录和历史版本找出对象缺失的记录。列举或核对出错时任务标记为失败，
+// 返回错误时消息重新入队，重新执行时清除上次的结果
+func processFileReconcile(jobId string) error {
+	var job model.ReconcileJob
+	if err := model.DB.Where("uuid = ?", jobId).Find(&job).Error; err != nil {
+		return err
+	}
+	if job.Uuid == "" || job.Finished() {
+		return nil
+	}
+
+	if job.Status == model.ReconcileJobRunning {
+		if err := model.DB.Where("job_id = ?", job.Uuid).Delete(&model.ReconcileIssue{}).Error; err != nil {
+			return err
+		}
+	}
+	job.Status = model.ReconcileJobRunning
+	job.ScannedObjects, job.ScannedRecords = 0, 0
+	job.Orphans, job.Missing, job.SizeMismatches, job.Repaired = 0, 0, 0, 0
+	if err := model.DB.Save(&job).Error; err != nil {
+		return err
+	}
+
+	r := reconciler{job: &job, seen: make(map[string]struct{}), startedAt: time.Now()}
+	err := disk.BaseCloudDisk.ListObjects("user/", r.checkObjects)
+	if err == nil {
+		err = r.checkRecords()
+	}
+	if err != nil {
+		logger.Log().Error("[processFileReconcile] 对账失败: ", err)
+		job.Status = model.ReconcileJobFailed
+		job.Error = err.Error()
+		return model.DB.Save(&job).Error
+	}
+	job.Status = model.ReconcileJobDone
+	return model.DB.Save(&job).Error
+}
+
+// reconciler 一次对账的状态
+type reconciler struct {
+	job       *model.ReconcileJob
+	seen      map[string]struct{} // 已列举的对象键
+	startedAt time.Time
+}
+
+// objectRecord 引用云端对象的文件记录或历史版本
+type objectRecord struct {
+	recordType string
+	id         string
+	object     model.StoredObject
+}
+
+// checkObjects 核对一页云端对象：没有记录引用的对象为孤立对象，记录大小与对象不符时报告大小不符
+func (r *reconciler) checkObjects(objects []disk.ListedObject) error {
+	keys := make([]string, 0, len(objects))
+	fileUuids := make([]string, 0, len(objects))
+	for _, object := range objects {
+		r.seen[object.Key] = struct{}{}
+		keys = append(keys, object.Key)
+		if stored, ok := model.ParseObjectKey(object.Key); ok {
+			fileUuids = append(fileUuids, stored.FileUuid)
+		}
+	}
+
+	records, err := loadObjectRecords(fileUuids)
+	if err != nil {
+		return err
+	}
+	// 等待清理的对象由对象清理任务删除，不重复报告
+	var scheduled []string
+	if err := model.DB.Model(&model.ObjectCleanup{}).
+		Where("object_key in ? and status in ?", keys, []string{model.ObjectCleanupPending, model.ObjectCleanupQueued}).
+		Pluck("object_key", &scheduled).Error; err != nil {
+		return err
+	}
+	isScheduled := make(map[string]bool, len(scheduled))
+	for _, key := range scheduled {
+		isScheduled[key] = true
+	}
+
+	var issues []model.ReconcileIssue
+	for _, object := range objects {
+		refs := records[object.Key]
+		if len(refs) == 0 {
+			if isScheduled[object.Key] || object.LastModified.After(r.startedAt.Add(-reconcileMinAge)) {
+				continue
+			}
+			issue := model.ReconcileIssue{
+				JobId:      r.job.Uuid,
+				Kind:       model.ReconcileOrphan,
+				ObjectKey:  object.Key,
+				ObjectSize: object.Size,
+			}
+			if r.job.DeleteOrphans() {
+				repaired, err := deleteOrphan(object.Key)
+				if err != nil {
+					return err
+				}
+				if repaired {
+					issue.Repaired = 1
+					r.job.Repaired++
+				}
+			}
+			r.job.Orphans++
+			issues = append(issues, issue)
+			continue
+		}
+		for _, record := range refs {
+			if record.object.Size == object.Size {
+				continue
+			}
+			issue := model.ReconcileIssue{
+				JobId:      r.job.Uuid,
+				Kind:       model.ReconcileSizeMismatch,
+				ObjectKey:  object.Key,
+				RecordType: record.recordType,
+				RecordId:   record.id,
+				ObjectSize: object.Size,
+				RecordSize: record.object.Size,
+			}
+			if err := r.markFailed(&issue); err != nil {
+				return err
+			}
+			r.job.SizeMismatches++
+			issues = append(issues, issue)
+		}
+	}
+
+	r.job.ScannedObjects += int64(len(objects))
+	return r.save(issues)
+}
+
+// checkRecords 分批遍历文件记录和历史版本，列举时不存在且再次检查仍不存在的对象报告为缺失，
+// 等待后台合并分片的文件还没有云端对象，不检查
+func (r *reconciler) checkRecords() error {
+	var files []model.File
+	err := model.DB.Select("uuid", "file_path", "file_uuid", "file_postfix", "size").
+		Where("status <> ?", model.FileStatusPending).
+		FindInBatches(&files, 1000, func(tx *gorm.DB, batch int) error {
+			records := make([]objectRecord, 0, len(files))
+			for _, file := range files {
+				records = append(records, objectRecord{recordType: model.ReconcileRecordFile, id: file.Uuid, object: file.Object()})
+			}
+			return r.checkMissing(records)
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	var versions []model.FileVersion
+	return model.DB.Select("uuid", "file_path", "file_uuid", "file_postfix", "size").
+		FindInBatches(&versions, 1000, func(tx *gorm.DB, batch int) error {
+			records := make([]objectRecord, 0, len(versions))
+			for _, version := range versions {
+				records = append(records, objectRecord{recordType: model.ReconcileRecordVersion, id: version.Uuid, object: version.Object()})
+			}
+			return r.checkMissing(records)
+		}).Error
+}
+
+// checkMissing 核对一批记录引用的对象是否存在
+func (r *reconciler) checkMissing(records []objectRecord) error {
+	var issues []model.ReconcileIssue
+	exists := make(map[string]bool)
+	for _, record := range records {
+		key := record.object.Key()
+		if _, ok := r.seen[key]; ok {
+			continue
+		}
+		// 列举之后才上传完成的对象不在列举结果中，再次检查避免误报
+		exist, checked := exists[key]
+		if !checked {
+			var err error
+			exist, err = disk.BaseCloudDisk.IsObjectExist(record.object.FilePath, "", record.object.Name())
+			if err != nil {
+				return err
+			}
+			exists[key] = exist
+		}
+		if exist {
+			continue
+		}
+		issue := model.ReconcileIssue{
+			JobId:      r.job.Uuid,
+			Kind:       model.ReconcileMissing,
+			ObjectKey:  key,
+			RecordType: record.recordType,
+			RecordId:   record.id,
+			RecordSize: record.object.Size,
+		}
+		if err := r.markFailed(&issue); err != nil {
+			return err
+		}
+		r.job.Missing++
+		issues = append(issues, issue)
+	}
+
+	r.job.ScannedRecords += int64(len(records))
+	return r.save(issues)
+}
+
+// markFailed 修复模式包含标记时，把对象缺失或大小不符的可用文件标记为失败状态，之后不能下载和分享，
+// 已失败和等待后台处理的文件不修改，历史版本只报告
+func (r *reconciler) markFailed(issue *model.ReconcileIssue) error {
+	if !r.job.MarkFailed() || issue.RecordType != model.ReconcileRecordFile {
+		return nil
+	}
+	result := model.DB.Model(&model.File{}).Where("uuid = ? and status = ?", issue.RecordId, model.FileStatusAvailable).
+		Update("status", model.FileStatusFailed)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	issue.Repaired = 1
+	r.job.Repaired++
+	return nil
+}
+
+// save 保存本批发现的问题并更新任务进度
+func (r *reconciler) save(issues []model.ReconcileIssue) error {
+	return model.DB.Transaction(func(t *gorm.DB) error {
+		if len(issues) > 0 {
+			if err := t.CreateInBatches(issues, 200).Error; err != nil {
+				return err
+			}
+		}
+		return t.Save(r.job).Error
+	})
+}
+
+// loadObjectRecords 查询引用这些对象名的文件记录和历史版本，按对象键分组
+func loadObjectRecords(fileUuids []string) (map[string][]objectRecord, error) {
+	records := make(map[string][]objectRecord)
+	if len(fileUuids) == 0 {
+		return records, nil
+	}
+	var files []model.File
+	if err := model.DB.Select("uuid", "file_path", "file_uuid", "file_postfix", "size").
+		Where("file_uuid in ?", fileUuids).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		object := file.Object()
+		records[object.Key()] = append(records[object.Key()], objectRecord{recordType: model.ReconcileRecordFile, id: file.Uuid, object: object})
+	}
+	var versions []model.FileVersion
+	if err := model.DB.Select("uuid", "file_path", "file_uuid", "file_postfix", "size").
+		Where("file_uuid in ?", fileUuids).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		object := version.Object()
+		records[object.Key()] = append(records[object.Key()], objectRecord{recordType: model.ReconcileRecordVersion, id: version.Uuid, object: object})
+	}
+	return records, nil
+}
+
+// deleteOrphan 删除前再次确认对象仍没有被引用，返回是否已删除。
+// 无法解析出文件记录的键无法确认引用，只报告不删除
+func deleteOrphan(key string) (bool, error) {
+	object, ok := model.ParseObjectKey(key)
+	if !ok || object.Key() != key {
+		logger.Log().Warning("[deleteOrphan] 无法解析对象键，跳过删除: Key=%s", key)
+		return false, nil
+	}
+	refs, err := model.CountObjectRefs(model.DB, object)
+	if err != nil || refs > 0 {
+		return false, err
+	}
+	if err := disk.BaseCloudDisk.DeleteObject(object.FilePath, "", []string{object.Name()}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,130 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/test"
+	"go-cloud-disk/utils"
+
+	"github.com/google/uuid"
+)
+
+func TestProcessFileReconcileMarkFailed(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+
+	// 对象完好、对象缺失、大小不符、等待合并的文件各一个
+	newFile := func(status string, size int64) model.File {
+		file := model.File{
+			Owner:          user.Uuid,
+			FileName:       uuid.NewString(),
+			FilePostfix:    "txt",
+			FileUuid:       uuid.NewString(),
+			FilePath:       user.Uuid,
+			ParentFolderId: user.UserMainFileFolderID,
+			Size:           size,
+			Status:         status,
+		}
+		if err := model.DB.Create(&file).Error; err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	healthy := newFile(model.FileStatusAvailable, 4)
+	mem.PutObject(healthy.Object().Key(), []byte("data"))
+	missing := newFile(model.FileStatusAvailable, 4)
+	mismatch := newFile(model.FileStatusAvailable, 10)
+	mem.PutObject(mismatch.Object().Key(), []byte("data"))
+	pending := newFile(model.FileStatusPending, 4)
+
+	job := model.ReconcileJob{Repair: model.ReconcileRepairMark, Status: model.ReconcileJobPending}
+	if err := model.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := processFileReconcile(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded model.ReconcileJob
+	if err := model.DB.Where("uuid = ?", job.Uuid).First(&loaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Status != model.ReconcileJobDone || loaded.Missing != 1 || loaded.SizeMismatches != 1 || loaded.Repaired != 2 {
+		t.Fatalf("对账结果不符: %+v", loaded)
+	}
+	for _, file := range []model.File{missing, mismatch} {
+		if loaded := loadFile(t, file.Uuid); loaded.Status != model.FileStatusFailed {
+			t.Fatalf("对象缺失或大小不符的文件应标记为失败: %+v", loaded)
+		}
+	}
+	if loaded := loadFile(t, healthy.Uuid); !loaded.Available() {
+		t.Fatalf("对象完好的文件不应修改: %+v", loaded)
+	}
+	if loaded := loadFile(t, pending.Uuid); loaded.Status != model.FileStatusPending {
+		t.Fatalf("等待合并的文件不应修改: %+v", loaded)
+	}
+}
+
+func TestProcessFileReconcileExtensionless(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+
+	// 没有扩展名的文件对象名不带点号，对账时应识别为被引用的对象
+	localPath := filepath.Join(t.TempDir(), "Makefile")
+	data := []byte("all: build")
+	if err := os.WriteFile(localPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	md5 := utils.GetBytesMD5(data)
+	if err := mem.UploadSimpleFile(localPath, user.Uuid, md5, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	live := model.File{
+		Owner:          user.Uuid,
+		FileName:       "Makefile",
+		FileUuid:       md5,
+		FilePath:       user.Uuid,
+		ParentFolderId: user.UserMainFileFolderID,
+		Size:           int64(len(data)),
+		Status:         model.FileStatusAvailable,
+	}
+	if err := model.DB.Create(&live).Error; err != nil {
+		t.Fatal(err)
+	}
+	orphanKey := "user/" + user.Uuid + "/" + uuid.NewString()
+	mem.PutObject(orphanKey, []byte("orphan"))
+	// 无法解析的键无法确认引用，只报告不删除
+	strayKey := "user/" + user.Uuid + "/.stray"
+	mem.PutObject(strayKey, []byte("stray"))
+
+	job := model.ReconcileJob{Repair: model.ReconcileRepairAll, Status: model.ReconcileJobPending}
+	if err := model.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := processFileReconcile(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded model.ReconcileJob
+	if err := model.DB.Where("uuid = ?", job.Uuid).First(&loaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Status != model.ReconcileJobDone || loaded.Missing != 0 || loaded.Orphans != 2 || loaded.Repaired != 1 {
+		t.Fatalf("对账结果不符: %+v", loaded)
+	}
+	if _, ok := mem.Object(live.Object().Key()); !ok {
+		t.Fatalf("被引用的对象不应删除: %v", mem.Keys())
+	}
+	if loaded := loadFile(t, live.Uuid); !loaded.Available() {
+		t.Fatalf("对象完好的文件不应修改: %+v", loaded)
+	}
+	if _, ok := mem.Object(orphanKey); ok {
+		t.Fatalf("孤立对象应被删除: %v", mem.Keys())
+	}
+	if _, ok := mem.Object(strayKey); !ok {
+		t.Fatalf("无法解析的对象不应删除: %v", mem.Keys())
+	}
+}
@@ -33,7 +33,7 @@ type AutoTagRequest struct {
 }
 
 type FileCleanRequest struct {
-	FileUuid  string `json:"file_uuid"`
+	CleanupId string `json:"cleanup_id"` // 待清理云端对象的记录ID
 	CleanTime int64  `json:"clean_time"` // Unix时间戳
 }
 
@@ -112,7 +112,7 @@ func processAutoTag(fileID, userID string) error {
 	}
 
 	// 生成预签名下载URL
-	downLoadURL, err := disk.BaseCloudDisk.GetDownloadURL(file.FilePath, file.FileUuid)
+	downLoadURL, err := file.DownloadURL(time.Hour)
 	if err != nil {
 		logger.Log().Error("[processAutoTag] 生成预签名下载URL失败: ", err)
 		return err
@@ -261,7 +261,7 @@ func RunFileCleanService(ctx context.Context) error {
 				continue
 			}
 
-			err = processFileClean(fileCleanReq.FileUuid)
+			err = processFileClean(fileCleanReq.CleanupId)
 			if err != nil {
 				logger.Log().Error("[RunFileCleanService] 处理文件清理失败: ", err)
 				msg.Nack(false, false) // 拒绝消息，不重新入队
@@ -276,38 +276,101 @@ func RunFileCleanService(ctx context.Context) error {
 	return nil
 }
 
-// processFileClean物理文件删除
-func processFileClean(fileUuid string) error {
-	// 再次检查文件引用计数
-	var file model.File
-	// if err := model.DB.Select("ref_count, file_path, is_deleted").Where("file_uuid = ?", fileUuid).First(&file).Error; err != nil {
-	// 	if err == gorm.ErrRecordNotFound {
-	// 		logger.Log().Info(fmt.Sprintf("[processFileClean] 文件已不存在: FileUuid=%s", fileUuid))
-	// 		return nil // 文件已不存在，认为成功
-	// 	}
-	// 	return fmt.Errorf("查询文件失败: %v", err)
-	// }
-
-	// // 如果引用计数大于0或文件未被删除，跳过清理
-	// if file.RefCount > 0 || file.IsDeleted == 0 {
-	// 	logger.Log().Info(fmt.Sprintf("[processFileClean] 文件仍有引用或未删除，跳过清理: FileUuid=%s, RefCount=%d, IsDeleted=%v",
-	// 		fileUuid, file.RefCount, file.IsDeleted))
-	// 	return nil
-	// }
-
-	// 从云存储删除物理文件
-	if err := disk.BaseCloudDisk.DeleteObject("", file.FilePath, []string{fileUuid}); err != nil {
-		logger.Log().Error(fmt.Sprintf("[processFileClean] 从云存储删除文件失败: FileUuid=%s, FilePath=%s, Error=%v",
-			fileUuid, file.FilePath, err))
-		return fmt.Errorf("从云存储删除文件失败: %v", err)
+// processFileClean 删除宽限期已结束的云端对象。删除前重新统计引用数，
+// 宽限期内重新被引用或对象在不再被引用后被重新上传时保留对象
+func processFileClean(cleanupId string) error {
+	var cleanup model.ObjectCleanup
+	if err := model.DB.Where("uuid = ?", cleanupId).Find(&cleanup).Error; err != nil {
+		return fmt.Errorf("查询待清理对象失败: %v", err)
+	}
+	if cleanup.Uuid == "" || cleanup.Status != model.ObjectCleanupQueued {
+		return nil
+	}
+	if !model.ObjectCleanupEnabled() {
+		// 提交后关闭了清理，对象回到等待状态
+		return model.DB.Model(&cleanup).Update("status", model.ObjectCleanupPending).Error
+	}
+
+	if err := cleanObject(cleanup); err != nil {
+		// 消息不重新入队，对象回到等待状态，由定时任务重新提交
+		if err := model.DB.Model(&cleanup).Update("status", model.ObjectCleanupPending).Error; err != nil {
+			logger.Log().Error("[processFileClean] 恢复待清理对象状态失败: ", err)
+		}
+		return err
+	}
+	logger.Log().Info(fmt.Sprintf("[processFileClean] 云端对象清理完成: Key=%s", cleanup.ObjectKey))
+	return nil
+}
+
+// cleanObject 重新统计引用数后删除云端对象，并更新清理状态
+func cleanObject(cleanup model.ObjectCleanup) error {
+	object := cleanup.Object()
+	refs, err := model.CountObjectRefs(model.DB, object)
+	if err != nil {
+		return fmt.Errorf("统计对象引用数失败: %v", err)
+	}
+	if refs > 0 {
+		logger.Log().Info(fmt.Sprintf("[cleanObject] 对象重新被引用，跳过清理: Key=%s, Refs=%d", cleanup.ObjectKey, refs))
+		return model.DB.Model(&cleanup).Update("status", model.ObjectCleanupKept).Error
 	}
 
-	// 从数据库删除文件记录
-	if err := model.DB.Where("file_uuid = ?", fileUuid).Delete(&model.File{}).Error; err != nil {
-		logger.Log().Error(fmt.Sprintf("[processFileClean] 从数据库删除文件记录失败: FileUuid=%s, Error=%v", fileUuid, err))
-		return fmt.Errorf("从数据库删除文件记录失败: %v", err)
+	exist, err := disk.BaseCloudDisk.IsObjectExist(object.FilePath, "", object.Name())
+	if err != nil {
+		return fmt.Errorf("检查云端对象失败: %v", err)
+	}
+	if exist {
+		info, err := disk.BaseCloudDisk.StatObject(object.FilePath, "", object.Name())
+		if err != nil {
+			return fmt.Errorf("获取云端对象信息失败: %v", err)
+		}
+		// 相同内容的文件会写入同一对象，不再被引用后被重新上传的对象由新的文件记录引用
+		if info.LastModified.After(cleanup.ReleasedAt) {
+			logger.Log().Info(fmt.Sprintf("[cleanObject] 对象已被重新上传，跳过清理: Key=%s", cleanup.ObjectKey))
+			return model.DB.Model(&cleanup).Update("status", model.ObjectCleanupKept).Error
+		}
+		if err := disk.BaseCloudDisk.DeleteObject(object.FilePath, "", []string{object.Name()}); err != nil {
+			logger.Log().Error(fmt.Sprintf("[cleanObject] 从云存储删除文件失败: Key=%s, Error=%v", cleanup.ObjectKey, err))
+			return fmt.Errorf("从云存储删除文件失败: %v", err)
+		}
 	}
 
-	logger.Log().Info(fmt.Sprintf("[processFileClean] 文件物理删除完成: FileUuid=%s", fileUuid))
+	if err := model.DB.Model(&cleanup).Update("status", model.ObjectCleanupDeleted).Error; err != nil {
+		return fmt.Errorf("更新待清理对象状态失败: %v", err)
+	}
 	return nil
 }
+
+// EnqueueDueObjectCleanups 把宽限期已结束的云端对象提交到清理队列，未开启清理时不提交
+func EnqueueDueObjectCleanups() error {
+	if !model.ObjectCleanupEnabled() {
+		return nil
+	}
+	for {
+		cleanups, err := model.DueObjectCleanups(model.DB, time.Now(), 500)
+		if err != nil {
+			return err
+		}
+		if len(cleanups) == 0 {
+			return nil
+		}
+		for _, cleanup := range cleanups {
+			body, err := json.Marshal(FileCleanRequest{CleanupId: cleanup.Uuid, CleanTime: cleanup.CleanAt.Unix()})
+			if err != nil {
+				return err
+			}
+			// 先更新状态再提交，提交失败时回到等待状态，避免同一对象重复提交
+			if err := model.DB.Model(&cleanup).Update("status", model.ObjectCleanupQueued).Error; err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+			err = rabbitMQ.SendMessageToMQ(ctx, rabbitMQ.RabbitMqFileCleanQueue, body)
+			cancel()
+			if err != nil {
+				if err := model.DB.Model(&cleanup).Update("status", model.ObjectCleanupPending).Error; err != nil {
+					logger.Log().Error("[EnqueueDueObjectCleanups] 恢复待清理对象状态失败: ", err)
+				}
+				return err
+			}
+		}
+	}
+}
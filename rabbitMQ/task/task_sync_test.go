@@ -0,0 +1,146 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-cloud-disk/conf"
+	"go-cloud-disk/model"
+	"go-cloud-disk/test"
+	"go-cloud-disk/utils"
+)
+
+func TestProcessFileCleanExtensionless(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	enable := conf.ObjectGCEnable
+	conf.ObjectGCEnable = "true"
+	t.Cleanup(func() { conf.ObjectGCEnable = enable })
+
+	// 没有扩展名的文件上传后对象名不带点号
+	localPath := filepath.Join(t.TempDir(), "Makefile")
+	data := []byte("all: build")
+	if err := os.WriteFile(localPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	md5 := utils.GetBytesMD5(data)
+	if err := mem.UploadSimpleFile(localPath, user.Uuid, md5, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	fileName, postfix := utils.SplitFilename("Makefile")
+	file := model.File{
+		Owner:          user.Uuid,
+		FileName:       fileName,
+		FilePostfix:    postfix,
+		FileUuid:       md5,
+		FilePath:       user.Uuid,
+		ParentFolderId: user.UserMainFileFolderID,
+		Size:           int64(len(data)),
+		Status:         model.FileStatusAvailable,
+	}
+	key := file.Object().Key()
+	if _, ok := mem.Object(key); !ok {
+		t.Fatalf("对象键与上传的对象不一致: %s, %v", key, mem.Keys())
+	}
+
+	// 文件不再被引用后登记的清理对象能删除上传的对象
+	if err := model.ReleaseObjects(model.DB, []model.StoredObject{file.Object()}); err != nil {
+		t.Fatal(err)
+	}
+	var cleanup model.ObjectCleanup
+	if err := model.DB.Where("object_key = ?", key).Take(&cleanup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Model(&cleanup).Update("status", model.ObjectCleanupQueued).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := processFileClean(cleanup.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mem.Object(key); ok {
+		t.Fatalf("不再被引用的对象应被删除: %v", mem.Keys())
+	}
+	if err := model.DB.Where("uuid = ?", cleanup.Uuid).Take(&cleanup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cleanup.Status != model.ObjectCleanupDeleted {
+		t.Fatalf("清理状态不符: %+v", cleanup)
+	}
+}
+
+func TestObjectCleanupGracePeriod(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	enable, grace := conf.ObjectGCEnable, conf.ObjectGCGraceDays
+	conf.ObjectGCEnable, conf.ObjectGCGraceDays = "true", "1"
+	t.Cleanup(func() { conf.ObjectGCEnable, conf.ObjectGCGraceDays = enable, grace })
+
+	root := test.Folder(t, user.UserMainFileFolderID)
+	file := test.CreateFile(t, root, "report", 6)
+	copied := test.CreateFile(t, root, "copy", 6)
+	if err := model.DB.Model(&copied).Update("file_uuid", file.FileUuid).Error; err != nil {
+		t.Fatal(err)
+	}
+	mem.PutObject(file.Object().Key(), []byte("report"))
+
+	// 仍有其他文件记录引用时不登记清理
+	if err := model.DB.Delete(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.ReleaseObjects(model.DB, []model.StoredObject{file.Object()}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := model.DB.Model(&model.ObjectCleanup{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("仍被引用的对象不应登记清理，已登记%d个", count)
+	}
+
+	// 最后一个引用删除后登记清理，宽限期内不提交
+	if err := model.DB.Delete(&copied).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.ReleaseObjects(model.DB, []model.StoredObject{file.Object()}); err != nil {
+		t.Fatal(err)
+	}
+	due, err := model.DueObjectCleanups(model.DB, time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("宽限期内的对象不应提交清理: %+v", due)
+	}
+	due, err = model.DueObjectCleanups(model.DB, time.Now().Add(25*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("宽限期结束后应提交清理: %+v", due)
+	}
+
+	// 宽限期内重新被引用时保留对象
+	restored := model.File{Owner: user.Uuid, FileName: "report", FilePostfix: file.FilePostfix, FileUuid: file.FileUuid, FilePath: file.FilePath, ParentFolderId: root.Uuid}
+	if err := model.DB.Create(&restored).Error; err != nil {
+		t.Fatal(err)
+	}
+	cleanup := due[0]
+	if err := model.DB.Model(&cleanup).Update("status", model.ObjectCleanupQueued).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := processFileClean(cleanup.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mem.Object(file.Object().Key()); !ok {
+		t.Fatalf("重新被引用的对象不应删除: %v", mem.Keys())
+	}
+	if err := model.DB.Where("uuid = ?", cleanup.Uuid).Take(&cleanup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cleanup.Status != model.ObjectCleanupKept {
+		t.Fatalf("清理状态不符: %+v", cleanup)
+	}
+}
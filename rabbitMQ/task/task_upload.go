@@ -0,0 +1,224 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/rabbitMQ"
+	"go-cloud-disk/utils"
+	"go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
+)
+
+type FileUploadRequest struct {
+	JobId string `json:"job_id"`
+}
+
+func RunFileUploadService(ctx context.Context) error {
+	msgs, err := rabbitMQ.ConsumerMessage(ctx, rabbitMQ.RabbitMqFileUploadQueue)
+	if err != nil {
+		return err
+	}
+	forever := make(chan struct{})
+
+	go func() {
+		for msg := range msgs {
+			logger.Log().Info("[RunFileUploadService] 收到消息: ", string(msg.Body))
+
+			fileUploadReq := FileUploadRequest{}
+			err = json.Unmarshal(msg.Body, &fileUploadReq)
+			if err != nil {
+				logger.Log().Error("[RunFileUploadService] 解析消息错误: ", err)
+				msg.Nack(false, false) // 拒绝消息，不重新入队
+				continue
+			}
+
+			err = processFileUpload(fileUploadReq.JobId)
+			if err != nil {
+				logger.Log().Error("[RunFileUploadService] 处理分片合并任务失败: ", err)
+				msg.Nack(false, true) // 拒绝消息，重新入队
+			} else {
+				msg.Ack(false) // 确认消息
+			}
+		}
+	}()
+
+	logger.Log().Info("分片合并服务已启动")
+	<-forever
+	return nil
+}
+
+// processFileUpload 执行分片合并任务：在云端合并分片、计算并校验内容哈希，完成后文件变为可用。
+// 合并失败时任务回到等待状态，由定时任务按退避时间重新提交，超过最大次数或校验不通过时文件标记为失败。
+// 只在更新任务状态失败时返回错误，消息重新入队
+func processFileUpload(jobId string) error {
+	var job model.UploadJob
+	if err := model.DB.Where("uuid = ?", jobId).Find(&job).Error; err != nil {
+		return err
+	}
+	if job.Uuid == "" || job.Status != model.UploadJobQueued {
+		return nil
+	}
+	// 重复投递的消息只执行一次
+	if claimed, err := model.ClaimUploadJob(model.DB, &job); err != nil || !claimed {
+		return err
+	}
+
+	hash, reason, err := mergeUpload(&job)
+	switch {
+	case reason != "":
+		return failUpload(&job, reason)
+	case err != nil:
+		logger.Log().Error(fmt.Sprintf("[processFileUpload] 第%d次合并分片失败: JobId=%s, 错误: %v", job.Attempts, job.Uuid, err))
+		if job.Attempts >= model.UploadJobMaxAttempts {
+			return failUpload(&job, "MergeFailed")
+		}
+		job.ScheduleRetry(time.Now(), "MergeFailed")
+		return model.DB.Save(&job).Error
+	}
+	return finishUpload(&job, hash)
+}
+
+// mergeUpload 在云端合并分片并计算内容哈希。上次执行合并成功但未能更新状态时对象已存在，不重复合并。
+// 任务无法继续执行时返回失败原因：合并前文件已被删除或内容哈希与客户端声明的不一致
+func mergeUpload(job *model.UploadJob) (hash string, reason string, err error) {
+	object := job.Object()
+	refs, err := model.CountObjectRefs(model.DB, object)
+	if err != nil {
+		return "", "", err
+	}
+	if refs == 0 {
+		if err := disk.BaseCloudDisk.AbortMultipartUpload(job.FilePath, "", object.Name(), job.CloudUploadId); err != nil {
+			logger.Log().Error("[mergeUpload] 取消云端分片上传失败: ", err)
+		}
+		return "", "FileDeleted", nil
+	}
+
+	exist, err := disk.BaseCloudDisk.IsObjectExist(job.FilePath, "", object.Name())
+	if err != nil {
+		return "", "", fmt.Errorf("检查云端对象失败: %v", err)
+	}
+	if !exist {
+		parts, err := job.PartList()
+		if err != nil {
+			return "", "", fmt.Errorf("解析分片列表失败: %v", err)
+		}
+		if err := disk.BaseCloudDisk.CompleteMultipartUpload(job.FilePath, "", object.Name(), job.CloudUploadId, parts); err != nil {
+			return "", "", fmt.Errorf("合并云端分片失败: %v", err)
+		}
+	}
+
+	// 分片可能乱序到达，无法边传边算整体哈希，合并后读取云端对象计算，供校验和秒传使用
+	hash, err = objectSHA256(object)
+	if err != nil {
+		if job.ExpectedHash != "" {
+			return "", "", fmt.Errorf("计算文件哈希失败: %v", err)
+		}
+		// 未声明哈希时内容哈希只用于秒传，计算失败不影响文件可用
+		logger.Log().Error("[mergeUpload] 计算文件哈希失败: ", err)
+		return "", "", nil
+	}
+	if job.ExpectedHash != "" && hash != job.ExpectedHash {
+		if err := disk.BaseCloudDisk.DeleteObject(job.FilePath, "", []string{object.Name()}); err != nil {
+			logger.Log().Error("[mergeUpload] 删除校验失败的云端对象失败: ", err)
+		}
+		return "", "FileChecksumMismatch", nil
+	}
+	return hash, "", nil
+}
+
+// finishUpload 将引用合并对象的等待中文件标记为可用并结束任务。合并期间文件可能已被删除，
+// 此时对象重新登记为待清理，不再被引用的对象按宽限期清理
+func finishUpload(job *model.UploadJob, hash string) error {
+	return model.DB.Transaction(func(t *gorm.DB) error {
+		object := job.Object()
+		if err := model.SetObjectFilesStatus(t, object, model.FileStatusPending, model.FileStatusAvailable, hash); err != nil {
+			return err
+		}
+		if err := model.ReleaseObjects(t, []model.StoredObject{object}); err != nil {
+			return err
+		}
+		job.Status = model.UploadJobDone
+		job.Error = ""
+		return t.Save(job).Error
+	})
+}
+
+// failUpload 将引用合并对象的等待中文件标记为失败并结束任务
+func failUpload(job *model.UploadJob, reason string) error {
+	logger.Log().Error(fmt.Sprintf("[failUpload] 分片合并任务失败: JobId=%s, 原因: %s", job.Uuid, reason))
+	return model.DB.Transaction(func(t *gorm.DB) error {
+		if err := model.SetObjectFilesStatus(t, job.Object(), model.FileStatusPending, model.FileStatusFailed, ""); err != nil {
+			return err
+		}
+		job.Status = model.UploadJobFailed
+		job.Error = reason
+		return t.Save(job).Error
+	})
+}
+
+// objectSHA256 读取云端对象并计算内容的SHA-256
+func objectSHA256(object model.StoredObject) (string, error) {
+	reader, err := disk.BaseCloudDisk.GetObject(object.FilePath, "", object.Name())
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	return utils.GetReaderSHA256(reader)
+}
+
+// EnqueueUploadJob 提交分片合并任务到合并队列。先更新状态再提交，避免同一任务重复提交，
+// 提交失败时任务回到等待状态，由定时任务重新提交
+func EnqueueUploadJob(job *model.UploadJob) error {
+	body, err := json.Marshal(FileUploadRequest{JobId: job.Uuid})
+	if err != nil {
+		return err
+	}
+	result := model.DB.Model(&model.UploadJob{}).Where("uuid = ? and status = ?", job.Uuid, model.UploadJobPending).
+		Update("status", model.UploadJobQueued)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	job.Status = model.UploadJobQueued
+
+	// 限制1秒超时
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	defer cancel()
+	if err := rabbitMQ.SendMessageToMQ(ctx, rabbitMQ.RabbitMqFileUploadQueue, body); err != nil {
+		if err := model.DB.Model(&model.UploadJob{}).Where("uuid = ?", job.Uuid).Update("status", model.UploadJobPending).Error; err != nil {
+			logger.Log().Error("[EnqueueUploadJob] 恢复分片合并任务状态失败: ", err)
+		}
+		job.Status = model.UploadJobPending
+		return err
+	}
+	return nil
+}
+
+// EnqueueDueUploadJobs 提交等待中且已到重试时间的分片合并任务，包括完成上传时未能提交的任务，
+// 以及提交后超时仍未结束、消息可能已丢失的任务
+func EnqueueDueUploadJobs() error {
+	if count, err := model.ResetStaleUploadJobs(model.DB, time.Now()); err != nil {
+		return err
+	} else if count > 0 {
+		logger.Log().Info(fmt.Sprintf("[EnqueueDueUploadJobs] 重新提交%d个超时的分片合并任务", count))
+	}
+	for {
+		jobs, err := model.DueUploadJobs(model.DB, time.Now(), 500)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+		for i := range jobs {
+			if err := EnqueueUploadJob(&jobs[i]); err != nil {
+				return err
+			}
+		}
+	}
+}
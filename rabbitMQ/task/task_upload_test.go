@@ -0,0 +1,215 @@
+package task
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/test"
+
+	"github.com/google/uuid"
+)
+
+// queueUploadJob 上传一个分片并创建已提交到合并队列的合并任务，返回等待中的文件记录和任务
+func queueUploadJob(t *testing.T, mem *disk.MemoryCloudDisk, user model.User, data []byte, expectedHash string) (model.File, *model.UploadJob) {
+	t.Helper()
+	file := model.File{
+		Owner:          user.Uuid,
+		FileName:       "notes",
+		FilePostfix:    "txt",
+		FileUuid:       uuid.NewString(),
+		FilePath:       user.Uuid,
+		ParentFolderId: user.UserMainFileFolderID,
+		Size:           int64(len(data)),
+		Status:         model.FileStatusPending,
+	}
+	if err := model.DB.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	object := file.Object()
+	uploadId, err := mem.InitMultipartUpload(user.Uuid, "", object.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.UploadPart(user.Uuid, "", object.Name(), uploadId, 1, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(data)
+	job, err := model.NewUploadJob(model.DB, file, uploadId, []disk.Part{{PartNumber: 1, ETag: hex.EncodeToString(sum[:])}}, expectedHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Model(job).Update("status", model.UploadJobQueued).Error; err != nil {
+		t.Fatal(err)
+	}
+	return file, job
+}
+
+func loadUploadJob(t *testing.T, jobId string) model.UploadJob {
+	t.Helper()
+	var job model.UploadJob
+	if err := model.DB.Where("uuid = ?", jobId).First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func loadFile(t *testing.T, fileId string) model.File {
+	t.Helper()
+	var file model.File
+	if err := model.DB.Where("uuid = ?", fileId).First(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestProcessFileUpload(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("chunked content")
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	file, job := queueUploadJob(t, mem, user, data, hash)
+	if err := processFileUpload(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	if job := loadUploadJob(t, job.Uuid); job.Status != model.UploadJobDone || job.Attempts != 1 {
+		t.Fatalf("合并任务应完成: %+v", job)
+	}
+	if file := loadFile(t, file.Uuid); !file.Available() || file.Hash != hash {
+		t.Fatalf("合并后文件应可用并记录内容哈希: %+v", file)
+	}
+	if object, ok := mem.Object(file.Object().Key()); !ok || !bytes.Equal(object, data) {
+		t.Fatalf("云端对象内容为%q，期望%q", object, data)
+	}
+
+	// 重复投递的消息不重复执行
+	if err := processFileUpload(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	if count := mem.CallCount("CompleteMultipartUpload"); count != 1 {
+		t.Fatalf("合并了%d次分片，期望1次", count)
+	}
+}
+
+func TestProcessFileUploadChecksumMismatch(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	file, job := queueUploadJob(t, mem, user, []byte("chunked content"), "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+
+	if err := processFileUpload(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadUploadJob(t, job.Uuid)
+	if loaded.Status != model.UploadJobFailed || loaded.Error != "FileChecksumMismatch" || loaded.Retryable() {
+		t.Fatalf("校验不通过的任务应失败且不能重试: %+v", loaded)
+	}
+	if file := loadFile(t, file.Uuid); file.Status != model.FileStatusFailed {
+		t.Fatalf("校验不通过的文件应标记为失败: %+v", file)
+	}
+	if _, ok := mem.Object(file.Object().Key()); ok {
+		t.Fatal("校验不通过的云端对象应删除")
+	}
+}
+
+func TestProcessFileUploadDeleted(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	file, job := queueUploadJob(t, mem, user, []byte("chunked content"), "")
+	if err := model.DB.Delete(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := processFileUpload(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadUploadJob(t, job.Uuid); loaded.Status != model.UploadJobFailed || loaded.Error != "FileDeleted" {
+		t.Fatalf("文件已删除的任务应失败: %+v", loaded)
+	}
+	if mem.CallCount("CompleteMultipartUpload") != 0 || mem.UploadCount() != 0 {
+		t.Fatal("文件已删除时应取消云端分片上传而不合并")
+	}
+}
+
+func TestProcessFileUploadRetry(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	file, job := queueUploadJob(t, mem, user, []byte("chunked content"), "")
+	mem.FailOn("CompleteMultipartUpload", errors.New("cloud unavailable"))
+
+	// 合并失败时回到等待状态，等待时间随次数加倍，超过最大次数后标记为失败
+	for attempt := 1; attempt <= model.UploadJobMaxAttempts; attempt++ {
+		if err := processFileUpload(job.Uuid); err != nil {
+			t.Fatal(err)
+		}
+		loaded := loadUploadJob(t, job.Uuid)
+		if loaded.Attempts != attempt || loaded.Error != "MergeFailed" {
+			t.Fatalf("第%d次合并后任务不符: %+v", attempt, loaded)
+		}
+		if attempt < model.UploadJobMaxAttempts {
+			if loaded.Status != model.UploadJobPending || !loaded.RetryAt.After(loaded.UpdatedAt) {
+				t.Fatalf("第%d次合并失败后应等待重试: %+v", attempt, loaded)
+			}
+			if err := model.DB.Model(&loaded).Update("status", model.UploadJobQueued).Error; err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if loaded.Status != model.UploadJobFailed || !loaded.Retryable() {
+			t.Fatalf("超过最大次数后任务应失败且可以手动重试: %+v", loaded)
+		}
+	}
+	if file := loadFile(t, file.Uuid); file.Status != model.FileStatusFailed {
+		t.Fatalf("超过最大次数后文件应标记为失败: %+v", file)
+	}
+}
+
+func TestProcessFileUploadClaim(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	_, job := queueUploadJob(t, mem, user, []byte("chunked content"), "")
+
+	// 另一条消息已领取任务时不再执行
+	stale := *job
+	if claimed, err := model.ClaimUploadJob(model.DB, job); err != nil || !claimed {
+		t.Fatalf("领取任务失败: %v", err)
+	}
+	if claimed, err := model.ClaimUploadJob(model.DB, &stale); err != nil || claimed {
+		t.Fatalf("重复消息不应领取成功: %v", err)
+	}
+	if err := processFileUpload(job.Uuid); err != nil {
+		t.Fatal(err)
+	}
+	if count := mem.CallCount("CompleteMultipartUpload"); count != 1 {
+		t.Fatalf("合并了%d次分片，期望1次", count)
+	}
+}
+
+func TestEnqueueDueUploadJobsResetsStale(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	_, stale := queueUploadJob(t, mem, user, []byte("stale content"), "")
+	_, fresh := queueUploadJob(t, mem, user, []byte("fresh content"), "")
+	expired := time.Now().Add(-model.UploadJobQueueTimeout - time.Minute)
+	if err := model.DB.Model(stale).UpdateColumn("updated_at", expired).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 测试中没有连接RabbitMQ，超时的任务恢复为等待状态后提交失败，仍保持等待状态
+	if err := EnqueueDueUploadJobs(); err == nil {
+		t.Fatal("没有连接RabbitMQ时提交应失败")
+	}
+	if loaded := loadUploadJob(t, stale.Uuid); loaded.Status != model.UploadJobPending {
+		t.Fatalf("超时的任务应恢复为等待状态: %+v", loaded)
+	}
+	if loaded := loadUploadJob(t, fresh.Uuid); loaded.Status != model.UploadJobQueued {
+		t.Fatalf("未超时的任务不应修改: %+v", loaded)
+	}
+}
@@ -0,0 +1,37 @@
+package serializer
+
+import (
+	"time"
+
+	"go-cloud-disk/model"
+)
+
+// CopyJob 后台复制任务序列化器
+type CopyJob struct {
+	Uuid            string    `json:"job_id"`
+	FileFolderId    string    `json:"filefolder_id"`
+	TargetId        string    `json:"target"`
+	Status          string    `json:"status"`
+	NewFileFolderId string    `json:"new_filefolder_id,omitempty"`
+	TotalFiles      int64     `json:"total_files"`
+	CopiedFiles     int64     `json:"copied_files"`
+	Error           string    `json:"error,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// BuildCopyJob 构建后台复制任务序列化器
+func BuildCopyJob(job model.CopyJob) CopyJob {
+	return CopyJob{
+		Uuid:            job.Uuid,
+		FileFolderId:    job.FileFolderId,
+		TargetId:        job.TargetId,
+		Status:          job.Status,
+		NewFileFolderId: job.NewFileFolderId,
+		TotalFiles:      job.TotalFiles,
+		CopiedFiles:     job.CopiedFiles,
+		Error:           job.Error,
+		CreatedAt:       job.CreatedAt,
+		UpdatedAt:       job.UpdatedAt,
+	}
+}
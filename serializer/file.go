@@ -8,6 +8,7 @@ type File struct {
 	FileName string `json:"filename"`
 	FileType string `json:"filetype"`
 	Size     int64  `json:"size"`
+	Status   string `json:"status"` // pending: 后台处理中，available: 可用，failed: 处理失败，可重试或重新上传
 }
 
 func BuildFile(file model.File) File {
@@ -16,6 +17,7 @@ func BuildFile(file model.File) File {
 		FileName: file.FileName,
 		FileType: file.FilePostfix,
 		Size:     file.Size,
+		Status:   file.Status,
 	}
 }
 
@@ -1,17 +1,41 @@
 package serializer
 
-import "go-cloud-disk/model"
+import (
+	"go-cloud-disk/model"
+	"go-cloud-disk/utils/throttle"
+)
 
 // FileStore 文件存储序列化器
 type FileStore struct {
-	MaxSize     int64 `json:"maxsize"`     // 最大存储空间
-	CurrentSize int64 `json:"currentsize"` // 当前已使用空间
+	MaxSize      int64    `json:"maxsize"`      // 最大存储空间
+	CurrentSize  int64    `json:"currentsize"`  // 当前已使用空间
+	ReservedSize int64    `json:"reservedsize"` // 进行中的上传预留的空间
+	Transfer     Transfer `json:"transfer"`     // 传输限制和当日流量
+}
+
+// Transfer 传输限制序列化器，限制为0表示不限制
+type Transfer struct {
+	Rate       int64 `json:"rate"`       // 每秒传输字节数
+	DailyQuota int64 `json:"dailyquota"` // 每日上传、下载各自的流量限制
+	Downloaded int64 `json:"downloaded"` // 当日已下载字节数
+	Uploaded   int64 `json:"uploaded"`   // 当日已上传字节数
 }
 
 // BuildFileStore 构建文件存储序列化器
-func BuildFileStore(fileStore model.FileStore) FileStore {
+func BuildFileStore(fileStore model.FileStore, reservedSize int64) FileStore {
 	return FileStore{
-		MaxSize:     fileStore.MaxSize,
-		CurrentSize: fileStore.CurrentSize,
+		MaxSize:      fileStore.MaxSize,
+		CurrentSize:  fileStore.CurrentSize,
+		ReservedSize: reservedSize,
+	}
+}
+
+// BuildTransfer 构建传输限制序列化器
+func BuildTransfer(limit throttle.Limit, usage throttle.Usage) Transfer {
+	return Transfer{
+		Rate:       limit.Rate,
+		DailyQuota: limit.DailyQuota,
+		Downloaded: usage.Downloaded,
+		Uploaded:   usage.Uploaded,
 	}
 }
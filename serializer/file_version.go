@@ -0,0 +1,38 @@
+package serializer
+
+import (
+	"time"
+
+	"go-cloud-disk/model"
+)
+
+// FileVersion 文件历史版本序列化器
+type FileVersion struct {
+	Uuid      string    `json:"version_id"`
+	FileId    string    `json:"file_id"`
+	FileType  string    `json:"filetype"`
+	Size      int64     `json:"size"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BuildFileVersion 构建文件历史版本序列化器
+func BuildFileVersion(version model.FileVersion) FileVersion {
+	return FileVersion{
+		Uuid:      version.Uuid,
+		FileId:    version.FileId,
+		FileType:  version.FilePostfix,
+		Size:      version.Size,
+		Hash:      version.Hash,
+		CreatedAt: version.CreatedAt,
+	}
+}
+
+// BuildFileVersions 构建文件历史版本列表序列化器
+func BuildFileVersions(versions []model.FileVersion) []FileVersion {
+	fileVersions := make([]FileVersion, 0, len(versions))
+	for _, version := range versions {
+		fileVersions = append(fileVersions, BuildFileVersion(version))
+	}
+	return fileVersions
+}
@@ -0,0 +1,52 @@
+package serializer
+
+import (
+	"time"
+
+	"go-cloud-disk/model"
+)
+
+// ObjectCleanupReport 云端对象清理报告序列化器，未开启清理时用于预先检查将被删除的对象
+type ObjectCleanupReport struct {
+	Enabled     bool                  `json:"enabled"`      // 是否已开启清理
+	GraceDays   int64                 `json:"grace_days"`   // 对象不再被引用后保留的天数
+	Statuses    []ObjectCleanupStatus `json:"statuses"`     // 各状态的对象数和总大小
+	DueCount    int64                 `json:"due_count"`    // 宽限期已结束的对象数
+	DueSize     int64                 `json:"due_size"`     // 宽限期已结束的对象总大小
+	DeleteCount int64                 `json:"delete_count"` // 列出的对象中将被删除的对象数
+	DeleteSize  int64                 `json:"delete_size"`  // 列出的对象中将被删除的对象总大小
+	Items       []ObjectCleanupItem   `json:"items"`        // 宽限期已结束的对象
+}
+
+// ObjectCleanupStatus 某一清理状态的对象统计
+type ObjectCleanupStatus struct {
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+	Size   int64  `json:"size"`
+}
+
+// ObjectCleanupItem 待清理的云端对象，Action为清理时的处理结果：delete或keep
+type ObjectCleanupItem struct {
+	ObjectKey  string    `json:"object_key"`
+	Size       int64     `json:"size"`
+	Refs       int64     `json:"refs"` // 当前引用数
+	Action     string    `json:"action"`
+	ReleasedAt time.Time `json:"released_at"`
+	CleanAt    time.Time `json:"clean_at"`
+}
+
+// BuildObjectCleanupItem 构建待清理对象序列化器
+func BuildObjectCleanupItem(cleanup model.ObjectCleanup, refs int64) ObjectCleanupItem {
+	action := "delete"
+	if refs > 0 {
+		action = "keep"
+	}
+	return ObjectCleanupItem{
+		ObjectKey:  cleanup.ObjectKey,
+		Size:       cleanup.Size,
+		Refs:       refs,
+		Action:     action,
+		ReleasedAt: cleanup.ReleasedAt,
+		CleanAt:    cleanup.CleanAt,
+	}
+}
@@ -0,0 +1,76 @@
+package serializer
+
+import (
+	"time"
+
+	"go-cloud-disk/model"
+)
+
+// ReconcileJob 存储桶对账任务序列化器
+type ReconcileJob struct {
+	Uuid           string    `json:"job_id"`
+	Repair         string    `json:"repair"`
+	Status         string    `json:"status"`
+	ScannedObjects int64     `json:"scanned_objects"`
+	ScannedRecords int64     `json:"scanned_records"`
+	Orphans        int64     `json:"orphans"`
+	Missing        int64     `json:"missing"`
+	SizeMismatches int64     `json:"size_mismatches"`
+	Repaired       int64     `json:"repaired"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ReconcileIssue 对账问题序列化器
+type ReconcileIssue struct {
+	Kind       string `json:"kind"`
+	ObjectKey  string `json:"object_key"`
+	RecordType string `json:"record_type,omitempty"`
+	RecordId   string `json:"record_id,omitempty"`
+	ObjectSize int64  `json:"object_size"`
+	RecordSize int64  `json:"record_size"`
+	Repaired   bool   `json:"repaired"`
+}
+
+// ReconcileReport 对账任务及其问题列表
+type ReconcileReport struct {
+	Job    ReconcileJob     `json:"job"`
+	Issues []ReconcileIssue `json:"issues"`
+	Total  int64            `json:"total"` // 符合条件的问题总数
+}
+
+// BuildReconcileJob 构建对账任务序列化器
+func BuildReconcileJob(job model.ReconcileJob) ReconcileJob {
+	return ReconcileJob{
+		Uuid:           job.Uuid,
+		Repair:         job.Repair,
+		Status:         job.Status,
+		ScannedObjects: job.ScannedObjects,
+		ScannedRecords: job.ScannedRecords,
+		Orphans:        job.Orphans,
+		Missing:        job.Missing,
+		SizeMismatches: job.SizeMismatches,
+		Repaired:       job.Repaired,
+		Error:          job.Error,
+		CreatedAt:      job.CreatedAt,
+		UpdatedAt:      job.UpdatedAt,
+	}
+}
+
+// BuildReconcileIssues 构建对账问题列表序列化器
+func BuildReconcileIssues(issues []model.ReconcileIssue) []ReconcileIssue {
+	res := make([]ReconcileIssue, 0, len(issues))
+	for _, issue := range issues {
+		res = append(res, ReconcileIssue{
+			Kind:       issue.Kind,
+			ObjectKey:  issue.ObjectKey,
+			RecordType: issue.RecordType,
+			RecordId:   issue.RecordId,
+			ObjectSize: issue.ObjectSize,
+			RecordSize: issue.RecordSize,
+			Repaired:   issue.Repaired == 1,
+		})
+	}
+	return res
+}
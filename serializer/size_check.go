@@ -0,0 +1,38 @@
+package serializer
+
+import "go-cloud-disk/model"
+
+// SizeCheck 文件夹大小和存储空间一致性检查结果序列化器
+type SizeCheck struct {
+	UserId      string     `json:"user_id"`
+	Folders     int        `json:"folders"`              // 检查的文件夹数
+	FolderDiffs []SizeDiff `json:"folder_diffs"`         // 大小不符的文件夹
+	StoreDiff   *SizeDiff  `json:"store_diff,omitempty"` // 存储空间已用大小不符时非空
+	Repaired    bool       `json:"repaired"`             // 是否已修正
+}
+
+// SizeDiff 大小不符的文件夹或存储空间
+type SizeDiff struct {
+	Id       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Recorded int64  `json:"recorded"` // 记录的大小
+	Actual   int64  `json:"actual"`   // 重新计算的大小
+}
+
+// BuildSizeCheck 构建一致性检查结果序列化器
+func BuildSizeCheck(check model.SizeCheck) SizeCheck {
+	res := SizeCheck{
+		UserId:      check.UserId,
+		Folders:     check.Folders,
+		FolderDiffs: make([]SizeDiff, 0, len(check.FolderDiffs)),
+		Repaired:    check.Repaired,
+	}
+	for _, diff := range check.FolderDiffs {
+		res.FolderDiffs = append(res.FolderDiffs, SizeDiff(diff))
+	}
+	if check.StoreDiff != nil {
+		storeDiff := SizeDiff(*check.StoreDiff)
+		res.StoreDiff = &storeDiff
+	}
+	return res
+}
@@ -0,0 +1,33 @@
+package serializer
+
+import (
+	"time"
+
+	"go-cloud-disk/model"
+)
+
+// UploadJob 分片合并任务序列化器
+type UploadJob struct {
+	Uuid      string    `json:"job_id"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	Retryable bool      `json:"retryable"`          // 失败后能否通过重试接口重新执行
+	Error     string    `json:"error,omitempty"`    // 最近一次失败的原因，例如FileChecksumMismatch
+	RetryAt   time.Time `json:"retry_at,omitempty"` // 等待重试时下次执行的时间
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BuildUploadJob 构建分片合并任务序列化器
+func BuildUploadJob(job model.UploadJob) UploadJob {
+	return UploadJob{
+		Uuid:      job.Uuid,
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		Retryable: job.Retryable(),
+		Error:     job.Error,
+		RetryAt:   job.RetryAt,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
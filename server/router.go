@@ -3,6 +3,7 @@ package server
 import (
 	"go-cloud-disk/api"
 	"go-cloud-disk/middleware"
+	"go-cloud-disk/utils/throttle"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,6 +25,18 @@ func NewRouter() *gin.Engine {
 
 		v1.GET("share/:shareId", api.GetShareInfo)
 
+		// 本地磁盘预签名URL，通过签名鉴权
+		v1.GET("local/object/*key", api.LocalDiskGetObject)
+		v1.PUT("local/object/*key", api.LocalDiskPutObject)
+
+		// 服务端代理下载，通过签名鉴权
+		v1.GET("file/:fileid/content", api.GetFileContent)
+		v1.HEAD("file/:fileid/content", api.GetFileContent)
+
+		// tus协议能力查询，无需登录
+		v1.OPTIONS("file/tus", api.TusOptions)
+		v1.OPTIONS("file/tus/:uploadId", api.TusOptions)
+
 		auth := v1.Group("")
 		auth.Use(middleware.JWTAuth(), middleware.CasbinAuth())
 		{
@@ -32,15 +45,38 @@ func NewRouter() *gin.Engine {
 			auth.PUT("user", api.UpdateUserInfo)
 
 			auth.GET("file/:fileid", api.GetDownloadURL)
-			auth.POST("file", api.UploadFile)
+			auth.POST("file", middleware.TransferLimit(throttle.Upload), api.UploadFile)
+			auth.POST("file/instant", api.InstantUploadFile)
+			auth.POST("file/archive", middleware.TransferLimit(throttle.Download), api.DownloadFileArchive)
 			auth.PUT("file", api.UpdateFile)
 			auth.DELETE("file/:fileid", api.DeleteFile)
 
+			// 批量操作接口，每个批次在一个事务中执行并返回每个条目的结果
+			auth.POST("file/batch/move", api.BatchMoveFiles)
+			auth.POST("file/batch/copy", api.BatchCopyFiles)
+			auth.POST("file/batch/restore", api.BatchRestoreFiles)
+			auth.DELETE("file/batch", api.BatchDeleteFiles)
+
+			// 复制接口，复制的文件与原文件共享云端对象，较大的文件夹在后台复制
+			auth.POST("file/:fileid/copy", api.CopyFile)
+			auth.POST("filefolder/:filefolderid/copy", api.CopyFileFolder)
+			auth.GET("file/copy-job/:jobid", api.GetCopyJob)
+
 			// 分片上传相关接口
 			auth.POST("file/chunk/init", api.InitChunkUpload)
-			auth.POST("file/chunk/upload", api.UploadChunk)
+			auth.POST("file/chunk/upload", middleware.TransferLimit(throttle.Upload), api.UploadChunk)
 			auth.POST("file/chunk/check", api.CheckChunks)
 			auth.POST("file/chunk/complete", api.CompleteChunkUpload)
+			auth.POST("file/:fileid/retry", api.RetryFileUpload)
+			auth.GET("file/:fileid/upload", api.GetFileUploadStatus)
+			auth.GET("file/chunk", api.ListChunkUploads)
+			auth.DELETE("file/chunk/:uploadId", api.AbortChunkUpload)
+
+			// tus断点续传协议接口
+			auth.POST("file/tus", api.TusCreateUpload)
+			auth.HEAD("file/tus/:uploadId", api.TusHeadUpload)
+			auth.PATCH("file/tus/:uploadId", middleware.TransferLimit(throttle.Upload), api.TusPatchUpload)
+			auth.DELETE("file/tus/:uploadId", api.TusTerminateUpload)
 
 			// 智能标签相关接口
 			auth.POST("tag/auto", api.AutoTagFile)
@@ -53,12 +89,29 @@ func NewRouter() *gin.Engine {
 			auth.GET("file/recycle-bin/config", api.GetRecycleBinConfig)
 			auth.PUT("file/recycle-bin/config", api.UpdateRecycleBinConfig)
 
+			// 文件历史版本相关接口
+			auth.GET("file/:fileid/version", api.ListFileVersions)
+			auth.GET("file/:fileid/version/:versionid", api.GetFileVersionURL)
+			auth.POST("file/:fileid/version/:versionid/restore", api.RestoreFileVersion)
+			auth.DELETE("file/:fileid/version/:versionid", api.DeleteFileVersion)
+			auth.GET("file/version/config", api.GetFileVersionConfig)
+			auth.PUT("file/version/config", api.UpdateFileVersionConfig)
+
 			auth.GET("filefolder/:filefolderid/file", api.GetFilefolderAllFile)
 			auth.GET("filefolder/:filefolderid/filefolder", api.GetFilefolderAllFilefolder)
 			auth.POST("filefolder", api.CreateFileFolder)
+			auth.POST("filefolder/:filefolderid/upload", middleware.TransferLimit(throttle.Upload), api.UploadFileFolder)
+			auth.GET("filefolder/:filefolderid/archive", middleware.TransferLimit(throttle.Download), api.DownloadFileFolderArchive)
 			auth.PUT("filefolder", api.UpdateFileFolder)
 			auth.DELETE("filefolder/:filefolderid", api.DeleteFileFolder)
 
+			// 按路径访问文件和文件夹，路径以主目录开头，例如 /main/reports/2026/q3.xlsx
+			auth.GET("filepath/stat", api.StatFilePath)
+			auth.GET("filepath/list", api.ListFilePath)
+			auth.POST("filepath/mkdir", api.MkdirFilePath)
+			auth.PUT("filepath/move", api.MoveFilePath)
+			auth.DELETE("filepath", api.DeleteFilePath)
+
 			auth.GET("filestore/:filestoreId", api.GetFileStoreInfo)
 
 			auth.GET("share", api.GetUserAllShare)
@@ -80,8 +133,12 @@ func NewRouter() *gin.Engine {
 
 				admin.DELETE("file/:fileId", api.AdminDeleteFile)
 				admin.GET("file/recycle-bin", api.GetRecycleBinList)
+				admin.GET("file/object-cleanup", api.AdminObjectCleanupReport)
+				admin.POST("file/reconcile", api.AdminStartReconcile)
+				admin.GET("file/reconcile/:jobId", api.AdminGetReconcileJob)
 
 				admin.GET("filestore/:userId", api.AdminGetFileStoreInfo)
+				admin.POST("filestore/:userId/size-check", api.AdminCheckUserSizes)
 				admin.PUT("filestore", api.UserFileStoreUpdate)
 			}
 		}
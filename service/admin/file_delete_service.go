@@ -4,6 +4,8 @@ import (
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
 )
 
 type FileDeleteService struct{}
@@ -39,7 +41,17 @@ func (service *FileDeleteService) FileDelete(operStatus string, fileId string) s
 		return serializer.DBErr("", err)
 	}
 
-	if err = model.DB.Delete(&files).Error; err != nil {
+	objects := make([]model.StoredObject, 0, len(files))
+	for _, file := range files {
+		objects = append(objects, file.Object())
+	}
+	err = model.DB.Transaction(func(t *gorm.DB) error {
+		if err := t.Delete(&files).Error; err != nil {
+			return err
+		}
+		return model.ReleaseObjects(t, objects)
+	})
+	if err != nil {
 		logger.Log().Error("[FileDeleteService.FileDelete] 删除文件失败: ", err)
 		return serializer.DBErr("", err)
 	}
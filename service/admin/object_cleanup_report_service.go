@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"time"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+)
+
+// ObjectCleanupReportService 云端对象清理报告服务，只统计不删除
+type ObjectCleanupReportService struct {
+	Limit int `json:"limit" form:"limit" binding:"omitempty,min=1,max=1000"` // 列出的到期对象数，默认100
+}
+
+// ObjectCleanupReport 统计待清理的云端对象，并重新计算到期对象的引用数，列出清理时将删除或保留的对象
+func (service *ObjectCleanupReportService) ObjectCleanupReport() serializer.Response {
+	if service.Limit == 0 {
+		service.Limit = 100
+	}
+	report := serializer.ObjectCleanupReport{
+		Enabled:   model.ObjectCleanupEnabled(),
+		GraceDays: int64(model.ObjectCleanupGrace() / (24 * time.Hour)),
+		Items:     []serializer.ObjectCleanupItem{},
+	}
+
+	if err := model.DB.Model(&model.ObjectCleanup{}).
+		Select("status, COUNT(*) as count, COALESCE(SUM(size), 0) as size").
+		Group("status").Scan(&report.Statuses).Error; err != nil {
+		logger.Log().Error("[ObjectCleanupReportService.ObjectCleanupReport] 统计待清理对象失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	now := time.Now()
+	if err := model.DB.Model(&model.ObjectCleanup{}).
+		Where("status = ? and clean_at <= ?", model.ObjectCleanupPending, now).
+		Select("COUNT(*), COALESCE(SUM(size), 0)").Row().Scan(&report.DueCount, &report.DueSize); err != nil {
+		logger.Log().Error("[ObjectCleanupReportService.ObjectCleanupReport] 统计到期对象失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	cleanups, err := model.DueObjectCleanups(model.DB, now, service.Limit)
+	if err != nil {
+		logger.Log().Error("[ObjectCleanupReportService.ObjectCleanupReport] 获取到期对象失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	for _, cleanup := range cleanups {
+		refs, err := model.CountObjectRefs(model.DB, cleanup.Object())
+		if err != nil {
+			logger.Log().Error("[ObjectCleanupReportService.ObjectCleanupReport] 统计对象引用数失败: ", err)
+			return serializer.DBErr("", err)
+		}
+		item := serializer.BuildObjectCleanupItem(cleanup, refs)
+		if refs == 0 {
+			report.DeleteCount++
+			report.DeleteSize += cleanup.Size
+		}
+		report.Items = append(report.Items, item)
+	}
+	return serializer.Success(report)
+}
@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/rabbitMQ"
+	"go-cloud-disk/rabbitMQ/task"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+)
+
+// ReconcileService 创建存储桶对账任务的服务
+type ReconcileService struct {
+	Repair string `json:"repair" form:"repair" binding:"omitempty,oneof=none delete_orphans mark_failed all"` // 修复模式，默认只报告
+}
+
+// ReconcileJobService 查询对账任务结果的服务
+type ReconcileJobService struct {
+	Kind     string `json:"kind" form:"kind" binding:"omitempty,oneof=orphan missing size_mismatch"` // 只列出某类问题
+	Page     int    `json:"page" form:"page"`
+	PageSize int    `json:"page_size" form:"page_size"`
+}
+
+// StartReconcile 创建对账任务并提交到对账队列，任务在后台列举存储桶中的全部对象
+func (service *ReconcileService) StartReconcile() serializer.Response {
+	if service.Repair == "" {
+		service.Repair = model.ReconcileRepairNone
+	}
+	job := model.ReconcileJob{
+		Repair: service.Repair,
+		Status: model.ReconcileJobPending,
+	}
+	if err := model.DB.Create(&job).Error; err != nil {
+		logger.Log().Error("[ReconcileService.StartReconcile] 创建对账任务失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	// 限制1秒超时
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	defer cancel()
+	body, err := json.Marshal(task.FileReconcileRequest{JobId: job.Uuid})
+	if err == nil {
+		err = rabbitMQ.SendMessageToMQ(ctx, rabbitMQ.RabbitMqReconcileQueue, body)
+	}
+	if err != nil {
+		logger.Log().Error("[ReconcileService.StartReconcile] 发送对账任务失败: ", err)
+		job.Status = model.ReconcileJobFailed
+		job.Error = "EnqueueFailed"
+		if err := model.DB.Save(&job).Error; err != nil {
+			logger.Log().Error("[ReconcileService.StartReconcile] 更新对账任务状态失败: ", err)
+		}
+	}
+	return serializer.Success(serializer.BuildReconcileJob(job))
+}
+
+// GetReconcileJob 获取对账任务的进度和分页的问题列表
+func (service *ReconcileJobService) GetReconcileJob(jobId string) serializer.Response {
+	if service.Page <= 0 {
+		service.Page = 1
+	}
+	if service.PageSize <= 0 || service.PageSize > 100 {
+		service.PageSize = 20
+	}
+
+	var job model.ReconcileJob
+	if err := model.DB.Where("uuid = ?", jobId).Find(&job).Error; err != nil {
+		logger.Log().Error("[ReconcileJobService.GetReconcileJob] 获取对账任务失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if job.Uuid == "" {
+		return serializer.ParamsErr("JobNotFound", nil)
+	}
+
+	query := model.DB.Model(&model.ReconcileIssue{}).Where("job_id = ?", job.Uuid)
+	if service.Kind != "" {
+		query = query.Where("kind = ?", service.Kind)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Log().Error("[ReconcileJobService.GetReconcileJob] 统计对账问题失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	var issues []model.ReconcileIssue
+	if err := query.Order("created_at, object_key").
+		Offset((service.Page - 1) * service.PageSize).Limit(service.PageSize).
+		Find(&issues).Error; err != nil {
+		logger.Log().Error("[ReconcileJobService.GetReconcileJob] 获取对账问题失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	return serializer.Success(serializer.ReconcileReport{
+		Job:    serializer.BuildReconcileJob(job),
+		Issues: serializer.BuildReconcileIssues(issues),
+		Total:  total,
+	})
+}
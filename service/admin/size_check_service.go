@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+
+	"go-cloud-disk/conf"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
+)
+
+// SizeCheckService 文件夹大小和存储空间一致性检查服务
+type SizeCheckService struct {
+	Repair bool `json:"repair" form:"repair"` // 是否修正不符的记录，默认只报告
+}
+
+// CheckUserSizes 重新计算用户每个文件夹的大小和存储空间已用大小，报告与记录不符之处
+func (service *SizeCheckService) CheckUserSizes(userId string) serializer.Response {
+	var check model.SizeCheck
+	err := model.DB.Transaction(func(t *gorm.DB) (err error) {
+		check, err = model.CheckUserSizes(t, userId, service.Repair)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return serializer.ParamsErr("UserNotFound", nil)
+	}
+	if err != nil {
+		logger.Log().Error("[SizeCheckService.CheckUserSizes] 检查文件夹大小失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	return serializer.Success(serializer.BuildSizeCheck(check))
+}
+
+// CheckAllUserSizes 逐个用户检查文件夹大小和存储空间，每个用户一个事务，
+// 不符时记录日志，配置了SIZE_CHECK_REPAIR时同时修正。单个用户检查失败不影响其他用户
+func (service *SizeCheckService) CheckAllUserSizes() error {
+	repair := conf.SizeCheckRepair == "true"
+	var owners []string
+	if err := model.DB.Model(&model.FileStore{}).Pluck("owner_id", &owners).Error; err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, owner := range owners {
+		var check model.SizeCheck
+		err := model.DB.Transaction(func(t *gorm.DB) (err error) {
+			check, err = model.CheckUserSizes(t, owner, repair)
+			return err
+		})
+		if err != nil {
+			logger.Log().Error("[SizeCheckService.CheckAllUserSizes] 检查用户 %s 失败: %v", owner, err)
+			failed++
+			continue
+		}
+		if check.Consistent() {
+			continue
+		}
+		for _, diff := range check.FolderDiffs {
+			logger.Log().Warning("[SizeCheckService.CheckAllUserSizes] 用户 %s 文件夹 %s 大小不符: 记录 %d, 实际 %d, 已修正 %v",
+				owner, diff.Id, diff.Recorded, diff.Actual, check.Repaired)
+		}
+		if check.StoreDiff != nil {
+			logger.Log().Warning("[SizeCheckService.CheckAllUserSizes] 用户 %s 存储空间已用大小不符: 记录 %d, 实际 %d, 已修正 %v",
+				owner, check.StoreDiff.Recorded, check.StoreDiff.Actual, check.Repaired)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d 个用户检查失败", failed)
+	}
+	return nil
+}
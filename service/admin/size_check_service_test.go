@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"testing"
+
+	"go-cloud-disk/conf"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/file"
+	"go-cloud-disk/service/filefolder"
+	"go-cloud-disk/test"
+)
+
+func TestCheckUserSizesAfterTrashAndRestore(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	docs := test.CreateFolder(t, root, "docs")
+	sub := test.CreateFolder(t, docs, "sub")
+	test.CreateFile(t, docs, "a", 3)
+	test.CreateFile(t, sub, "b", 4)
+
+	// 文件夹移入回收站再恢复后大小仍一致
+	if res := (&filefolder.DeleteFileFolderService{}).DeleteFileFolder(user.Uuid, sub.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("删除文件夹失败: %+v", res)
+	}
+	var recycleBin model.RecycleBin
+	if err := model.DB.Where("file_id = ?", sub.Uuid).First(&recycleBin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res := (&file.FileRefCountService{}).RestoreFile(user.Uuid, recycleBin.ID); res.Code != 0 {
+		t.Fatalf("恢复文件夹失败: %+v", res)
+	}
+	service := SizeCheckService{}
+	res := service.CheckUserSizes(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("检查失败: %+v", res)
+	}
+	if check := res.Data.(serializer.SizeCheck); check.Folders != 3 || len(check.FolderDiffs) != 0 || check.StoreDiff != nil {
+		t.Fatalf("恢复后大小应一致: %+v", check)
+	}
+
+	// 记录的大小偏离后只报告不修正，repair时修正
+	if err := model.DB.Model(&model.FileFolder{}).Where("uuid = ?", docs.Uuid).Update("size", 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Model(&model.FileStore{}).Where("owner_id = ?", user.Uuid).Update("current_size", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	check := service.CheckUserSizes(user.Uuid).Data.(serializer.SizeCheck)
+	if len(check.FolderDiffs) != 1 || check.FolderDiffs[0].Id != docs.Uuid || check.FolderDiffs[0].Actual != 7 ||
+		check.StoreDiff == nil || check.StoreDiff.Actual != 7 || check.Repaired {
+		t.Fatalf("检查结果不符: %+v", check)
+	}
+	if folder := test.Folder(t, docs.Uuid); folder.Size != 100 {
+		t.Fatalf("未开启修正时不应修改记录，文件夹大小%d", folder.Size)
+	}
+
+	service.Repair = true
+	if check := service.CheckUserSizes(user.Uuid).Data.(serializer.SizeCheck); !check.Repaired {
+		t.Fatalf("应修正不符的记录: %+v", check)
+	}
+	test.CheckSizes(t, user.Uuid)
+
+	if res := service.CheckUserSizes("missing"); res.Code != serializer.CodeParamsError || res.Msg != "UserNotFound" {
+		t.Fatalf("用户不存在时应返回UserNotFound: %+v", res)
+	}
+}
+
+func TestCheckAllUserSizes(t *testing.T) {
+	test.Setup(t)
+	repair := conf.SizeCheckRepair
+	conf.SizeCheckRepair = "true"
+	t.Cleanup(func() { conf.SizeCheckRepair = repair })
+
+	var users []model.User
+	for i := 0; i < 2; i++ {
+		user := test.CreateUser(t, 1024)
+		test.CreateFile(t, test.Folder(t, user.UserMainFileFolderID), "a", 3)
+		users = append(users, user)
+	}
+	if err := model.DB.Model(&model.FileStore{}).Where("owner_id = ?", users[1].Uuid).Update("current_size", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&SizeCheckService{}).CheckAllUserSizes(); err != nil {
+		t.Fatalf("检查所有用户失败: %v", err)
+	}
+	for _, user := range users {
+		test.CheckSizes(t, user.Uuid)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/throttle"
 )
 
 type FileStoreGetInfoService struct{}
@@ -16,5 +17,23 @@ func (service *FileStoreGetInfoService) FileStoreGetInfo(userId string) serializ
 		logger.Log().Error("[FileStoreGetInfoService.FileStoreGetInfo] 获取用户文件存储信息失败: ", err)
 		return serializer.DBErr("", err)
 	}
-	return serializer.Success(serializer.BuildFileStore(store))
+	reserved, err := model.GetReservedSize(model.DB, userId)
+	if err != nil {
+		logger.Log().Error("[FileStoreGetInfoService.FileStoreGetInfo] 获取预留空间失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	limit, err := throttle.GetUserLimit(userId)
+	if err != nil {
+		logger.Log().Error("[FileStoreGetInfoService.FileStoreGetInfo] 获取用户传输限制失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	usage, err := throttle.GetUserUsage(userId)
+	if err != nil {
+		logger.Log().Error("[FileStoreGetInfoService.FileStoreGetInfo] 获取用户当日流量失败: ", err)
+		return serializer.InternalErr("", err)
+	}
+
+	fileStore := serializer.BuildFileStore(store, reserved)
+	fileStore.Transfer = serializer.BuildTransfer(limit, usage)
+	return serializer.Success(fileStore)
 }
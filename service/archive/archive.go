@@ -0,0 +1,164 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+)
+
+const (
+	// FormatZip ZIP格式
+	FormatZip = "zip"
+	// FormatTarGz tar.gz格式
+	FormatTarGz = "tar.gz"
+)
+
+// archiveEntry 压缩包中的一项，file为空时表示目录
+type archiveEntry struct {
+	name string
+	file *model.File
+}
+
+// Archive 待打包下载的文件集合，写出时逐个读取云端对象边读边写，不在内存中缓存整个文件
+type Archive struct {
+	Name    string // 压缩包文件名，不含扩展名
+	Format  string // 压缩格式
+	entries []archiveEntry
+	used    map[string]bool // 已使用的条目名，用于处理重名
+}
+
+// newArchive 创建压缩包
+func newArchive(name string, format string) *Archive {
+	if format == "" {
+		format = FormatZip
+	}
+	return &Archive{Name: name, Format: format, used: make(map[string]bool)}
+}
+
+// FileName 返回带扩展名的压缩包文件名
+func (archive *Archive) FileName() string {
+	return archive.Name + "." + archive.Format
+}
+
+// ContentType 返回压缩包的MIME类型
+func (archive *Archive) ContentType() string {
+	if archive.Format == FormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// addDir 添加目录条目，保证空文件夹也出现在压缩包中
+func (archive *Archive) addDir(dir string) string {
+	name := archive.uniqueName(dir)
+	archive.entries = append(archive.entries, archiveEntry{name: name + "/"})
+	return name
+}
+
+// addFile 添加文件条目，使用用户可见的文件名
+func (archive *Archive) addFile(dir string, file model.File) {
+	archive.entries = append(archive.entries, archiveEntry{
+		name: archive.uniqueName(path.Join(dir, file.DisplayName())),
+		file: &file,
+	})
+}
+
+// uniqueName 同一目录下存在同名条目时在文件名后追加序号
+func (archive *Archive) uniqueName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if !archive.used[name] {
+		archive.used[name] = true
+		return name
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !archive.used[candidate] {
+			archive.used[candidate] = true
+			return candidate
+		}
+	}
+}
+
+// Stream 将压缩包写入w
+func (archive *Archive) Stream(w io.Writer) error {
+	if archive.Format == FormatTarGz {
+		return archive.writeTarGz(w)
+	}
+	return archive.writeZip(w)
+}
+
+// writeZip 以ZIP格式写出
+func (archive *Archive) writeZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range archive.entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: time.Now()}
+		if entry.file == nil {
+			header.Method = zip.Store
+		}
+		entryWriter, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if entry.file == nil {
+			continue
+		}
+		if err := copyObject(entryWriter, *entry.file); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz 以tar.gz格式写出
+func (archive *Archive) writeTarGz(w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, entry := range archive.entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, ModTime: time.Now()}
+		if entry.file == nil {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0o755
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = entry.file.Size
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.file == nil {
+			continue
+		}
+		if err := copyObject(tw, *entry.file); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// copyObject 读取云端对象并写入w
+func copyObject(w io.Writer, file model.File) error {
+	reader, err := disk.BaseCloudDisk.GetObject(file.FilePath, "", disk.ObjectName(file.FileUuid, file.FilePostfix))
+	if err != nil {
+		return fmt.Errorf("读取文件%s失败: %v", file.Uuid, err)
+	}
+	defer reader.Close()
+
+	// tar条目大小已写入头部，只复制声明的大小
+	if _, err := io.CopyN(w, reader, file.Size); err != nil {
+		return fmt.Errorf("写入文件%s失败: %v", file.Uuid, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"path"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+)
+
+// FileFolderArchiveService 文件夹打包下载服务
+type FileFolderArchiveService struct {
+	Format string `form:"format" json:"format" binding:"omitempty,oneof=zip tar.gz"` // 压缩格式，默认zip
+}
+
+// FileArchiveService 多选文件和文件夹打包下载服务
+type FileArchiveService struct {
+	Format      string   `form:"format" json:"format" binding:"omitempty,oneof=zip tar.gz"` // 压缩格式，默认zip
+	FileIds     []string `form:"files" json:"files"`                                        // 文件ID列表
+	FileFolders []string `form:"filefolders" json:"filefolders"`                            // 文件夹ID列表
+}
+
+// GetFileFolderArchive 构建文件夹的压缩包，压缩包内保留目录结构
+func (service *FileFolderArchiveService) GetFileFolderArchive(userId string, fileFolderId string) (*Archive, serializer.Response) {
+	var fileFolder model.FileFolder
+	if err := model.DB.Where("uuid = ? and owner_id = ?", fileFolderId, userId).Find(&fileFolder).Error; err != nil {
+		logger.Log().Error("[FileFolderArchiveService.GetFileFolderArchive] 获取文件夹失败: ", err)
+		return nil, serializer.DBErr("", err)
+	}
+	if fileFolder.Uuid == "" {
+		return nil, serializer.NotAuthErr("")
+	}
+
+	archive := newArchive(fileFolder.FileFolderName, service.Format)
+	tree, err := model.LoadFolderTree(model.DB, userId)
+	if err != nil {
+		logger.Log().Error("[FileFolderArchiveService.GetFileFolderArchive] 获取文件夹树失败: ", err)
+		return nil, serializer.DBErr("", err)
+	}
+	if err := addFolderContents(archive, tree, userId, fileFolder.Uuid, ""); err != nil {
+		logger.Log().Error("[FileFolderArchiveService.GetFileFolderArchive] 获取文件列表失败: ", err)
+		return nil, serializer.DBErr("", err)
+	}
+	return archive, serializer.Success(nil)
+}
+
+// GetFileArchive 构建多选文件和文件夹的压缩包
+func (service *FileArchiveService) GetFileArchive(userId string) (*Archive, serializer.Response) {
+	if len(service.FileIds) == 0 && len(service.FileFolders) == 0 {
+		return nil, serializer.ParamsErr("没有选择文件", nil)
+	}
+
+	// 重复选择的文件和文件夹只打包一次
+	service.FileIds = uniqueIds(service.FileIds)
+	service.FileFolders = uniqueIds(service.FileFolders)
+
+	archive := newArchive("download", service.Format)
+	if len(service.FileIds) > 0 {
+		var files []model.File
+		if err := model.DB.Where("uuid in ? and owner = ?", service.FileIds, userId).Find(&files).Error; err != nil {
+			logger.Log().Error("[FileArchiveService.GetFileArchive] 获取文件列表失败: ", err)
+			return nil, serializer.DBErr("", err)
+		}
+		if len(files) != len(service.FileIds) {
+			return nil, serializer.NotAuthErr("")
+		}
+		for _, file := range files {
+			if !file.Available() {
+				return nil, serializer.ParamsErr("FileNotAvailable", nil)
+			}
+			archive.addFile("", file)
+		}
+	}
+
+	if len(service.FileFolders) > 0 {
+		var fileFolders []model.FileFolder
+		if err := model.DB.Where("uuid in ? and owner_id = ?", service.FileFolders, userId).Find(&fileFolders).Error; err != nil {
+			logger.Log().Error("[FileArchiveService.GetFileArchive] 获取文件夹失败: ", err)
+			return nil, serializer.DBErr("", err)
+		}
+		if len(fileFolders) != len(service.FileFolders) {
+			return nil, serializer.NotAuthErr("")
+		}
+		tree, err := model.LoadFolderTree(model.DB, userId)
+		if err != nil {
+			logger.Log().Error("[FileArchiveService.GetFileArchive] 获取文件夹树失败: ", err)
+			return nil, serializer.DBErr("", err)
+		}
+		for _, fileFolder := range fileFolders {
+			dir := archive.addDir(fileFolder.FileFolderName)
+			if err := addFolderContents(archive, tree, userId, fileFolder.Uuid, dir); err != nil {
+				logger.Log().Error("[FileArchiveService.GetFileArchive] 获取文件列表失败: ", err)
+				return nil, serializer.DBErr("", err)
+			}
+		}
+	}
+	return archive, serializer.Success(nil)
+}
+
+// uniqueIds 去除重复的ID，保持原有顺序
+func uniqueIds(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// addFolderContents 将文件夹下的所有子文件夹和文件添加到压缩包的dir目录下，尚未就绪或处理失败的文件不打包
+func addFolderContents(archive *Archive, tree *model.FolderTree, userId string, fileFolderId string, dir string) error {
+	// 广度优先收集子文件夹及其在压缩包中的目录
+	dirs := map[string]string{fileFolderId: dir}
+	folderIds := tree.Descendants(fileFolderId)
+	for _, folderId := range folderIds {
+		for _, child := range tree.Children(folderId) {
+			dirs[child.Uuid] = archive.addDir(path.Join(dirs[folderId], child.FileFolderName))
+		}
+	}
+
+	var files []model.File
+	if err := model.DB.Where("parent_folder_id in ? and owner = ? and status = ?", folderIds, userId, model.FileStatusAvailable).Find(&files).Error; err != nil {
+		return err
+	}
+	for _, file := range files {
+		archive.addFile(dirs[file.ParentFolderId], file)
+	}
+	return nil
+}
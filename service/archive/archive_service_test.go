@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"sort"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+func TestGetFileArchiveDuplicateIds(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	file := model.File{
+		Owner:          user.Uuid,
+		FileName:       "notes",
+		FilePostfix:    "txt",
+		FileUuid:       "notes-object",
+		FilePath:       user.Uuid,
+		ParentFolderId: user.UserMainFileFolderID,
+		Size:           3,
+	}
+	if err := model.DB.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 重复选择同一文件时只打包一次，不视为无权限
+	service := FileArchiveService{
+		FileIds:     []string{file.Uuid, file.Uuid},
+		FileFolders: []string{user.UserMainFileFolderID, user.UserMainFileFolderID},
+	}
+	archive, res := service.GetFileArchive(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("重复选择时打包失败: %+v", res)
+	}
+	// 单独选择的文件一项，主目录及其中的文件两项
+	if len(archive.entries) != 3 {
+		t.Fatalf("压缩包有%d项，期望3项: %+v", len(archive.entries), archive.entries)
+	}
+
+	// 其他用户的文件仍然拒绝
+	other := test.CreateUser(t, 1024)
+	if _, res := service.GetFileArchive(other.Uuid); res.Code != serializer.CodeNotAuthError {
+		t.Fatalf("打包其他用户的文件应返回未授权: %+v", res)
+	}
+}
+
+func TestStreamFileFolderArchive(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	docs := test.CreateFolder(t, root, "docs")
+	sub := test.CreateFolder(t, docs, "sub")
+	test.CreateFolder(t, docs, "empty")
+	for _, file := range []model.File{test.CreateFile(t, docs, "a", 3), test.CreateFile(t, sub, "b", 4), test.CreateFile(t, sub, "b", 4)} {
+		mem.PutObject(file.Object().Key(), bytes.Repeat([]byte(file.FileName), int(file.Size)))
+	}
+	// 后台处理中的文件不打包
+	pending := test.CreateFile(t, docs, "pending", 1)
+	if err := model.DB.Model(&pending).Update("status", model.FileStatusPending).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	archive, res := (&FileFolderArchiveService{}).GetFileFolderArchive(user.Uuid, docs.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("打包文件夹失败: %+v", res)
+	}
+	var buf bytes.Buffer
+	if err := archive.Stream(&buf); err != nil {
+		t.Fatalf("写出压缩包失败: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := make(map[string]string)
+	names := make([]string, 0, len(zr.File))
+	for _, entry := range zr.File {
+		names = append(names, entry.Name)
+		reader, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[entry.Name] = string(data)
+	}
+	sort.Strings(names)
+	// 同一目录下的同名文件追加序号，空文件夹保留目录条目
+	want := []string{"a.txt", "empty/", "sub/", "sub/b (1).txt", "sub/b.txt"}
+	if len(names) != len(want) {
+		t.Fatalf("压缩包条目%v，期望%v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("压缩包条目%v，期望%v", names, want)
+		}
+	}
+	if contents["a.txt"] != "aaa" || contents["sub/b.txt"] != "bbbb" {
+		t.Fatalf("压缩包内容不符: %v", contents)
+	}
+}
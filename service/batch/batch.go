@@ -0,0 +1,192 @@
+package batch
+
+import (
+	"errors"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 批量操作的条目类型
+const (
+	itemTypeFile       = "file"
+	itemTypeFileFolder = "file_folder"
+	itemTypeRecycleBin = "recycle_bin"
+)
+
+var errTargetNotFound = errors.New("target folder not found")
+
+// batchItem 单个条目的处理结果
+type batchItem struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"` // file、file_folder 或 recycle_bin
+	Success bool   `json:"success"`
+	Skipped bool   `json:"skipped,omitempty"` // 目标位置已有同名文件或文件夹，按skip策略未处理
+	NewId   string `json:"new_id,omitempty"`  // 复制生成的文件或文件夹ID，恢复后的文件ID
+	JobId   string `json:"job_id,omitempty"`  // 文件夹较大时转为后台复制任务的ID
+	Error   string `json:"error,omitempty"`
+}
+
+// batchResult 批量操作结果
+type batchResult struct {
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Items     []batchItem `json:"items"`
+}
+
+// batch 一次批量操作的上下文，所有条目在同一事务中处理，
+// 文件夹大小和用户存储空间的变化先汇总，最后对每个受影响的文件夹只更新一次
+type batch struct {
+	t            *gorm.DB
+	userId       string
+	tree         *model.FolderTree
+	store        model.FileStore
+	reserved     int64            // 进行中的分片上传预留的空间
+	folderDeltas map[string]int64 // 文件夹ID -> 大小变化量
+	storeDelta   int64            // 用户存储空间变化量
+	jobs         []model.CopyJob  // 事务提交后提交到消息队列的后台复制任务
+	result       batchResult
+}
+
+// runBatch 在一个事务中执行批量操作并统一更新文件夹大小和用户存储空间，
+// 单个条目的失败记录在结果中，数据库错误使整个批次回滚
+func runBatch(caller string, userId string, fn func(b *batch) error) serializer.Response {
+	result, err := execBatch(userId, fn)
+	if errors.Is(err, errTargetNotFound) {
+		return serializer.NotAuthErr("")
+	}
+	if err != nil {
+		logger.Log().Error(caller+" 批量操作失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	return serializer.Success(result)
+}
+
+// execBatch 在一个事务中执行批量操作，提交后将产生的后台复制任务提交到消息队列
+func execBatch(userId string, fn func(b *batch) error) (batchResult, error) {
+	var result batchResult
+	var jobs []model.CopyJob
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		tree, err := model.LoadFolderTree(t, userId)
+		if err != nil {
+			return err
+		}
+		var store model.FileStore
+		if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", userId).First(&store).Error; err != nil {
+			return err
+		}
+		reserved, err := model.GetReservedSize(t, userId)
+		if err != nil {
+			return err
+		}
+
+		b := &batch{
+			t:            t,
+			userId:       userId,
+			tree:         tree,
+			store:        store,
+			reserved:     reserved,
+			folderDeltas: make(map[string]int64),
+			result:       batchResult{Items: []batchItem{}},
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+
+		if err := model.AddFileFoldersSize(t, b.folderDeltas); err != nil {
+			return err
+		}
+		if b.storeDelta != 0 {
+			b.store.CurrentSize = max(b.store.CurrentSize+b.storeDelta, 0)
+			if err := t.Save(&b.store).Error; err != nil {
+				return err
+			}
+		}
+		result = b.result
+		jobs = b.jobs
+		return nil
+	})
+	if err != nil {
+		return batchResult{}, err
+	}
+	for _, job := range jobs {
+		enqueueCopyJob(job)
+	}
+	return result, nil
+}
+
+// succeed 记录条目处理成功
+func (b *batch) succeed(id string, itemType string, newId string) {
+	b.result.Succeeded++
+	b.result.Items = append(b.result.Items, batchItem{Id: id, Type: itemType, Success: true, NewId: newId})
+}
+
+// queue 记录文件夹转为后台复制任务
+func (b *batch) queue(id string, job model.CopyJob) {
+	b.jobs = append(b.jobs, job)
+	b.result.Succeeded++
+	b.result.Items = append(b.result.Items, batchItem{Id: id, Type: itemTypeFileFolder, Success: true, JobId: job.Uuid})
+}
+
+// skip 记录条目因同名冲突被跳过
+func (b *batch) skip(id string, itemType string) {
+	b.result.Succeeded++
+	b.result.Items = append(b.result.Items, batchItem{Id: id, Type: itemType, Success: true, Skipped: true})
+}
+
+// fail 记录条目处理失败的原因
+func (b *batch) fail(id string, itemType string, reason string) {
+	b.result.Failed++
+	b.result.Items = append(b.result.Items, batchItem{Id: id, Type: itemType, Error: reason})
+}
+
+// fits 判断增加size后是否超过用户存储空间限制
+func (b *batch) fits(size int64) bool {
+	return b.store.CurrentSize+b.storeDelta+b.reserved+size <= b.store.MaxSize
+}
+
+// loadFiles 一次查询用户选择的文件，不属于用户或已在回收站中的文件不会返回
+func (b *batch) loadFiles(fileIds []string) (map[string]model.File, error) {
+	files := make(map[string]model.File, len(fileIds))
+	if len(fileIds) == 0 {
+		return files, nil
+	}
+	var userFiles []model.File
+	if err := b.t.Where("uuid in ? and owner = ?", fileIds, b.userId).Find(&userFiles).Error; err != nil {
+		return nil, err
+	}
+	for _, file := range userFiles {
+		files[file.Uuid] = file
+	}
+	return files, nil
+}
+
+// target 获取移动或复制的目标文件夹
+func (b *batch) target(targetId string) (model.FileFolder, error) {
+	target, ok := b.tree.Get(targetId)
+	if !ok {
+		return model.FileFolder{}, errTargetNotFound
+	}
+	return target, nil
+}
+
+// deleteFile 彻底删除文件记录及其历史版本，用于覆盖同名文件
+func (b *batch) deleteFile(file model.File) error {
+	freed, err := model.DeleteFileVersions(b.t, file.Uuid)
+	if err != nil {
+		return err
+	}
+	if err := b.t.Delete(&file).Error; err != nil {
+		return err
+	}
+	if err := model.ReleaseObjects(b.t, []model.StoredObject{file.Object()}); err != nil {
+		return err
+	}
+	b.folderDeltas[file.ParentFolderId] -= file.Size
+	b.storeDelta -= file.Size + freed
+	return nil
+}
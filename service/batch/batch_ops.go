@@ -0,0 +1,239 @@
+package batch
+
+import (
+	"errors"
+	"time"
+
+	"go-cloud-disk/model"
+)
+
+// moveFile 移动文件到目标文件夹，overwrite时彻底删除目标文件夹中的同名文件
+func (b *batch) moveFile(file model.File, target model.FileFolder, conflict string) error {
+	oldParentId := file.ParentFolderId
+	file.ParentFolderId = target.Uuid
+	existing, err := model.ResolveFileName(b.t, &file, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		b.fail(file.Uuid, itemTypeFile, "NameConflict")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing != nil && conflict == model.ConflictSkip {
+		b.skip(file.Uuid, itemTypeFile)
+		return nil
+	}
+	if existing != nil {
+		if err := b.deleteFile(*existing); err != nil {
+			return err
+		}
+	}
+
+	if err := b.t.Save(&file).Error; err != nil {
+		return err
+	}
+	b.folderDeltas[oldParentId] -= file.Size
+	b.folderDeltas[target.Uuid] += file.Size
+	b.succeed(file.Uuid, itemTypeFile, "")
+	return nil
+}
+
+// moveFileFolder 移动文件夹到目标文件夹，不能移动主目录或移动到自身的子文件夹中
+func (b *batch) moveFileFolder(fileFolder model.FileFolder, target model.FileFolder, conflict string) error {
+	switch {
+	case fileFolder.Uuid == b.tree.Root.Uuid:
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "CannotMoveRoot")
+		return nil
+	case b.tree.IsDescendant(target.Uuid, fileFolder.Uuid):
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "CannotMoveIntoItself")
+		return nil
+	case conflict == model.ConflictOverwrite:
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "CannotOverwriteFileFolder")
+		return nil
+	}
+
+	oldParentId := fileFolder.ParentFolderID
+	fileFolder.ParentFolderID = target.Uuid
+	existing, err := model.ResolveFileFolderName(b.t, &fileFolder, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "NameConflict")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		b.skip(fileFolder.Uuid, itemTypeFileFolder)
+		return nil
+	}
+
+	// 文件夹大小在批次结束时统一更新，这里只修改位置、名称和子树的物化路径
+	err = model.MoveFileFolder(b.t, fileFolder.Uuid, target.Uuid, fileFolder.FileFolderName)
+	if errors.Is(err, model.ErrFileFolderTooDeep) {
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "FileFolderTooDeep")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.tree.Move(fileFolder.Uuid, target.Uuid, fileFolder.FileFolderName)
+	b.folderDeltas[oldParentId] -= fileFolder.Size
+	b.folderDeltas[target.Uuid] += fileFolder.Size
+	b.succeed(fileFolder.Uuid, itemTypeFileFolder, "")
+	return nil
+}
+
+// copyFile 复制文件到目标文件夹，新文件记录复用原文件的云端对象，overwrite时原有同名文件的内容保留为历史版本
+func (b *batch) copyFile(file model.File, target model.FileFolder, conflict string) error {
+	newFile := model.File{
+		Owner:          b.userId,
+		FileName:       file.FileName,
+		FilePostfix:    file.FilePostfix,
+		FileUuid:       file.FileUuid,
+		FilePath:       file.FilePath,
+		ParentFolderId: target.Uuid,
+		Size:           file.Size,
+		Hash:           file.Hash,
+		Status:         file.Status,
+	}
+	existing, err := model.ResolveFileName(b.t, &newFile, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		b.fail(file.Uuid, itemTypeFile, "NameConflict")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing != nil && conflict == model.ConflictSkip {
+		b.skip(file.Uuid, itemTypeFile)
+		return nil
+	}
+	if !b.fits(file.Size) {
+		b.fail(file.Uuid, itemTypeFile, "ExceedStoreLimit")
+		return nil
+	}
+
+	folderDelta, storeDelta, err := model.SaveFileWithVersion(b.t, &newFile)
+	if err != nil {
+		return err
+	}
+	b.folderDeltas[target.Uuid] += folderDelta
+	b.storeDelta += storeDelta
+	b.succeed(file.Uuid, itemTypeFile, newFile.Uuid)
+	return nil
+}
+
+// copyFileFolder 复制文件夹及其所有子文件夹和文件到目标文件夹，不能复制到自身或其子文件夹中，
+// 子树中的文件和文件夹总数超过copyJobThreshold时转为后台任务
+func (b *batch) copyFileFolder(fileFolder model.FileFolder, target model.FileFolder, conflict string) error {
+	switch {
+	case b.tree.IsDescendant(target.Uuid, fileFolder.Uuid):
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "CannotCopyIntoItself")
+		return nil
+	case conflict == model.ConflictOverwrite:
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "CannotOverwriteFileFolder")
+		return nil
+	}
+
+	copyRoot := model.FileFolder{
+		FileFolderName: fileFolder.FileFolderName,
+		ParentFolderID: target.Uuid,
+		FileStoreID:    target.FileStoreID,
+		OwnerID:        b.userId,
+	}
+	existing, err := model.ResolveFileFolderName(b.t, &copyRoot, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "NameConflict")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		b.skip(fileFolder.Uuid, itemTypeFileFolder)
+		return nil
+	}
+
+	// 先统计子树的文件数和大小，容量不足时直接失败，较大的子树不在请求中复制
+	folderIds := b.tree.Descendants(fileFolder.Uuid)
+	var stat struct {
+		Count int64
+		Total int64
+	}
+	if err := b.t.Model(&model.File{}).Where("parent_folder_id in ? and owner = ?", folderIds, b.userId).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS total").Scan(&stat).Error; err != nil {
+		return err
+	}
+	if !b.fits(stat.Total) {
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "ExceedStoreLimit")
+		return nil
+	}
+	if int64(len(folderIds))+stat.Count > copyJobThreshold {
+		job := model.CopyJob{
+			Owner:        b.userId,
+			FileFolderId: fileFolder.Uuid,
+			TargetId:     target.Uuid,
+			Conflict:     conflict,
+			Status:       model.CopyJobPending,
+			TotalFiles:   stat.Count,
+		}
+		if err := b.t.Create(&job).Error; err != nil {
+			return err
+		}
+		b.queue(fileFolder.Uuid, job)
+		return nil
+	}
+
+	plan, err := model.PlanFolderCopy(b.t, b.tree, fileFolder, copyRoot)
+	if errors.Is(err, model.ErrFileFolderTooDeep) {
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "FileFolderTooDeep")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := plan.CreateFolders(b.t); err != nil {
+		return err
+	}
+	if err := plan.CreateFiles(b.t, plan.Files); err != nil {
+		return err
+	}
+
+	b.folderDeltas[target.Uuid] += plan.Root.Size
+	b.storeDelta += plan.Root.Size
+	b.succeed(fileFolder.Uuid, itemTypeFileFolder, plan.Root.Uuid)
+	return nil
+}
+
+// trashFileFolder 把文件夹连同整个子树作为一个条目移到回收站，已在回收站中的文件保留各自的条目
+func (b *batch) trashFileFolder(fileFolder model.FileFolder, now time.Time) error {
+	if fileFolder.Uuid == b.tree.Root.Uuid {
+		b.fail(fileFolder.Uuid, itemTypeFileFolder, "CanDeleteRoot")
+		return nil
+	}
+
+	// 本批次中已移入回收站的子树文件尚未计入文件夹大小，先写入子树中的变化量，使回收站条目的大小准确
+	subtreeDeltas := make(map[string]int64)
+	size := fileFolder.Size
+	for id, delta := range b.folderDeltas {
+		if b.tree.IsDescendant(id, fileFolder.Uuid) {
+			subtreeDeltas[id] = delta
+			size += delta
+			delete(b.folderDeltas, id)
+		}
+	}
+	if err := model.AddFileFoldersSize(b.t, subtreeDeltas); err != nil {
+		return err
+	}
+	fileFolder.Size = max(size, 0)
+
+	if _, err := model.TrashFileFolder(b.t, fileFolder, b.tree.Path(fileFolder.ParentFolderID), now); err != nil {
+		return err
+	}
+
+	b.tree.Remove(fileFolder.Uuid)
+	b.folderDeltas[fileFolder.ParentFolderID] -= fileFolder.Size
+	b.storeDelta -= fileFolder.Size
+	b.succeed(fileFolder.Uuid, itemTypeFileFolder, "")
+	return nil
+}
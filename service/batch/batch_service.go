@@ -0,0 +1,221 @@
+package batch
+
+import (
+	"errors"
+	"time"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+)
+
+// FileBatchService 批量删除文件和文件夹的服务
+type FileBatchService struct {
+	FileIds     []string `json:"files" form:"files" binding:"max=1000"`             // 文件ID列表
+	FileFolders []string `json:"filefolders" form:"filefolders" binding:"max=1000"` // 文件夹ID列表
+}
+
+// FileBatchTransferService 批量移动、复制文件和文件夹的服务
+type FileBatchTransferService struct {
+	FileIds     []string `json:"files" form:"files" binding:"max=1000"`                                         // 文件ID列表
+	FileFolders []string `json:"filefolders" form:"filefolders" binding:"max=1000"`                             // 文件夹ID列表
+	Target      string   `json:"target" form:"target" binding:"required"`                                       // 目标文件夹ID
+	Conflict    string   `json:"conflict" form:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认fail，overwrite仅适用于文件
+}
+
+// FileBatchRestoreService 批量恢复回收站文件的服务
+type FileBatchRestoreService struct {
+	RecycleBinIds []string `json:"items" form:"items" binding:"required,max=1000"` // 回收站记录ID列表
+}
+
+// conflict 返回同名冲突策略，默认fail
+func (service *FileBatchTransferService) conflict() string {
+	if service.Conflict == "" {
+		return model.ConflictFail
+	}
+	return service.Conflict
+}
+
+// MoveFiles 批量移动文件和文件夹到目标文件夹
+func (service *FileBatchTransferService) MoveFiles(userId string) serializer.Response {
+	if len(service.FileIds) == 0 && len(service.FileFolders) == 0 {
+		return serializer.ParamsErr("没有选择文件", nil)
+	}
+
+	return runBatch("[FileBatchTransferService.MoveFiles]", userId, func(b *batch) error {
+		target, err := b.target(service.Target)
+		if err != nil {
+			return err
+		}
+		files, err := b.loadFiles(service.FileIds)
+		if err != nil {
+			return err
+		}
+
+		for _, fileId := range service.FileIds {
+			file, ok := files[fileId]
+			if !ok {
+				b.fail(fileId, itemTypeFile, "FileNotFound")
+				continue
+			}
+			// 同一文件在请求中重复出现时只处理一次
+			delete(files, fileId)
+			if err := b.moveFile(file, target, service.conflict()); err != nil {
+				return err
+			}
+		}
+		for _, fileFolderId := range service.FileFolders {
+			fileFolder, ok := b.tree.Get(fileFolderId)
+			if !ok {
+				b.fail(fileFolderId, itemTypeFileFolder, "FileFolderNotFound")
+				continue
+			}
+			if err := b.moveFileFolder(fileFolder, target, service.conflict()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CopyFiles 批量复制文件和文件夹到目标文件夹，复制的文件与原文件共享云端对象，但计入用户存储空间
+func (service *FileBatchTransferService) CopyFiles(userId string) serializer.Response {
+	if len(service.FileIds) == 0 && len(service.FileFolders) == 0 {
+		return serializer.ParamsErr("没有选择文件", nil)
+	}
+
+	return runBatch("[FileBatchTransferService.CopyFiles]", userId, func(b *batch) error {
+		target, err := b.target(service.Target)
+		if err != nil {
+			return err
+		}
+		files, err := b.loadFiles(service.FileIds)
+		if err != nil {
+			return err
+		}
+
+		for _, fileId := range service.FileIds {
+			file, ok := files[fileId]
+			if !ok {
+				b.fail(fileId, itemTypeFile, "FileNotFound")
+				continue
+			}
+			if err := b.copyFile(file, target, service.conflict()); err != nil {
+				return err
+			}
+		}
+		for _, fileFolderId := range service.FileFolders {
+			fileFolder, ok := b.tree.Get(fileFolderId)
+			if !ok {
+				b.fail(fileFolderId, itemTypeFileFolder, "FileFolderNotFound")
+				continue
+			}
+			if err := b.copyFileFolder(fileFolder, target, service.conflict()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteFiles 批量删除文件和文件夹，文件和文件夹都移到回收站，每个文件夹连同其子树作为一个条目
+func (service *FileBatchService) DeleteFiles(userId string) serializer.Response {
+	if len(service.FileIds) == 0 && len(service.FileFolders) == 0 {
+		return serializer.ParamsErr("没有选择文件", nil)
+	}
+
+	return runBatch("[FileBatchService.DeleteFiles]", userId, func(b *batch) error {
+		files, err := b.loadFiles(service.FileIds)
+		if err != nil {
+			return err
+		}
+
+		// 先处理文件，使选中的文件在回收站中各自成为一个条目
+		now := time.Now()
+		for _, fileId := range service.FileIds {
+			file, ok := files[fileId]
+			if !ok {
+				b.fail(fileId, itemTypeFile, "FileNotFound")
+				continue
+			}
+			delete(files, fileId)
+			if _, err := model.TrashFile(b.t, file, b.tree.Path(file.ParentFolderId), now); err != nil {
+				return err
+			}
+			b.folderDeltas[file.ParentFolderId] -= file.Size
+			b.storeDelta -= file.Size
+			b.succeed(fileId, itemTypeFile, "")
+		}
+		for _, fileFolderId := range service.FileFolders {
+			fileFolder, ok := b.tree.Get(fileFolderId)
+			if !ok {
+				b.fail(fileFolderId, itemTypeFileFolder, "FileFolderNotFound")
+				continue
+			}
+			if err := b.trashFileFolder(fileFolder, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RestoreFiles 批量从回收站恢复文件和文件夹，原文件夹已删除时在主目录下按原路径重建，同名时自动重命名
+func (service *FileBatchRestoreService) RestoreFiles(userId string) serializer.Response {
+	return runBatch("[FileBatchRestoreService.RestoreFiles]", userId, func(b *batch) error {
+		var recycleBins []model.RecycleBin
+		if err := b.t.Where("id in ? and user_id = ? and is_restored = 0", service.RecycleBinIds, userId).
+			Find(&recycleBins).Error; err != nil {
+			return err
+		}
+		items := make(map[string]model.RecycleBin, len(recycleBins))
+		for _, recycleBin := range recycleBins {
+			items[recycleBin.ID] = recycleBin
+		}
+
+		now := time.Now()
+		for _, id := range service.RecycleBinIds {
+			recycleBin, ok := items[id]
+			switch {
+			case !ok:
+				b.fail(id, itemTypeRecycleBin, "RecycleBinNotFound")
+				continue
+			case now.After(recycleBin.ExpireAt):
+				b.fail(id, itemTypeRecycleBin, "RecycleBinExpired")
+				continue
+			case !b.fits(recycleBin.Size):
+				b.fail(id, itemTypeRecycleBin, "ExceedStoreLimit")
+				continue
+			}
+			// 同一条目在请求中重复出现时只恢复一次
+			delete(items, id)
+
+			var parentId, newId string
+			var size int64
+			var err error
+			if recycleBin.ItemType == model.RecycleBinItemFileFolder {
+				var fileFolder model.FileFolder
+				fileFolder, err = model.RestoreRecycleBinFileFolder(b.t, recycleBin, b.tree.Root)
+				parentId, newId, size = fileFolder.ParentFolderID, fileFolder.Uuid, fileFolder.Size
+			} else {
+				var file model.File
+				file, err = model.RestoreRecycleBinFile(b.t, recycleBin, b.tree.Root)
+				parentId, newId, size = file.ParentFolderId, file.Uuid, file.Size
+			}
+			if errors.Is(err, model.ErrRecycleBinFileMissing) {
+				b.fail(id, itemTypeRecycleBin, "FileNotFound")
+				continue
+			}
+			if errors.Is(err, model.ErrFileFolderTooDeep) {
+				b.fail(id, itemTypeRecycleBin, "FileFolderTooDeep")
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			b.folderDeltas[parentId] += size
+			b.storeDelta += size
+			b.succeed(id, itemTypeRecycleBin, newId)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,159 @@
+package batch
+
+import (
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+// batchFixture 主目录下的 docs(a.txt 3字节)/sub(b.txt 4字节) 和空文件夹 backup
+type batchFixture struct {
+	user   model.User
+	root   model.FileFolder
+	docs   model.FileFolder
+	sub    model.FileFolder
+	backup model.FileFolder
+	a      model.File
+	b      model.File
+}
+
+func newBatchFixture(t *testing.T, maxSize int64) batchFixture {
+	t.Helper()
+	var f batchFixture
+	f.user = test.CreateUser(t, maxSize)
+	f.root = test.Folder(t, f.user.UserMainFileFolderID)
+	f.docs = test.CreateFolder(t, f.root, "docs")
+	f.sub = test.CreateFolder(t, f.docs, "sub")
+	f.backup = test.CreateFolder(t, f.root, "backup")
+	f.a = test.CreateFile(t, f.docs, "a", 3)
+	f.b = test.CreateFile(t, f.sub, "b", 4)
+	return f
+}
+
+// batchData 取出批量操作的结果
+func batchData(t *testing.T, res serializer.Response) batchResult {
+	t.Helper()
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("批量操作失败: %+v", res)
+	}
+	return res.Data.(batchResult)
+}
+
+func TestBatchCopyAndMove(t *testing.T) {
+	test.Setup(t)
+	f := newBatchFixture(t, 1024)
+
+	copyService := FileBatchTransferService{FileIds: []string{f.a.Uuid}, FileFolders: []string{f.sub.Uuid}, Target: f.backup.Uuid}
+	result := batchData(t, copyService.CopyFiles(f.user.Uuid))
+	if result.Succeeded != 2 || result.Failed != 0 {
+		t.Fatalf("复制结果不符: %+v", result)
+	}
+	if folder := test.Folder(t, f.backup.Uuid); folder.Size != 7 {
+		t.Fatalf("目标文件夹大小%d，期望7", folder.Size)
+	}
+	if store := test.Store(t, f.user.Uuid); store.CurrentSize != 14 {
+		t.Fatalf("存储空间已用%d，期望14", store.CurrentSize)
+	}
+	test.CheckSizes(t, f.user.Uuid)
+
+	// 再次复制时默认fail策略按条目报告冲突，不回滚其他条目
+	result = batchData(t, copyService.CopyFiles(f.user.Uuid))
+	if result.Succeeded != 0 || result.Failed != 2 || result.Items[0].Error != "NameConflict" {
+		t.Fatalf("同名复制应按条目失败: %+v", result)
+	}
+
+	// 移动时不能移到自身的子文件夹中，其余条目照常移动
+	moveService := FileBatchTransferService{
+		FileIds:     []string{f.b.Uuid},
+		FileFolders: []string{f.docs.Uuid},
+		Target:      f.sub.Uuid,
+		Conflict:    model.ConflictRename,
+	}
+	result = batchData(t, moveService.MoveFiles(f.user.Uuid))
+	if result.Succeeded != 1 || result.Failed != 1 || result.Items[1].Error != "CannotMoveIntoItself" {
+		t.Fatalf("移动结果不符: %+v", result)
+	}
+
+	moveService = FileBatchTransferService{FileFolders: []string{f.sub.Uuid}, Target: f.root.Uuid, Conflict: model.ConflictRename}
+	result = batchData(t, moveService.MoveFiles(f.user.Uuid))
+	if result.Succeeded != 1 {
+		t.Fatalf("移动文件夹失败: %+v", result)
+	}
+	moved := test.Folder(t, f.sub.Uuid)
+	if moved.ParentFolderID != f.root.Uuid || moved.TreePath != f.root.TreePath+f.sub.Uuid+"/" {
+		t.Fatalf("移动后的文件夹位置不符: %+v", moved)
+	}
+	if folder := test.Folder(t, f.docs.Uuid); folder.Size != 3 {
+		t.Fatalf("原父文件夹大小%d，期望3", folder.Size)
+	}
+	test.CheckSizes(t, f.user.Uuid)
+}
+
+func TestBatchCopyExceedStoreLimit(t *testing.T) {
+	test.Setup(t)
+	f := newBatchFixture(t, 10)
+
+	// 文件能放下，文件夹的副本超过容量
+	service := FileBatchTransferService{FileIds: []string{f.a.Uuid}, FileFolders: []string{f.docs.Uuid}, Target: f.backup.Uuid}
+	result := batchData(t, service.CopyFiles(f.user.Uuid))
+	if result.Succeeded != 1 || result.Failed != 1 || result.Items[1].Error != "ExceedStoreLimit" {
+		t.Fatalf("超过容量的条目应失败: %+v", result)
+	}
+	if store := test.Store(t, f.user.Uuid); store.CurrentSize != 10 {
+		t.Fatalf("存储空间已用%d，期望10", store.CurrentSize)
+	}
+	test.CheckSizes(t, f.user.Uuid)
+
+	// 不能复制到其他用户的文件夹
+	other := test.CreateUser(t, 1024)
+	service = FileBatchTransferService{FileIds: []string{f.a.Uuid}, Target: other.UserMainFileFolderID}
+	if res := service.CopyFiles(f.user.Uuid); res.Code != serializer.CodeNotAuthError {
+		t.Fatalf("复制到其他用户的文件夹应返回未授权: %+v", res)
+	}
+}
+
+func TestBatchDeleteAndRestore(t *testing.T) {
+	test.Setup(t)
+	f := newBatchFixture(t, 1024)
+
+	// 同一批次中先删除子文件夹中的文件，再删除其祖先文件夹，文件保留各自的回收站条目
+	deleteService := FileBatchService{FileIds: []string{f.b.Uuid}, FileFolders: []string{f.docs.Uuid, f.root.Uuid}}
+	result := batchData(t, deleteService.DeleteFiles(f.user.Uuid))
+	if result.Succeeded != 2 || result.Failed != 1 || result.Items[2].Error != "CanDeleteRoot" {
+		t.Fatalf("删除结果不符: %+v", result)
+	}
+	if store := test.Store(t, f.user.Uuid); store.CurrentSize != 0 {
+		t.Fatalf("存储空间已用%d，期望0", store.CurrentSize)
+	}
+	if folder := test.Folder(t, f.root.Uuid); folder.Size != 0 {
+		t.Fatalf("主目录大小%d，期望0", folder.Size)
+	}
+	test.CheckSizes(t, f.user.Uuid)
+
+	var recycleBins []model.RecycleBin
+	if err := model.DB.Where("user_id = ?", f.user.Uuid).Order("item_type").Find(&recycleBins).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(recycleBins) != 2 || recycleBins[0].Size != 4 || recycleBins[1].Size != 3 {
+		t.Fatalf("回收站条目不符: %+v", recycleBins)
+	}
+
+	// 恢复文件夹时只恢复仍属于该条目的内容，b.txt单独恢复后回到重建的原文件夹
+	restoreService := FileBatchRestoreService{RecycleBinIds: []string{recycleBins[1].ID, recycleBins[0].ID, "missing"}}
+	result = batchData(t, restoreService.RestoreFiles(f.user.Uuid))
+	if result.Succeeded != 2 || result.Failed != 1 || result.Items[2].Error != "RecycleBinNotFound" {
+		t.Fatalf("恢复结果不符: %+v", result)
+	}
+	if store := test.Store(t, f.user.Uuid); store.CurrentSize != 7 {
+		t.Fatalf("存储空间已用%d，期望7", store.CurrentSize)
+	}
+	if folder := test.Folder(t, f.docs.Uuid); folder.Size != 7 {
+		t.Fatalf("恢复后文件夹大小%d，期望7", folder.Size)
+	}
+	if files := test.Files(t, f.sub.Uuid); len(files) != 1 || files[0].Uuid != f.b.Uuid {
+		t.Fatalf("文件应恢复到原文件夹: %+v", files)
+	}
+	test.CheckSizes(t, f.user.Uuid)
+}
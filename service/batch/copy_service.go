@@ -0,0 +1,160 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/rabbitMQ"
+	"go-cloud-disk/rabbitMQ/task"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+)
+
+// copyJobThreshold 复制的子树中文件和文件夹总数超过此值时转为后台任务
+const copyJobThreshold = 1000
+
+// FileCopyService 复制单个文件或文件夹的服务
+type FileCopyService struct {
+	Target   string `json:"target" form:"target" binding:"required"`                                       // 目标文件夹ID
+	Conflict string `json:"conflict" form:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认fail，overwrite仅适用于文件
+}
+
+// CopyJobService 查询后台复制任务进度的服务
+type CopyJobService struct{}
+
+// copyResult 复制结果，文件夹转为后台任务时只返回任务
+type copyResult struct {
+	Skipped    bool                   `json:"skipped,omitempty"` // 目标位置已有同名文件或文件夹，按skip策略未复制
+	File       *serializer.File       `json:"file,omitempty"`
+	FileFolder *serializer.FileFolder `json:"filefolder,omitempty"`
+	Job        *serializer.CopyJob    `json:"job,omitempty"`
+}
+
+// conflict 返回同名冲突策略，默认fail
+func (service *FileCopyService) conflict() string {
+	if service.Conflict == "" {
+		return model.ConflictFail
+	}
+	return service.Conflict
+}
+
+// CopyFile 复制文件到目标文件夹，新文件与原文件共享云端对象，但计入用户存储空间
+func (service *FileCopyService) CopyFile(userId string, fileId string) serializer.Response {
+	result, err := execBatch(userId, func(b *batch) error {
+		target, err := b.target(service.Target)
+		if err != nil {
+			return err
+		}
+		files, err := b.loadFiles([]string{fileId})
+		if err != nil {
+			return err
+		}
+		file, ok := files[fileId]
+		if !ok {
+			b.fail(fileId, itemTypeFile, "FileNotFound")
+			return nil
+		}
+		return b.copyFile(file, target, service.conflict())
+	})
+	return buildCopyResult("[FileCopyService.CopyFile]", result, err)
+}
+
+// CopyFileFolder 复制文件夹及其所有子文件夹和文件到目标文件夹，子树较大时返回后台复制任务
+func (service *FileCopyService) CopyFileFolder(userId string, fileFolderId string) serializer.Response {
+	result, err := execBatch(userId, func(b *batch) error {
+		target, err := b.target(service.Target)
+		if err != nil {
+			return err
+		}
+		fileFolder, ok := b.tree.Get(fileFolderId)
+		if !ok {
+			b.fail(fileFolderId, itemTypeFileFolder, "FileFolderNotFound")
+			return nil
+		}
+		return b.copyFileFolder(fileFolder, target, service.conflict())
+	})
+	return buildCopyResult("[FileCopyService.CopyFileFolder]", result, err)
+}
+
+// GetCopyJob 获取用户的后台复制任务进度
+func (service *CopyJobService) GetCopyJob(userId string, jobId string) serializer.Response {
+	var job model.CopyJob
+	if err := model.DB.Where("uuid = ? and owner = ?", jobId, userId).Find(&job).Error; err != nil {
+		logger.Log().Error("[CopyJobService.GetCopyJob] 获取复制任务失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if job.Uuid == "" {
+		return serializer.NotAuthErr("")
+	}
+	return serializer.Success(serializer.BuildCopyJob(job))
+}
+
+// buildCopyResult 将单个条目的批量操作结果转换为复制结果，查询复制生成的文件、文件夹或后台任务
+func buildCopyResult(caller string, result batchResult, err error) serializer.Response {
+	if errors.Is(err, errTargetNotFound) {
+		return serializer.NotAuthErr("")
+	}
+	if err != nil {
+		logger.Log().Error(caller+" 复制失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	item := result.Items[0]
+	switch {
+	case item.Error == "FileNotFound" || item.Error == "FileFolderNotFound":
+		return serializer.NotAuthErr("")
+	case !item.Success:
+		return serializer.ParamsErr(item.Error, nil)
+	case item.Skipped:
+		return serializer.Success(copyResult{Skipped: true})
+	}
+
+	var res copyResult
+	switch {
+	case item.JobId != "":
+		var job model.CopyJob
+		err = model.DB.Where("uuid = ?", item.JobId).First(&job).Error
+		copyJob := serializer.BuildCopyJob(job)
+		res.Job = &copyJob
+	case item.Type == itemTypeFile:
+		var file model.File
+		err = model.DB.Where("uuid = ?", item.NewId).First(&file).Error
+		newFile := serializer.BuildFile(file)
+		res.File = &newFile
+	default:
+		var fileFolder model.FileFolder
+		err = model.DB.Where("uuid = ?", item.NewId).First(&fileFolder).Error
+		newFileFolder := serializer.BuildFileFolder(fileFolder)
+		res.FileFolder = &newFileFolder
+	}
+	if err != nil {
+		logger.Log().Error(caller+" 获取复制结果失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	return serializer.Success(res)
+}
+
+// enqueueCopyJob 提交后台复制任务到消息队列，提交失败时将任务标记为失败
+func enqueueCopyJob(job model.CopyJob) {
+	// 限制1秒超时
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	defer cancel()
+
+	body, err := json.Marshal(task.FileCopyRequest{JobId: job.Uuid})
+	if err == nil {
+		err = rabbitMQ.SendMessageToMQ(ctx, rabbitMQ.RabbitMqFileCopyQueue, body)
+	}
+	if err == nil {
+		return
+	}
+	logger.Log().Error("[enqueueCopyJob] 发送复制任务失败: ", err)
+	if err := model.DB.Model(&model.CopyJob{}).Where("uuid = ?", job.Uuid).Updates(map[string]interface{}{
+		"status": model.CopyJobFailed,
+		"error":  "EnqueueFailed",
+	}).Error; err != nil {
+		logger.Log().Error("[enqueueCopyJob] 更新复制任务状态失败: ", err)
+	}
+}
@@ -0,0 +1,87 @@
+package batch
+
+import (
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+func TestCopyFileAndFileFolder(t *testing.T) {
+	test.Setup(t)
+	f := newBatchFixture(t, 1024)
+
+	service := FileCopyService{Target: f.backup.Uuid}
+	res := service.CopyFile(f.user.Uuid, f.a.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("复制文件失败: %+v", res)
+	}
+	files := test.Files(t, f.backup.Uuid)
+	if len(files) != 1 || files[0].Uuid != res.Data.(copyResult).File.Uuid || files[0].Object() != f.a.Object() {
+		t.Fatalf("复制的文件应复用原文件的云端对象: %+v", files)
+	}
+
+	res = service.CopyFileFolder(f.user.Uuid, f.docs.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("复制文件夹失败: %+v", res)
+	}
+	folder := res.Data.(copyResult).FileFolder
+	if folder == nil || folder.Size != 7 {
+		t.Fatalf("复制的文件夹不符: %+v", res.Data)
+	}
+	if backup := test.Folder(t, f.backup.Uuid); backup.Size != 10 {
+		t.Fatalf("目标文件夹大小%d，期望10", backup.Size)
+	}
+	if store := test.Store(t, f.user.Uuid); store.CurrentSize != 17 {
+		t.Fatalf("存储空间已用%d，期望17", store.CurrentSize)
+	}
+	test.CheckSizes(t, f.user.Uuid)
+
+	// 不能复制到自身的子文件夹中，skip时同名文件夹不复制
+	if res := (&FileCopyService{Target: f.sub.Uuid}).CopyFileFolder(f.user.Uuid, f.docs.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "CannotCopyIntoItself" {
+		t.Fatalf("复制到子文件夹中应返回CannotCopyIntoItself: %+v", res)
+	}
+	service.Conflict = model.ConflictSkip
+	if res := service.CopyFileFolder(f.user.Uuid, f.docs.Uuid); res.Code != serializer.CodeSuccess || !res.Data.(copyResult).Skipped {
+		t.Fatalf("skip时应跳过同名文件夹: %+v", res)
+	}
+	test.CheckSizes(t, f.user.Uuid)
+}
+
+func TestCopyLargeFileFolderCreatesJob(t *testing.T) {
+	test.Setup(t)
+	f := newBatchFixture(t, 1024)
+	files := make([]model.File, copyJobThreshold)
+	for i := range files {
+		files[i] = model.File{Owner: f.user.Uuid, FileName: "empty", FilePostfix: "txt", FileUuid: "empty-object", ParentFolderId: f.sub.Uuid}
+	}
+	if err := model.DB.CreateInBatches(files, 200).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 子树较大时不在请求中复制，只创建任务；测试中没有消息队列，任务提交失败后标记为失败
+	res := (&FileCopyService{Target: f.backup.Uuid}).CopyFileFolder(f.user.Uuid, f.docs.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("复制文件夹失败: %+v", res)
+	}
+	job := res.Data.(copyResult).Job
+	if job == nil || job.TotalFiles != copyJobThreshold+2 {
+		t.Fatalf("应返回后台复制任务: %+v", res.Data)
+	}
+	if folder := test.Folder(t, f.backup.Uuid); folder.Size != 0 {
+		t.Fatalf("任务执行前目标文件夹大小%d，期望0", folder.Size)
+	}
+
+	res = (&CopyJobService{}).GetCopyJob(f.user.Uuid, job.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("查询复制任务失败: %+v", res)
+	}
+	if got := res.Data.(serializer.CopyJob); got.Status != model.CopyJobFailed || got.Error != "EnqueueFailed" {
+		t.Fatalf("任务提交失败后应标记为失败: %+v", got)
+	}
+	other := test.CreateUser(t, 1024)
+	if res := (&CopyJobService{}).GetCopyJob(other.Uuid, job.Uuid); res.Code != serializer.CodeNotAuthError {
+		t.Fatalf("不能查询其他用户的任务: %+v", res)
+	}
+}
@@ -2,28 +2,31 @@ package chunk
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"sort"
+	"strings"
 
 	"go-cloud-disk/cache"
 	"go-cloud-disk/disk"
 	"go-cloud-disk/model"
+	"go-cloud-disk/rabbitMQ/task"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils"
 	"go-cloud-disk/utils/logger"
 
-	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // FileChunkCompleteService 完成分片上传服务
 type FileChunkCompleteService struct {
-	UploadId string `json:"upload_id" binding:"required"` // 上传任务ID
+	UploadId string `json:"upload_id" binding:"required"`                                  // 上传任务ID
+	FileHash string `json:"file_hash" binding:"omitempty,len=64,hexadecimal"`              // 客户端声明的整个文件SHA-256，可选
+	Conflict string `json:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认overwrite，旧内容保留为历史版本
 }
 
-// CompleteChunkUpload 完成分片上传，合并分片并上传到COS
+// CompleteChunkUpload 完成分片上传，创建等待中的文件记录，分片在后台合并，完成后文件变为可用。
+// 客户端通过GetUploadStatus轮询合并结果，校验不通过等失败原因记录在合并任务中
 func (service *FileChunkCompleteService) CompleteChunkUpload(userId string) serializer.Response {
 	// 1. 获取上传任务信息
 	uploadInfo, err := getChunkUploadInfoFromRedis(service.UploadId)
@@ -37,149 +40,122 @@ func (service *FileChunkCompleteService) CompleteChunkUpload(userId string) seri
 		return serializer.NotAuthErr("没有权限")
 	}
 
-	// 3. 检查所有分片是否都已上传
-	if len(uploadInfo.UploadedChunks) != uploadInfo.TotalChunks {
-		return serializer.ParamsErr("分片未完全上传", fmt.Errorf("已上传%d个，需要%d个", len(uploadInfo.UploadedChunks), uploadInfo.TotalChunks))
+	// 3. 创建文件记录并提交分片合并任务
+	fileModel, err := completeUpload(uploadInfo, service.FileHash, service.Conflict)
+	switch {
+	case errors.Is(err, model.ErrNameConflict):
+		return serializer.ParamsErr("NameConflict", nil)
+	case errors.Is(err, errChunksMissing):
+		return serializer.ParamsErr("分片未完全上传", err)
+	case errors.Is(err, errExceedStoreLimit):
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	case err != nil:
+		logger.Log().Error("[FileChunkCompleteService.CompleteChunkUpload] 完成分片上传失败: ", err)
+		return serializer.InternalErr("", err)
 	}
 
-	// 4. 验证分片完整性
-	expectedChunks := make([]int, uploadInfo.TotalChunks)
-	for i := 0; i < uploadInfo.TotalChunks; i++ {
-		expectedChunks[i] = i + 1
-	}
+	return serializer.Success(serializer.BuildFile(*fileModel))
+}
 
-	sort.Ints(uploadInfo.UploadedChunks)
-	if !isSliceEqual(expectedChunks, uploadInfo.UploadedChunks) {
-		return serializer.ParamsErr("分片不完整", nil)
+// completeUpload 检查分片完整性，创建等待中的文件记录和分片合并任务，分片接口和tus接口共用此流程。
+// 分片在后台合并，合并后计算内容哈希，expectedHash不为空时校验SHA-256，不一致则文件标记为失败。
+// conflict为同名冲突策略，跳过时取消上传并返回已有文件
+func completeUpload(uploadInfo *ChunkUploadInfo, expectedHash string, conflict string) (*model.File, error) {
+	if conflict == "" {
+		conflict = model.ConflictOverwrite
 	}
 
-	// 5. 合并分片文件
-	mergedFilePath, fileMD5, err := service.mergeChunkFiles(uploadInfo)
-	if err != nil {
-		logger.Log().Error("[FileChunkCompleteService.CompleteChunkUpload] 合并分片失败: ", err)
-		return serializer.InternalErr("合并分片失败", err)
+	// 1. 检查所有分片是否都已上传
+	missingChunks := findMissingChunks(uploadInfo.UploadedChunks, uploadInfo.TotalChunks)
+	if len(missingChunks) != 0 {
+		return nil, fmt.Errorf("%w: 缺少分片%v", errChunksMissing, missingChunks)
 	}
-	defer os.Remove(mergedFilePath) // 确保清理临时文件
 
-	// 6. 检查用户存储空间
-	var userStore model.FileStore
-	isExceed, err := checkIfFileSizeExceedsVolum(&userStore, userId, uploadInfo.FileSize)
+	// 创建记录前检查同名冲突，冲突时保留上传任务，客户端可更换策略后重试
+	filename, extend := utils.SplitFilename(uploadInfo.FileName)
+	existing, err := model.ResolveFileName(model.DB, &model.File{
+		Owner:          uploadInfo.UserId,
+		FileName:       filename,
+		FilePostfix:    extend,
+		ParentFolderId: uploadInfo.FolderId,
+	}, conflict)
 	if err != nil {
-		logger.Log().Error("[FileChunkCompleteService.CompleteChunkUpload] 检查用户容量失败: ", err)
-		return serializer.DBErr("", err)
+		return nil, err
 	}
-	if isExceed {
-		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	if existing != nil && conflict == model.ConflictSkip {
+		abortUpload(uploadInfo)
+		return existing, nil
 	}
 
-	// 7. 检查文件是否已存在（去重）
-	existingFilePath := model.GetFileInfoFromRedis(fileMD5)
-	needUploadToCOS := existingFilePath == ""
-	if needUploadToCOS {
-		existingFilePath = userId
+	// 2. 创建等待中的文件记录和分片合并任务，容量已在初始化时预留
+	fileModel, job, err := createFileRecord(uploadInfo, strings.ToLower(expectedHash), conflict)
+	if errors.Is(err, errExceedStoreLimit) || errors.Is(err, model.ErrNameConflict) {
+		abortUpload(uploadInfo)
+		return nil, err
 	}
-
-	// 8. 创建文件记录并入库（先完成数据库操作）
-	fileModel, err := service.createFileRecord(uploadInfo, fileMD5, existingFilePath, userId, userStore)
 	if err != nil {
-		logger.Log().Error("[FileChunkCompleteService.CompleteChunkUpload] 创建文件记录失败: ", err)
-		return serializer.DBErr("创建文件记录失败", err)
+		return nil, fmt.Errorf("创建文件记录失败: %v", err)
 	}
-
-	// 7.1 如果需要上传到COS，使用协程异步处理
-	if needUploadToCOS {
-		go func() {
-			// 复制合并文件路径，因为主协程会删除原文件
-			tempCopyPath := mergedFilePath + ".png"
-			if err := service.copyFile(mergedFilePath, tempCopyPath); err != nil {
-				logger.Log().Error("[FileChunkCompleteService.CompleteChunkUpload] 复制临时文件失败: ", err)
-				return
-			}
-			defer os.Remove(tempCopyPath) // 确保清理复制的临时文件
-
-			// 异步上传到COS
-			err := disk.BaseCloudDisk.UploadSimpleFile(tempCopyPath, userId, fileMD5, uploadInfo.FileSize)
-			if err != nil {
-				logger.Log().Error("[FileChunkCompleteService.CompleteChunkUpload] 异步上传文件到COS失败: ", err)
-				// 这里可以考虑重试机制或者更新文件状态
-				return
-			}
-
-			logger.Log().Info("[FileChunkCompleteService.CompleteChunkUpload] 文件异步上传到COS成功: ", fileMD5)
-		}()
+	if job == nil {
+		abortUpload(uploadInfo)
+		return fileModel, nil
 	}
 
-	// 9. 清理Redis分片信息
-	if err := service.cleanupChunkInfo(service.UploadId, uploadInfo.TotalChunks); err != nil {
-		logger.Log().Error("[FileChunkCompleteService.CompleteChunkUpload] 清理Redis分片信息失败: ", err)
+	// 3. 清理Redis分片信息，之后由合并任务负责云端分片上传
+	if err := cleanupChunkInfo(uploadInfo); err != nil {
+		logger.Log().Error("[completeUpload] 清理Redis分片信息失败: ", err)
 		// 不返回错误，因为文件已经成功创建
 	}
 
-	// 10. 清理本地分片文件
-	service.cleanupLocalChunkFiles(service.UploadId)
-
-	// 11. 保存文件信息到Redis
-	fileModel.SaveFileUploadInfoToRedis()
-
-	return serializer.Success(serializer.BuildFile(*fileModel))
-}
-
-// mergeChunkFiles 合并分片文件
-func (service *FileChunkCompleteService) mergeChunkFiles(uploadInfo *ChunkUploadInfo) (string, string, error) {
-	// 创建临时合并文件
-	tempDir := "./tmp_merge"
-	if err := os.MkdirAll(tempDir, 0o755); err != nil {
-		return "", "", fmt.Errorf("创建临时目录失败: %v", err)
-	}
-
-	mergedFilePath := filepath.Join(tempDir, fmt.Sprintf("merged_%s_%s", service.UploadId, uploadInfo.FileName))
-	mergedFile, err := os.Create(mergedFilePath)
-	if err != nil {
-		return "", "", fmt.Errorf("创建合并文件失败: %v", err)
+	// 4. 提交分片合并任务，提交失败时由定时任务重新提交
+	if err := task.EnqueueUploadJob(job); err != nil {
+		logger.Log().Error("[completeUpload] 提交分片合并任务失败: ", err)
 	}
-	defer mergedFile.Close()
 
-	// 按顺序合并所有分片
-	chunkDir := filepath.Join("./tmp_chunks", service.UploadId)
-	for i := 0; i < uploadInfo.TotalChunks; i++ {
-		chunkPath := filepath.Join(chunkDir, fmt.Sprintf("chunk_%d", i+1))
-
-		chunkFile, err := os.Open(chunkPath)
-		if err != nil {
-			return "", "", fmt.Errorf("打开分片文件 %s 失败: %v", chunkPath, err)
-		}
-
-		_, err = io.Copy(mergedFile, chunkFile)
-		chunkFile.Close()
+	return fileModel, nil
+}
 
-		if err != nil {
-			return "", "", fmt.Errorf("复制分片 %d 失败: %v", i, err)
+// buildPartList 按分片序号构建云端合并所需的分片列表
+func buildPartList(uploadInfo *ChunkUploadInfo) []disk.Part {
+	parts := make([]disk.Part, 0, len(uploadInfo.Parts))
+	for partNumber, etag := range uploadInfo.Parts {
+		if partNumber < 1 || partNumber > uploadInfo.TotalChunks {
+			continue
 		}
+		parts = append(parts, disk.Part{PartNumber: partNumber, ETag: etag})
 	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].PartNumber < parts[j].PartNumber
+	})
+	return parts
+}
 
-	// 计算合并后文件的MD5
-	fileMD5, err := utils.GetFileMD5(mergedFilePath)
-	if err != nil {
-		return "", "", fmt.Errorf("计算文件MD5失败: %v", err)
+// abortUpload 取消云端分片上传并清理Redis分片信息
+func abortUpload(uploadInfo *ChunkUploadInfo) {
+	if err := disk.BaseCloudDisk.AbortMultipartUpload(uploadInfo.UserId, "", uploadInfo.ObjectName, uploadInfo.CloudUploadId); err != nil {
+		logger.Log().Error("[abortUpload] 取消云端分片上传失败: ", err)
+	}
+	if err := cleanupChunkInfo(uploadInfo); err != nil {
+		logger.Log().Error("[abortUpload] 清理Redis分片信息失败: ", err)
 	}
-
-	return mergedFilePath, fileMD5, nil
 }
 
-// createFileRecord 创建文件记录并入库
-func (service *FileChunkCompleteService) createFileRecord(uploadInfo *ChunkUploadInfo, fileMD5, filePath, userId string, userStore model.FileStore) (*model.File, error) {
+// createFileRecord 创建等待中的文件记录和分片合并任务，按conflict处理上传期间出现的同名文件，
+// 跳过时返回已有文件且不创建合并任务
+func createFileRecord(uploadInfo *ChunkUploadInfo, expectedHash string, conflict string) (*model.File, *model.UploadJob, error) {
 	// 分离文件名和扩展名
 	filename, extend := utils.SplitFilename(uploadInfo.FileName)
 
-	// 创建文件模型
+	// 创建文件模型，云端对象以上传任务ID命名
 	fileModel := model.File{
-		Owner:          userId,
+		Owner:          uploadInfo.UserId,
 		FileName:       filename,
 		FilePostfix:    extend,
-		FileUuid:       fileMD5,
-		FilePath:       filePath,
+		FileUuid:       uploadInfo.UploadId,
+		FilePath:       uploadInfo.UserId,
 		ParentFolderId: uploadInfo.FolderId,
 		Size:           uploadInfo.FileSize,
+		Status:         model.FileStatusPending,
 	}
 
 	// 开始数据库事务
@@ -190,100 +166,59 @@ func (service *FileChunkCompleteService) createFileRecord(uploadInfo *ChunkUploa
 		}
 	}()
 
+	// 锁定用户存储空间，将预留容量转为已用容量
+	var userStore model.FileStore
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", uploadInfo.UserId).First(&userStore).Error; err != nil {
+		tx.Rollback()
+		return nil, nil, fmt.Errorf("获取用户存储信息失败: %v", err)
+	}
+	if err := model.ReleaseUploadReservation(tx, uploadInfo.UploadId); err != nil {
+		tx.Rollback()
+		return nil, nil, fmt.Errorf("释放预留容量失败: %v", err)
+	}
+
 	// 创建文件记录
-	if err := createFile(tx, fileModel, userStore); err != nil {
+	folderDelta, skipped, err := model.CreateFile(tx, &fileModel, &userStore, conflict)
+	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("保存文件信息失败: %v", err)
+		return nil, nil, err
 	}
 
 	// 更新文件夹大小
 	var userFileFolder model.FileFolder
 	if err := tx.Where("uuid = ?", uploadInfo.FolderId).First(&userFileFolder).Error; err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("获取文件夹信息失败: %v", err)
+		return nil, nil, fmt.Errorf("获取文件夹信息失败: %v", err)
 	}
 
-	if err := userFileFolder.AddFileFolderSize(tx, uploadInfo.FileSize); err != nil {
+	if err := userFileFolder.AddFileFolderSize(tx, folderDelta); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("更新文件夹容量失败: %v", err)
-	}
-
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("提交事务失败: %v", err)
-	}
-
-	return &fileModel, nil
-}
-
-// cleanupChunkInfo 清理Redis中的分片信息
-func (service *FileChunkCompleteService) cleanupChunkInfo(uploadId string, totalChunks int) error {
-	// 构建要删除的Redis键列表
-	keys := []string{
-		cache.ChunkUploadInfoKey(uploadId),
+		return nil, nil, fmt.Errorf("更新文件夹容量失败: %v", err)
 	}
 
-	// 添加所有分片信息的键
-	for i := 0; i < totalChunks; i++ {
-		chunkKey := fmt.Sprintf("chunk:%s:%d", uploadId, i)
-		keys = append(keys, chunkKey+":info", chunkKey+":data")
-	}
-
-	// 批量删除Redis键
-	return cache.RedisClient.Del(context.Background(), keys...).Err()
-}
-
-// cleanupLocalChunkFiles 清理本地分片文件
-func (service *FileChunkCompleteService) cleanupLocalChunkFiles(uploadId string) {
-	chunkDir := filepath.Join("./tmp_chunks", uploadId)
-	if err := os.RemoveAll(chunkDir); err != nil {
-		logger.Log().Error("[FileChunkCompleteService.cleanupLocalChunkFiles] 清理本地分片文件失败: ", err)
-	}
-}
-
-// createFile 使用事务保存用户文件信息
-func createFile(tx *gorm.DB, file model.File, userStore model.FileStore) error {
-	// 保存文件信息到数据库
-	if err := tx.Save(&file).Error; err != nil {
-		return err
+	// 创建分片合并任务，与文件记录一起提交，保证合并任务不会丢失
+	var job *model.UploadJob
+	if !skipped {
+		if job, err = model.NewUploadJob(tx, fileModel, uploadInfo.CloudUploadId, buildPartList(uploadInfo), expectedHash); err != nil {
+			tx.Rollback()
+			return nil, nil, fmt.Errorf("创建分片合并任务失败: %v", err)
+		}
 	}
 
-	// 增加用户文件存储容量
-	userStore.AddCurrentSize(file.Size)
-	if err := tx.Save(&userStore).Error; err != nil {
-		return err
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return nil, nil, fmt.Errorf("提交事务失败: %v", err)
 	}
 
-	return nil
+	return &fileModel, job, nil
 }
 
-// copyFile 复制文件
-func (service *FileChunkCompleteService) copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
+// cleanupChunkInfo 清理Redis中的分片信息、上传会话和tus暂存数据，并释放预留容量
+func cleanupChunkInfo(uploadInfo *ChunkUploadInfo) error {
+	releaseReservation(uploadInfo.UploadId)
+	removeTusBuffers(uploadInfo.UploadId, "")
+	if err := cache.RedisClient.Del(context.Background(), cache.ChunkUploadInfoKey(uploadInfo.UploadId)).Err(); err != nil {
 		return err
 	}
-	defer sourceFile.Close()
-
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	_, err = io.Copy(destFile, sourceFile)
-	return err
-}
-
-// isSliceEqual 比较两个int切片是否相等
-func isSliceEqual(a, b []int) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
-	}
-	return true
+	return unregisterUploadSession(uploadInfo.UserId, uploadInfo.UploadId)
 }
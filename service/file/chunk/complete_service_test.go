@@ -0,0 +1,239 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// initUpload 初始化分片上传并返回上传任务ID
+func initUpload(t *testing.T, user model.User, fileName string, size int) string {
+	t.Helper()
+	service := ChunkInitService{FolderId: user.UserMainFileFolderID, FileName: fileName, FileSize: int64(size)}
+	res := service.InitChunkUpload(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("初始化分片上传失败: %+v", res)
+	}
+	return res.Data.(map[string]interface{})["upload_id"].(string)
+}
+
+// uploadChunk 上传data中第chunkNumber个分片
+func uploadChunk(t *testing.T, userId string, uploadId string, chunkNumber int, data []byte) serializer.Response {
+	t.Helper()
+	start := (chunkNumber - 1) * ChunkSize
+	end := min(start+ChunkSize, len(data))
+	service := FileChunkUploadService{UploadId: uploadId, ChunkNumber: chunkNumber}
+	return service.UploadChunk(userId, test.FileHeader(t, "chunk", data[start:end]))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func reservedSize(t *testing.T, userId string) int64 {
+	t.Helper()
+	reserved, err := model.GetReservedSize(model.DB, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reserved
+}
+
+func TestCompleteChunkUpload(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("chunked content")
+
+	uploadId := initUpload(t, user, "notes.txt", len(data))
+	if reserved := reservedSize(t, user.Uuid); reserved != int64(len(data)) {
+		t.Fatalf("初始化后预留%d，期望%d", reserved, len(data))
+	}
+	if res := uploadChunk(t, user.Uuid, uploadId, 1, data); res.Code != serializer.CodeSuccess {
+		t.Fatalf("上传分片失败: %+v", res)
+	}
+
+	service := FileChunkCompleteService{UploadId: uploadId, FileHash: sha256Hex(data)}
+	res := service.CompleteChunkUpload(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("完成分片上传失败: %+v", res)
+	}
+	file := res.Data.(serializer.File)
+	if file.Status != model.FileStatusPending || file.Size != int64(len(data)) {
+		t.Fatalf("完成上传后文件应等待后台合并: %+v", file)
+	}
+
+	// 分片在后台合并，完成上传时不合并
+	if count := mem.CallCount("CompleteMultipartUpload"); count != 0 {
+		t.Fatalf("完成上传时合并了%d次分片，期望0", count)
+	}
+	var job model.UploadJob
+	if err := model.DB.Where("uuid = ?", uploadId).First(&job).Error; err != nil {
+		t.Fatalf("没有创建分片合并任务: %v", err)
+	}
+	if job.FileId != file.Uuid || job.ExpectedHash != sha256Hex(data) || job.Status != model.UploadJobPending {
+		t.Fatalf("分片合并任务不符: %+v", job)
+	}
+	parts, err := job.PartList()
+	if err != nil || len(parts) != 1 || parts[0].PartNumber != 1 {
+		t.Fatalf("分片合并任务的分片列表不符: %+v, err=%v", parts, err)
+	}
+
+	// 预留转为已用，Redis中的上传信息已清理
+	if reserved := reservedSize(t, user.Uuid); reserved != 0 {
+		t.Fatalf("完成上传后仍预留%d", reserved)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != int64(len(data)) {
+		t.Fatalf("存储空间已用%d，期望%d", store.CurrentSize, len(data))
+	}
+	if exist := cache.RedisClient.Exists(context.Background(), cache.ChunkUploadInfoKey(uploadId)).Val(); exist != 0 {
+		t.Fatal("完成上传后Redis中仍有上传信息")
+	}
+}
+
+func TestCompleteChunkUploadMissingChunks(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 3*ChunkSize)
+	data := bytes.Repeat([]byte("x"), ChunkSize+10)
+
+	uploadId := initUpload(t, user, "big.bin", len(data))
+	if res := uploadChunk(t, user.Uuid, uploadId, 1, data); res.Code != serializer.CodeSuccess {
+		t.Fatalf("上传分片失败: %+v", res)
+	}
+
+	service := FileChunkCompleteService{UploadId: uploadId}
+	res := service.CompleteChunkUpload(user.Uuid)
+	if res.Code != serializer.CodeParamsError {
+		t.Fatalf("缺少分片时应返回参数错误: %+v", res)
+	}
+	if files := test.Files(t, user.UserMainFileFolderID); len(files) != 0 {
+		t.Fatalf("缺少分片时不应创建文件记录: %+v", files)
+	}
+
+	// 补传分片后可以继续完成上传
+	if res := uploadChunk(t, user.Uuid, uploadId, 2, data); res.Code != serializer.CodeSuccess {
+		t.Fatalf("上传分片失败: %+v", res)
+	}
+	if res := service.CompleteChunkUpload(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("补传分片后完成上传失败: %+v", res)
+	}
+}
+
+func TestCompleteChunkUploadConflict(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("chunked content")
+
+	first := initUpload(t, user, "notes.txt", len(data))
+	uploadChunk(t, user.Uuid, first, 1, data)
+	if res := (&FileChunkCompleteService{UploadId: first}).CompleteChunkUpload(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("完成分片上传失败: %+v", res)
+	}
+
+	// 冲突策略为fail时保留上传任务，客户端可以更换策略后重试
+	second := initUpload(t, user, "notes.txt", len(data))
+	uploadChunk(t, user.Uuid, second, 1, data)
+	res := (&FileChunkCompleteService{UploadId: second, Conflict: model.ConflictFail}).CompleteChunkUpload(user.Uuid)
+	if res.Code != serializer.CodeParamsError || res.Msg != "NameConflict" {
+		t.Fatalf("同名冲突时应返回NameConflict: %+v", res)
+	}
+	if exist := cache.RedisClient.Exists(context.Background(), cache.ChunkUploadInfoKey(second)).Val(); exist == 0 {
+		t.Fatal("同名冲突时不应清理上传信息")
+	}
+
+	// 跳过时取消云端分片上传并返回已有文件，取消失败不影响结果
+	mem.FailOn("AbortMultipartUpload", errors.New("cloud unavailable"))
+	res = (&FileChunkCompleteService{UploadId: second, Conflict: model.ConflictSkip}).CompleteChunkUpload(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("跳过同名文件失败: %+v", res)
+	}
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 || res.Data.(serializer.File).Uuid != files[0].Uuid {
+		t.Fatalf("跳过时应返回已有文件: %+v, 文件夹中的文件: %+v", res.Data, files)
+	}
+	if count := mem.CallCount("AbortMultipartUpload"); count != 1 {
+		t.Fatalf("跳过时取消云端分片上传%d次，期望1次", count)
+	}
+	if reserved := reservedSize(t, user.Uuid); reserved != 0 {
+		t.Fatalf("跳过后仍预留%d", reserved)
+	}
+}
+
+func TestChunkUploadCloudFailure(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("chunked content")
+
+	// 云端初始化失败时释放预留容量
+	mem.FailOn("InitMultipartUpload", errors.New("cloud unavailable"))
+	service := ChunkInitService{FolderId: user.UserMainFileFolderID, FileName: "notes.txt", FileSize: int64(len(data))}
+	if res := service.InitChunkUpload(user.Uuid); res.Code != serializer.CodeInternalError {
+		t.Fatalf("云端初始化失败时应返回内部错误: %+v", res)
+	}
+	if reserved := reservedSize(t, user.Uuid); reserved != 0 {
+		t.Fatalf("云端初始化失败后仍预留%d", reserved)
+	}
+	mem.FailOn("InitMultipartUpload", nil)
+
+	// 分片上传到云端失败时不记录分片，重传成功后可以完成上传
+	uploadId := initUpload(t, user, "notes.txt", len(data))
+	mem.FailOn("UploadPart", errors.New("cloud unavailable"))
+	res := uploadChunk(t, user.Uuid, uploadId, 1, data)
+	if res.Code != serializer.CodeInternalError || res.Msg != "SaveChunkFailed" {
+		t.Fatalf("分片上传到云端失败时应返回SaveChunkFailed: %+v", res)
+	}
+	if res := (&FileChunkCompleteService{UploadId: uploadId}).CompleteChunkUpload(user.Uuid); res.Code != serializer.CodeParamsError {
+		t.Fatalf("分片上传失败后完成上传应返回参数错误: %+v", res)
+	}
+	mem.FailOn("UploadPart", nil)
+	if res := uploadChunk(t, user.Uuid, uploadId, 1, data); res.Code != serializer.CodeSuccess {
+		t.Fatalf("重传分片失败: %+v", res)
+	}
+	if res := (&FileChunkCompleteService{UploadId: uploadId}).CompleteChunkUpload(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("重传分片后完成上传失败: %+v", res)
+	}
+}
+
+func TestCompleteEmptyChunkUpload(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+
+	// 空文件能通过参数校验，负数大小不能
+	if err := binding.Validator.ValidateStruct(&ChunkInitService{FolderId: user.UserMainFileFolderID, FileName: "empty.txt"}); err != nil {
+		t.Fatalf("空文件应通过参数校验: %v", err)
+	}
+	if err := binding.Validator.ValidateStruct(&ChunkInitService{FolderId: user.UserMainFileFolderID, FileName: "empty.txt", FileSize: -1}); err == nil {
+		t.Fatal("负数大小不应通过参数校验")
+	}
+
+	// 与tus一致，初始化时上传唯一的空分片，不上传分片即可完成
+	uploadId := initUpload(t, user, "empty.txt", 0)
+	if count := mem.CallCount("UploadPart"); count != 1 {
+		t.Fatalf("初始化时上传了%d个分片，期望1个", count)
+	}
+	service := FileChunkCompleteService{UploadId: uploadId, FileHash: sha256Hex(nil)}
+	res := service.CompleteChunkUpload(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("完成空文件上传失败: %+v", res)
+	}
+	if file := res.Data.(serializer.File); file.Size != 0 {
+		t.Fatalf("空文件大小%d", file.Size)
+	}
+	var job model.UploadJob
+	if err := model.DB.Where("uuid = ?", uploadId).First(&job).Error; err != nil {
+		t.Fatalf("没有创建分片合并任务: %v", err)
+	}
+	if parts, err := job.PartList(); err != nil || len(parts) != 1 {
+		t.Fatalf("分片合并任务的分片列表不符: %+v, err=%v", parts, err)
+	}
+}
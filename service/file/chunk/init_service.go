@@ -1,119 +1,209 @@
 package chunk
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
-	"mime/multipart"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"go-cloud-disk/cache"
+	"go-cloud-disk/disk"
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils"
 	"go-cloud-disk/utils/logger"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 const (
 	ChunkSize = 5 * 1024 * 1024 // 5MB 分片大小
+
+	// chunkUploadExpire 分片上传信息在Redis中的过期时间
+	chunkUploadExpire = 24 * time.Hour
+
+	// partFieldPrefix 分片ETag在Redis哈希中的字段前缀，每个分片单独一个字段，避免并发上传时覆盖
+	partFieldPrefix = "Part:"
+)
+
+var (
+	errInvalidFileSize  = errors.New("文件大小不能小于0")
+	errFolderNotOwned   = errors.New("文件夹不属于当前用户")
+	errExceedStoreLimit = model.ErrExceedStoreLimit
+	errChunksMissing    = errors.New("分片未完全上传")
+	errUploadNotFound   = errors.New("上传任务不存在或已过期")
 )
 
+// saveUploadFieldsScript 上传信息仍存在时才写入字段，避免上传任务过期或被取消后迟到的分片重新创建没有过期时间的哈希
+var saveUploadFieldsScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+return redis.call("HSET", KEYS[1], unpack(ARGV))`)
+
 type ChunkInitService struct {
 	FolderId string `form:"filefolder" json:"filefolder" binding:"required"` // 文件夹ID
+	FileName string `form:"file_name" json:"file_name" binding:"required"`   // 文件名
+	FileSize int64  `form:"file_size" json:"file_size" binding:"min=0"`      // 文件总大小，空文件为0
 }
 
 type ChunkUploadInfo struct {
-	UploadId       string    `json:"upload_id"`       // 上传任务ID
-	FileName       string    `json:"file_name"`       // 文件名
-	FileSize       int64     `json:"file_size"`       // 文件总大小
-	ChunkSize      int64     `json:"chunk_size"`      // 分片大小
-	TotalChunks    int       `json:"total_chunks"`    // 总分片数
-	FolderId       string    `json:"folder_id"`       // 文件夹ID
-	UserId         string    `json:"user_id"`         // 用户ID
-	CreatedAt      time.Time `json:"created_at"`      // 创建时间
-	UploadedChunks []int     `json:"uploaded_chunks"` // 已上传的分片列表
+	UploadId       string         `json:"upload_id"`       // 上传任务ID
+	FileName       string         `json:"file_name"`       // 文件名
+	FileSize       int64          `json:"file_size"`       // 文件总大小
+	ChunkSize      int64          `json:"chunk_size"`      // 分片大小
+	TotalChunks    int            `json:"total_chunks"`    // 总分片数
+	FolderId       string         `json:"folder_id"`       // 文件夹ID
+	UserId         string         `json:"user_id"`         // 用户ID
+	CreatedAt      time.Time      `json:"created_at"`      // 创建时间
+	UploadedChunks []int          `json:"uploaded_chunks"` // 已上传的分片列表
+	ObjectName     string         `json:"-"`               // 云端对象名
+	CloudUploadId  string         `json:"-"`               // 云端分片上传ID
+	Parts          map[int]string `json:"-"`               // 分片序号 -> 云端ETag
 }
 
-func (service *ChunkInitService) InitChunkUpload(userId string, file *multipart.FileHeader, dst string) serializer.Response {
-	// 获取用户上传文件并保存到本地
-	var userStore model.FileStore
-	var err error
-
-	// 检查添加文件大小后当前大小是否超过最大限制
-	var isExceed bool
-	if isExceed, err = checkIfFileSizeExceedsVolum(&userStore, userId, file.Size); err != nil {
-		logger.Log().Error("[FileUploadService.UploadFile] 检查用户容量失败: ", err)
-		return serializer.DBErr("", err)
+// InitChunkUpload 初始化分片上传，在云端创建分片上传任务。空文件在初始化时上传唯一的空分片，之后可直接完成上传
+func (service *ChunkInitService) InitChunkUpload(userId string) serializer.Response {
+	uploadInfo, err := newChunkUpload(userId, service.FolderId, service.FileName, service.FileSize)
+	if err == nil && service.FileSize == 0 {
+		err = uploadEmptyPart(uploadInfo)
 	}
-	if isExceed {
+	switch {
+	case errors.Is(err, errInvalidFileSize):
+		return serializer.ParamsErr("InvalidFileSize", nil)
+	case errors.Is(err, errFolderNotOwned):
+		return serializer.NotAuthErr("")
+	case errors.Is(err, errExceedStoreLimit):
 		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	case err != nil:
+		logger.Log().Error("[ChunkInitService.InitChunkUpload] 初始化分片上传失败: ", err)
+		return serializer.InternalErr("", err)
 	}
 
-	// 计算分片数
-	totalChunks := int((file.Size + ChunkSize - 1) / ChunkSize)
+	response := map[string]interface{}{
+		"upload_id":    uploadInfo.UploadId,
+		"chunk_size":   ChunkSize,
+		"total_chunks": uploadInfo.TotalChunks,
+		"file_size":    uploadInfo.FileSize,
+	}
 
-	// 生成上传任务ID
+	return serializer.Success(response)
+}
+
+// newChunkUpload 检查文件夹归属和用户容量，在云端初始化分片上传并将上传信息保存到Redis
+func newChunkUpload(userId string, folderId string, fileName string, fileSize int64) (*ChunkUploadInfo, error) {
+	if fileSize < 0 {
+		return nil, errInvalidFileSize
+	}
+
+	// 检查文件夹归属
+	var userFileFolder model.FileFolder
+	if err := model.DB.Where("uuid = ?", folderId).Find(&userFileFolder).Error; err != nil {
+		return nil, fmt.Errorf("获取文件夹信息失败: %v", err)
+	}
+	if userFileFolder.OwnerID != userId {
+		return nil, errFolderNotOwned
+	}
+
+	// 生成上传任务ID，并以其作为云端对象名
 	uploadId := uuid.New().String()
+	_, extend := utils.SplitFilename(fileName)
+	objectName := disk.ObjectName(uploadId, extend)
+	createdAt := time.Now()
+
+	// 检查容量并预留空间，直到上传完成、取消或过期
+	ok, err := model.ReserveUploadSize(userId, uploadId, fileSize, createdAt.Add(chunkUploadExpire))
+	if err != nil {
+		return nil, fmt.Errorf("预留用户容量失败: %v", err)
+	}
+	if !ok {
+		return nil, errExceedStoreLimit
+	}
+
+	// 计算分片数，云端合并至少需要一个分片，空文件上传一个空分片
+	totalChunks := max(int((fileSize+ChunkSize-1)/ChunkSize), 1)
+
+	// 在云端初始化分片上传
+	cloudUploadId, err := disk.BaseCloudDisk.InitMultipartUpload(userId, "", objectName)
+	if err != nil {
+		releaseReservation(uploadId)
+		return nil, err
+	}
 
 	// 创建分片上传信息
 	uploadInfo := ChunkUploadInfo{
-		UploadId:       uploadId,
-		FileName:       file.Filename,
-		FileSize:       file.Size,
-		ChunkSize:      ChunkSize,
-		TotalChunks:    totalChunks,
-		FolderId:       service.FolderId,
-		UserId:         userId,
-		CreatedAt:      time.Now(),
-		UploadedChunks: make([]int, 0),
+		UploadId:      uploadId,
+		FileName:      fileName,
+		FileSize:      fileSize,
+		ChunkSize:     ChunkSize,
+		TotalChunks:   totalChunks,
+		FolderId:      folderId,
+		UserId:        userId,
+		CreatedAt:     createdAt,
+		ObjectName:    objectName,
+		CloudUploadId: cloudUploadId,
+		Parts:         make(map[int]string),
 	}
 
 	// 保存到Redis，设置过期时间为24小时
 	if err := saveChunkUploadInfoToRedis(uploadId, uploadInfo); err != nil {
-		logger.Log().Error("[FileChunkInitService.InitChunkUpload] 保存上传信息到Redis失败: ", err)
-		return serializer.InternalErr("", err)
+		if err := disk.BaseCloudDisk.AbortMultipartUpload(userId, "", objectName, cloudUploadId); err != nil {
+			logger.Log().Error("[newChunkUpload] 取消云端分片上传失败: ", err)
+		}
+		releaseReservation(uploadId)
+		return nil, fmt.Errorf("保存上传信息到Redis失败: %v", err)
 	}
 
-	response := map[string]interface{}{
-		"upload_id":    uploadId,
-		"chunk_size":   ChunkSize,
-		"total_chunks": totalChunks,
-		"file_size":    file.Size,
+	// 登记上传会话，上传信息过期后仍可由定时任务取消云端分片上传
+	if err := registerUploadSession(&uploadInfo); err != nil {
+		logger.Log().Error("[newChunkUpload] 登记上传会话失败: ", err)
 	}
 
-	return serializer.Success(response)
+	return &uploadInfo, nil
+}
+
+// uploadEmptyPart 空文件没有数据可上传，在云端上传一个空分片作为唯一的分片，失败时取消上传
+func uploadEmptyPart(uploadInfo *ChunkUploadInfo) error {
+	etag, err := disk.BaseCloudDisk.UploadPart(uploadInfo.UserId, "", uploadInfo.ObjectName, uploadInfo.CloudUploadId, 1, bytes.NewReader(nil), 0)
+	if err == nil {
+		err = savePartToRedis(uploadInfo.UploadId, 1, etag)
+	}
+	if err != nil {
+		abortUpload(uploadInfo)
+		return err
+	}
+	uploadInfo.Parts[1] = etag
+	uploadInfo.UploadedChunks = []int{1}
+	return nil
 }
 
-// checkIfFileSizeExceedsVolum 检查上传文件大小是否超过用户存储空间限制
-func checkIfFileSizeExceedsVolum(userStore *model.FileStore, userId string, size int64) (bool, error) {
-	if err := model.DB.Where("owner_id = ?", userId).Find(userStore).Error; err != nil {
-		return false, err
+// releaseReservation 释放上传任务预留的容量
+func releaseReservation(uploadId string) {
+	if err := model.ReleaseUploadReservation(model.DB, uploadId); err != nil {
+		logger.Log().Error("[releaseReservation] 释放预留容量失败: ", err)
 	}
-	ans := userStore.CurrentSize+size > userStore.MaxSize
-	return ans, nil
 }
 
 // saveChunkUploadInfoToRedis 哈希存储分片上传信息
 func saveChunkUploadInfoToRedis(uploadId string, uploadInfo ChunkUploadInfo) error {
 	key := cache.ChunkUploadInfoKey(uploadId)
 
-	// 将 UploadedChunks 序列化为 JSON 字符串
-	uploadedChunks, err := json.Marshal(uploadInfo.UploadedChunks)
-	if err != nil {
-		return err
-	}
-
 	// Redis 哈希字段
 	fields := map[string]interface{}{
-		"UploadId":       uploadInfo.UploadId,
-		"FileName":       uploadInfo.FileName,
-		"FileSize":       uploadInfo.FileSize,
-		"ChunkSize":      uploadInfo.ChunkSize,
-		"TotalChunks":    uploadInfo.TotalChunks,
-		"FolderId":       uploadInfo.FolderId,
-		"UserId":         uploadInfo.UserId,
-		"CreatedAt":      uploadInfo.CreatedAt.Unix(), // 时间戳存储
-		"UploadedChunks": string(uploadedChunks),
+		"UploadId":      uploadInfo.UploadId,
+		"FileName":      uploadInfo.FileName,
+		"FileSize":      uploadInfo.FileSize,
+		"ChunkSize":     uploadInfo.ChunkSize,
+		"TotalChunks":   uploadInfo.TotalChunks,
+		"FolderId":      uploadInfo.FolderId,
+		"UserId":        uploadInfo.UserId,
+		"CreatedAt":     uploadInfo.CreatedAt.Unix(), // 时间戳存储
+		"ObjectName":    uploadInfo.ObjectName,
+		"CloudUploadId": uploadInfo.CloudUploadId,
 	}
 
 	// 写入哈希
@@ -122,5 +212,36 @@ func saveChunkUploadInfoToRedis(uploadId string, uploadInfo ChunkUploadInfo) err
 	}
 
 	// 设置过期时间
-	return cache.RedisClient.Expire(context.Background(), key, 24*time.Hour).Err()
+	return cache.RedisClient.Expire(context.Background(), key, chunkUploadExpire).Err()
+}
+
+// savePartToRedis 记录已上传分片的ETag，单字段写入保证并发上传不同分片时互不覆盖，
+// 上传信息已过期或被删除时返回errUploadNotFound
+func savePartToRedis(uploadId string, partNumber int, etag string) error {
+	return saveUploadFields(uploadId, partFieldPrefix+strconv.Itoa(partNumber), etag)
+}
+
+// saveUploadFields 上传信息仍存在时写入字段，args为交替的字段名和值，上传信息已过期或被删除时返回errUploadNotFound
+func saveUploadFields(uploadId string, args ...interface{}) error {
+	key := cache.ChunkUploadInfoKey(uploadId)
+	res, err := saveUploadFieldsScript.Run(context.Background(), cache.RedisClient, []string{key}, args...).Int()
+	if err != nil {
+		return err
+	}
+	if res < 0 {
+		return errUploadNotFound
+	}
+	return nil
+}
+
+// parsePartField 解析分片字段名中的分片序号
+func parsePartField(field string) (int, bool) {
+	if !strings.HasPrefix(field, partFieldPrefix) {
+		return 0, false
+	}
+	partNumber, err := strconv.Atoi(strings.TrimPrefix(field, partFieldPrefix))
+	if err != nil {
+		return 0, false
+	}
+	return partNumber, true
 }
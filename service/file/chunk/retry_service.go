@@ -0,0 +1,62 @@
+package chunk
+
+import (
+	"time"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/rabbitMQ/task"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+
+	"gorm.io/gorm"
+)
+
+// UploadRetryService 重试处理失败的分片上传服务
+type UploadRetryService struct{}
+
+// RetryUpload 重新执行失败文件的分片合并任务，文件回到等待状态。
+// 校验不通过、对账发现对象缺失等没有可重试任务的文件需要重新上传
+func (service *UploadRetryService) RetryUpload(userId string, fileId string) serializer.Response {
+	var file model.File
+	if err := model.DB.Where("uuid = ? and owner = ?", fileId, userId).Find(&file).Error; err != nil {
+		logger.Log().Error("[UploadRetryService.RetryUpload] 查找文件失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if file.Uuid == "" {
+		return serializer.NotAuthErr("")
+	}
+	if file.Status != model.FileStatusFailed {
+		return serializer.ParamsErr("FileNotFailed", nil)
+	}
+
+	var job model.UploadJob
+	if err := model.DB.Where("uuid = ? and file_path = ?", file.FileUuid, file.FilePath).Find(&job).Error; err != nil {
+		logger.Log().Error("[UploadRetryService.RetryUpload] 查找分片合并任务失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if job.Uuid == "" || !job.Retryable() {
+		return serializer.ParamsErr("FileCannotRetry", nil)
+	}
+
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		job.Status = model.UploadJobPending
+		job.Attempts = 0
+		job.RetryAt = time.Now()
+		job.Error = ""
+		if err := t.Save(&job).Error; err != nil {
+			return err
+		}
+		return model.SetObjectFilesStatus(t, job.Object(), model.FileStatusFailed, model.FileStatusPending, "")
+	})
+	if err != nil {
+		logger.Log().Error("[UploadRetryService.RetryUpload] 重置分片合并任务失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	// 提交失败时由定时任务重新提交
+	if err := task.EnqueueUploadJob(&job); err != nil {
+		logger.Log().Error("[UploadRetryService.RetryUpload] 提交分片合并任务失败: ", err)
+	}
+	file.Status = model.FileStatusPending
+	return serializer.Success(serializer.BuildFile(file))
+}
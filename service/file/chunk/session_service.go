@@ -0,0 +1,220 @@
+package chunk
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// legacyChunkDir 旧版分片上传保存分片的本地目录，分片改为直接上传到云端后只需清理遗留数据
+const legacyChunkDir = "./tmp_chunks"
+
+// uploadSession 取消云端分片上传所需的会话信息
+type uploadSession struct {
+	UserId        string `json:"user_id"`
+	ObjectName    string `json:"object_name"`
+	CloudUploadId string `json:"cloud_upload_id"`
+}
+
+// uploadSessionMember 构建过期有序集合的成员，包含用户ID，会话哈希丢失时仍能清理用户集合
+func uploadSessionMember(userId string, uploadId string) string {
+	return userId + ":" + uploadId
+}
+
+// parseUploadSessionMember 从过期有序集合的成员中解析用户ID和上传任务ID
+func parseUploadSessionMember(member string) (userId string, uploadId string, ok bool) {
+	userId, uploadId, ok = strings.Cut(member, ":")
+	return userId, uploadId, ok && userId != "" && uploadId != ""
+}
+
+// UploadSessionService 分片上传会话管理服务
+type UploadSessionService struct{}
+
+// registerUploadSession 登记上传会话到会话哈希、过期有序集合和用户集合
+func registerUploadSession(uploadInfo *ChunkUploadInfo) error {
+	session, err := json.Marshal(uploadSession{
+		UserId:        uploadInfo.UserId,
+		ObjectName:    uploadInfo.ObjectName,
+		CloudUploadId: uploadInfo.CloudUploadId,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	expireAt := uploadInfo.CreatedAt.Add(chunkUploadExpire).Unix()
+	pipe := cache.RedisClient.TxPipeline()
+	pipe.HSet(ctx, cache.ChunkUploadSessionKey, uploadInfo.UploadId, session)
+	pipe.ZAdd(ctx, cache.ChunkUploadExpireKey, redis.Z{Score: float64(expireAt), Member: uploadSessionMember(uploadInfo.UserId, uploadInfo.UploadId)})
+	pipe.SAdd(ctx, cache.ChunkUploadUserKey(uploadInfo.UserId), uploadInfo.UploadId)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// unregisterUploadSession 移除上传会话登记
+func unregisterUploadSession(userId string, uploadId string) error {
+	ctx := context.Background()
+	pipe := cache.RedisClient.TxPipeline()
+	pipe.HDel(ctx, cache.ChunkUploadSessionKey, uploadId)
+	pipe.ZRem(ctx, cache.ChunkUploadExpireKey, uploadSessionMember(userId, uploadId))
+	pipe.SRem(ctx, cache.ChunkUploadUserKey(userId), uploadId)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// removeLegacyChunkDir 删除旧版分片上传遗留的本地分片目录
+func removeLegacyChunkDir(uploadId string) {
+	if err := os.RemoveAll(filepath.Join(legacyChunkDir, filepath.Base(uploadId))); err != nil {
+		logger.Log().Error("[removeLegacyChunkDir] 删除本地分片目录失败: ", err)
+	}
+}
+
+// ListUploadSessions 列出用户进行中的分片上传
+func (service *UploadSessionService) ListUploadSessions(userId string) serializer.Response {
+	ctx := context.Background()
+	uploadIds, err := cache.RedisClient.SMembers(ctx, cache.ChunkUploadUserKey(userId)).Result()
+	if err != nil {
+		logger.Log().Error("[UploadSessionService.ListUploadSessions] 获取上传会话失败: ", err)
+		return serializer.InternalErr("", err)
+	}
+
+	sessions := make([]map[string]interface{}, 0, len(uploadIds))
+	for _, uploadId := range uploadIds {
+		// 上传信息已过期的会话等待定时任务清理
+		uploadInfo, err := getChunkUploadInfoFromRedis(uploadId)
+		if err != nil || uploadInfo.UserId != userId {
+			continue
+		}
+		sessions = append(sessions, map[string]interface{}{
+			"upload_id":       uploadInfo.UploadId,
+			"file_name":       uploadInfo.FileName,
+			"file_size":       uploadInfo.FileSize,
+			"folder_id":       uploadInfo.FolderId,
+			"chunk_size":      uploadInfo.ChunkSize,
+			"total_chunks":    uploadInfo.TotalChunks,
+			"uploaded_chunks": uploadInfo.UploadedChunks,
+			"uploaded_count":  len(uploadInfo.UploadedChunks),
+			"created_at":      uploadInfo.CreatedAt,
+			"expires_at":      uploadInfo.CreatedAt.Add(chunkUploadExpire),
+		})
+	}
+
+	// 按创建时间倒序排列
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i]["created_at"].(time.Time).After(sessions[j]["created_at"].(time.Time))
+	})
+	return serializer.Success(sessions)
+}
+
+// AbortUploadSession 取消分片上传，取消云端分片上传并清理Redis信息和遗留的本地分片
+func (service *UploadSessionService) AbortUploadSession(userId string, uploadId string) serializer.Response {
+	uploadInfo, err := getChunkUploadInfoFromRedis(uploadId)
+	if err != nil {
+		return serializer.ParamsErr("UploadIdNotFound", err)
+	}
+	if uploadInfo.UserId != userId {
+		return serializer.NotAuthErr("没有权限")
+	}
+
+	abortUpload(uploadInfo)
+	removeLegacyChunkDir(uploadId)
+	return serializer.Success(nil)
+}
+
+// CleanExpiredUploadSessions 清理上传信息已过期的会话，取消云端分片上传并释放预留容量，
+// 并删除没有对应上传信息的遗留本地分片目录和tus暂存目录
+func (service *UploadSessionService) CleanExpiredUploadSessions() error {
+	ctx := context.Background()
+	members, err := cache.RedisClient.ZRangeByScore(ctx, cache.ChunkUploadExpireKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		userId, uploadId, ok := parseUploadSessionMember(member)
+		if !ok {
+			// 无法确定所属用户的成员无法清理，直接移除避免反复处理
+			logger.Log().Error("[UploadSessionService.CleanExpiredUploadSessions] 上传会话成员格式错误: ", member)
+			cache.RedisClient.ZRem(ctx, cache.ChunkUploadExpireKey, member)
+			continue
+		}
+		// 上传信息仍然存在说明会话未真正过期
+		if exists, err := cache.RedisClient.Exists(ctx, cache.ChunkUploadInfoKey(uploadId)).Result(); err != nil || exists > 0 {
+			continue
+		}
+
+		var session uploadSession
+		raw, err := cache.RedisClient.HGet(ctx, cache.ChunkUploadSessionKey, uploadId).Result()
+		if err == nil && json.Unmarshal([]byte(raw), &session) == nil {
+			if err := disk.BaseCloudDisk.AbortMultipartUpload(userId, "", session.ObjectName, session.CloudUploadId); err != nil {
+				// 云端分片上传可能已被生命周期规则清理，记录后继续移除会话，避免反复重试
+				logger.Log().Error("[UploadSessionService.CleanExpiredUploadSessions] 取消云端分片上传失败: ", err)
+			}
+		} else {
+			// 会话信息丢失时无法取消云端分片上传，交由云端生命周期规则清理，仍释放预留容量和用户集合
+			logger.Log().Error("[UploadSessionService.CleanExpiredUploadSessions] 上传会话信息缺失: ", uploadId)
+		}
+
+		removeLegacyChunkDir(uploadId)
+		removeTusBuffers(uploadId, "")
+		releaseReservation(uploadId)
+		if err := unregisterUploadSession(userId, uploadId); err != nil {
+			logger.Log().Error("[UploadSessionService.CleanExpiredUploadSessions] 移除上传会话失败: ", err)
+		}
+	}
+
+	// 过期的预留已不再占用容量，一并删除记录
+	if err := model.CleanExpiredUploadReservations(); err != nil {
+		return err
+	}
+	if err := cleanStaleUploadDirs(legacyChunkDir); err != nil {
+		return err
+	}
+	// 上传任务在其他实例上完成或过期时，本实例的tus暂存目录只能在这里清理
+	return cleanStaleUploadDirs(tusSpoolDir)
+}
+
+// cleanStaleUploadDirs 删除dir中超过过期时间且没有对应上传信息的上传任务目录
+func cleanStaleUploadDirs(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < chunkUploadExpire {
+			continue
+		}
+		exists, err := cache.RedisClient.Exists(context.Background(), cache.ChunkUploadInfoKey(entry.Name())).Result()
+		if err != nil || exists > 0 {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			logger.Log().Error("[cleanStaleUploadDirs] 删除本地上传目录失败: ", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package chunk
+
+import (
+	"context"
+	"testing"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/test"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCleanExpiredUploadSessions(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	ctx := context.Background()
+
+	expired := initUpload(t, user, "expired.txt", 10)
+	lost := initUpload(t, user, "lost.txt", 10)
+	active := initUpload(t, user, "active.txt", 10)
+
+	// 模拟上传信息过期，其中一个会话的会话信息也已丢失
+	for _, uploadId := range []string{expired, lost} {
+		if err := cache.RedisClient.Del(ctx, cache.ChunkUploadInfoKey(uploadId)).Err(); err != nil {
+			t.Fatal(err)
+		}
+		member := uploadSessionMember(user.Uuid, uploadId)
+		if err := cache.RedisClient.ZAdd(ctx, cache.ChunkUploadExpireKey, redis.Z{Score: 0, Member: member}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.RedisClient.HDel(ctx, cache.ChunkUploadSessionKey, lost).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	service := UploadSessionService{}
+	if err := service.CleanExpiredUploadSessions(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 会话信息丢失时仍从有序集合成员中得到用户ID，清理用户集合和预留容量
+	uploadIds := cache.RedisClient.SMembers(ctx, cache.ChunkUploadUserKey(user.Uuid)).Val()
+	if len(uploadIds) != 1 || uploadIds[0] != active {
+		t.Fatalf("清理后用户的上传会话为%v，期望只剩%s", uploadIds, active)
+	}
+	if count := cache.RedisClient.ZCard(ctx, cache.ChunkUploadExpireKey).Val(); count != 1 {
+		t.Fatalf("清理后过期集合中有%d个会话，期望1个", count)
+	}
+	if reserved := reservedSize(t, user.Uuid); reserved != 10 {
+		t.Fatalf("清理后预留%d，期望10", reserved)
+	}
+	if count := mem.CallCount("AbortMultipartUpload"); count != 1 {
+		t.Fatalf("取消云端分片上传%d次，期望1次", count)
+	}
+}
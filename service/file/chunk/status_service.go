@@ -0,0 +1,41 @@
+package chunk
+
+import (
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+)
+
+// UploadStatusService 查询分片上传后台处理状态服务
+type UploadStatusService struct{}
+
+// uploadStatusResponse 文件及其分片合并任务的状态，普通上传和秒传的文件没有合并任务
+type uploadStatusResponse struct {
+	File serializer.File       `json:"file"`
+	Job  *serializer.UploadJob `json:"job,omitempty"`
+}
+
+// GetUploadStatus 查询文件的后台合并状态，客户端完成分片上传后轮询此接口，
+// 文件变为failed时可从任务的error得知校验不通过等失败原因
+func (service *UploadStatusService) GetUploadStatus(userId string, fileId string) serializer.Response {
+	var file model.File
+	if err := model.DB.Where("uuid = ? and owner = ?", fileId, userId).Find(&file).Error; err != nil {
+		logger.Log().Error("[UploadStatusService.GetUploadStatus] 查找文件失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if file.Uuid == "" {
+		return serializer.NotAuthErr("")
+	}
+
+	var job model.UploadJob
+	if err := model.DB.Where("uuid = ? and file_path = ?", file.FileUuid, file.FilePath).Find(&job).Error; err != nil {
+		logger.Log().Error("[UploadStatusService.GetUploadStatus] 查找分片合并任务失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	res := uploadStatusResponse{File: serializer.BuildFile(file)}
+	if job.Uuid != "" {
+		uploadJob := serializer.BuildUploadJob(job)
+		res.Job = &uploadJob
+	}
+	return serializer.Success(res)
+}
@@ -0,0 +1,49 @@
+package chunk
+
+import (
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+func TestGetUploadStatus(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("chunked content")
+
+	uploadId := initUpload(t, user, "notes.txt", len(data))
+	uploadChunk(t, user.Uuid, uploadId, 1, data)
+	res := (&FileChunkCompleteService{UploadId: uploadId, FileHash: sha256Hex([]byte("other"))}).CompleteChunkUpload(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("完成分片上传失败: %+v", res)
+	}
+	fileId := res.Data.(serializer.File).Uuid
+
+	service := UploadStatusService{}
+	res = service.GetUploadStatus(user.Uuid, fileId)
+	status := res.Data.(uploadStatusResponse)
+	if res.Code != serializer.CodeSuccess || status.File.Status != model.FileStatusPending || status.Job == nil || status.Job.Status != model.UploadJobPending {
+		t.Fatalf("合并前应返回等待中的文件和任务: %+v", res)
+	}
+
+	// 后台校验不通过时客户端轮询得到失败原因
+	if err := model.DB.Model(&model.UploadJob{}).Where("uuid = ?", status.Job.Uuid).
+		Updates(map[string]interface{}{"status": model.UploadJobFailed, "error": "FileChecksumMismatch"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Model(&model.File{}).Where("uuid = ?", fileId).Update("status", model.FileStatusFailed).Error; err != nil {
+		t.Fatal(err)
+	}
+	status = service.GetUploadStatus(user.Uuid, fileId).Data.(uploadStatusResponse)
+	if status.File.Status != model.FileStatusFailed || status.Job.Error != "FileChecksumMismatch" || status.Job.Retryable {
+		t.Fatalf("校验不通过时应返回失败原因且不能重试: %+v %+v", status.File, status.Job)
+	}
+
+	// 其他用户不能查询
+	other := test.CreateUser(t, 1024)
+	if res := service.GetUploadStatus(other.Uuid, fileId); res.Code != serializer.CodeNotAuthError {
+		t.Fatalf("查询其他用户的文件应返回未授权: %+v", res)
+	}
+}
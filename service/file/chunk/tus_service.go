@@ -0,0 +1,498 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/disk"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// TusVersion 支持的tus协议版本
+	TusVersion = "1.0.0"
+	// TusExtensions 支持的tus协议扩展
+	TusExtensions = "creation,termination,checksum"
+	// TusChecksumAlgorithms 支持的校验和算法
+	TusChecksumAlgorithms = "md5,sha1,sha256"
+	// StatusChecksumMismatch tus校验和不匹配的状态码
+	StatusChecksumMismatch = 460
+
+	// tusBufferFileField 暂存文件名在Redis哈希中的字段，云端分片除最后一个外不能小于5MB，
+	// 尚未凑满一个分片的数据暂存在本地文件中，Redis只记录文件名和大小
+	tusBufferFileField = "TusBufferFile"
+	// tusBufferSizeField 暂存数据大小在Redis哈希中的字段
+	tusBufferSizeField = "TusBufferSize"
+	// tusLockExpire 写入锁过期时间，防止进程异常退出后锁无法释放。慢速连接上一次PATCH可能持续更久，
+	// 写入期间每隔tusLockRefresh续期一次
+	tusLockExpire = time.Minute
+	// tusLockRefresh 写入锁续期间隔
+	tusLockRefresh = 20 * time.Second
+)
+
+// tusSpoolDir 暂存尚未凑满一个分片的数据的本地目录，每个上传任务一个子目录
+var tusSpoolDir = "./tmp_tus"
+
+var (
+	// tusLockRefreshScript 仍持有写入锁时续期
+	tusLockRefreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	// tusLockReleaseScript 仍持有写入锁时释放，避免删除锁过期后其他请求获得的锁
+	tusLockReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// TusError tus协议错误，携带需要返回的HTTP状态码
+type TusError struct {
+	Status int
+	Msg    string
+}
+
+func (e *TusError) Error() string {
+	return e.Msg
+}
+
+// newTusError 创建tus协议错误
+func newTusError(status int, msg string) *TusError {
+	return &TusError{Status: status, Msg: msg}
+}
+
+// TusCreateService tus创建上传服务
+type TusCreateService struct {
+	UploadLength   int64  // Upload-Length 请求头，文件总大小
+	UploadMetadata string // Upload-Metadata 请求头，需包含filename和filefolder
+}
+
+// CreateUpload 创建tus上传任务，返回上传任务ID
+func (service *TusCreateService) CreateUpload(userId string) (string, error) {
+	metadata, err := parseTusMetadata(service.UploadMetadata)
+	if err != nil {
+		return "", newTusError(http.StatusBadRequest, err.Error())
+	}
+	fileName, folderId := metadata["filename"], metadata["filefolder"]
+	if fileName == "" || folderId == "" {
+		return "", newTusError(http.StatusBadRequest, "Upload-Metadata缺少filename或filefolder")
+	}
+
+	uploadInfo, err := newChunkUpload(userId, folderId, fileName, service.UploadLength)
+	if err == nil && service.UploadLength == 0 {
+		err = finishEmptyUpload(userId, uploadInfo)
+	}
+	switch {
+	case errors.Is(err, errInvalidFileSize):
+		return "", newTusError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, errFolderNotOwned):
+		return "", newTusError(http.StatusForbidden, err.Error())
+	case errors.Is(err, errExceedStoreLimit):
+		return "", newTusError(http.StatusRequestEntityTooLarge, err.Error())
+	case err != nil:
+		var tusErr *TusError
+		if !errors.As(err, &tusErr) {
+			logger.Log().Error("[TusCreateService.CreateUpload] 初始化分片上传失败: ", err)
+		}
+		return "", err
+	}
+	return uploadInfo.UploadId, nil
+}
+
+// finishEmptyUpload 空文件创建后没有PATCH请求，直接上传一个空分片并完成上传
+func finishEmptyUpload(userId string, uploadInfo *ChunkUploadInfo) error {
+	if err := uploadEmptyPart(uploadInfo); err != nil {
+		return err
+	}
+	return finishTusUpload(userId, uploadInfo)
+}
+
+// GetTusOffset 获取tus上传任务的当前偏移量和文件总大小
+func GetTusOffset(userId string, uploadId string) (int64, int64, error) {
+	uploadInfo, buffer, err := getTusUploadInfo(userId, uploadId)
+	if err == nil {
+		return tusOffset(uploadInfo) + buffer.size, uploadInfo.FileSize, nil
+	}
+
+	// 上传已完成时上传信息已清理，返回完成记录
+	done, doneErr := cache.RedisClient.HGetAll(context.Background(), cache.TusUploadDoneKey(uploadId)).Result()
+	if doneErr != nil || len(done) == 0 || done["UserId"] != userId {
+		return 0, 0, err
+	}
+	fileSize, _ := strconv.ParseInt(done["FileSize"], 10, 64)
+	return fileSize, fileSize, nil
+}
+
+// TusPatchService tus写入数据服务
+type TusPatchService struct {
+	UploadOffset   int64  // Upload-Offset 请求头
+	UploadChecksum string // Upload-Checksum 请求头，可为空
+}
+
+// PatchUpload 从当前偏移量开始写入数据，凑满一个分片即上传到云端，剩余数据暂存到本地文件，
+// 数据全部到达后合并分片并创建文件记录，返回新的偏移量
+func (service *TusPatchService) PatchUpload(userId string, uploadId string, body io.Reader) (int64, error) {
+	// 同一上传任务同时只允许一个PATCH请求
+	lock, err := acquireTusLock(uploadId)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.release()
+
+	uploadInfo, buffer, err := getTusUploadInfo(userId, uploadId)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := tusOffset(uploadInfo) + buffer.size
+	if service.UploadOffset != offset {
+		return 0, newTusError(http.StatusConflict, "Upload-Offset与当前偏移量不一致")
+	}
+	pending, err := buffer.read()
+	if err != nil {
+		return 0, err
+	}
+
+	// 解析校验和
+	var checksum hash.Hash
+	var expectedSum []byte
+	if service.UploadChecksum != "" {
+		checksum, expectedSum, err = parseTusChecksum(service.UploadChecksum)
+		if err != nil {
+			return 0, newTusError(http.StatusBadRequest, err.Error())
+		}
+		body = io.TeeReader(body, checksum)
+	}
+
+	// 按分片大小切分数据并上传到云端，只有完整接收并通过校验后才记录进度
+	received := offset
+	nextPart := len(uploadInfo.Parts) + 1
+	newParts := make(map[int]string)
+	reader := io.LimitReader(body, uploadInfo.FileSize-offset)
+	var readErr error
+	for {
+		chunk := make([]byte, ChunkSize-len(pending))
+		n, err := io.ReadFull(reader, chunk)
+		pending = append(pending, chunk[:n]...)
+		received += int64(n)
+
+		if len(pending) == ChunkSize || (received == uploadInfo.FileSize && len(pending) > 0) {
+			if lock.lost.Load() {
+				return 0, errTusLockLost
+			}
+			etag, err := disk.BaseCloudDisk.UploadPart(userId, "", uploadInfo.ObjectName, uploadInfo.CloudUploadId,
+				nextPart, bytes.NewReader(pending), int64(len(pending)))
+			if err != nil {
+				logger.Log().Error("[TusPatchService.PatchUpload] 上传分片到云端失败: ", err)
+				return 0, err
+			}
+			newParts[nextPart] = etag
+			nextPart++
+			pending = nil
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	// 携带校验和时，数据不完整或校验失败都丢弃本次写入，已上传的同序号分片会在重传时被覆盖
+	if checksum != nil {
+		if readErr != nil {
+			return 0, readErr
+		}
+		if !bytes.Equal(checksum.Sum(nil), expectedSum) {
+			return 0, newTusError(StatusChecksumMismatch, "Checksum Mismatch")
+		}
+	}
+
+	// 记录已上传分片和剩余数据，写入锁失效时其他请求可能已修改进度，丢弃本次写入
+	if lock.lost.Load() {
+		return 0, errTusLockLost
+	}
+	bufferFile, err := writeTusBuffer(uploadId, pending)
+	if err != nil {
+		logger.Log().Error("[TusPatchService.PatchUpload] 暂存剩余数据失败: ", err)
+		return 0, err
+	}
+	fields := []interface{}{tusBufferFileField, bufferFile, tusBufferSizeField, len(pending)}
+	for partNumber, etag := range newParts {
+		fields = append(fields, partFieldPrefix+strconv.Itoa(partNumber), etag)
+		uploadInfo.Parts[partNumber] = etag
+		uploadInfo.UploadedChunks = append(uploadInfo.UploadedChunks, partNumber)
+	}
+	if err := saveUploadFields(uploadId, fields...); err != nil {
+		if bufferFile != "" {
+			os.Remove(filepath.Join(tusBufferDir(uploadId), bufferFile))
+		}
+		if errors.Is(err, errUploadNotFound) {
+			return 0, newTusError(http.StatusNotFound, err.Error())
+		}
+		return 0, err
+	}
+	// 新的暂存文件生效后删除旧的暂存文件
+	removeTusBuffers(uploadId, bufferFile)
+
+	if received < uploadInfo.FileSize {
+		return received, nil
+	}
+
+	// 数据全部到达，创建文件记录并提交分片合并任务
+	if err := finishTusUpload(userId, uploadInfo); err != nil {
+		return 0, err
+	}
+	return received, nil
+}
+
+// finishTusUpload 创建文件记录并提交分片合并任务，保存完成记录，便于客户端完成后通过HEAD确认
+func finishTusUpload(userId string, uploadInfo *ChunkUploadInfo) error {
+	if _, err := completeUpload(uploadInfo, "", ""); err != nil {
+		if errors.Is(err, errExceedStoreLimit) {
+			return newTusError(http.StatusRequestEntityTooLarge, err.Error())
+		}
+		logger.Log().Error("[finishTusUpload] 完成分片上传失败: ", err)
+		return err
+	}
+
+	doneKey := cache.TusUploadDoneKey(uploadInfo.UploadId)
+	if err := cache.RedisClient.HSet(context.Background(), doneKey, "UserId", userId, "FileSize", uploadInfo.FileSize).Err(); err == nil {
+		cache.RedisClient.Expire(context.Background(), doneKey, 24*time.Hour)
+	}
+	return nil
+}
+
+// errTusLockLost 写入期间锁已过期并可能被其他请求获得
+var errTusLockLost = newTusError(http.StatusLocked, "上传任务写入锁已失效")
+
+// tusLock 上传任务的写入锁，持有期间定时续期
+type tusLock struct {
+	key   string
+	token string
+	stop  chan struct{}
+	lost  atomic.Bool // 续期时发现锁已不属于自己
+}
+
+// acquireTusLock 获取上传任务的写入锁，锁已被其他请求持有时返回423
+func acquireTusLock(uploadId string) (*tusLock, error) {
+	lock := &tusLock{key: cache.TusUploadLockKey(uploadId), token: uuid.NewString(), stop: make(chan struct{})}
+	ok, err := cache.RedisClient.SetNX(context.Background(), lock.key, lock.token, tusLockExpire).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newTusError(http.StatusLocked, "上传任务正在写入")
+	}
+	go lock.refresh()
+	return lock, nil
+}
+
+// refresh 定时续期直到释放，续期失败说明锁已过期
+func (lock *tusLock) refresh() {
+	ticker := time.NewTicker(tusLockRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+			renewed, err := tusLockRefreshScript.Run(context.Background(), cache.RedisClient,
+				[]string{lock.key}, lock.token, tusLockExpire.Milliseconds()).Int()
+			if err != nil {
+				logger.Log().Error("[tusLock.refresh] 续期写入锁失败: ", err)
+				continue
+			}
+			if renewed == 0 {
+				lock.lost.Store(true)
+				return
+			}
+		}
+	}
+}
+
+// release 停止续期并释放写入锁
+func (lock *tusLock) release() {
+	close(lock.stop)
+	if err := tusLockReleaseScript.Run(context.Background(), cache.RedisClient, []string{lock.key}, lock.token).Err(); err != nil {
+		logger.Log().Error("[tusLock.release] 释放写入锁失败: ", err)
+	}
+}
+
+// TerminateUpload 终止tus上传任务，取消云端分片上传并清理上传信息
+func TerminateUpload(userId string, uploadId string) error {
+	uploadInfo, _, err := getTusUploadInfo(userId, uploadId)
+	if err != nil {
+		return err
+	}
+	abortUpload(uploadInfo)
+	return nil
+}
+
+// tusBuffer 暂存在本地文件中尚未上传的剩余数据，文件不在当前实例时size为0
+type tusBuffer struct {
+	path string
+	size int64
+}
+
+// read 读取暂存数据
+func (buffer tusBuffer) read() ([]byte, error) {
+	if buffer.size == 0 {
+		return nil, nil
+	}
+	data, err := os.ReadFile(buffer.path)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != buffer.size {
+		return nil, fmt.Errorf("暂存数据大小%d与记录%d不一致", len(data), buffer.size)
+	}
+	return data, nil
+}
+
+// tusBufferDir 返回上传任务暂存数据的本地目录
+func tusBufferDir(uploadId string) string {
+	return filepath.Join(tusSpoolDir, filepath.Base(uploadId))
+}
+
+// writeTusBuffer 将剩余数据写入新的暂存文件并返回文件名，没有剩余数据时返回空文件名。
+// 每次写入使用新文件，记录到Redis失败时旧的暂存数据仍然有效
+func writeTusBuffer(uploadId string, data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	dir := tusBufferDir(uploadId)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := uuid.NewString()
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// removeTusBuffers 删除上传任务除keep以外的暂存文件，keep为空时删除整个暂存目录
+func removeTusBuffers(uploadId string, keep string) {
+	dir := tusBufferDir(uploadId)
+	if keep == "" {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Log().Error("[removeTusBuffers] 删除暂存目录失败: ", err)
+		}
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() != keep {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				logger.Log().Error("[removeTusBuffers] 删除暂存文件失败: ", err)
+			}
+		}
+	}
+}
+
+// getTusUploadInfo 获取上传信息和尚未上传的剩余数据，并校验用户。
+// 暂存文件不在当前实例或大小与记录不符时视为没有剩余数据，偏移量退回到已上传分片的末尾
+func getTusUploadInfo(userId string, uploadId string) (*ChunkUploadInfo, tusBuffer, error) {
+	uploadInfo, err := getChunkUploadInfoFromRedis(uploadId)
+	if err != nil {
+		return nil, tusBuffer{}, newTusError(http.StatusNotFound, err.Error())
+	}
+	if uploadInfo.UserId != userId {
+		return nil, tusBuffer{}, newTusError(http.StatusForbidden, "没有权限")
+	}
+
+	values, err := cache.RedisClient.HMGet(context.Background(), cache.ChunkUploadInfoKey(uploadId), tusBufferFileField, tusBufferSizeField).Result()
+	if err != nil {
+		return nil, tusBuffer{}, err
+	}
+	name, _ := values[0].(string)
+	sizeStr, _ := values[1].(string)
+	size, _ := strconv.ParseInt(sizeStr, 10, 64)
+	if name == "" || size <= 0 {
+		return uploadInfo, tusBuffer{}, nil
+	}
+	buffer := tusBuffer{path: filepath.Join(tusBufferDir(uploadId), filepath.Base(name)), size: size}
+	if info, err := os.Stat(buffer.path); err != nil || info.Size() != size {
+		return uploadInfo, tusBuffer{}, nil
+	}
+	return uploadInfo, buffer, nil
+}
+
+// tusOffset 计算从第1片开始连续上传的分片大小，即暂存数据的起始偏移量
+func tusOffset(uploadInfo *ChunkUploadInfo) int64 {
+	var offset int64
+	for partNumber := 1; partNumber <= uploadInfo.TotalChunks; partNumber++ {
+		if _, ok := uploadInfo.Parts[partNumber]; !ok {
+			break
+		}
+		offset += ChunkSize
+	}
+	if offset > uploadInfo.FileSize {
+		offset = uploadInfo.FileSize
+	}
+	return offset
+}
+
+// parseTusMetadata 解析Upload-Metadata请求头，格式为逗号分隔的“键 base64值”
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.New("Upload-Metadata格式错误")
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// parseTusChecksum 解析Upload-Checksum请求头，格式为“算法 base64校验和”
+func parseTusChecksum(header string) (hash.Hash, []byte, error) {
+	algorithm, encoded, _ := strings.Cut(strings.TrimSpace(header), " ")
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, errors.New("Upload-Checksum格式错误")
+	}
+	switch algorithm {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	default:
+		return nil, nil, errors.New("不支持的校验和算法")
+	}
+}
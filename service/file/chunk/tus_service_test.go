@@ -0,0 +1,209 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/model"
+	"go-cloud-disk/test"
+)
+
+// tusMetadata 构建Upload-Metadata请求头
+func tusMetadata(fileName string, folderId string) string {
+	return "filename " + base64.StdEncoding.EncodeToString([]byte(fileName)) +
+		",filefolder " + base64.StdEncoding.EncodeToString([]byte(folderId))
+}
+
+// useTusSpoolDir 将tus暂存目录切换到临时目录
+func useTusSpoolDir(t *testing.T) string {
+	t.Helper()
+	dir := tusSpoolDir
+	tusSpoolDir = t.TempDir()
+	t.Cleanup(func() { tusSpoolDir = dir })
+	return tusSpoolDir
+}
+
+func tusStatus(err error) int {
+	var tusErr *TusError
+	if errors.As(err, &tusErr) {
+		return tusErr.Status
+	}
+	return 0
+}
+
+func TestTusUpload(t *testing.T) {
+	test.Setup(t)
+	useTusSpoolDir(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("resumable content")
+
+	create := TusCreateService{UploadLength: int64(len(data)), UploadMetadata: tusMetadata("notes.txt", user.UserMainFileFolderID)}
+	uploadId, err := create.CreateUpload(user.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := TusPatchService{UploadOffset: 0}
+	offset, err := patch.PatchUpload(user.Uuid, uploadId, bytes.NewReader(data[:5]))
+	if err != nil || offset != 5 {
+		t.Fatalf("第一次写入后偏移量为%d，期望5，err=%v", offset, err)
+	}
+	// 偏移量不一致时拒绝写入
+	if _, err := patch.PatchUpload(user.Uuid, uploadId, bytes.NewReader(data)); tusStatus(err) != http.StatusConflict {
+		t.Fatalf("偏移量不一致时应返回409: %v", err)
+	}
+	patch.UploadOffset = 5
+	if offset, err := patch.PatchUpload(user.Uuid, uploadId, bytes.NewReader(data[5:])); err != nil || offset != int64(len(data)) {
+		t.Fatalf("写入剩余数据后偏移量为%d，期望%d，err=%v", offset, len(data), err)
+	}
+
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 || files[0].Size != int64(len(data)) || files[0].Status != model.FileStatusPending {
+		t.Fatalf("写入完成后应创建等待合并的文件: %+v", files)
+	}
+	if offset, length, err := GetTusOffset(user.Uuid, uploadId); err != nil || offset != length || length != int64(len(data)) {
+		t.Fatalf("完成后偏移量为%d/%d，err=%v", offset, length, err)
+	}
+}
+
+func TestTusBufferSpool(t *testing.T) {
+	test.Setup(t)
+	spoolDir := useTusSpoolDir(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("resumable content")
+	ctx := context.Background()
+
+	create := TusCreateService{UploadLength: int64(len(data)), UploadMetadata: tusMetadata("notes.txt", user.UserMainFileFolderID)}
+	uploadId, err := create.CreateUpload(user.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := TusPatchService{UploadOffset: 0}
+	if _, err := patch.PatchUpload(user.Uuid, uploadId, bytes.NewReader(data[:10])); err != nil {
+		t.Fatal(err)
+	}
+
+	// 剩余数据暂存在本地文件中，Redis只记录文件名和大小
+	fields, err := cache.RedisClient.HGetAll(ctx, cache.ChunkUploadInfoKey(uploadId)).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for field, value := range fields {
+		if strings.Contains(value, string(data[:10])) {
+			t.Fatalf("Redis字段%s保存了上传数据", field)
+		}
+	}
+	if fields[tusBufferSizeField] != "10" {
+		t.Fatalf("暂存数据大小记录为%q，期望10", fields[tusBufferSizeField])
+	}
+	buffered, err := os.ReadFile(filepath.Join(spoolDir, uploadId, fields[tusBufferFileField]))
+	if err != nil || string(buffered) != string(data[:10]) {
+		t.Fatalf("暂存文件内容为%q，err=%v", buffered, err)
+	}
+
+	patch.UploadOffset = 10
+	if offset, err := patch.PatchUpload(user.Uuid, uploadId, bytes.NewReader(data[10:12])); err != nil || offset != 12 {
+		t.Fatalf("继续写入后偏移量为%d，期望12，err=%v", offset, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(spoolDir, uploadId)); len(entries) != 1 {
+		t.Fatalf("旧的暂存文件未删除: %d个文件", len(entries))
+	}
+
+	// 暂存数据不在当前实例时偏移量退回到已上传分片的末尾，客户端从该偏移量重新写入
+	if err := os.RemoveAll(filepath.Join(spoolDir, uploadId)); err != nil {
+		t.Fatal(err)
+	}
+	if offset, _, err := GetTusOffset(user.Uuid, uploadId); err != nil || offset != 0 {
+		t.Fatalf("暂存数据丢失后偏移量为%d，期望0，err=%v", offset, err)
+	}
+	patch.UploadOffset = 12
+	if _, err := patch.PatchUpload(user.Uuid, uploadId, bytes.NewReader(data[12:])); tusStatus(err) != http.StatusConflict {
+		t.Fatalf("暂存数据丢失后按原偏移量写入应返回409: %v", err)
+	}
+	patch.UploadOffset = 0
+	if offset, err := patch.PatchUpload(user.Uuid, uploadId, bytes.NewReader(data)); err != nil || offset != int64(len(data)) {
+		t.Fatalf("重新写入后偏移量为%d，期望%d，err=%v", offset, len(data), err)
+	}
+	if _, err := os.Stat(filepath.Join(spoolDir, uploadId)); !os.IsNotExist(err) {
+		t.Fatalf("上传完成后暂存目录未删除: %v", err)
+	}
+}
+
+func TestTusEmptyUpload(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+
+	// 空文件创建后立即完成
+	create := TusCreateService{UploadLength: 0, UploadMetadata: tusMetadata("empty.txt", user.UserMainFileFolderID)}
+	uploadId, err := create.CreateUpload(user.Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 || files[0].FileName != "empty" || files[0].Size != 0 {
+		t.Fatalf("空文件应在创建时完成上传: %+v", files)
+	}
+	if offset, length, err := GetTusOffset(user.Uuid, uploadId); err != nil || offset != 0 || length != 0 {
+		t.Fatalf("空文件偏移量为%d/%d，err=%v", offset, length, err)
+	}
+
+	var job model.UploadJob
+	if err := model.DB.Where("uuid = ?", uploadId).First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if parts, err := job.PartList(); err != nil || len(parts) != 1 {
+		t.Fatalf("空文件应有一个空分片: %+v, err=%v", parts, err)
+	}
+	if count := mem.CallCount("UploadPart"); count != 1 {
+		t.Fatalf("空文件上传了%d个分片，期望1个", count)
+	}
+
+	// 负数大小仍然拒绝
+	create.UploadLength = -1
+	if _, err := create.CreateUpload(user.Uuid); tusStatus(err) != http.StatusBadRequest {
+		t.Fatalf("负数大小应返回400: %v", err)
+	}
+}
+
+func TestTusLock(t *testing.T) {
+	test.Setup(t)
+	ctx := context.Background()
+
+	lock, err := acquireTusLock("upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireTusLock("upload"); tusStatus(err) != http.StatusLocked {
+		t.Fatalf("写入期间再次加锁应返回423: %v", err)
+	}
+
+	// 锁过期后被其他请求获得，释放时不能删除其他请求的锁
+	key := cache.TusUploadLockKey("upload")
+	if err := cache.RedisClient.Set(ctx, key, "other", tusLockExpire).Err(); err != nil {
+		t.Fatal(err)
+	}
+	lock.release()
+	if owner := cache.RedisClient.Get(ctx, key).Val(); owner != "other" {
+		t.Fatalf("释放后锁属于%q，期望仍属于other", owner)
+	}
+
+	if err := cache.RedisClient.Del(ctx, key).Err(); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = acquireTusLock("upload")
+	if err != nil {
+		t.Fatalf("锁释放后应能再次加锁: %v", err)
+	}
+	lock.release()
+	if exist := cache.RedisClient.Exists(ctx, key).Val(); exist != 0 {
+		t.Fatal("释放后锁仍存在")
+	}
+}
@@ -2,27 +2,30 @@ package chunk
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"os"
-	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"go-cloud-disk/cache"
+	"go-cloud-disk/disk"
 	"go-cloud-disk/serializer"
-	"go-cloud-disk/utils"
 	"go-cloud-disk/utils/logger"
 )
 
 type FileChunkUploadService struct {
-	UploadId    string `form:"upload_id" json:"upload_id" binding:"required"`       // 上传任务ID
-	ChunkNumber int    `form:"chunk_number" json:"chunk_number" binding:"required"` // 分片序号
+	UploadId    string `form:"upload_id" json:"upload_id" binding:"required"`                     // 上传任务ID
+	ChunkNumber int    `form:"chunk_number" json:"chunk_number" binding:"required"`               // 分片序号，从1开始
+	ChunkMd5    string `form:"chunk_md5" json:"chunk_md5" binding:"omitempty,len=32,hexadecimal"` // 客户端声明的分片MD5，可选
 }
 
-// UploadChunk 上传单个分片
+// UploadChunk 上传单个分片，分片直接转发到云端分片上传任务
 func (service *FileChunkUploadService) UploadChunk(userId string, chunkFile *multipart.FileHeader) serializer.Response {
 	// 1. 获取上传任务信息
 	uploadInfo, err := getChunkUploadInfoFromRedis(service.UploadId)
@@ -37,7 +40,7 @@ func (service *FileChunkUploadService) UploadChunk(userId string, chunkFile *mul
 	}
 
 	// 3. 验证分片序号
-	if service.ChunkNumber < 0 || service.ChunkNumber > uploadInfo.TotalChunks {
+	if service.ChunkNumber < 1 || service.ChunkNumber > uploadInfo.TotalChunks {
 		return serializer.ParamsErr("InvalidChunkNumber", nil)
 	}
 
@@ -47,45 +50,69 @@ func (service *FileChunkUploadService) UploadChunk(userId string, chunkFile *mul
 		expectedSize = uploadInfo.FileSize - int64(ChunkSize*(uploadInfo.TotalChunks-1))
 	}
 
-	if chunkFile.Size != int64(expectedSize) {
+	if chunkFile.Size != expectedSize {
 		return serializer.ParamsErr("InvalidChunkSize", nil)
 	}
 
-	// 5. 保存分片到本地临时目录
-	tmDir, err := saveChunkToTempDir(service.UploadId, service.ChunkNumber, chunkFile)
+	// 5. 计算分片MD5，并与客户端声明的MD5比对，避免损坏的分片进入云端
+	md5Str, err := getChunkMD5(chunkFile)
 	if err != nil {
-		logger.Log().Error("[FileChunkUploadService.UploadChunk] 保存分片失败: ", err)
-		return serializer.InternalErr("SaveChunkFailed", err)
+		return serializer.InternalErr("计算分片MD5失败", err)
+	}
+	if service.ChunkMd5 != "" && !strings.EqualFold(service.ChunkMd5, md5Str) {
+		return serializer.ParamsErr("ChunkChecksumMismatch", fmt.Errorf("期望%s，实际%s", service.ChunkMd5, md5Str))
 	}
 
-	dstPath := filepath.Join(tmDir, fmt.Sprintf("chunk_%d", service.ChunkNumber))
-	if err := saveMultipartFile(chunkFile, dstPath); err != nil {
-		return serializer.InternalErr("保存分片失败", err)
+	// 6. 上传分片到云端
+	src, err := chunkFile.Open()
+	if err != nil {
+		return serializer.InternalErr("打开分片失败", err)
 	}
+	defer src.Close()
 
-	// 6. 计算分片MD5
-	md5Str, err := utils.GetFileMD5(dstPath)
+	etag, err := disk.BaseCloudDisk.UploadPart(userId, "", uploadInfo.ObjectName, uploadInfo.CloudUploadId,
+		service.ChunkNumber, src, chunkFile.Size)
 	if err != nil {
-		return serializer.InternalErr("计算分片MD5失败", err)
+		logger.Log().Error("[FileChunkUploadService.UploadChunk] 上传分片到云端失败: ", err)
+		return serializer.InternalErr("SaveChunkFailed", err)
 	}
 
-	// 7. 更新上传信息（Redis）
-	uploadInfo.UploadedChunks = append(uploadInfo.UploadedChunks, service.ChunkNumber)
-	uploadInfo.UploadedChunks = utils.UniqueAndSortInts(uploadInfo.UploadedChunks)
-	if err := saveChunkUploadInfoToRedis(service.UploadId, *uploadInfo); err != nil {
+	// 7. 记录分片ETag（Redis）
+	// 上传期间任务过期或被取消时拒绝分片
+	err = savePartToRedis(service.UploadId, service.ChunkNumber, etag)
+	switch {
+	case errors.Is(err, errUploadNotFound):
+		return serializer.ParamsErr("UploadIdNotFound", err)
+	case err != nil:
 		return serializer.InternalErr("更新上传信息失败", err)
 	}
+	uploadInfo.Parts[service.ChunkNumber] = etag
 
 	response := map[string]interface{}{
 		"chunk_number":   service.ChunkNumber,
 		"chunk_md5":      md5Str,
-		"uploaded_count": len(uploadInfo.UploadedChunks),
+		"uploaded_count": len(uploadInfo.Parts),
 		"total_chunks":   uploadInfo.TotalChunks,
 	}
 
 	return serializer.Success(response)
 }
 
+// getChunkMD5 计算分片内容的MD5
+func getChunkMD5(chunkFile *multipart.FileHeader) (string, error) {
+	src, err := chunkFile.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, src); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // 从 Redis 中获取分片上传信息
 func getChunkUploadInfoFromRedis(uploadId string) (*ChunkUploadInfo, error) {
 	key := cache.ChunkUploadInfoKey(uploadId)
@@ -93,17 +120,20 @@ func getChunkUploadInfoFromRedis(uploadId string) (*ChunkUploadInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(result) == 0 {
+	if len(result) == 0 || result["CloudUploadId"] == "" {
 		return nil, fmt.Errorf("上传信息未找到")
 	}
 
-	// 解析 UploadedChunks
-	var uploadedChunks []int
-	if ucStr, ok := result["UploadedChunks"]; ok && ucStr != "" {
-		if err := json.Unmarshal([]byte(ucStr), &uploadedChunks); err != nil {
-			return nil, err
+	// 解析已上传分片
+	parts := make(map[int]string)
+	uploadedChunks := make([]int, 0)
+	for field, etag := range result {
+		if partNumber, ok := parsePartField(field); ok {
+			parts[partNumber] = etag
+			uploadedChunks = append(uploadedChunks, partNumber)
 		}
 	}
+	sort.Ints(uploadedChunks)
 
 	// 解析 CreatedAt
 	var createdAt time.Time
@@ -129,42 +159,10 @@ func getChunkUploadInfoFromRedis(uploadId string) (*ChunkUploadInfo, error) {
 		UserId:         result["UserId"],
 		CreatedAt:      createdAt,
 		UploadedChunks: uploadedChunks,
+		ObjectName:     result["ObjectName"],
+		CloudUploadId:  result["CloudUploadId"],
+		Parts:          parts,
 	}
 
 	return info, nil
 }
-
-// saveChunkToTempDir 为每个上传任务和分片创建临时目录
-func saveChunkToTempDir(uploadId string, chunkNumber int, fileHeader *multipart.FileHeader) (string, error) {
-	// 临时目录按uploadId创建，保证不同任务隔离
-	tmpRoot := "./tmp_chunks"
-	taskDir := filepath.Join(tmpRoot, uploadId)
-	if err := os.MkdirAll(taskDir, os.ModePerm); err != nil {
-		return "", fmt.Errorf("创建任务临时目录失败: %v", err)
-	}
-	return taskDir, nil
-}
-
-// 将multipart.FileHeader 保存到指定路径
-func saveMultipartFile(fileHeader *multipart.FileHeader, dstPath string) error {
-	// 打开 multipart 文件
-	srcFile, err := fileHeader.Open()
-	if err != nil {
-		return fmt.Errorf("打开分片文件失败: %v", err)
-	}
-	defer srcFile.Close()
-
-	// 创建目标文件
-	dstFile, err := os.Create(dstPath)
-	if err != nil {
-		return fmt.Errorf("创建目标文件失败: %v", err)
-	}
-	defer dstFile.Close()
-
-	// 拷贝数据
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		return fmt.Errorf("保存分片文件失败: %v", err)
-	}
-	return nil
-}
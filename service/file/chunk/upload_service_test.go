@@ -0,0 +1,36 @@
+package chunk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/test"
+)
+
+func TestSavePartAfterUploadExpired(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	uploadId := initUpload(t, user, "notes.txt", 4)
+
+	key := cache.ChunkUploadInfoKey(uploadId)
+	if err := savePartToRedis(uploadId, 1, "etag-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上传任务过期或被取消后，迟到的分片不能重新创建没有过期时间的上传信息
+	if err := cache.RedisClient.Del(context.Background(), key).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := savePartToRedis(uploadId, 1, "etag-1"); !errors.Is(err, errUploadNotFound) {
+		t.Fatalf("上传信息已删除时记录分片返回%v，期望errUploadNotFound", err)
+	}
+	exists, err := cache.RedisClient.Exists(context.Background(), key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists != 0 {
+		t.Fatal("迟到的分片重新创建了上传信息")
+	}
+}
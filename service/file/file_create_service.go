@@ -4,7 +4,6 @@ import (
 	"go-cloud-disk/disk"
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
-	"go-cloud-disk/utils"
 	"go-cloud-disk/utils/logger"
 )
 
@@ -20,7 +19,7 @@ type FileCreateService struct {
 // CreateFile 通过使用上传URL上传文件来创建文件记录
 func (service *FileCreateService) CreateFile(owner string) serializer.Response {
 	// 检查文件是否已成功上传到云端
-	uploadFileNameInCloud := utils.FastBuildFileName(service.FileUuid, service.FilePostfix)
+	uploadFileNameInCloud := disk.ObjectName(service.FileUuid, service.FilePostfix)
 	successUpload, err := disk.BaseCloudDisk.IsObjectExist(owner, "", uploadFileNameInCloud)
 	if err != nil {
 		return serializer.ErrorResponse(err)
@@ -19,12 +19,21 @@ func deleteFile(t *gorm.DB, userFile model.File, userStore model.FileStore, user
 		return fmt.Errorf("删除文件时减少文件夹大小失败：%v", err)
 	}
 
-	// 从用户存储空间中减去删除文件的大小
-	userStore.SubCurrentSize(userFile.Size)
-	if err := model.DB.Delete(&userFile).Error; err != nil {
+	// 删除文件的历史版本
+	freed, err := model.DeleteFileVersions(t, userFile.Uuid)
+	if err != nil {
+		return fmt.Errorf("删除文件时删除历史版本失败：%v", err)
+	}
+
+	// 从用户存储空间中减去删除文件及其历史版本的大小
+	userStore.SubCurrentSize(userFile.Size + freed)
+	if err := t.Delete(&userFile).Error; err != nil {
 		return fmt.Errorf("删除文件时删除文件记录失败：%v", err)
 	}
-	if err := model.DB.Save(&userStore).Error; err != nil {
+	if err := model.ReleaseObjects(t, []model.StoredObject{userFile.Object()}); err != nil {
+		return fmt.Errorf("删除文件时登记待清理对象失败：%v", err)
+	}
+	if err := t.Save(&userStore).Error; err != nil {
 		return fmt.Errorf("删除文件时更新用户存储空间失败：%v", err)
 	}
 	return nil
@@ -1,14 +1,19 @@
 package file
 
 import (
-	"go-cloud-disk/disk"
+	"errors"
+	"time"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/throttle"
 )
 
 // FileGetDownloadURLService 获取文件下载URL服务结构体
-type FileGetDownloadURLService struct{}
+type FileGetDownloadURLService struct {
+	Mode string `form:"mode" json:"mode" binding:"omitempty,oneof=direct proxy"` // direct返回云端URL，proxy返回经服务端代理的下载URL
+}
 
 // fileGetDownloadURLResponse 获取文件下载URL响应结构体
 type fileGetDownloadURLResponse struct {
@@ -26,14 +31,41 @@ func (service *FileGetDownloadURLService) GetDownloadURL(userId string, fileid s
 	if userId != file.Owner {
 		return serializer.NotAuthErr("")
 	}
+	if !file.Available() {
+		return serializer.ParamsErr("FileNotAvailable", nil)
+	}
+
+	// 无法访问存储桶域名的客户端使用服务端代理下载，代理下载时按实际传输字节数计入流量
+	if service.Mode == "proxy" {
+		if err := throttle.CheckUserQuota(userId, throttle.Download, 0); err != nil {
+			return transferQuotaErr("[FileGetDownloadURLService.GetDownloadURL]", err)
+		}
+		return serializer.Success(fileGetDownloadURLResponse{
+			Url: BuildProxyDownloadURL(file.Uuid),
+		})
+	}
 
-	fileName := file.FileUuid + "." + file.FilePostfix
-	url, err := disk.BaseCloudDisk.GetObjectURL(file.FilePath, "", fileName)
+	// 预签名URL直接访问云端，无法统计实际传输字节数，签发时按文件大小扣除流量
+	if err := throttle.ReserveUserQuota(userId, throttle.Download, file.Size); err != nil {
+		return transferQuotaErr("[FileGetDownloadURLService.GetDownloadURL]", err)
+	}
+
+	url, err := file.DownloadURL(time.Hour)
 	if err != nil {
 		logger.Log().Error("[FileGetDownloadURLService.GetDownloadURL] 获取下载URL失败: ", err)
+		throttle.Refund(userId, throttle.Download, file.Size)
 		return serializer.InternalErr("", err)
 	}
 	return serializer.Success(fileGetDownloadURLResponse{
 		Url: url,
 	})
 }
+
+// transferQuotaErr 将流量检查错误转换为响应
+func transferQuotaErr(caller string, err error) serializer.Response {
+	if errors.Is(err, throttle.ErrDailyQuotaExceeded) {
+		return serializer.ParamsErr("DailyTransferQuotaExceeded", nil)
+	}
+	logger.Log().Error(caller+" 检查传输流量失败: ", err)
+	return serializer.InternalErr("", err)
+}
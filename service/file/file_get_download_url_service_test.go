@@ -0,0 +1,39 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+func TestGetDownloadURLExtensionless(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("all: build")
+
+	upload := FileUploadService{FolderId: user.UserMainFileFolderID}
+	res := upload.UploadFile(user.Uuid, test.FileHeader(t, "Makefile", data), saveUploadedFile(t, "Makefile", data))
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("上传失败: %+v", res)
+	}
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 || files[0].FilePostfix != "" {
+		t.Fatalf("文件记录不符: %+v", files)
+	}
+
+	// 没有扩展名的文件下载时使用不带点号的对象名和原始文件名
+	service := FileGetDownloadURLService{}
+	res = service.GetDownloadURL(user.Uuid, files[0].Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("获取下载URL失败: %+v", res)
+	}
+	downloadURL := res.Data.(fileGetDownloadURLResponse).Url
+	if !strings.HasPrefix(downloadURL, "memory://"+files[0].Object().Key()+"?") || strings.Contains(downloadURL, files[0].FileUuid+".") {
+		t.Fatalf("下载URL不符: %s", downloadURL)
+	}
+	if !strings.Contains(downloadURL, "Makefile") || strings.Contains(downloadURL, "Makefile.") {
+		t.Fatalf("下载文件名不符: %s", downloadURL)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"go-cloud-disk/disk"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/throttle"
 	"github.com/google/uuid"
 )
 
@@ -20,8 +21,13 @@ type getUploadURLResponse struct {
 
 // GetUploadURL 获取文件上传预签名URL
 func (service *GetUploadURLService) GetUploadURL(fileowner string) serializer.Response {
+	// 预签名上传不经过服务器，签发前检查当日上传流量是否已用完
+	if err := throttle.CheckUserQuota(fileowner, throttle.Upload, 0); err != nil {
+		return transferQuotaErr("[GetUploadURLService.GetUploadURL]", err)
+	}
+
 	fileID := uuid.New().String()
-	fileName := fileID + "." + service.FileType
+	fileName := disk.ObjectName(fileID, service.FileType)
 	url, err := disk.BaseCloudDisk.GetUploadPresignedURL(fileowner, "", fileName)
 	if err != nil {
 		logger.Log().Error("[GetUploadURLService.GetUploadURL] 获取上传URL失败: ", err)
@@ -0,0 +1,245 @@
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// instantProofLength 持有证明校验的内容长度，文件小于该长度时校验整个文件
+	instantProofLength = 64 * 1024
+	// instantChallengeExpire 持有证明校验信息的有效期
+	instantChallengeExpire = 5 * time.Minute
+)
+
+// FileInstantUploadService 秒传服务结构体，客户端上传前先提交文件哈希。
+// 只支持SHA-256，MD5容易构造碰撞，不用于判断内容相同
+type FileInstantUploadService struct {
+	FolderId    string `form:"filefolder" json:"filefolder" binding:"required"`                               // 文件夹ID
+	FileName    string `form:"file_name" json:"file_name" binding:"required"`                                 // 文件名
+	FileSize    int64  `form:"file_size" json:"file_size" binding:"required"`                                 // 文件大小
+	Hash        string `form:"hash" json:"hash" binding:"required,len=64,hexadecimal"`                        // 文件内容的SHA-256
+	Conflict    string `form:"conflict" json:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认overwrite
+	ChallengeId string `form:"challenge_id" json:"challenge_id"`                                              // 上次请求返回的持有证明校验ID
+	Proof       string `form:"proof" json:"proof" binding:"omitempty,len=64,hexadecimal"`                     // 校验要求范围内文件内容的SHA-256
+}
+
+// instantChallenge 秒传持有证明校验信息，要求客户端提交文件指定范围内容的SHA-256
+type instantChallenge struct {
+	UserId string `json:"user_id"`
+	Hash   string `json:"hash"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// InstantUploadFile 根据文件哈希秒传文件，云端已存在相同内容时直接创建文件记录，
+// 否则返回hit为false，客户端需正常上传文件。只知道哈希不能证明持有文件，相同内容属于其他用户时，
+// 先返回随机选取的校验范围，客户端携带校验ID和该范围内容的SHA-256再次请求，校验通过后才秒传
+func (service *FileInstantUploadService) InstantUploadFile(userId string) serializer.Response {
+	// 检查目标文件夹归属
+	var userFileFolder model.FileFolder
+	if err := model.DB.Where("uuid = ?", service.FolderId).Find(&userFileFolder).Error; err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 获取文件夹信息失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if userFileFolder.OwnerID != userId {
+		return serializer.NotAuthErr("")
+	}
+
+	// 查找内容相同的文件
+	filename, extend := utils.SplitFilename(service.FileName)
+	hash := strings.ToLower(service.Hash)
+	sameFile, err := model.GetFileByHash(userId, hash, service.FileSize, extend)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return serializer.Success(map[string]interface{}{"hit": false})
+	}
+	if err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 查找相同文件失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	// 确认云端对象仍然存在
+	ok, err := disk.BaseCloudDisk.IsObjectExist(sameFile.FilePath, "", disk.ObjectName(sameFile.FileUuid, sameFile.FilePostfix))
+	if err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 检查云端对象失败: ", err)
+		return serializer.InternalErr("", err)
+	}
+	if !ok {
+		return serializer.Success(map[string]interface{}{"hit": false})
+	}
+
+	// 用户自己的文件不需要证明持有
+	if sameFile.Owner != userId {
+		if service.ChallengeId == "" {
+			return service.newChallenge(userId, hash)
+		}
+		if res, ok := service.verifyChallenge(userId, hash, sameFile); !ok {
+			return res
+		}
+	}
+
+	// 检查添加文件大小后当前大小是否超过最大限制
+	var userStore model.FileStore
+	isExceed, err := checkIfFileSizeExceedsVolum(model.DB, &userStore, userId, service.FileSize)
+	if err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 检查用户容量失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if isExceed {
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	}
+
+	// 复用云端对象创建文件记录
+	fileModel := model.File{
+		Owner:          userId,
+		FileName:       filename,
+		FilePostfix:    extend,
+		FileUuid:       sameFile.FileUuid,
+		FilePath:       sameFile.FilePath,
+		ParentFolderId: service.FolderId,
+		Size:           service.FileSize,
+		Hash:           sameFile.Hash,
+	}
+
+	conflict := service.Conflict
+	if conflict == "" {
+		conflict = model.ConflictOverwrite
+	}
+	t := model.DB.Begin()
+	// 锁定用户存储空间后重新检查容量，避免并发上传使用过期的已用容量
+	if isExceed, err = checkIfFileSizeExceedsVolum(t, &userStore, userId, service.FileSize); err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 检查用户容量失败: ", err)
+		t.Rollback()
+		return serializer.DBErr("", err)
+	}
+	if isExceed {
+		t.Rollback()
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	}
+	folderDelta, _, err := model.CreateFile(t, &fileModel, &userStore, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		t.Rollback()
+		return serializer.ParamsErr("NameConflict", nil)
+	}
+	if errors.Is(err, model.ErrExceedStoreLimit) {
+		t.Rollback()
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	}
+	if err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 创建文件信息失败: ", err)
+		t.Rollback()
+		return serializer.DBErr("", err)
+	}
+	if err := userFileFolder.AddFileFolderSize(t, folderDelta); err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 更新文件夹容量失败: ", err)
+		t.Rollback()
+		return serializer.DBErr("", err)
+	}
+	if err := t.Commit().Error; err != nil {
+		logger.Log().Error("[FileInstantUploadService.InstantUploadFile] 提交事务失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	return serializer.Success(map[string]interface{}{
+		"hit":  true,
+		"file": serializer.BuildFile(fileModel),
+	})
+}
+
+// newChallenge 随机选取文件中的校验范围并保存校验信息，返回给客户端
+func (service *FileInstantUploadService) newChallenge(userId string, hash string) serializer.Response {
+	length := min(service.FileSize, instantProofLength)
+	offset, err := rand.Int(rand.Reader, big.NewInt(service.FileSize-length+1))
+	if err != nil {
+		logger.Log().Error("[FileInstantUploadService.newChallenge] 生成校验范围失败: ", err)
+		return serializer.InternalErr("", err)
+	}
+	challenge := instantChallenge{
+		UserId: userId,
+		Hash:   hash,
+		Size:   service.FileSize,
+		Offset: offset.Int64(),
+		Length: length,
+	}
+	value, err := json.Marshal(challenge)
+	if err != nil {
+		return serializer.InternalErr("", err)
+	}
+	challengeId := uuid.NewString()
+	if err := cache.RedisClient.Set(context.Background(), cache.InstantUploadChallengeKey(challengeId), value, instantChallengeExpire).Err(); err != nil {
+		logger.Log().Error("[FileInstantUploadService.newChallenge] 保存校验信息失败: ", err)
+		return serializer.InternalErr("", err)
+	}
+	return serializer.Success(map[string]interface{}{
+		"hit": false,
+		"challenge": map[string]interface{}{
+			"challenge_id": challengeId,
+			"offset":       challenge.Offset,
+			"length":       challenge.Length,
+		},
+	})
+}
+
+// verifyChallenge 读取云端对象的校验范围，与客户端提交的内容哈希比对。校验信息只能使用一次，
+// 校验不通过时客户端需重新获取校验范围或正常上传
+func (service *FileInstantUploadService) verifyChallenge(userId string, hash string, sameFile model.File) (serializer.Response, bool) {
+	value, err := cache.RedisClient.GetDel(context.Background(), cache.InstantUploadChallengeKey(service.ChallengeId)).Bytes()
+	if err != nil {
+		return serializer.ParamsErr("ChallengeNotFound", nil), false
+	}
+	var challenge instantChallenge
+	if err := json.Unmarshal(value, &challenge); err != nil {
+		return serializer.ParamsErr("ChallengeNotFound", nil), false
+	}
+	if challenge.UserId != userId || challenge.Hash != hash || challenge.Size != service.FileSize {
+		return serializer.ParamsErr("ChallengeNotFound", nil), false
+	}
+
+	expected, err := objectRangeSHA256(sameFile, challenge.Offset, challenge.Length)
+	if err != nil {
+		logger.Log().Error("[FileInstantUploadService.verifyChallenge] 读取校验范围失败: ", err)
+		return serializer.InternalErr("", err), false
+	}
+	if !strings.EqualFold(service.Proof, expected) {
+		return serializer.ParamsErr("InstantUploadProofMismatch", nil), false
+	}
+	return serializer.Response{}, true
+}
+
+// objectRangeSHA256 计算云端对象指定范围内容的SHA-256
+func objectRangeSHA256(file model.File, offset int64, length int64) (string, error) {
+	reader, err := disk.BaseCloudDisk.GetObjectRange(file.FilePath, "", disk.ObjectName(file.FileUuid, file.FilePostfix), offset, length)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, io.LimitReader(reader, length))
+	if err != nil {
+		return "", err
+	}
+	if n != length {
+		return "", fmt.Errorf("校验范围读取了%d字节，期望%d字节", n, length)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,101 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// instantResult 解析秒传响应，返回是否命中和校验范围
+func instantResult(t *testing.T, res serializer.Response) (bool, map[string]interface{}) {
+	t.Helper()
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("秒传请求失败: %+v", res)
+	}
+	data := res.Data.(map[string]interface{})
+	challenge, _ := data["challenge"].(map[string]interface{})
+	return data["hit"].(bool), challenge
+}
+
+func TestInstantUploadFile(t *testing.T) {
+	mem := test.Setup(t)
+	owner := test.CreateUser(t, 1024)
+	user := test.CreateUser(t, 1024)
+	data := []byte("private document content")
+	existing := model.File{
+		Owner:          owner.Uuid,
+		FileName:       "secret",
+		FilePostfix:    "txt",
+		FileUuid:       "secret-object",
+		FilePath:       owner.Uuid,
+		ParentFolderId: owner.UserMainFileFolderID,
+		Size:           int64(len(data)),
+		Hash:           sha256Hex(data),
+	}
+	if err := model.DB.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+	mem.PutObject(existing.Object().Key(), data)
+
+	service := FileInstantUploadService{
+		FolderId: user.UserMainFileFolderID,
+		FileName: "copy.txt",
+		FileSize: int64(len(data)),
+		Hash:     sha256Hex(data),
+	}
+
+	// 其他用户的文件只凭哈希不能秒传，需先通过持有证明校验
+	hit, challenge := instantResult(t, service.InstantUploadFile(user.Uuid))
+	if hit || challenge == nil {
+		t.Fatalf("其他用户的文件应返回校验范围: hit=%v, challenge=%v", hit, challenge)
+	}
+	service.ChallengeId = challenge["challenge_id"].(string)
+	service.Proof = sha256Hex([]byte("guess"))
+	if res := service.InstantUploadFile(user.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "InstantUploadProofMismatch" {
+		t.Fatalf("证明错误时应拒绝秒传: %+v", res)
+	}
+	// 校验信息只能使用一次
+	if res := service.InstantUploadFile(user.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "ChallengeNotFound" {
+		t.Fatalf("校验信息使用后应失效: %+v", res)
+	}
+	if files := test.Files(t, user.UserMainFileFolderID); len(files) != 0 {
+		t.Fatalf("校验未通过时不应创建文件记录: %+v", files)
+	}
+
+	service.ChallengeId, service.Proof = "", ""
+	_, challenge = instantResult(t, service.InstantUploadFile(user.Uuid))
+	offset, length := int(challenge["offset"].(int64)), int(challenge["length"].(int64))
+	service.ChallengeId = challenge["challenge_id"].(string)
+	service.Proof = sha256Hex(data[offset : offset+length])
+	if hit, _ := instantResult(t, service.InstantUploadFile(user.Uuid)); !hit {
+		t.Fatal("持有证明校验通过后应秒传")
+	}
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 || files[0].Object() != existing.Object() {
+		t.Fatalf("秒传的文件应引用已有的云端对象: %+v", files)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != int64(len(data)) {
+		t.Fatalf("存储空间已用%d，期望%d", store.CurrentSize, len(data))
+	}
+
+	// 用户自己已有相同内容时不需要校验
+	service.FileName, service.ChallengeId, service.Proof = "again.txt", "", ""
+	if hit, challenge := instantResult(t, service.InstantUploadFile(user.Uuid)); !hit || challenge != nil {
+		t.Fatalf("自己的文件应直接秒传: hit=%v, challenge=%v", hit, challenge)
+	}
+
+	// 没有相同内容时需要正常上传
+	service.Hash = sha256Hex([]byte("something else"))
+	if hit, challenge := instantResult(t, service.InstantUploadFile(user.Uuid)); hit || challenge != nil {
+		t.Fatalf("没有相同内容时不应命中: hit=%v, challenge=%v", hit, challenge)
+	}
+}
@@ -1,6 +1,7 @@
 package file
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"go-cloud-disk/utils/logger"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // FileRefCountService 文件逻辑删除服务
@@ -39,37 +41,34 @@ func (service *FileRefCountService) LogicalDeleteFile(userID, fileID string) ser
 	// 	return serializer.DBErr("减少文件引用计数失败", err)
 	// }
 
-	// 2. todo:直接在库删除
-	now := time.Now()
-	if err := tx.Model(&file).Updates(map[string]interface{}{
-		"is_deleted": 1,
-		"deleted_at": &now,
-		"owner":      "", // 清空所有者信息
-	}).Error; err != nil {
+	// 2. 标记删除并添加到回收站，记录所在文件夹的路径以便原文件夹被删除后重建
+	var parent model.FileFolder
+	if err := tx.Where("uuid = ?", file.ParentFolderId).Limit(1).Find(&parent).Error; err != nil {
 		tx.Rollback()
-		logger.Log().Error("[LogicalDeleteFile] 标记删除失败: ", err)
-		return serializer.DBErr("逻辑删除文件失败", err)
+		logger.Log().Error("[LogicalDeleteFile] 查找所在文件夹失败: ", err)
+		return serializer.DBErr("查找所在文件夹失败", err)
 	}
-
-	// 3. 添加到回收站,要事务处理
-	recycleBin := model.RecycleBin{
-		UserID:           userID,
-		FileID:           fileID,
-		OriginalFileName: file.FileName + "." + file.FilePostfix,
-		OriginalPath:     file.ParentFolderId,
-		Size:             file.Size,
-		DeletedAt:        now,
-		ExpireAt:         now.Add(30 * 24 * time.Hour), // 30天后过期
+	folderPath, err := parent.NamePath(tx)
+	if err != nil {
+		tx.Rollback()
+		logger.Log().Error("[LogicalDeleteFile] 获取文件夹路径失败: ", err)
+		return serializer.DBErr("获取文件夹路径失败", err)
 	}
-
-	if err := tx.Create(&recycleBin).Error; err != nil {
+	if _, err := model.TrashFile(tx, file, folderPath, time.Now()); err != nil {
 		tx.Rollback()
 		logger.Log().Error("[LogicalDeleteFile] 添加到回收站失败: ", err)
 		return serializer.DBErr("添加到回收站失败", err)
 	}
 
+	// 3. 从文件夹及其上级中减去文件大小
+	if err := model.AddFileFoldersSize(tx, map[string]int64{file.ParentFolderId: -file.Size}); err != nil {
+		tx.Rollback()
+		logger.Log().Error("[LogicalDeleteFile] 更新文件夹大小失败: ", err)
+		return serializer.DBErr("更新文件夹大小失败", err)
+	}
+
 	// 4. 更新用户存储空间
-	if err := tx.Model(&model.FileStore{}).Where("user_id = ?", userID).UpdateColumn("current_size", gorm.Expr("current_size - ?", file.Size)).Error; err != nil {
+	if err := tx.Model(&model.FileStore{}).Where("owner_id = ?", userID).UpdateColumn("current_size", gorm.Expr("current_size - ?", file.Size)).Error; err != nil {
 		tx.Rollback()
 		logger.Log().Error("[LogicalDeleteFile] 更新用户存储空间失败: ", err)
 		return serializer.DBErr("更新用户存储空间失败", err)
@@ -132,14 +131,57 @@ func (service *FileRefCountService) RestoreFile(userID, recycleBinID string) ser
 		}
 	}()
 
-	// 1. TODO:新建文件记录
-	now := time.Now()
-	if err := tx.Model(&model.File{}).Where("uuid = ?", recycleBin.FileID).Updates(map[string]interface{}{
-		"is_deleted": 0,
-		"deleted_at": nil,
-		"owner":      userID,
-		"updated_at": now,
-	}).Error; err != nil {
+	// 1. 检查用户存储空间是否足够
+	var store model.FileStore
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", userID).First(&store).Error; err != nil {
+		tx.Rollback()
+		logger.Log().Error("[RestoreFile] 查找用户存储空间失败: ", err)
+		return serializer.DBErr("恢复文件失败", err)
+	}
+	reserved, err := model.GetReservedSize(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		logger.Log().Error("[RestoreFile] 获取预留空间失败: ", err)
+		return serializer.DBErr("恢复文件失败", err)
+	}
+	if store.CurrentSize+reserved+recycleBin.Size > store.MaxSize {
+		tx.Rollback()
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	}
+
+	// 2. 恢复文件或整个文件夹到原文件夹，原文件夹已删除时在主目录下按原路径重建，并标记回收站记录为已恢复
+	var user model.User
+	if err := tx.Where("uuid = ?", userID).First(&user).Error; err != nil {
+		tx.Rollback()
+		logger.Log().Error("[RestoreFile] 查找用户失败: ", err)
+		return serializer.DBErr("恢复文件失败", err)
+	}
+	var root model.FileFolder
+	if err := tx.Where("uuid = ?", user.UserMainFileFolderID).First(&root).Error; err != nil {
+		tx.Rollback()
+		logger.Log().Error("[RestoreFile] 查找主目录失败: ", err)
+		return serializer.DBErr("恢复文件失败", err)
+	}
+	var parentId string
+	var size int64
+	if recycleBin.ItemType == model.RecycleBinItemFileFolder {
+		var fileFolder model.FileFolder
+		fileFolder, err = model.RestoreRecycleBinFileFolder(tx, recycleBin, root)
+		parentId, size = fileFolder.ParentFolderID, fileFolder.Size
+	} else {
+		var file model.File
+		file, err = model.RestoreRecycleBinFile(tx, recycleBin, root)
+		parentId, size = file.ParentFolderId, file.Size
+	}
+	if errors.Is(err, model.ErrRecycleBinFileMissing) {
+		tx.Rollback()
+		return serializer.ParamsErr("文件已被清理，无法恢复", nil)
+	}
+	if errors.Is(err, model.ErrFileFolderTooDeep) {
+		tx.Rollback()
+		return serializer.ParamsErr("FileFolderTooDeep", nil)
+	}
+	if err != nil {
 		tx.Rollback()
 		logger.Log().Error("[RestoreFile] 恢复文件失败: ", err)
 		return serializer.DBErr("恢复文件失败", err)
@@ -152,15 +194,16 @@ func (service *FileRefCountService) RestoreFile(userID, recycleBinID string) ser
 	// 	return serializer.DBErr("增加引用计数失败", err)
 	// }
 
-	// 3. 标记回收站记录为已恢复
-	if err := tx.Model(&recycleBin).Update("is_restored", 1).Error; err != nil {
+	// 3. 为文件夹及其上级增加文件或文件夹的大小
+	if err := model.AddFileFoldersSize(tx, map[string]int64{parentId: size}); err != nil {
 		tx.Rollback()
-		logger.Log().Error("[RestoreFile] 更新回收站记录失败: ", err)
-		return serializer.DBErr("更新回收站记录失败", err)
+		logger.Log().Error("[RestoreFile] 更新文件夹大小失败: ", err)
+		return serializer.DBErr("更新文件夹大小失败", err)
 	}
 
 	// 4. 更新用户存储空间
-	if err := tx.Model(&model.FileStore{}).Where("user_id = ?", userID).UpdateColumn("current_size", gorm.Expr("current + ?", recycleBin.Size)).Error; err != nil {
+	store.CurrentSize += size
+	if err := tx.Save(&store).Error; err != nil {
 		tx.Rollback()
 		logger.Log().Error("[RestoreFile] 更新用户存储空间失败: ", err)
 		return serializer.DBErr("更新用户存储空间失败", err)
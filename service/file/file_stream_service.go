@@ -0,0 +1,200 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-cloud-disk/conf"
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/sign"
+	"go-cloud-disk/utils/throttle"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// FileContentRoute 服务端代理下载路由前缀
+	FileContentRoute = "/api/v1/file/"
+
+	// proxyDownloadExpire 代理下载URL的有效期
+	proxyDownloadExpire = time.Hour
+)
+
+// FileStreamService 服务端代理下载服务，通过签名鉴权，便于播放器和下载工具直接访问
+type FileStreamService struct {
+	Expires   string `form:"expires" json:"expires" binding:"required"`     // 过期时间戳
+	Signature string `form:"signature" json:"signature" binding:"required"` // HMAC签名
+}
+
+// FileStream 待代理下载的文件
+type FileStream struct {
+	Name    string    // 用户可见的文件名
+	Size    int64     // 文件大小
+	ETag    string    // 对象ETag
+	ModTime time.Time // 最后修改时间
+	file    model.File
+	limit   throttle.Limit // 文件所有者的传输限制
+}
+
+// BuildProxyDownloadURL 生成带签名的代理下载URL
+func BuildProxyDownloadURL(fileId string) string {
+	expires := strconv.FormatInt(time.Now().Add(proxyDownloadExpire).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", sign.HmacSign(conf.JwtKey, "GET", fileId, expires))
+	return FileContentRoute + fileId + "/content?" + query.Encode()
+}
+
+// verifyProxyDownload 校验代理下载URL的签名和过期时间
+func (service *FileStreamService) verifyProxyDownload(fileId string) error {
+	expireUnix, err := strconv.ParseInt(service.Expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("过期时间格式错误")
+	}
+	if time.Now().Unix() > expireUnix {
+		return fmt.Errorf("下载链接已过期")
+	}
+	if !sign.CheckHmacSign(conf.JwtKey, service.Signature, "GET", fileId, service.Expires) {
+		return fmt.Errorf("下载链接签名错误")
+	}
+	return nil
+}
+
+// GetFileStream 校验签名并获取文件的对象信息，失败时同时返回HTTP状态码，
+// 播放器和下载工具只根据状态码判断请求是否成功
+func (service *FileStreamService) GetFileStream(fileId string) (*FileStream, int, serializer.Response) {
+	if err := service.verifyProxyDownload(fileId); err != nil {
+		return nil, http.StatusForbidden, serializer.NotAuthErr(err.Error())
+	}
+
+	var file model.File
+	if err := model.DB.Where("uuid = ?", fileId).Find(&file).Error; err != nil {
+		logger.Log().Error("[FileStreamService.GetFileStream] 查找用户文件失败: ", err)
+		return nil, http.StatusInternalServerError, serializer.DBErr("", err)
+	}
+	// 签名后文件可能已被删除
+	if file.Uuid == "" || file.Owner == "" {
+		return nil, http.StatusNotFound, serializer.ParamsErr("FileNotFound", nil)
+	}
+	if !file.Available() {
+		return nil, http.StatusConflict, serializer.ParamsErr("FileNotAvailable", nil)
+	}
+
+	// 代理下载的流量计入文件所有者
+	limit, err := throttle.GetUserLimit(file.Owner)
+	if err != nil {
+		logger.Log().Error("[FileStreamService.GetFileStream] 获取用户传输限制失败: ", err)
+		return nil, http.StatusInternalServerError, serializer.DBErr("", err)
+	}
+	if err := throttle.CheckQuota(file.Owner, limit, throttle.Download, 0); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, throttle.ErrDailyQuotaExceeded) {
+			status = http.StatusTooManyRequests
+		}
+		return nil, status, transferQuotaErr("[FileStreamService.GetFileStream]", err)
+	}
+
+	info, err := disk.BaseCloudDisk.StatObject(file.FilePath, "", disk.ObjectName(file.FileUuid, file.FilePostfix))
+	if err != nil {
+		logger.Log().Error("[FileStreamService.GetFileStream] 获取对象信息失败: ", err)
+		return nil, http.StatusBadGateway, serializer.InternalErr("", err)
+	}
+
+	stream := &FileStream{
+		Name:    file.DisplayName(),
+		Size:    info.Size,
+		ETag:    info.ETag,
+		ModTime: info.LastModified,
+		file:    file,
+		limit:   limit,
+	}
+	// 内容哈希比云端ETag更稳定，秒传共享对象时也保持一致
+	if file.Hash != "" {
+		stream.ETag = file.Hash
+	}
+	return stream, http.StatusOK, serializer.Success(nil)
+}
+
+// Serve 写出文件内容，由http.ServeContent处理Range、If-None-Match、If-Modified-Since等条件请求
+func (stream *FileStream) Serve(w gin.ResponseWriter, r *http.Request) {
+	// 根据保存的扩展名判断类型，不为探测类型额外请求对象
+	w.Header().Set("Content-Type", disk.ContentTypeByPostfix(stream.file.FilePostfix))
+	w.Header().Set("Content-Disposition", disk.ContentDisposition(stream.Name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if stream.ETag != "" {
+		w.Header().Set("ETag", "\""+stream.ETag+"\"")
+	}
+
+	content := &objectReadSeeker{file: stream.file, size: stream.Size}
+	defer content.Close()
+	if stream.limit.Unlimited() {
+		http.ServeContent(w, r, stream.Name, stream.ModTime, content)
+		return
+	}
+	writer := throttle.NewResponseWriter(w, stream.file.Owner, stream.limit, throttle.Download)
+	defer writer.Done()
+	http.ServeContent(writer, r, stream.Name, stream.ModTime, content)
+}
+
+// objectReadSeeker 按需读取云端对象的ReadSeeker，Seek只记录偏移量，
+// 读取时才从偏移量处发起范围请求，避免将整个文件读入内存
+type objectReadSeeker struct {
+	file   model.File
+	size   int64
+	offset int64
+	reader io.ReadCloser
+}
+
+// Read 从当前偏移量读取对象内容
+func (object *objectReadSeeker) Read(p []byte) (int, error) {
+	if object.offset >= object.size {
+		return 0, io.EOF
+	}
+	if object.reader == nil {
+		reader, err := disk.BaseCloudDisk.GetObjectRange(object.file.FilePath, "",
+			disk.ObjectName(object.file.FileUuid, object.file.FilePostfix), object.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		object.reader = reader
+	}
+	n, err := object.reader.Read(p)
+	object.offset += int64(n)
+	return n, err
+}
+
+// Seek 修改偏移量，偏移量变化时关闭当前数据流
+func (object *objectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += object.offset
+	case io.SeekEnd:
+		offset += object.size
+	}
+	if offset < 0 {
+		return 0, errors.New("偏移量不能为负数")
+	}
+	if offset != object.offset {
+		object.Close()
+		object.offset = offset
+	}
+	return offset, nil
+}
+
+// Close 关闭当前数据流
+func (object *objectReadSeeker) Close() error {
+	if object.reader == nil {
+		return nil
+	}
+	err := object.reader.Close()
+	object.reader = nil
+	return err
+}
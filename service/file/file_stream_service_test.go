@@ -0,0 +1,80 @@
+package file
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/test"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamService 从代理下载URL中解析出签名参数
+func streamService(t *testing.T, fileId string) FileStreamService {
+	t.Helper()
+	u, err := url.Parse(BuildProxyDownloadURL(fileId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FileStreamService{Expires: u.Query().Get("expires"), Signature: u.Query().Get("signature")}
+}
+
+func TestFileStream(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("<html><script>alert(1)</script></html>")
+	file := model.File{
+		Owner:          user.Uuid,
+		FileName:       "page",
+		FilePostfix:    "unknownext",
+		FileUuid:       "page-object",
+		FilePath:       user.Uuid,
+		ParentFolderId: user.UserMainFileFolderID,
+		Size:           int64(len(data)),
+	}
+	if err := model.DB.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	mem.PutObject(file.Object().Key(), data)
+
+	service := streamService(t, file.Uuid)
+	stream, status, res := service.GetFileStream(file.Uuid)
+	if stream == nil || status != http.StatusOK {
+		t.Fatalf("获取文件失败: %d %+v", status, res)
+	}
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	stream.Serve(c.Writer, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != string(data) {
+		t.Fatalf("响应为%d %q", recorder.Code, recorder.Body.String())
+	}
+	// 无法根据后缀判断类型时不探测内容，只读取一次对象
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/octet-stream" {
+		t.Fatalf("Content-Type为%q，期望application/octet-stream", contentType)
+	}
+	if count := mem.CallCount("GetObjectRange"); count != 1 {
+		t.Fatalf("读取对象%d次，期望1次", count)
+	}
+
+	// 失败时返回对应的HTTP状态码
+	wrong := service
+	wrong.Signature = "invalid"
+	if _, status, _ := wrong.GetFileStream(file.Uuid); status != http.StatusForbidden {
+		t.Fatalf("签名错误时状态码为%d，期望403", status)
+	}
+	if err := model.DB.Model(&file).Update("status", model.FileStatusPending).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, status, _ := service.GetFileStream(file.Uuid); status != http.StatusConflict {
+		t.Fatalf("文件不可用时状态码为%d，期望409", status)
+	}
+	if err := model.DB.Delete(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, status, _ := service.GetFileStream(file.Uuid); status != http.StatusNotFound {
+		t.Fatalf("文件已删除时状态码为%d，期望404", status)
+	}
+}
@@ -1,6 +1,8 @@
 package file
 
 import (
+	"errors"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
@@ -8,9 +10,10 @@ import (
 
 // FileUpdateService 文件更新服务结构体
 type FileUpdateService struct {
-	FileId      string `json:"file" form:"file" binding:"required"`     // 文件ID
-	FileName    string `json:"name" form:"name"`                        // 文件名
-	NewParentId string `json:"parent" form:"parent" binding:"required"` // 新的父文件夹ID
+	FileId      string `json:"file" form:"file" binding:"required"`                                           // 文件ID
+	FileName    string `json:"name" form:"name"`                                                              // 文件名
+	NewParentId string `json:"parent" form:"parent" binding:"required"`                                       // 新的父文件夹ID
+	Conflict    string `json:"conflict" form:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认fail，overwrite会删除目标文件夹中的同名文件
 }
 
 // UpdateFileInfo 更新文件信息，包括文件名和所属文件夹
@@ -41,12 +44,17 @@ func (service *FileUpdateService) UpdateFileInfo(userId string) serializer.Respo
 	}
 
 	// 构建新的文件信息
+	originFile := file
 	file.ParentFolderId = service.NewParentId
 	newFilename := file.FileName
 	if service.FileName != "" {
 		newFilename = service.FileName
 	}
 	file.FileName = newFilename
+	conflict := service.Conflict
+	if conflict == "" {
+		conflict = model.ConflictFail
+	}
 	// 更新文件信息到数据库
 	t := model.DB.Begin()
 	defer func() {
@@ -56,7 +64,41 @@ func (service *FileUpdateService) UpdateFileInfo(userId string) serializer.Respo
 			t.Commit()
 		}
 	}()
-	if err := t.Save(&file).Error; err != nil {
+
+	// 处理目标文件夹中的同名文件
+	existing, err := model.ResolveFileName(t, &file, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		return serializer.ParamsErr("NameConflict", nil)
+	}
+	if err != nil {
+		logger.Log().Error("[FileUpdateService.UpdateFileInfo] 检查同名文件失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if existing != nil && conflict == model.ConflictSkip {
+		return serializer.Success(serializer.BuildFile(originFile))
+	}
+	if existing != nil {
+		var userStore model.FileStore
+		if err = t.Where("owner_id = ?", userId).First(&userStore).Error; err != nil {
+			logger.Log().Error("[FileUpdateService.UpdateFileInfo] 查找用户文件存储信息失败: ", err)
+			return serializer.DBErr("", err)
+		}
+		if err = deleteFile(t, *existing, userStore, parentFilefolder); err != nil {
+			logger.Log().Error("[FileUpdateService.UpdateFileInfo] 删除被覆盖的文件失败: ", err)
+			return serializer.DBErr("", err)
+		}
+		// 删除文件已更新文件夹及其上级的大小，重新读取后再调整
+		if err = t.Where("uuid = ?", nowFilefolder.Uuid).Find(&nowFilefolder).Error; err != nil {
+			logger.Log().Error("[FileUpdateService.UpdateFileInfo] 查找文件夹失败: ", err)
+			return serializer.DBErr("", err)
+		}
+		if err = t.Where("uuid = ?", parentFilefolder.Uuid).Find(&parentFilefolder).Error; err != nil {
+			logger.Log().Error("[FileUpdateService.UpdateFileInfo] 查找文件夹失败: ", err)
+			return serializer.DBErr("", err)
+		}
+	}
+
+	if err = t.Save(&file).Error; err != nil {
 		logger.Log().Error("[FileUpdateService.UpdateFileInfo] 更新文件失败: ", err)
 		return serializer.DBErr("", err)
 	}
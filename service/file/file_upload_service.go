@@ -1,6 +1,7 @@
 package file
 
 import (
+	"errors"
 	"mime/multipart"
 
 	"go-cloud-disk/disk"
@@ -10,35 +11,27 @@ import (
 	"go-cloud-disk/utils/logger"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // FileUploadService 文件上传服务结构体
 type FileUploadService struct {
-	FolderId string `form:"filefolder" json:"filefolder" binding:"required"` // 文件夹ID
+	FolderId string `form:"filefolder" json:"filefolder" binding:"required"`                               // 文件夹ID
+	Conflict string `form:"conflict" json:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认overwrite，旧内容保留为历史版本
 }
 
-// checkIfFileSizeExceedsVolum 检查上传文件大小是否超过用户存储空间限制
-func checkIfFileSizeExceedsVolum(userStore *model.FileStore, userId string, size int64) (bool, error) {
-	if err := model.DB.Where("owner_id = ?", userId).Find(userStore).Error; err != nil {
+// checkIfFileSizeExceedsVolum 检查上传文件大小是否超过用户存储空间限制，进行中的分片上传预留的空间不可用。
+// 在事务中调用时锁定用户存储空间直到事务结束，保存文件前须在同一事务中重新检查，避免并发上传覆盖已用容量
+func checkIfFileSizeExceedsVolum(t *gorm.DB, userStore *model.FileStore, userId string, size int64) (bool, error) {
+	if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", userId).Find(userStore).Error; err != nil {
 		return false, err
 	}
-	ans := userStore.CurrentSize+size > userStore.MaxSize
-	return ans, nil
-}
-
-// createFile 使用事务保存用户文件信息，确保用户存储空间安全
-func createFile(t *gorm.DB, file model.File, userStore model.FileStore) error {
-	// 保存文件信息到数据库
-	var err error
-	if err = t.Save(&file).Error; err != nil {
-		return err
-	}
-	// 增加用户文件存储容量
-	userStore.AddCurrentSize(file.Size)
-	if err = t.Save(&userStore).Error; err != nil {
-		return err
+	reserved, err := model.GetReservedSize(t, userId)
+	if err != nil {
+		return false, err
 	}
-	return nil
+	ans := userStore.CurrentSize+reserved+size > userStore.MaxSize
+	return ans, nil
 }
 
 // UploadFile 上传文件到云端并创建文件记录
@@ -49,7 +42,7 @@ func (service *FileUploadService) UploadFile(userId string, file *multipart.File
 
 	// 检查添加文件大小后当前大小是否超过最大限制
 	var isExceed bool
-	if isExceed, err = checkIfFileSizeExceedsVolum(&userStore, userId, file.Size); err != nil {
+	if isExceed, err = checkIfFileSizeExceedsVolum(model.DB, &userStore, userId, file.Size); err != nil {
 		logger.Log().Error("[FileUploadService.UploadFile] 检查用户容量失败: ", err)
 		return serializer.DBErr("", err)
 	}
@@ -63,6 +56,12 @@ func (service *FileUploadService) UploadFile(userId string, file *multipart.File
 		logger.Log().Error("[FileUploadService.UploadFile] 获取文件MD5失败: ", err)
 		return serializer.ParamsErr("", err)
 	}
+	// 计算文件内容哈希，用于后续秒传
+	hash, err := utils.GetFileSHA256(dst)
+	if err != nil {
+		logger.Log().Error("[FileUploadService.UploadFile] 获取文件SHA-256失败: ", err)
+		return serializer.ParamsErr("", err)
+	}
 	// 如果文件最近已经上传过，不重复上传到云端
 	// 从Redis获取文件信息
 	filePath := model.GetFileInfoFromRedis(md5String)
@@ -85,16 +84,44 @@ func (service *FileUploadService) UploadFile(userId string, file *multipart.File
 		FilePath:       filePath,
 		ParentFolderId: service.FolderId,
 		Size:           file.Size,
+		Hash:           hash,
 		RefCount:       1, // 新文件引用计数为1
 	}
 
+	conflict := service.Conflict
+	if conflict == "" {
+		conflict = model.ConflictOverwrite
+	}
 	t := model.DB.Begin()
+	// 上传到云端期间容量可能已变化，锁定后重新检查
+	if isExceed, err = checkIfFileSizeExceedsVolum(t, &userStore, userId, file.Size); err != nil {
+		logger.Log().Error("[FileUploadService.UploadFile] 检查用户容量失败: ", err)
+		t.Rollback()
+		return serializer.DBErr("", err)
+	}
+	if isExceed {
+		t.Rollback()
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	}
 	// 插入用户文件信息到数据库
-	if err := createFile(t, fileModel, userStore); err != nil {
+	folderDelta, skipped, err := model.CreateFile(t, &fileModel, &userStore, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		t.Rollback()
+		return serializer.ParamsErr("NameConflict", nil)
+	}
+	if errors.Is(err, model.ErrExceedStoreLimit) {
+		t.Rollback()
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	}
+	if err != nil {
 		logger.Log().Error("[FileUploadService.UploadFile] 创建文件信息失败: ", err)
 		t.Rollback()
 		return serializer.DBErr("", err)
 	}
+	if skipped {
+		t.Rollback()
+		return serializer.Success(serializer.BuildFile(fileModel))
+	}
 
 	// 将文件大小添加到文件夹和父文件夹
 	var userFileFolder model.FileFolder
@@ -103,7 +130,7 @@ func (service *FileUploadService) UploadFile(userId string, file *multipart.File
 		t.Rollback()
 		return serializer.DBErr("", err)
 	}
-	if err := userFileFolder.AddFileFolderSize(t, file.Size); err != nil {
+	if err := userFileFolder.AddFileFolderSize(t, folderDelta); err != nil {
 		logger.Log().Error("[FileUploadService.UploadFile] 更新文件夹容量失败: ", err)
 		t.Rollback()
 		return serializer.DBErr("", err)
@@ -0,0 +1,97 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+// saveUploadedFile 模拟接口层把上传文件保存到本地
+func saveUploadedFile(t *testing.T, fileName string, data []byte) string {
+	t.Helper()
+	dst := filepath.Join(t.TempDir(), fileName)
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func TestUploadFile(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	data := []byte("hello cloud disk")
+
+	service := FileUploadService{FolderId: user.UserMainFileFolderID}
+	res := service.UploadFile(user.Uuid, test.FileHeader(t, "hello.txt", data), saveUploadedFile(t, "hello.txt", data))
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("上传失败: %+v", res)
+	}
+
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 || files[0].FileName != "hello" || files[0].Size != int64(len(data)) || !files[0].Available() {
+		t.Fatalf("文件记录不符: %+v", files)
+	}
+	object, ok := mem.Object(files[0].Object().Key())
+	if !ok || string(object) != string(data) {
+		t.Fatalf("云端对象内容为%q，期望%q", object, data)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != int64(len(data)) {
+		t.Fatalf("存储空间已用%d，期望%d", store.CurrentSize, len(data))
+	}
+	if folder := test.Folder(t, user.UserMainFileFolderID); folder.Size != int64(len(data)) {
+		t.Fatalf("文件夹大小%d，期望%d", folder.Size, len(data))
+	}
+
+	// 最近上传过的内容不重复上传到云端
+	res = service.UploadFile(user.Uuid, test.FileHeader(t, "copy.txt", data), saveUploadedFile(t, "copy.txt", data))
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("上传相同内容失败: %+v", res)
+	}
+	if count := mem.CallCount("UploadSimpleFile"); count != 1 {
+		t.Fatalf("相同内容上传到云端%d次，期望1次", count)
+	}
+	if files := test.Files(t, user.UserMainFileFolderID); len(files) != 2 {
+		t.Fatalf("文件数%d，期望2", len(files))
+	}
+}
+
+func TestUploadFileCloudFailure(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	mem.FailOn("UploadSimpleFile", errors.New("cloud unavailable"))
+
+	data := []byte("hello cloud disk")
+	service := FileUploadService{FolderId: user.UserMainFileFolderID}
+	res := service.UploadFile(user.Uuid, test.FileHeader(t, "hello.txt", data), saveUploadedFile(t, "hello.txt", data))
+	if res.Code != serializer.CodeInternalError {
+		t.Fatalf("云端上传失败时应返回内部错误: %+v", res)
+	}
+	if files := test.Files(t, user.UserMainFileFolderID); len(files) != 0 {
+		t.Fatalf("云端上传失败时不应创建文件记录: %+v", files)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != 0 {
+		t.Fatalf("云端上传失败时存储空间已用%d，期望0", store.CurrentSize)
+	}
+	if len(mem.Keys()) != 0 {
+		t.Fatalf("云端上传失败时不应有对象: %v", mem.Keys())
+	}
+}
+
+func TestUploadFileExceedStoreLimit(t *testing.T) {
+	mem := test.Setup(t)
+	user := test.CreateUser(t, 4)
+
+	data := []byte("hello cloud disk")
+	service := FileUploadService{FolderId: user.UserMainFileFolderID}
+	res := service.UploadFile(user.Uuid, test.FileHeader(t, "hello.txt", data), saveUploadedFile(t, "hello.txt", data))
+	if res.Code != serializer.CodeParamsError || res.Msg != "ExceedStoreLimit" {
+		t.Fatalf("超过容量时应返回ExceedStoreLimit: %+v", res)
+	}
+	if count := mem.CallCount("UploadSimpleFile"); count != 0 {
+		t.Fatalf("超过容量时不应上传到云端，实际上传%d次", count)
+	}
+}
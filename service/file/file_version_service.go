@@ -0,0 +1,243 @@
+package file
+
+import (
+	"errors"
+	"time"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/throttle"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FileVersionService 文件历史版本服务
+type FileVersionService struct{}
+
+// FileVersionConfigService 历史版本保留策略服务
+type FileVersionConfigService struct {
+	MaxVersions int `json:"max_versions" binding:"min=0,max=100"`        // 每个文件保留的历史版本数，0表示不保留
+	KeepDays    int `json:"keep_days" binding:"required,min=1,max=3650"` // 历史版本保留天数
+}
+
+// errVersionNotFound 历史版本不存在或不属于该文件
+var errVersionNotFound = errors.New("历史版本不存在")
+
+// getUserFile 获取用户拥有的文件
+func getUserFile(t *gorm.DB, userId string, fileId string) (model.File, error) {
+	var file model.File
+	if err := t.Where("uuid = ? and owner = ?", fileId, userId).Find(&file).Error; err != nil {
+		return file, err
+	}
+	if file.Uuid == "" {
+		return file, gorm.ErrRecordNotFound
+	}
+	return file, nil
+}
+
+// getFileVersion 获取文件的指定历史版本
+func getFileVersion(t *gorm.DB, fileId string, versionId string) (model.FileVersion, error) {
+	var version model.FileVersion
+	if err := t.Where("uuid = ? and file_id = ?", versionId, fileId).Find(&version).Error; err != nil {
+		return version, err
+	}
+	if version.Uuid == "" {
+		return version, errVersionNotFound
+	}
+	return version, nil
+}
+
+// ListFileVersions 列出文件的历史版本，最新的在前
+func (service *FileVersionService) ListFileVersions(userId string, fileId string) serializer.Response {
+	if _, err := getUserFile(model.DB, userId, fileId); errors.Is(err, gorm.ErrRecordNotFound) {
+		return serializer.NotAuthErr("")
+	} else if err != nil {
+		logger.Log().Error("[FileVersionService.ListFileVersions] 查找用户文件失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	var versions []model.FileVersion
+	if err := model.DB.Where("file_id = ?", fileId).Order("created_at desc").Find(&versions).Error; err != nil {
+		logger.Log().Error("[FileVersionService.ListFileVersions] 查找历史版本失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	return serializer.Success(serializer.BuildFileVersions(versions))
+}
+
+// GetFileVersionURL 获取历史版本的下载URL
+func (service *FileVersionService) GetFileVersionURL(userId string, fileId string, versionId string) serializer.Response {
+	file, err := getUserFile(model.DB, userId, fileId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return serializer.NotAuthErr("")
+	} else if err != nil {
+		logger.Log().Error("[FileVersionService.GetFileVersionURL] 查找用户文件失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	version, err := getFileVersion(model.DB, fileId, versionId)
+	if errors.Is(err, errVersionNotFound) {
+		return serializer.ParamsErr("VersionNotFound", nil)
+	} else if err != nil {
+		logger.Log().Error("[FileVersionService.GetFileVersionURL] 查找历史版本失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	if err := throttle.ReserveUserQuota(userId, throttle.Download, version.Size); err != nil {
+		return transferQuotaErr("[FileVersionService.GetFileVersionURL]", err)
+	}
+	url, err := disk.GetFileDownloadURL(version.FilePath, "", version.ObjectName(), file.DisplayName(), time.Hour)
+	if err != nil {
+		logger.Log().Error("[FileVersionService.GetFileVersionURL] 获取下载URL失败: ", err)
+		return serializer.InternalErr("", err)
+	}
+	return serializer.Success(fileGetDownloadURLResponse{
+		Url: url,
+	})
+}
+
+// RestoreFileVersion 将历史版本恢复为当前内容，当前内容转为新的历史版本
+func (service *FileVersionService) RestoreFileVersion(userId string, fileId string, versionId string) serializer.Response {
+	var file model.File
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		var err error
+		if file, err = getUserFile(t.Clauses(clause.Locking{Strength: "UPDATE"}), userId, fileId); err != nil {
+			return err
+		}
+		version, err := getFileVersion(t, fileId, versionId)
+		if err != nil {
+			return err
+		}
+
+		// 当前内容转为历史版本，总存储空间不变
+		if err := t.Create(&model.FileVersion{
+			FileId:      file.Uuid,
+			Owner:       file.Owner,
+			FileUuid:    file.FileUuid,
+			FilePostfix: file.FilePostfix,
+			FilePath:    file.FilePath,
+			Size:        file.Size,
+			Hash:        file.Hash,
+		}).Error; err != nil {
+			return err
+		}
+		if err := t.Delete(&version).Error; err != nil {
+			return err
+		}
+
+		folderDelta := version.Size - file.Size
+		file.FileUuid = version.FileUuid
+		file.FilePostfix = version.FilePostfix
+		file.FilePath = version.FilePath
+		file.Size = version.Size
+		file.Hash = version.Hash
+		file.Status = model.FileStatusAvailable
+		if err := t.Save(&file).Error; err != nil {
+			return err
+		}
+
+		var fileFolder model.FileFolder
+		if err := t.Where("uuid = ?", file.ParentFolderId).Find(&fileFolder).Error; err != nil {
+			return err
+		}
+		return fileFolder.AddFileFolderSize(t, folderDelta)
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return serializer.NotAuthErr("")
+	case errors.Is(err, errVersionNotFound):
+		return serializer.ParamsErr("VersionNotFound", nil)
+	case err != nil:
+		logger.Log().Error("[FileVersionService.RestoreFileVersion] 恢复历史版本失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	return serializer.Success(serializer.BuildFile(file))
+}
+
+// DeleteFileVersion 删除历史版本并释放其占用的存储空间
+func (service *FileVersionService) DeleteFileVersion(userId string, fileId string, versionId string) serializer.Response {
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		if _, err := getUserFile(t, userId, fileId); err != nil {
+			return err
+		}
+		version, err := getFileVersion(t, fileId, versionId)
+		if err != nil {
+			return err
+		}
+		if err := t.Delete(&version).Error; err != nil {
+			return err
+		}
+		if err := model.ReleaseObjects(t, []model.StoredObject{version.Object()}); err != nil {
+			return err
+		}
+		return subStoreSize(t, userId, version.Size)
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return serializer.NotAuthErr("")
+	case errors.Is(err, errVersionNotFound):
+		return serializer.ParamsErr("VersionNotFound", nil)
+	case err != nil:
+		logger.Log().Error("[FileVersionService.DeleteFileVersion] 删除历史版本失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	return serializer.Success(nil)
+}
+
+// subStoreSize 减少用户已用存储空间
+func subStoreSize(t *gorm.DB, userId string, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	var userStore model.FileStore
+	if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", userId).First(&userStore).Error; err != nil {
+		return err
+	}
+	userStore.SubCurrentSize(size)
+	return t.Save(&userStore).Error
+}
+
+// GetFileVersionConfig 获取历史版本保留策略
+func (service *FileVersionService) GetFileVersionConfig(userId string) serializer.Response {
+	config, err := model.GetFileVersionConfig(model.DB, userId)
+	if err != nil {
+		logger.Log().Error("[FileVersionService.GetFileVersionConfig] 查询配置失败: ", err)
+		return serializer.DBErr("获取配置失败", err)
+	}
+	return serializer.Success(config)
+}
+
+// UpdateFileVersionConfig 更新历史版本保留策略，并立即按新的版本数清理多余的历史版本
+func (service *FileVersionConfigService) UpdateFileVersionConfig(userId string) serializer.Response {
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		config, err := model.GetFileVersionConfig(t, userId)
+		if err != nil {
+			return err
+		}
+		config.MaxVersions = service.MaxVersions
+		config.KeepDays = service.KeepDays
+		if err := t.Save(&config).Error; err != nil {
+			return err
+		}
+
+		var fileIds []string
+		if err := t.Model(&model.FileVersion{}).Where("owner = ?", userId).Distinct().Pluck("file_id", &fileIds).Error; err != nil {
+			return err
+		}
+		var freed int64
+		for _, fileId := range fileIds {
+			size, err := model.PruneFileVersions(t, fileId, config.MaxVersions)
+			if err != nil {
+				return err
+			}
+			freed += size
+		}
+		return subStoreSize(t, userId, freed)
+	})
+	if err != nil {
+		logger.Log().Error("[FileVersionConfigService.UpdateFileVersionConfig] 更新配置失败: ", err)
+		return serializer.DBErr("更新配置失败", err)
+	}
+	return serializer.Success(nil)
+}
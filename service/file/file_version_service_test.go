@@ -0,0 +1,68 @@
+package file
+
+import (
+	"fmt"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+// fileVersions 按成为历史版本的时间倒序返回文件的历史版本
+func fileVersions(t *testing.T, fileId string) []model.FileVersion {
+	t.Helper()
+	var versions []model.FileVersion
+	if err := model.DB.Where("file_id = ?", fileId).Order("created_at desc").Find(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+func TestUploadFileOverwriteVersions(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	config := FileVersionConfigService{MaxVersions: 2, KeepDays: model.DefaultFileVersionDays}
+	if res := config.UpdateFileVersionConfig(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("更新保留策略失败: %+v", res)
+	}
+
+	// 同名覆盖时旧内容转为历史版本，超过保留数量的旧版本被清理
+	service := FileUploadService{FolderId: user.UserMainFileFolderID}
+	var total int64
+	for i := 1; i <= 4; i++ {
+		data := []byte(fmt.Sprintf("version %d content", i))
+		res := service.UploadFile(user.Uuid, test.FileHeader(t, "notes.txt", data), saveUploadedFile(t, "notes.txt", data))
+		if res.Code != serializer.CodeSuccess {
+			t.Fatalf("第%d次上传失败: %+v", i, res)
+		}
+		total = int64(len(data))
+	}
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 {
+		t.Fatalf("同名覆盖后文件数%d，期望1", len(files))
+	}
+	versions := fileVersions(t, files[0].Uuid)
+	if len(versions) != 2 {
+		t.Fatalf("保留%d个历史版本，期望2个", len(versions))
+	}
+	for _, version := range versions {
+		total += version.Size
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != total {
+		t.Fatalf("存储空间已用%d，期望%d", store.CurrentSize, total)
+	}
+
+	// 减少保留数量时立即清理多余的历史版本
+	config.MaxVersions = 1
+	if res := config.UpdateFileVersionConfig(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("更新保留策略失败: %+v", res)
+	}
+	remaining := fileVersions(t, files[0].Uuid)
+	if len(remaining) != 1 || remaining[0].Uuid != versions[0].Uuid {
+		t.Fatalf("应只保留最新的历史版本: %+v", remaining)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != total-versions[1].Size {
+		t.Fatalf("存储空间已用%d，期望%d", store.CurrentSize, total-versions[1].Size)
+	}
+}
@@ -111,8 +111,8 @@ func (service *RecycleBinService) EmptyRecycleBin(userID string) serializer.Resp
 	// 	}
 	// }
 
-	// 删除回收站记录
-	if err := tx.Where("user_id = ? AND is_restored = 0", userID).Delete(&model.RecycleBin{}).Error; err != nil {
+	// 删除回收站记录及其中的文件和文件夹
+	if err := model.PurgeRecycleBins(tx, userID, recycleBins); err != nil {
 		tx.Rollback()
 		logger.Log().Error("[EmptyRecycleBin] 删除回收站记录失败: ", err)
 		return serializer.DBErr("清空回收站失败", err)
@@ -215,7 +215,7 @@ func (service *RecycleBinService) AutoCleanExpiredFiles() error {
 
 		// 处理过期文件
 		for _, file := range expiredFiles {
-			if err := model.DB.Delete(&file).Error; err != nil {
+			if err := service.processExpiredFile(file); err != nil {
 				logger.Log().Error(fmt.Sprintf("[AutoCleanExpiredFiles] 删除过期文件失败: UserID=%s, FileID=%s, Error=%v", config.UserID, file.FileID, err))
 			}
 		}
@@ -248,8 +248,8 @@ func (service *RecycleBinService) processExpiredFile(recycleBin model.RecycleBin
 	// 	}
 	// }
 
-	// 删除回收站记录
-	if err := tx.Delete(&recycleBin).Error; err != nil {
+	// 删除回收站记录及其中的文件和文件夹
+	if err := model.PurgeRecycleBins(tx, recycleBin.UserID, []model.RecycleBin{recycleBin}); err != nil {
 		tx.Rollback()
 		return fmt.Errorf("删除回收站记录失败: %v", err)
 	}
@@ -1,6 +1,8 @@
 package filefolder
 
 import (
+	"errors"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
@@ -8,8 +10,9 @@ import (
 
 // FileFolderCreateService 创建文件夹服务结构体
 type FileFolderCreateService struct {
-	ParentFolderID string `json:"parent" form:"parent" binding:"required"` // 父文件夹ID
-	FileFolderName string `json:"name" form:"name" binding:"required"`     // 文件夹名称
+	ParentFolderID string `json:"parent" form:"parent" binding:"required"`                             // 父文件夹ID
+	FileFolderName string `json:"name" form:"name" binding:"required"`                                 // 文件夹名称
+	Conflict       string `json:"conflict" form:"conflict" binding:"omitempty,oneof=fail rename skip"` // 同名冲突策略，默认fail，skip返回已存在的同名文件夹
 }
 
 // CreateFileFolder 在用户数据库中创建文件夹
@@ -34,7 +37,27 @@ func (service *FileFolderCreateService) CreateFileFolder(userId string) serializ
 		Size:           0, // 新建文件夹默认大小为0
 	}
 
-	if err = model.DB.Create(&createFilerFolder).Error; err != nil {
+	conflict := service.Conflict
+	if conflict == "" {
+		conflict = model.ConflictFail
+	}
+	existing, err := model.ResolveFileFolderName(model.DB, &createFilerFolder, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		return serializer.ParamsErr("NameConflict", nil)
+	}
+	if err != nil {
+		logger.Log().Error("[FileFolderCreateService.CreateFileFolder] 检查同名文件夹失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if existing != nil {
+		return serializer.Success(serializer.BuildFileFolder(*existing))
+	}
+
+	err = model.DB.Create(&createFilerFolder).Error
+	if errors.Is(err, model.ErrFileFolderTooDeep) {
+		return serializer.ParamsErr("FileFolderTooDeep", nil)
+	}
+	if err != nil {
 		logger.Log().Error("[FileFolderCreateService.CreateFileFolder] 创建文件夹失败: ", err)
 		return serializer.DBErr("", err)
 	}
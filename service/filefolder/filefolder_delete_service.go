@@ -1,6 +1,8 @@
 package filefolder
 
 import (
+	"time"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
@@ -9,7 +11,7 @@ import (
 // DeleteFileFolderService 删除文件夹服务结构体
 type DeleteFileFolderService struct{}
 
-// DeleteFileFolder 临时删除文件夹，当添加大小模型时此函数将被更新
+// DeleteFileFolder 删除文件夹，文件夹及其整个子树作为一个条目移到回收站
 func (service *DeleteFileFolderService) DeleteFileFolder(userId string, fileFolderId string) serializer.Response {
 	// 检查用户权限是否匹配此文件夹
 	var fileFolder model.FileFolder
@@ -35,51 +37,31 @@ func (service *DeleteFileFolderService) DeleteFileFolder(userId string, fileFold
 		}
 	}()
 
-	// 删除文件夹和其中的文件
-	deleteFileFolderIDs := []string{}
-	deleteFileFolderIDs = append(deleteFileFolderIDs, fileFolderId)
-	for len(deleteFileFolderIDs) > 0 {
-		deleteFileFolders := []model.FileFolder{}
-		deleteIDs := []string{}
-		// 获取要删除文件夹中的子文件夹
-		if err := t.Select("uuid").Where("parent_folder_id in (?)", deleteFileFolderIDs).Find(&deleteFileFolders).Error; err != nil {
-			logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 查找要删除的文件夹信息失败: ", err)
-			return serializer.DBErr("", err)
-		}
-		// 获取将要删除的文件夹ID
-		for _, filefolder := range deleteFileFolders {
-			deleteIDs = append(deleteIDs, filefolder.Uuid)
-		}
-		// 删除当前批次的文件夹
-		if err := t.Where("uuid in (?)", deleteFileFolderIDs).Delete(&model.FileFolder{}).Error; err != nil {
-			logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 删除文件夹失败: ", err)
-			return serializer.DBErr("", err)
-		}
-		// 删除当前批次文件夹内的文件
-		if err := t.Where("parent_folder_id in (?)", deleteFileFolderIDs).Delete(&model.File{}).Error; err != nil {
-			logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 删除文件失败: ", err)
-			return serializer.DBErr("", err)
-		}
-		// 下一轮处理子文件夹
-		deleteFileFolderIDs = deleteIDs
+	// 把文件夹连同整个子树作为一个条目移到回收站，记录父文件夹的路径以便父文件夹被删除后重建
+	var parent model.FileFolder
+	if err = t.Where("uuid = ?", fileFolder.ParentFolderID).First(&parent).Error; err != nil {
+		logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 查找父文件夹失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	folderPath, err := parent.NamePath(t)
+	if err != nil {
+		logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 获取文件夹路径失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if _, err = model.TrashFileFolder(t, fileFolder, folderPath, time.Now()); err != nil {
+		logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 移入回收站失败: ", err)
+		return serializer.DBErr("", err)
 	}
 
-	// 从父文件夹中减去删除文件夹的大小
-	if fileFolder.ParentFolderID != "root" {
-		var parentFileFolder model.FileFolder
-		if err := t.Where("uuid = ?", fileFolder.ParentFolderID).Find(&parentFileFolder).Error; err != nil {
-			logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 查找文件夹信息失败: ", err)
-			return serializer.DBErr("", err)
-		}
-		if err := parentFileFolder.SubFileFolderSize(t, fileFolder.Size); err != nil {
-			logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 更新父文件夹信息失败: ", err)
-			return serializer.DBErr("", err)
-		}
+	// 从父文件夹及其祖先中减去删除文件夹的大小
+	if err = model.AddFileFoldersSize(t, map[string]int64{fileFolder.ParentFolderID: -fileFolder.Size}); err != nil {
+		logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 更新父文件夹信息失败: ", err)
+		return serializer.DBErr("", err)
 	}
 
 	// 从用户存储空间中减去文件夹大小
 	var userStore model.FileStore
-	if err := t.Where("uuid = ? and owner_id = ?", fileFolder.FileStoreID, userId).Find(&userStore).Error; err != nil {
+	if err = t.Where("uuid = ? and owner_id = ?", fileFolder.FileStoreID, userId).Find(&userStore).Error; err != nil {
 		logger.Log().Error("[DeleteFileFolderService.DeleteFileFolder] 查找文件存储信息失败: ", err)
 		return serializer.DBErr("", err)
 	}
@@ -0,0 +1,103 @@
+package filefolder
+
+import (
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/file"
+	"go-cloud-disk/test"
+)
+
+// recycleBinOf 读取文件夹对应的未恢复回收站条目
+func recycleBinOf(t *testing.T, fileFolderId string) model.RecycleBin {
+	t.Helper()
+	var recycleBin model.RecycleBin
+	if err := model.DB.Where("file_id = ? and is_restored = 0", fileFolderId).First(&recycleBin).Error; err != nil {
+		t.Fatalf("读取回收站条目失败: %v", err)
+	}
+	return recycleBin
+}
+
+func TestTrashAndRestoreFileFolder(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	docs := test.CreateFolder(t, root, "docs")
+	sub := test.CreateFolder(t, docs, "sub")
+	leaf := test.CreateFolder(t, sub, "leaf")
+	test.CreateFile(t, docs, "a", 3)
+	test.CreateFile(t, sub, "b", 4)
+	test.CreateFile(t, leaf, "c", 5)
+
+	// 先删除子文件夹，再删除父文件夹，两者各自成为一个回收站条目
+	service := DeleteFileFolderService{}
+	for _, id := range []string{sub.Uuid, docs.Uuid} {
+		if res := service.DeleteFileFolder(user.Uuid, id); res.Code != serializer.CodeSuccess {
+			t.Fatalf("删除文件夹失败: %+v", res)
+		}
+	}
+	if res := service.DeleteFileFolder(user.Uuid, root.Uuid); res.Code != serializer.CodeParamsError {
+		t.Fatalf("删除主目录应失败: %+v", res)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != 0 {
+		t.Fatalf("存储空间已用%d，期望0", store.CurrentSize)
+	}
+	test.CheckSizes(t, user.Uuid)
+	subBin, docsBin := recycleBinOf(t, sub.Uuid), recycleBinOf(t, docs.Uuid)
+	if subBin.Size != 9 || docsBin.Size != 3 {
+		t.Fatalf("回收站条目大小%d、%d，期望9、3", subBin.Size, docsBin.Size)
+	}
+
+	// 原父文件夹在回收站中时按删除时的路径在主目录下重建，整个子树随之恢复。RestoreFile成功时Code为0
+	restore := file.FileRefCountService{}
+	if res := restore.RestoreFile(user.Uuid, subBin.ID); res.Code != 0 {
+		t.Fatalf("恢复文件夹失败: %+v", res)
+	}
+	restored := test.Folder(t, sub.Uuid)
+	rebuilt := test.Folder(t, restored.ParentFolderID)
+	if rebuilt.Uuid == docs.Uuid || rebuilt.FileFolderName != "docs" || rebuilt.ParentFolderID != root.Uuid || rebuilt.Size != 9 {
+		t.Fatalf("应在主目录下重建原父文件夹: %+v", rebuilt)
+	}
+	if folder := test.Folder(t, leaf.Uuid); folder.TreePath != rebuilt.TreePath+sub.Uuid+"/"+leaf.Uuid+"/" || folder.RecycleBinId != "" {
+		t.Fatalf("恢复的子树路径不符: %+v", folder)
+	}
+	if files := test.Files(t, leaf.Uuid); len(files) != 1 || files[0].Owner != user.Uuid {
+		t.Fatalf("子树中的文件应一起恢复: %+v", files)
+	}
+	test.CheckSizes(t, user.Uuid)
+
+	// 原文件夹恢复时与重建的同名文件夹冲突，自动重命名
+	if res := restore.RestoreFile(user.Uuid, docsBin.ID); res.Code != 0 {
+		t.Fatalf("恢复文件夹失败: %+v", res)
+	}
+	if folder := test.Folder(t, docs.Uuid); folder.FileFolderName == "docs" || folder.Size != 3 {
+		t.Fatalf("同名时恢复的文件夹应重命名: %+v", folder)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != 12 {
+		t.Fatalf("存储空间已用%d，期望12", store.CurrentSize)
+	}
+	test.CheckSizes(t, user.Uuid)
+}
+
+func TestRestoreFileFolderExceedStoreLimit(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 10)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	docs := test.CreateFolder(t, root, "docs")
+	test.CreateFile(t, docs, "a", 6)
+
+	if res := (&DeleteFileFolderService{}).DeleteFileFolder(user.Uuid, docs.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("删除文件夹失败: %+v", res)
+	}
+	test.CreateFile(t, root, "b", 6)
+
+	restore := file.FileRefCountService{}
+	if res := restore.RestoreFile(user.Uuid, recycleBinOf(t, docs.Uuid).ID); res.Code != serializer.CodeParamsError || res.Msg != "ExceedStoreLimit" {
+		t.Fatalf("超过容量时应返回ExceedStoreLimit: %+v", res)
+	}
+	if folder := test.Folder(t, docs.Uuid); folder.OwnerID != "" {
+		t.Fatalf("恢复失败时文件夹应留在回收站中: %+v", folder)
+	}
+	test.CheckSizes(t, user.Uuid)
+}
@@ -17,9 +17,13 @@ func (service *FileFolderGetAllFileService) GetAllFile(userId string, fileFolder
 		logger.Log().Error("[FileFolderGetAllFileService.GetAllFile] 获取文件夹失败: ", err)
 		return serializer.DBErr("", err)
 	}
+	if fileFolder.Uuid == "" {
+		return serializer.NotAuthErr("")
+	}
 
+	// 回收站中的文件所有者已清空，不在列表中显示
 	var files []model.File
-	if err := model.DB.Where("parent_folder_id = ?", fileFolderID).Find(&files).Error; err != nil {
+	if err := model.DB.Where("parent_folder_id = ? and owner = ?", fileFolderID, userId).Find(&files).Error; err != nil {
 		logger.Log().Error("[FileFolderGetAllFileService.GetAllFile] 获取文件列表失败: ", err)
 		return serializer.DBErr("", err)
 	}
@@ -1,6 +1,8 @@
 package filefolder
 
 import (
+	"errors"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
@@ -8,12 +10,13 @@ import (
 
 // FileFolderUpdateService 文件夹更新服务结构体
 type FileFolderUpdateService struct {
-	FileFolderId      string `json:"filefolder" form:"filefolder" binding:"required"` // 文件夹ID
-	NewFileFolderName string `json:"name" form:"name"`                                // 新文件夹名称
-	NewParentId       string `json:"parent" form:"parent" binding:"required"`         // 新父文件夹ID
+	FileFolderId      string `json:"filefolder" form:"filefolder" binding:"required"`                     // 文件夹ID
+	NewFileFolderName string `json:"name" form:"name"`                                                    // 新文件夹名称
+	NewParentId       string `json:"parent" form:"parent" binding:"required"`                             // 新父文件夹ID
+	Conflict          string `json:"conflict" form:"conflict" binding:"omitempty,oneof=fail rename skip"` // 同名冲突策略，默认fail，文件夹不支持覆盖
 }
 
-// UpdateFileFolderInfo 更新文件夹信息，包括文件夹名称和所属位置
+// UpdateFileFolderInfo 更新文件夹信息，包括文件夹名称和所属位置，不能移动主目录或把文件夹移动到自身的子文件夹中
 func (service *FileFolderUpdateService) UpdateFileFolderInfo(userid string) serializer.Response {
 	var filefolder model.FileFolder
 	var err error
@@ -22,6 +25,12 @@ func (service *FileFolderUpdateService) UpdateFileFolderInfo(userid string) seri
 		logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 查找文件夹信息失败: ", err)
 		return serializer.DBErr("", err)
 	}
+	if filefolder.Uuid == "" {
+		return serializer.NotAuthErr("")
+	}
+	if filefolder.ParentFolderID == "root" {
+		return serializer.ParamsErr("CannotMoveRoot", nil)
+	}
 
 	// 检查目标文件夹所有者
 	var targetFilefolder model.FileFolder
@@ -29,12 +38,8 @@ func (service *FileFolderUpdateService) UpdateFileFolderInfo(userid string) seri
 		logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 查找新父文件夹信息失败: ", err)
 		return serializer.DBErr("", err)
 	}
-
-	// 找到旧父文件夹
-	var parentFilefolder model.FileFolder
-	if err := model.DB.Where("uuid = ?", filefolder.ParentFolderID).Find(&parentFilefolder).Error; err != nil {
-		logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 查找旧父文件夹信息失败: ", err)
-		return serializer.DBErr("", err)
+	if targetFilefolder.Uuid == "" {
+		return serializer.NotAuthErr("")
 	}
 
 	// 获取新的文件夹信息
@@ -42,8 +47,13 @@ func (service *FileFolderUpdateService) UpdateFileFolderInfo(userid string) seri
 	if service.NewFileFolderName != "" {
 		newFileFolderName = service.NewFileFolderName
 	}
+	originFileFolder := filefolder
 	filefolder.FileFolderName = newFileFolderName
 	filefolder.ParentFolderID = service.NewParentId
+	conflict := service.Conflict
+	if conflict == "" {
+		conflict = model.ConflictFail
+	}
 
 	// 更新文件夹信息到数据库
 	t := model.DB.Begin()
@@ -55,25 +65,40 @@ func (service *FileFolderUpdateService) UpdateFileFolderInfo(userid string) seri
 		}
 	}()
 
-	if err := t.Save(&filefolder).Error; err != nil {
+	// 处理目标文件夹中的同名文件夹或文件
+	existing, err := model.ResolveFileFolderName(t, &filefolder, conflict)
+	if errors.Is(err, model.ErrNameConflict) {
+		return serializer.ParamsErr("NameConflict", nil)
+	}
+	if err != nil {
+		logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 检查同名文件夹失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if existing != nil {
+		return serializer.Success(serializer.BuildFileFolder(originFileFolder))
+	}
+
+	// 移动文件夹并更新子树的物化路径，目标为自身或子文件夹时拒绝，避免形成环
+	err = model.MoveFileFolder(t, filefolder.Uuid, filefolder.ParentFolderID, filefolder.FileFolderName)
+	switch {
+	case errors.Is(err, model.ErrFileFolderCycle):
+		return serializer.ParamsErr("CannotMoveIntoItself", nil)
+	case errors.Is(err, model.ErrFileFolderTooDeep):
+		return serializer.ParamsErr("FileFolderTooDeep", nil)
+	case err != nil:
 		logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 更新文件夹信息失败: ", err)
 		return serializer.DBErr("", err)
 	}
 
 	// 更改文件夹大小
-	// 移动一个文件夹，就像搬箱子 → 旧箱子里少一份体积，新箱子里多一份体积
-	if targetFilefolder.Uuid != parentFilefolder.Uuid {
-		err = parentFilefolder.SubFileFolderSize(t, filefolder.Size)
-		if err != nil {
-			logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 更新旧文件夹信息失败: ", err)
-			return serializer.DBErr("", err)
-		}
-		targetFilefolder.AddFileFolderSize(t, filefolder.Size)
-		if err != nil {
-			logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 更新新文件夹信息失败: ", err)
-			return serializer.DBErr("", err)
-		}
+	// 移动一个文件夹，就像搬箱子 → 旧箱子里少一份体积，新箱子里多一份体积，共同祖先的大小不变
+	if err = model.AddFileFoldersSize(t, map[string]int64{
+		originFileFolder.ParentFolderID: -filefolder.Size,
+		filefolder.ParentFolderID:       filefolder.Size,
+	}); err != nil {
+		logger.Log().Error("[FileFolderUpdateService.UpdateFileFolderInfo] 更新文件夹大小失败: ", err)
+		return serializer.DBErr("", err)
 	}
 
-	return serializer.Success(nil)
+	return serializer.Success(serializer.BuildFileFolder(filefolder))
 }
@@ -0,0 +1,81 @@
+package filefolder
+
+import (
+	"strings"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+func TestMoveFileFolder(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	docs := test.CreateFolder(t, root, "docs")
+	sub := test.CreateFolder(t, docs, "sub")
+	leaf := test.CreateFolder(t, sub, "leaf")
+	backup := test.CreateFolder(t, root, "backup")
+	test.CreateFile(t, leaf, "a", 5)
+
+	// 不能移动到自身或子孙文件夹中
+	for _, target := range []string{docs.Uuid, leaf.Uuid} {
+		service := FileFolderUpdateService{FileFolderId: docs.Uuid, NewParentId: target}
+		if res := service.UpdateFileFolderInfo(user.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "CannotMoveIntoItself" {
+			t.Fatalf("移动到自身或子文件夹中应返回CannotMoveIntoItself: %+v", res)
+		}
+	}
+	service := FileFolderUpdateService{FileFolderId: root.Uuid, NewParentId: backup.Uuid}
+	if res := service.UpdateFileFolderInfo(user.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "CannotMoveRoot" {
+		t.Fatalf("移动主目录应返回CannotMoveRoot: %+v", res)
+	}
+
+	// 移动后整个子树的物化路径随之更新，原父文件夹和新父文件夹的大小随之变化
+	service = FileFolderUpdateService{FileFolderId: sub.Uuid, NewParentId: backup.Uuid}
+	if res := service.UpdateFileFolderInfo(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("移动文件夹失败: %+v", res)
+	}
+	if moved := test.Folder(t, leaf.Uuid); moved.TreePath != backup.TreePath+sub.Uuid+"/"+leaf.Uuid+"/" {
+		t.Fatalf("子文件夹的物化路径%s未更新", moved.TreePath)
+	}
+	if folder := test.Folder(t, docs.Uuid); folder.Size != 0 {
+		t.Fatalf("原父文件夹大小%d，期望0", folder.Size)
+	}
+	if folder := test.Folder(t, backup.Uuid); folder.Size != 5 {
+		t.Fatalf("新父文件夹大小%d，期望5", folder.Size)
+	}
+	test.CheckSizes(t, user.Uuid)
+
+	// 移动后原来的子孙关系不再限制移动
+	service = FileFolderUpdateService{FileFolderId: docs.Uuid, NewParentId: leaf.Uuid}
+	if res := service.UpdateFileFolderInfo(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("移动文件夹失败: %+v", res)
+	}
+	if moved := test.Folder(t, docs.Uuid); !strings.HasPrefix(moved.TreePath, test.Folder(t, leaf.Uuid).TreePath) {
+		t.Fatalf("移动后的物化路径%s不在新父文件夹下", moved.TreePath)
+	}
+	test.CheckSizes(t, user.Uuid)
+}
+
+func TestMoveFileFolderTooDeep(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+
+	// 主目录为第1层，deepest位于最大层级
+	deepest := root
+	for i := 1; i < model.MaxFileFolderDepth; i++ {
+		deepest = test.CreateFolder(t, deepest, "d")
+	}
+	docs := test.CreateFolder(t, root, "docs")
+	test.CreateFolder(t, docs, "sub")
+
+	service := FileFolderUpdateService{FileFolderId: docs.Uuid, NewParentId: deepest.Uuid}
+	if res := service.UpdateFileFolderInfo(user.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "FileFolderTooDeep" {
+		t.Fatalf("移动后层级过深应返回FileFolderTooDeep: %+v", res)
+	}
+	if folder := test.Folder(t, docs.Uuid); folder.ParentFolderID != root.Uuid {
+		t.Fatalf("移动失败时文件夹不应移动: %+v", folder)
+	}
+}
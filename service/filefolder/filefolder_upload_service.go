@@ -0,0 +1,287 @@
+package filefolder
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/utils"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxFolderUploadFileSize 文件夹上传中单个文件的大小限制，与普通上传一致，更大的文件应使用分片上传
+const maxFolderUploadFileSize = 1024 * 1024 * 100
+
+// errExceedStoreLimit 超过用户存储空间限制
+var errExceedStoreLimit = errors.New("超过用户存储空间限制")
+
+// FileFolderUploadService 文件夹上传服务结构体
+type FileFolderUploadService struct {
+	Paths []string `form:"paths" json:"paths" binding:"required"` // 每个文件相对于目标文件夹的路径，与files一一对应
+}
+
+// uploadedFolderFile 已上传到云端、等待入库的文件
+type uploadedFolderFile struct {
+	dir  string // 相对目录
+	file model.File
+}
+
+// UploadFileFolder 上传整个目录树，按相对路径在目标文件夹下创建缺失的子文件夹，
+// 并将每个文件放入对应的子文件夹
+func (service *FileFolderUploadService) UploadFileFolder(userId string, folderId string, files []*multipart.FileHeader) serializer.Response {
+	if len(files) == 0 || len(files) != len(service.Paths) {
+		return serializer.ParamsErr("文件与路径数量不一致", nil)
+	}
+
+	// 检查目标文件夹归属
+	var targetFolder model.FileFolder
+	if err := model.DB.Where("uuid = ?", folderId).Find(&targetFolder).Error; err != nil {
+		logger.Log().Error("[FileFolderUploadService.UploadFileFolder] 获取文件夹信息失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if targetFolder.OwnerID != userId {
+		return serializer.NotAuthErr("")
+	}
+
+	// 校验相对路径和文件大小
+	dirs := make([]string, len(files))
+	names := make([]string, len(files))
+	var totalSize int64
+	for i, file := range files {
+		dir, name, err := splitRelativePath(service.Paths[i])
+		if err != nil {
+			return serializer.ParamsErr("InvalidPath", err)
+		}
+		if file.Size > maxFolderUploadFileSize {
+			return serializer.ParamsErr("文件大小过大", fmt.Errorf("%s", service.Paths[i]))
+		}
+		dirs[i], names[i] = dir, name
+		totalSize += file.Size
+	}
+
+	// 预先检查容量，避免上传后才发现容量不足
+	var userStore model.FileStore
+	if err := model.DB.Where("owner_id = ?", userId).First(&userStore).Error; err != nil {
+		logger.Log().Error("[FileFolderUploadService.UploadFileFolder] 获取用户存储信息失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	if err := checkStoreCapacity(model.DB, userStore, totalSize); errors.Is(err, errExceedStoreLimit) {
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	} else if err != nil {
+		logger.Log().Error("[FileFolderUploadService.UploadFileFolder] 检查用户容量失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	// 上传文件到云端
+	uploaded := make([]uploadedFolderFile, 0, len(files))
+	for i, file := range files {
+		fileModel, err := uploadFolderFile(userId, file, names[i])
+		if err != nil {
+			logger.Log().Error("[FileFolderUploadService.UploadFileFolder] 上传文件到云端失败: ", err)
+			releaseUploadedObjects(uploaded)
+			return serializer.InternalErr("", err)
+		}
+		uploaded = append(uploaded, uploadedFolderFile{dir: dirs[i], file: fileModel})
+	}
+
+	// 创建文件夹和文件记录
+	var createdFolders []model.FileFolder
+	var createdFiles []model.File
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		if err := t.Clauses(clause.Locking{Strength: "UPDATE"}).Where("owner_id = ?", userId).First(&userStore).Error; err != nil {
+			return err
+		}
+		if err := checkStoreCapacity(t, userStore, totalSize); err != nil {
+			return err
+		}
+
+		folderIds := map[string]string{".": targetFolder.Uuid}
+		sizeDeltas := make(map[string]int64)
+		var storeDelta int64
+		for _, item := range uploaded {
+			parentId, err := ensureFolderPath(t, targetFolder, item.dir, folderIds, &createdFolders)
+			if err != nil {
+				return err
+			}
+			// 已有同名文件时旧内容转为历史版本
+			item.file.ParentFolderId = parentId
+			folderDelta, fileStoreDelta, err := model.SaveFileWithVersion(t, &item.file)
+			if err != nil {
+				return err
+			}
+			createdFiles = append(createdFiles, item.file)
+			sizeDeltas[parentId] += folderDelta
+			storeDelta += fileStoreDelta
+		}
+
+		// 每个受影响的文件夹只更新一次大小
+		if err := model.AddFileFoldersSize(t, sizeDeltas); err != nil {
+			return err
+		}
+		userStore.CurrentSize += storeDelta
+		return t.Save(&userStore).Error
+	})
+	if err != nil {
+		releaseUploadedObjects(uploaded)
+	}
+	if errors.Is(err, errExceedStoreLimit) {
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
+	}
+	if errors.Is(err, model.ErrFileFolderTooDeep) {
+		return serializer.ParamsErr("FileFolderTooDeep", nil)
+	}
+	if err != nil {
+		logger.Log().Error("[FileFolderUploadService.UploadFileFolder] 创建文件夹和文件记录失败: ", err)
+		return serializer.DBErr("", err)
+	}
+
+	for i := range createdFiles {
+		createdFiles[i].SaveFileUploadInfoToRedis()
+	}
+	return serializer.Success(map[string]interface{}{
+		"filefolders": serializer.BuildFileFolders(createdFolders),
+		"files":       serializer.BuildFiles(createdFiles),
+	})
+}
+
+// releaseUploadedObjects 入库失败时把已上传的云端对象登记为待清理，仍被其他记录引用的对象不会登记
+func releaseUploadedObjects(uploaded []uploadedFolderFile) {
+	objects := make([]model.StoredObject, 0, len(uploaded))
+	for _, item := range uploaded {
+		objects = append(objects, item.file.Object())
+	}
+	if err := model.ReleaseObjects(model.DB, objects); err != nil {
+		logger.Log().Error("[releaseUploadedObjects] 登记待清理的云端对象失败: ", err)
+	}
+}
+
+// checkStoreCapacity 检查添加指定大小后是否超过用户存储空间限制，进行中的分片上传预留的空间不可用
+func checkStoreCapacity(t *gorm.DB, userStore model.FileStore, size int64) error {
+	reserved, err := model.GetReservedSize(t, userStore.OwnerID)
+	if err != nil {
+		return err
+	}
+	if userStore.CurrentSize+reserved+size > userStore.MaxSize {
+		return errExceedStoreLimit
+	}
+	return nil
+}
+
+// splitRelativePath 校验并拆分客户端提交的相对路径，返回相对目录和文件名
+func splitRelativePath(relPath string) (string, string, error) {
+	relPath = strings.ReplaceAll(relPath, "\\", "/")
+	if relPath == "" || strings.HasPrefix(relPath, "/") {
+		return "", "", fmt.Errorf("非法的相对路径: %s", relPath)
+	}
+	for _, segment := range strings.Split(relPath, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", "", fmt.Errorf("非法的相对路径: %s", relPath)
+		}
+	}
+	return path.Dir(relPath), path.Base(relPath), nil
+}
+
+// ensureFolderPath 按相对目录逐级查找或创建子文件夹（类似mkdir -p），返回最深一级文件夹ID
+func ensureFolderPath(t *gorm.DB, root model.FileFolder, dir string, folderIds map[string]string, created *[]model.FileFolder) (string, error) {
+	if id, ok := folderIds[dir]; ok {
+		return id, nil
+	}
+
+	parentId, err := ensureFolderPath(t, root, path.Dir(dir), folderIds, created)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(dir)
+
+	var folder model.FileFolder
+	if err := t.Where("parent_folder_id = ? and file_folder_name = ? and owner_id = ?", parentId, name, root.OwnerID).
+		Find(&folder).Error; err != nil {
+		return "", err
+	}
+	if folder.Uuid == "" {
+		folder = model.FileFolder{
+			FileFolderName: name,
+			ParentFolderID: parentId,
+			FileStoreID:    root.FileStoreID,
+			OwnerID:        root.OwnerID,
+		}
+		if err := t.Create(&folder).Error; err != nil {
+			return "", err
+		}
+		*created = append(*created, folder)
+	}
+
+	folderIds[dir] = folder.Uuid
+	return folder.Uuid, nil
+}
+
+// uploadFolderFile 将单个文件保存到本地临时目录后上传到云端，返回待入库的文件模型
+func uploadFolderFile(userId string, file *multipart.FileHeader, name string) (model.File, error) {
+	// 临时文件保留原扩展名，云端对象名和MD5都依赖扩展名
+	uploadDay := time.Now().Format("2006-01-02")
+	dst := utils.FastBuildString("./user/", uploadDay, "/", userId, "/", uuid.NewString(), "_", name)
+	if err := saveUploadedFile(file, dst); err != nil {
+		return model.File{}, err
+	}
+	defer os.Remove(dst)
+
+	md5String, err := utils.GetFileMD5(dst)
+	if err != nil {
+		return model.File{}, err
+	}
+	hash, err := utils.GetFileSHA256(dst)
+	if err != nil {
+		return model.File{}, err
+	}
+
+	// 如果文件最近已经上传过，不重复上传到云端
+	filePath := model.GetFileInfoFromRedis(md5String)
+	if filePath == "" {
+		if err := disk.BaseCloudDisk.UploadSimpleFile(dst, userId, md5String, file.Size); err != nil {
+			return model.File{}, err
+		}
+		filePath = userId
+	}
+
+	filename, extend := utils.SplitFilename(name)
+	return model.File{
+		Owner:       userId,
+		FileName:    filename,
+		FilePostfix: extend,
+		FileUuid:    md5String,
+		FilePath:    filePath,
+		Size:        file.Size,
+		Hash:        hash,
+	}, nil
+}
+
+// saveUploadedFile 将上传的文件保存到本地路径
+func saveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := utils.EnsureDir(path.Dir(dst)); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = out.ReadFrom(src)
+	return err
+}
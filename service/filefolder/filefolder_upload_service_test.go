@@ -0,0 +1,80 @@
+package filefolder
+
+import (
+	"mime/multipart"
+	"os"
+	"strings"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+// useTempWorkDir 切换到临时工作目录，上传的文件会先保存到工作目录下
+func useTempWorkDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestUploadFileFolder(t *testing.T) {
+	mem := test.Setup(t)
+	useTempWorkDir(t)
+	user := test.CreateUser(t, 1024)
+
+	service := FileFolderUploadService{Paths: []string{"docs/a.txt", "docs/sub/b.txt"}}
+	files := []*multipart.FileHeader{test.FileHeader(t, "a.txt", []byte("aaa")), test.FileHeader(t, "b.txt", []byte("bbbb"))}
+	res := service.UploadFileFolder(user.Uuid, user.UserMainFileFolderID, files)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("上传文件夹失败: %+v", res)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != 7 {
+		t.Fatalf("存储空间已用%d，期望7", store.CurrentSize)
+	}
+	if count := mem.CallCount("UploadSimpleFile"); count != 2 {
+		t.Fatalf("上传到云端%d次，期望2次", count)
+	}
+}
+
+func TestUploadFileFolderFailure(t *testing.T) {
+	mem := test.Setup(t)
+	useTempWorkDir(t)
+	user := test.CreateUser(t, 1024)
+
+	// 第二个文件的目录层级过深，入库失败时已上传的对象应登记为待清理
+	deep := strings.Repeat("d/", model.MaxFileFolderDepth) + "b.txt"
+	service := FileFolderUploadService{Paths: []string{"a.txt", deep}}
+	files := []*multipart.FileHeader{test.FileHeader(t, "a.txt", []byte("aaa")), test.FileHeader(t, "b.txt", []byte("bbbb"))}
+	res := service.UploadFileFolder(user.Uuid, user.UserMainFileFolderID, files)
+	if res.Code != serializer.CodeParamsError || res.Msg != "FileFolderTooDeep" {
+		t.Fatalf("层级过深时应返回FileFolderTooDeep: %+v", res)
+	}
+	if files := test.Files(t, user.UserMainFileFolderID); len(files) != 0 {
+		t.Fatalf("入库失败时不应创建文件记录: %+v", files)
+	}
+
+	var cleanups []model.ObjectCleanup
+	if err := model.DB.Find(&cleanups).Error; err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	for _, cleanup := range cleanups {
+		keys[cleanup.ObjectKey] = cleanup.Status == model.ObjectCleanupPending
+	}
+	objects := mem.Keys()
+	if len(objects) != 2 || len(keys) != 2 {
+		t.Fatalf("云端对象%v，待清理对象%v，期望都为2个", objects, keys)
+	}
+	for _, key := range objects {
+		if !keys[key] {
+			t.Fatalf("云端对象%s没有登记为待清理", key)
+		}
+	}
+}
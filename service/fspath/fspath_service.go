@@ -0,0 +1,229 @@
+package fspath
+
+import (
+	"errors"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/file"
+	"go-cloud-disk/service/filefolder"
+	"go-cloud-disk/utils"
+	"go-cloud-disk/utils/logger"
+	"gorm.io/gorm"
+)
+
+// FilePathService 按路径访问文件和文件夹的服务
+type FilePathService struct {
+	Path string `form:"path" json:"path" binding:"required"` // 以主目录开头的路径，例如 /main/reports/2026/q3.xlsx
+}
+
+// FilePathMoveService 按路径移动或重命名文件和文件夹的服务
+type FilePathMoveService struct {
+	From     string `form:"from" json:"from" binding:"required"`                                           // 源路径
+	To       string `form:"to" json:"to" binding:"required"`                                               // 目标路径，为已存在的文件夹时移动到该文件夹内
+	Conflict string `form:"conflict" json:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认fail，overwrite仅适用于文件
+}
+
+// pathStatResponse 路径信息响应结构体
+type pathStatResponse struct {
+	Type       string                 `json:"type"` // file 或 file_folder
+	Path       string                 `json:"path"`
+	File       *serializer.File       `json:"file,omitempty"`
+	FileFolder *serializer.FileFolder `json:"filefolder,omitempty"`
+}
+
+// pathErr 将路径解析错误转换为响应
+func pathErr(caller string, err error) serializer.Response {
+	if errors.Is(err, errPathNotFound) {
+		return serializer.Err(serializer.CodeError, "PathNotFound", nil)
+	}
+	logger.Log().Error(caller+" 解析路径失败: ", err)
+	return serializer.DBErr("", err)
+}
+
+// loadEntry 从主目录开始逐级解析路径
+func loadEntry(userId string, p string) (entry, error) {
+	return resolve(model.DB, userId, splitPath(p))
+}
+
+// Stat 获取路径指向的文件或文件夹信息
+func (service *FilePathService) Stat(userId string) serializer.Response {
+	e, err := loadEntry(userId, service.Path)
+	if err != nil {
+		return pathErr("[FilePathService.Stat]", err)
+	}
+	folderPath, err := e.folder.NamePath(model.DB)
+	if err != nil {
+		return pathErr("[FilePathService.Stat]", err)
+	}
+
+	res := pathStatResponse{Path: folderPath}
+	if e.file != nil {
+		f := serializer.BuildFile(*e.file)
+		res.Type = "file"
+		res.Path += "/" + e.file.DisplayName()
+		res.File = &f
+	} else {
+		fileFolder := serializer.BuildFileFolder(e.folder)
+		res.Type = "file_folder"
+		res.FileFolder = &fileFolder
+	}
+	return serializer.Success(res)
+}
+
+// List 列出路径指向的文件夹中的子文件夹和文件
+func (service *FilePathService) List(userId string) serializer.Response {
+	e, err := loadEntry(userId, service.Path)
+	if err != nil {
+		return pathErr("[FilePathService.List]", err)
+	}
+	if e.file != nil {
+		return serializer.ParamsErr("NotAFolder", nil)
+	}
+
+	var fileFolders []model.FileFolder
+	if err := model.DB.Where("parent_folder_id = ? and owner_id = ?", e.folder.Uuid, userId).
+		Order("file_folder_name").Find(&fileFolders).Error; err != nil {
+		logger.Log().Error("[FilePathService.List] 获取文件夹列表失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	var files []model.File
+	if err := model.DB.Where("parent_folder_id = ? and owner = ?", e.folder.Uuid, userId).Find(&files).Error; err != nil {
+		logger.Log().Error("[FilePathService.List] 获取文件列表失败: ", err)
+		return serializer.DBErr("", err)
+	}
+	return serializer.Success(map[string]interface{}{
+		"filefolders": serializer.BuildFileFolders(fileFolders),
+		"files":       serializer.BuildFiles(files),
+	})
+}
+
+// Mkdir 逐级创建路径中不存在的文件夹（类似mkdir -p），返回最深一级文件夹
+func (service *FilePathService) Mkdir(userId string) serializer.Response {
+	names := splitPath(service.Path)
+	var fileFolder model.FileFolder
+	err := model.DB.Transaction(func(t *gorm.DB) error {
+		walked, depth, err := walkFolders(t, userId, names)
+		if err != nil {
+			return err
+		}
+		fileFolder = walked
+
+		for _, name := range names[depth:] {
+			child := model.FileFolder{
+				FileFolderName: name,
+				ParentFolderID: fileFolder.Uuid,
+				FileStoreID:    fileFolder.FileStoreID,
+				OwnerID:        userId,
+			}
+			// 同一文件夹中已有同名文件时无法创建文件夹
+			if _, err := model.ResolveFileFolderName(t, &child, model.ConflictFail); err != nil {
+				return err
+			}
+			if err := t.Create(&child).Error; err != nil {
+				return err
+			}
+			fileFolder = child
+		}
+		return nil
+	})
+	if errors.Is(err, model.ErrNameConflict) {
+		return serializer.ParamsErr("NameConflict", nil)
+	}
+	if errors.Is(err, model.ErrFileFolderTooDeep) {
+		return serializer.ParamsErr("FileFolderTooDeep", nil)
+	}
+	if err != nil {
+		return pathErr("[FilePathService.Mkdir]", err)
+	}
+	return serializer.Success(serializer.BuildFileFolder(fileFolder))
+}
+
+// Delete 删除路径指向的文件或文件夹
+func (service *FilePathService) Delete(userId string) serializer.Response {
+	e, err := loadEntry(userId, service.Path)
+	if err != nil {
+		return pathErr("[FilePathService.Delete]", err)
+	}
+
+	if e.file != nil {
+		var deleteService file.FileDeleteService
+		return deleteService.FileDelete(userId, e.file.Uuid)
+	}
+	var deleteService filefolder.DeleteFileFolderService
+	return deleteService.DeleteFileFolder(userId, e.folder.Uuid)
+}
+
+// Move 移动或重命名路径指向的文件或文件夹
+// 目标路径为已存在的文件夹时移动到该文件夹内并保留原名，否则移动到目标路径的上级文件夹并使用目标路径的最后一级作为新名称，
+// 目标位置的同名冲突按Conflict处理
+func (service *FilePathMoveService) Move(userId string) serializer.Response {
+	src, err := loadEntry(userId, service.From)
+	if err != nil {
+		return pathErr("[FilePathMoveService.Move]", err)
+	}
+
+	// 确定目标文件夹和新名称
+	var parent model.FileFolder
+	var name string
+	toNames := splitPath(service.To)
+	dst, err := resolve(model.DB, userId, toNames)
+	switch {
+	case err == nil && dst.file == nil:
+		parent = dst.folder
+		if src.file != nil {
+			name = src.file.DisplayName()
+		} else {
+			name = src.folder.FileFolderName
+		}
+	case (err == nil || errors.Is(err, errPathNotFound)) && len(toNames) >= 2:
+		if parent, err = resolveFolder(model.DB, userId, toNames[:len(toNames)-1]); err != nil {
+			return pathErr("[FilePathMoveService.Move]", err)
+		}
+		name = toNames[len(toNames)-1]
+	default:
+		return pathErr("[FilePathMoveService.Move]", err)
+	}
+
+	if src.file != nil {
+		return moveFile(userId, *src.file, parent, name, service.Conflict)
+	}
+	return moveFileFolder(userId, src.folder, parent, name, service.Conflict)
+}
+
+// moveFile 移动文件到目标文件夹，文件扩展名决定云端对象名，不允许通过重命名修改
+func moveFile(userId string, userFile model.File, parent model.FileFolder, name string, conflict string) serializer.Response {
+	filename, extend := utils.SplitFilename(name)
+	if extend != userFile.FilePostfix {
+		return serializer.ParamsErr("CannotChangeFileType", nil)
+	}
+
+	updateService := file.FileUpdateService{
+		FileId:      userFile.Uuid,
+		FileName:    filename,
+		NewParentId: parent.Uuid,
+		Conflict:    conflict,
+	}
+	return updateService.UpdateFileInfo(userId)
+}
+
+// moveFileFolder 移动文件夹到目标文件夹，不能移动主目录或移动到自身的子文件夹中，按物化路径判断子孙关系
+func moveFileFolder(userId string, fileFolder model.FileFolder, parent model.FileFolder, name string, conflict string) serializer.Response {
+	if fileFolder.ParentFolderID == "root" {
+		return serializer.ParamsErr("CannotMoveRoot", nil)
+	}
+	if parent.IsDescendantOf(fileFolder) {
+		return serializer.ParamsErr("CannotMoveIntoItself", nil)
+	}
+	if conflict == model.ConflictOverwrite {
+		return serializer.ParamsErr("CannotOverwriteFileFolder", nil)
+	}
+
+	updateService := filefolder.FileFolderUpdateService{
+		FileFolderId:      fileFolder.Uuid,
+		NewFileFolderName: name,
+		NewParentId:       parent.Uuid,
+		Conflict:          conflict,
+	}
+	return updateService.UpdateFileFolderInfo(userId)
+}
@@ -0,0 +1,99 @@
+package fspath
+
+import (
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+func TestResolvePath(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	reports := test.CreateFolder(t, root, "reports")
+	year := test.CreateFolder(t, reports, "2026")
+	test.CreateFile(t, year, "q3", 3)
+	// 其他用户的同名路径不影响解析
+	other := test.CreateUser(t, 1024)
+	test.CreateFolder(t, test.Folder(t, other.UserMainFileFolderID), "reports")
+
+	base := "/" + root.FileFolderName
+	res := (&FilePathService{Path: base + "/reports/2026/q3.txt"}).Stat(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("解析文件路径失败: %+v", res)
+	}
+	if stat := res.Data.(pathStatResponse); stat.Type != "file" || stat.Path != base+"/reports/2026/q3.txt" {
+		t.Fatalf("文件路径信息不符: %+v", stat)
+	}
+	res = (&FilePathService{Path: base + "//reports/./2026/"}).Stat(user.Uuid)
+	if res.Code != serializer.CodeSuccess || res.Data.(pathStatResponse).FileFolder.Uuid != year.Uuid {
+		t.Fatalf("解析文件夹路径失败: %+v", res)
+	}
+	for _, p := range []string{"/other", base + "/reports/2025", base + "/reports/2026/q3.txt/more", base + "/reports/q3.txt"} {
+		if res := (&FilePathService{Path: p}).Stat(user.Uuid); res.Msg != "PathNotFound" {
+			t.Fatalf("路径%s不存在时应返回PathNotFound: %+v", p, res)
+		}
+	}
+
+	// 回收站中的文件夹不能按路径找到
+	if res := (&FilePathService{Path: base + "/reports/2026"}).Delete(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("按路径删除失败: %+v", res)
+	}
+	if res := (&FilePathService{Path: base + "/reports/2026"}).Stat(user.Uuid); res.Msg != "PathNotFound" {
+		t.Fatalf("删除后的路径应返回PathNotFound: %+v", res)
+	}
+	test.CheckSizes(t, user.Uuid)
+}
+
+func TestMkdirAndMovePath(t *testing.T) {
+	test.Setup(t)
+	user := test.CreateUser(t, 1024)
+	root := test.Folder(t, user.UserMainFileFolderID)
+	base := "/" + root.FileFolderName
+
+	// 逐级创建不存在的文件夹，已存在的部分复用
+	res := (&FilePathService{Path: base + "/a/b/c"}).Mkdir(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("创建路径失败: %+v", res)
+	}
+	c := test.Folder(t, res.Data.(serializer.FileFolder).Uuid)
+	if res := (&FilePathService{Path: base + "/a/b/c/d"}).Mkdir(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("创建路径失败: %+v", res)
+	}
+	var count int64
+	if err := model.DB.Model(&model.FileFolder{}).Where("owner_id = ?", user.Uuid).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Fatalf("文件夹数%d，期望5", count)
+	}
+
+	res = (&FilePathService{Path: base + "/a"}).List(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("列出文件夹失败: %+v", res)
+	}
+	if list := res.Data.(map[string]interface{})["filefolders"].([]serializer.FileFolder); len(list) != 1 || list[0].FileFolderName != "b" {
+		t.Fatalf("子文件夹列表不符: %+v", list)
+	}
+
+	// 不能移动到自身的子文件夹中，也不能移动主目录
+	if res := (&FilePathMoveService{From: base + "/a", To: base + "/a/b/c"}).Move(user.Uuid); res.Msg != "CannotMoveIntoItself" {
+		t.Fatalf("移动到子文件夹中应返回CannotMoveIntoItself: %+v", res)
+	}
+	if res := (&FilePathMoveService{From: base, To: base + "/a"}).Move(user.Uuid); res.Msg != "CannotMoveRoot" {
+		t.Fatalf("移动主目录应返回CannotMoveRoot: %+v", res)
+	}
+
+	// 目标路径不存在时移动到上级文件夹并改名
+	if res := (&FilePathMoveService{From: base + "/a/b/c", To: base + "/moved"}).Move(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("移动文件夹失败: %+v", res)
+	}
+	if folder := test.Folder(t, c.Uuid); folder.FileFolderName != "moved" || folder.ParentFolderID != root.Uuid {
+		t.Fatalf("移动后的文件夹不符: %+v", folder)
+	}
+	if res := (&FilePathService{Path: base + "/moved/d"}).Stat(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("移动后子文件夹应随之移动: %+v", res)
+	}
+}
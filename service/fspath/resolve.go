@@ -0,0 +1,118 @@
+package fspath
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/utils"
+	"gorm.io/gorm"
+)
+
+var errPathNotFound = errors.New("path not found")
+
+// entry 路径解析结果，file为空时路径指向文件夹
+type entry struct {
+	folder model.FileFolder // 路径指向的文件夹，或文件所在的文件夹
+	file   *model.File      // 路径指向的文件
+}
+
+// splitPath 清理路径并拆分为各级名称，例如 /main/reports/q3.xlsx -> [main reports q3.xlsx]
+func splitPath(p string) []string {
+	p = strings.TrimPrefix(path.Clean("/"+strings.TrimSpace(p)), "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// walkFolders 从用户主目录开始逐级按父文件夹和名称查找文件夹，每级一次索引查询，
+// 返回最深一级找到的文件夹和匹配的层数。第一级不是主目录时返回errPathNotFound
+func walkFolders(t *gorm.DB, userId string, names []string) (model.FileFolder, int, error) {
+	if len(names) == 0 {
+		return model.FileFolder{}, 0, errPathNotFound
+	}
+	var fileFolder model.FileFolder
+	if err := t.Where("uuid = (?) and owner_id = ?",
+		t.Model(&model.User{}).Select("user_main_file_folder_id").Where("uuid = ?", userId), userId).
+		Limit(1).Find(&fileFolder).Error; err != nil {
+		return model.FileFolder{}, 0, err
+	}
+	if fileFolder.Uuid == "" || names[0] != fileFolder.FileFolderName {
+		return model.FileFolder{}, 0, errPathNotFound
+	}
+
+	for i, name := range names[1:] {
+		child, err := findFileFolder(t, fileFolder, name)
+		if err != nil {
+			return model.FileFolder{}, 0, err
+		}
+		if child == nil {
+			return fileFolder, i + 1, nil
+		}
+		fileFolder = *child
+	}
+	return fileFolder, len(names), nil
+}
+
+// resolveFolder 解析路径指向的文件夹
+func resolveFolder(t *gorm.DB, userId string, names []string) (model.FileFolder, error) {
+	fileFolder, depth, err := walkFolders(t, userId, names)
+	if err != nil {
+		return model.FileFolder{}, err
+	}
+	if depth != len(names) {
+		return model.FileFolder{}, errPathNotFound
+	}
+	return fileFolder, nil
+}
+
+// resolve 解析路径指向的文件夹或文件，最后一级不是文件夹时在上级文件夹中按文件名查找
+func resolve(t *gorm.DB, userId string, names []string) (entry, error) {
+	fileFolder, depth, err := walkFolders(t, userId, names)
+	if err != nil {
+		return entry{}, err
+	}
+	if depth == len(names) {
+		return entry{folder: fileFolder}, nil
+	}
+	if depth != len(names)-1 {
+		return entry{}, errPathNotFound
+	}
+	file, err := findFile(t, fileFolder, names[len(names)-1])
+	if err != nil {
+		return entry{}, err
+	}
+	if file == nil {
+		return entry{}, errPathNotFound
+	}
+	return entry{folder: fileFolder, file: file}, nil
+}
+
+// findFileFolder 按名称查找文件夹的子文件夹，不存在时返回nil，回收站中的文件夹没有所有者，不会被找到
+func findFileFolder(t *gorm.DB, parent model.FileFolder, name string) (*model.FileFolder, error) {
+	var fileFolder model.FileFolder
+	if err := t.Where("parent_folder_id = ? and file_folder_name = ? and owner_id = ?",
+		parent.Uuid, name, parent.OwnerID).Limit(1).Find(&fileFolder).Error; err != nil {
+		return nil, err
+	}
+	if fileFolder.Uuid == "" {
+		return nil, nil
+	}
+	return &fileFolder, nil
+}
+
+// findFile 按文件名查找文件夹中的文件，不存在时返回nil
+func findFile(t *gorm.DB, parent model.FileFolder, name string) (*model.File, error) {
+	filename, extend := utils.SplitFilename(name)
+	var file model.File
+	if err := t.Where("parent_folder_id = ? and file_name = ? and file_postfix = ? and owner = ?",
+		parent.Uuid, filename, extend, parent.OwnerID).Limit(1).Find(&file).Error; err != nil {
+		return nil, err
+	}
+	if file.Uuid == "" {
+		return nil, nil
+	}
+	return &file, nil
+}
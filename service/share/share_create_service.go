@@ -3,7 +3,6 @@ package share
 import (
 	"time"
 
-	"go-cloud-disk/disk"
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils"
@@ -30,6 +29,10 @@ func (service *ShareCreateService) CreateShare(userId string) serializer.Respons
 		logger.Log().Error("[ShareCreateService.CreateShare] 查找文件信息失败: ", err)
 		return serializer.DBErr("", err)
 	}
+	// 云端对象尚未就绪或处理失败的文件不能分享
+	if shareFile.Uuid != "" && !shareFile.Available() {
+		return serializer.ParamsErr("FileNotAvailable", nil)
+	}
 
 	// 创建分享并保存到数据库
 	newShare := model.Share{
@@ -45,7 +48,7 @@ func (service *ShareCreateService) CreateShare(userId string) serializer.Respons
 		return serializer.DBErr("", err)
 	}
 	// 生成预签名下载URL
-	downloadUrl, err := disk.BaseCloudDisk.GetDownloadURL(shareFile.FilePath, shareFile.FileUuid)
+	downloadUrl, err := shareFile.DownloadURL(24 * time.Hour)
 	if err != nil {
 		logger.Log().Error("[ShareCreateService.CreateShare] 生成下载链接失败: ", err)
 		return serializer.DBErr("", err)
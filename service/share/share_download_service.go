@@ -1,15 +1,18 @@
 package share
 
 import (
-	"go-cloud-disk/disk"
+	"errors"
+	"time"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/throttle"
 )
 
 // ShareDownloadService 分享下载服务
 type ShareDownloadService struct {
-	ShareId string `json:"shareid" form:"shareid""` // 分享ID
+	ShareId string `json:"shareid" form:"shareid"` // 分享ID
 }
 
 type shareDownloadResponse struct {
@@ -31,11 +34,24 @@ func (service *ShareDownloadService) GetDownloadUrl(shareId string) serializer.R
 		logger.Log().Error("[ShareDownloadService.GetDownloadUrl] 查找文件失败: ", err)
 		return serializer.DBErr("文件不存在", err)
 	}
+	if !file.Available() {
+		return serializer.ParamsErr("FileNotAvailable", nil)
+	}
+
+	// 分享下载的流量计入分享者，防止分享链接被刷占满出口带宽
+	if err := throttle.ReserveUserQuota(share.Owner, throttle.Download, file.Size); err != nil {
+		if errors.Is(err, throttle.ErrDailyQuotaExceeded) {
+			return serializer.ParamsErr("DailyTransferQuotaExceeded", nil)
+		}
+		logger.Log().Error("[ShareDownloadService.GetDownloadUrl] 检查传输流量失败: ", err)
+		return serializer.InternalErr("", err)
+	}
 
 	// 生成预签名下载URL
-	downloadUrl, err := disk.BaseCloudDisk.GetDownloadURL(file.FilePath, file.FileUuid)
+	downloadUrl, err := file.DownloadURL(24 * time.Hour)
 	if err != nil {
 		logger.Log().Error("[ShareDownloadService.GetDownloadUrl] 生成预签名下载URL失败: ", err)
+		throttle.Refund(share.Owner, throttle.Download, file.Size)
 		return serializer.DBErr("生成预签名下载URL失败", err)
 	}
 
@@ -0,0 +1,78 @@
+package share
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/file"
+	"go-cloud-disk/test"
+	"go-cloud-disk/utils/throttle"
+)
+
+// createShare 分享文件并返回分享记录
+func createShare(t *testing.T, owner model.User, shared model.File) model.Share {
+	t.Helper()
+	share := model.Share{Owner: owner.Uuid, FileId: shared.Uuid, FileName: shared.DisplayName(), Title: "report", Size: shared.Size}
+	if err := model.DB.Create(&share).Error; err != nil {
+		t.Fatal(err)
+	}
+	return share
+}
+
+func TestGetShareInfo(t *testing.T) {
+	mem := test.Setup(t)
+	owner := test.CreateUser(t, 1024)
+	shared := createSharedFile(t, mem, owner, []byte("quarterly report"))
+	share := createShare(t, owner, shared)
+
+	// 公开的分享页面返回代理下载URL，不签发云端预签名URL
+	service := ShareGetInfoService{}
+	res := service.GetShareInfo(share.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("获取分享信息失败: %+v", res)
+	}
+	info := res.Data.(serializer.Share)
+	if !strings.HasPrefix(info.DownloadURL, file.FileContentRoute+shared.Uuid+"/content?") {
+		t.Fatalf("下载链接%q不是代理下载URL", info.DownloadURL)
+	}
+	if count := mem.CallCount("GetObjectDownloadURL"); count != 0 {
+		t.Fatalf("签发了%d个预签名URL，期望0", count)
+	}
+
+	// 文件已删除时设为空分享
+	if err := model.DB.Delete(&shared).Error; err != nil {
+		t.Fatal(err)
+	}
+	res = service.GetShareInfo(share.Uuid)
+	if info := res.Data.(serializer.Share); res.Code != serializer.CodeSuccess || info.DownloadURL != "" || info.FileId != "" {
+		t.Fatalf("文件已删除时应返回空分享: %+v", res)
+	}
+}
+
+func TestShareDownloadRefund(t *testing.T) {
+	mem := test.Setup(t)
+	owner := test.CreateUser(t, 1024)
+	shared := createSharedFile(t, mem, owner, []byte("quarterly report"))
+	share := createShare(t, owner, shared)
+
+	// 签发URL失败时退还预先扣除的流量
+	mem.FailOn("GetObjectDownloadURL", errors.New("cloud unavailable"))
+	service := ShareDownloadService{}
+	if res := service.GetDownloadUrl(share.Uuid); res.Code == serializer.CodeSuccess {
+		t.Fatalf("签发URL失败时应返回错误: %+v", res)
+	}
+	if used, err := throttle.GetUsage(owner.Uuid, throttle.Download); err != nil || used != 0 {
+		t.Fatalf("签发失败后已用流量%d，期望0，err=%v", used, err)
+	}
+
+	mem.FailOn("GetObjectDownloadURL", nil)
+	if res := service.GetDownloadUrl(share.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("获取下载链接失败: %+v", res)
+	}
+	if used, _ := throttle.GetUsage(owner.Uuid, throttle.Download); used != shared.Size {
+		t.Fatalf("已用流量%d，期望%d", used, shared.Size)
+	}
+}
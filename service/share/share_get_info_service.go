@@ -1,9 +1,13 @@
 package share
 
 import (
+	"errors"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
+	"go-cloud-disk/service/file"
 	"go-cloud-disk/utils/logger"
+	"go-cloud-disk/utils/throttle"
 )
 
 // ShareGetInfoService 获取分享信息服务结构体
@@ -17,11 +21,12 @@ func (service *ShareGetInfoService) GetShareInfo(shareid string) serializer.Resp
 	// 尝试从Redis获取分享信息
 	if share.CheckRedisExistsShare() {
 		downloadUrl := share.GetShareInfoFromRedis()
-		// 检查是否为空分享
+		// 检查是否为空分享，缓存的下载链接可能已过期，重新签名
 		if downloadUrl != "" {
+			downloadUrl = file.BuildProxyDownloadURL(share.FileId)
 			share.AddViewCount()
 		}
-		return serializer.Success(serializer.BuildShareWithDownloadUrl(share, downloadUrl))
+		return serializer.Success(serializer.BuildShareWithDownloadUrl(share, limitShareDownload(share, downloadUrl)))
 	}
 
 	// 无法从Redis获取分享信息时搜索数据库
@@ -30,10 +35,18 @@ func (service *ShareGetInfoService) GetShareInfo(shareid string) serializer.Resp
 		return serializer.DBErr("", err)
 	}
 
-	// 获取下载URL，如果无法获取下载URL说明分享已被删除
-	downloadUrl, err := share.DownloadURL()
-	if err != nil {
+	// 公开的分享页面返回经服务端代理的下载URL，按实际传输字节数计入分享者流量并限速。
+	// 文件已删除时设为空分享，文件处理失败时保留分享信息但不返回下载链接
+	var downloadUrl string
+	sharedFile, err := share.SharedFile()
+	switch {
+	case err == nil:
+		downloadUrl = file.BuildProxyDownloadURL(sharedFile.Uuid)
+	case errors.Is(err, model.ErrShareFileDeleted):
 		share.SetEmptyShare()
+	case !errors.Is(err, model.ErrFileNotAvailable):
+		logger.Log().Error("[ShareGetInfoService.GetShareInfo] 获取分享的文件失败: ", err)
+		return serializer.DBErr("", err)
 	}
 
 	// 如果日查看次数超过20次，将其添加到Redis中
@@ -50,5 +63,20 @@ func (service *ShareGetInfoService) GetShareInfo(shareid string) serializer.Resp
 	if downloadUrl != "" {
 		share.AddViewCount()
 	}
-	return serializer.Success(serializer.BuildShareWithDownloadUrl(share, downloadUrl))
+	return serializer.Success(serializer.BuildShareWithDownloadUrl(share, limitShareDownload(share, downloadUrl)))
+}
+
+// limitShareDownload 分享者当日下载流量已用完时不再返回下载链接
+func limitShareDownload(share model.Share, downloadUrl string) string {
+	if downloadUrl == "" {
+		return ""
+	}
+	err := throttle.CheckUserQuota(share.Owner, throttle.Download, 0)
+	if errors.Is(err, throttle.ErrDailyQuotaExceeded) {
+		return ""
+	}
+	if err != nil {
+		logger.Log().Error("[limitShareDownload] 检查传输流量失败: ", err)
+	}
+	return downloadUrl
 }
@@ -1,15 +1,19 @@
 package share
 
 import (
+	"errors"
+
 	"go-cloud-disk/model"
 	"go-cloud-disk/serializer"
 	"go-cloud-disk/utils/logger"
+	"gorm.io/gorm"
 )
 
 // ShareSaveFileService 保存分享文件服务结构体
 type ShareSaveFileService struct {
-	FileId         string `json:"fileid" form:"fileid" binding:"required"`         // 文件ID
-	SaveFilefolder string `json:"filefolder" form:"filefolder" binding:"required"` // 保存目标文件夹
+	FileId         string `json:"fileid" form:"fileid" binding:"required"`                                       // 文件ID
+	SaveFilefolder string `json:"filefolder" form:"filefolder" binding:"required"`                               // 保存目标文件夹
+	Conflict       string `json:"conflict" form:"conflict" binding:"omitempty,oneof=fail rename overwrite skip"` // 同名冲突策略，默认fail，overwrite时旧内容保留为历史版本
 }
 
 // ShareSaveFile 将分享的文件保存到用户的文件夹中
@@ -21,6 +25,9 @@ func (service *ShareSaveFileService) ShareSaveFile(userId string) serializer.Res
 		logger.Log().Error("[ShareSaveFileService.ShareSaveFile] 查找文件信息失败: ", err)
 		return serializer.DBErr("", err)
 	}
+	if saveFile.Uuid != "" && !saveFile.Available() {
+		return serializer.ParamsErr("FileNotAvailable", nil)
+	}
 
 	// 从数据库获取保存目标文件夹并检查所有者
 	var targetFilefolder model.FileFolder
@@ -28,6 +35,9 @@ func (service *ShareSaveFileService) ShareSaveFile(userId string) serializer.Res
 		logger.Log().Error("[ShareSaveFileService.ShareSaveFile] 查找文件夹失败: ", err)
 		return serializer.DBErr("", err)
 	}
+	if targetFilefolder.Uuid == "" {
+		return serializer.NotAuthErr("")
+	}
 
 	// 从数据库获取用户文件存储信息
 	var targetFileStore model.FileStore
@@ -36,31 +46,21 @@ func (service *ShareSaveFileService) ShareSaveFile(userId string) serializer.Res
 		return serializer.DBErr("", err)
 	}
 
-	// 检查添加文件大小后是否超过当前大小限制
-	if targetFileStore.CurrentSize+saveFile.Size > targetFileStore.MaxSize {
-		return serializer.ParamsErr("ExceedStoreLimit", nil)
-	}
-	// 更改文件夹大小
-	targetFileStore.AddCurrentSize(saveFile.Size)
-	t := model.DB.Begin()
-	defer func() {
-		if err != nil {
-			t.Rollback()
-		} else {
-			t.Commit()
-		}
-	}()
-
-	if err := t.Save(&targetFileStore).Error; err != nil {
-		logger.Log().Error("[ShareSaveFileService.ShareSaveFile] 更新用户存储信息失败: ", err)
+	// 检查添加文件大小后是否超过当前大小限制，进行中的分片上传预留的空间不可用
+	reserved, err := model.GetReservedSize(model.DB, targetFileStore.OwnerID)
+	if err != nil {
+		logger.Log().Error("[ShareSaveFileService.ShareSaveFile] 获取预留空间失败: ", err)
 		return serializer.DBErr("", err)
 	}
-	if err := targetFilefolder.AddFileFolderSize(t, saveFile.Size); err != nil {
-		logger.Log().Error("[ShareSaveFileService.ShareSaveFile] 增加文件夹大小失败: ", err)
-		return serializer.DBErr("", err)
+	if targetFileStore.CurrentSize+reserved+saveFile.Size > targetFileStore.MaxSize {
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
 	}
 
-	// 保存文件到文件夹
+	// 保存文件到文件夹，按冲突策略处理同名文件，覆盖时旧内容转为历史版本
+	conflict := service.Conflict
+	if conflict == "" {
+		conflict = model.ConflictFail
+	}
 	newFile := model.File{
 		Owner:          targetFileStore.OwnerID,
 		FileName:       saveFile.FileName,
@@ -68,12 +68,26 @@ func (service *ShareSaveFileService) ShareSaveFile(userId string) serializer.Res
 		FileUuid:       saveFile.FileUuid,
 		FilePath:       saveFile.FilePath,
 		Size:           saveFile.Size,
-		ParentFolderId: service.SaveFilefolder,
+		Hash:           saveFile.Hash,
+		ParentFolderId: targetFilefolder.Uuid,
+	}
+	err = model.DB.Transaction(func(t *gorm.DB) error {
+		folderDelta, skipped, err := model.CreateFile(t, &newFile, &targetFileStore, conflict)
+		if err != nil || skipped {
+			return err
+		}
+		return targetFilefolder.AddFileFolderSize(t, folderDelta)
+	})
+	if errors.Is(err, model.ErrNameConflict) {
+		return serializer.ParamsErr("NameConflict", nil)
+	}
+	if errors.Is(err, model.ErrExceedStoreLimit) {
+		return serializer.ParamsErr("ExceedStoreLimit", nil)
 	}
-	if err := model.DB.Create(&newFile).Error; err != nil {
-		logger.Log().Error("[ShareSaveFileService.ShareSaveFile] 创建文件失败: ", err)
+	if err != nil {
+		logger.Log().Error("[ShareSaveFileService.ShareSaveFile] 保存文件失败: ", err)
 		return serializer.DBErr("", err)
 	}
 
-	return serializer.Success(nil)
+	return serializer.Success(serializer.BuildFile(newFile))
 }
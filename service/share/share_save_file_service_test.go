@@ -0,0 +1,102 @@
+package share
+
+import (
+	"errors"
+	"testing"
+
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+	"go-cloud-disk/serializer"
+	"go-cloud-disk/test"
+)
+
+// createSharedFile 在用户主目录中创建文件记录并写入云端对象
+func createSharedFile(t *testing.T, mem *disk.MemoryCloudDisk, owner model.User, data []byte) model.File {
+	t.Helper()
+	file := model.File{
+		Owner:          owner.Uuid,
+		FileName:       "report",
+		FilePostfix:    "pdf",
+		FileUuid:       "report-object",
+		FilePath:       owner.Uuid,
+		ParentFolderId: owner.UserMainFileFolderID,
+		Size:           int64(len(data)),
+	}
+	if err := model.DB.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	mem.PutObject(file.Object().Key(), data)
+	return file
+}
+
+func TestShareSaveFile(t *testing.T) {
+	mem := test.Setup(t)
+	owner := test.CreateUser(t, 1024)
+	user := test.CreateUser(t, 1024)
+	shared := createSharedFile(t, mem, owner, []byte("quarterly report"))
+
+	// 转存只复用云端对象，不访问云端
+	for _, method := range []string{"UploadSimpleFile", "GetObject", "IsObjectExist", "DeleteObject"} {
+		mem.FailOn(method, errors.New("cloud unavailable"))
+	}
+	service := ShareSaveFileService{FileId: shared.Uuid, SaveFilefolder: user.UserMainFileFolderID}
+	res := service.ShareSaveFile(user.Uuid)
+	if res.Code != serializer.CodeSuccess {
+		t.Fatalf("转存失败: %+v", res)
+	}
+	if calls := mem.Calls(); len(calls) != 0 {
+		t.Fatalf("转存不应访问云端: %+v", calls)
+	}
+
+	files := test.Files(t, user.UserMainFileFolderID)
+	if len(files) != 1 || files[0].Owner != user.Uuid || files[0].Object() != shared.Object() || !files[0].Available() {
+		t.Fatalf("转存的文件应引用原文件的云端对象: %+v", files)
+	}
+	if store := test.Store(t, user.Uuid); store.CurrentSize != shared.Size {
+		t.Fatalf("存储空间已用%d，期望%d", store.CurrentSize, shared.Size)
+	}
+	if folder := test.Folder(t, user.UserMainFileFolderID); folder.Size != shared.Size {
+		t.Fatalf("文件夹大小%d，期望%d", folder.Size, shared.Size)
+	}
+
+	// 默认冲突策略为fail，rename时生成新文件名
+	if res := service.ShareSaveFile(user.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "NameConflict" {
+		t.Fatalf("同名冲突时应返回NameConflict: %+v", res)
+	}
+	service.Conflict = model.ConflictRename
+	if res := service.ShareSaveFile(user.Uuid); res.Code != serializer.CodeSuccess {
+		t.Fatalf("重命名转存失败: %+v", res)
+	}
+	if files := test.Files(t, user.UserMainFileFolderID); len(files) != 2 || files[0].FileName == files[1].FileName {
+		t.Fatalf("重命名转存后文件不符: %+v", files)
+	}
+}
+
+func TestShareSaveFileRejected(t *testing.T) {
+	mem := test.Setup(t)
+	owner := test.CreateUser(t, 1024)
+	user := test.CreateUser(t, 4)
+	shared := createSharedFile(t, mem, owner, []byte("quarterly report"))
+
+	service := ShareSaveFileService{FileId: shared.Uuid, SaveFilefolder: user.UserMainFileFolderID}
+	if res := service.ShareSaveFile(user.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "ExceedStoreLimit" {
+		t.Fatalf("超过容量时应返回ExceedStoreLimit: %+v", res)
+	}
+
+	// 不能转存到其他用户的文件夹
+	service.SaveFilefolder = owner.UserMainFileFolderID
+	if res := service.ShareSaveFile(user.Uuid); res.Code != serializer.CodeNotAuthError {
+		t.Fatalf("转存到其他用户的文件夹应返回未授权: %+v", res)
+	}
+
+	// 后台处理中的文件不能转存
+	if err := model.DB.Model(&shared).Update("status", model.FileStatusPending).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res := service.ShareSaveFile(owner.Uuid); res.Code != serializer.CodeParamsError || res.Msg != "FileNotAvailable" {
+		t.Fatalf("转存不可用的文件应返回FileNotAvailable: %+v", res)
+	}
+	if files := test.Files(t, user.UserMainFileFolderID); len(files) != 0 {
+		t.Fatalf("转存被拒绝时不应创建文件记录: %+v", files)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"os"
 	"time"
 
+	"go-cloud-disk/model"
+	mqtask "go-cloud-disk/rabbitMQ/task"
+	"go-cloud-disk/service/admin"
 	"go-cloud-disk/service/file"
+	"go-cloud-disk/service/file/chunk"
 	"go-cloud-disk/utils"
 )
 
@@ -26,3 +30,30 @@ func AutoCleanByCapacity() error {
 	var service file.RecycleBinService
 	return service.AutoCleanByCapacity()
 }
+
+// CleanExpiredUploadSessions 清理过期的分片上传会话
+func CleanExpiredUploadSessions() error {
+	var service chunk.UploadSessionService
+	return service.CleanExpiredUploadSessions()
+}
+
+// CleanExpiredFileVersions 按用户的保留天数清理过期的文件历史版本
+func CleanExpiredFileVersions() error {
+	return model.CleanExpiredFileVersions()
+}
+
+// EnqueueObjectCleanups 把宽限期已结束、不再被引用的云端对象提交到清理队列
+func EnqueueObjectCleanups() error {
+	return mqtask.EnqueueDueObjectCleanups()
+}
+
+// EnqueueUploadJobs 把已到重试时间或完成上传时未能提交的分片合并任务提交到合并队列
+func EnqueueUploadJobs() error {
+	return mqtask.EnqueueDueUploadJobs()
+}
+
+// CheckUserSizes 检查所有用户的文件夹大小和存储空间已用大小
+func CheckUserSizes() error {
+	var service admin.SizeCheckService
+	return service.CheckAllUserSizes()
+}
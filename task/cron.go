@@ -49,6 +49,27 @@ func CronJob() {
 	if _, err := Cron.AddFunc("@hourly", func() { Run("按容量自动清理", AutoCleanByCapacity) }); err != nil {
 		logger.Log().Error("设置按容量自动清理任务失败", err)
 	}
+	// 每小时清理过期的分片上传会话
+	if _, err := Cron.AddFunc("@hourly", func() { Run("清理过期上传会话", CleanExpiredUploadSessions) }); err != nil {
+		logger.Log().Error("设置清理过期上传会话任务失败", err)
+	}
+	// 每天凌晨3点清理过期的文件历史版本
+	if _, err := Cron.AddFunc("0 3 * * *", func() { Run("清理过期历史版本", CleanExpiredFileVersions) }); err != nil {
+		logger.Log().Error("设置清理过期历史版本任务失败", err)
+	}
+
+	// 每小时提交宽限期已结束的云端对象清理任务
+	if _, err := Cron.AddFunc("@hourly", func() { Run("提交云端对象清理", EnqueueObjectCleanups) }); err != nil {
+		logger.Log().Error("设置提交云端对象清理任务失败", err)
+	}
+	// 每分钟提交等待重试的分片合并任务
+	if _, err := Cron.AddFunc("@every 1m", func() { Run("提交分片合并任务", EnqueueUploadJobs) }); err != nil {
+		logger.Log().Error("设置提交分片合并任务失败", err)
+	}
+	// 每天凌晨4点检查文件夹大小和存储空间已用大小
+	if _, err := Cron.AddFunc("0 4 * * *", func() { Run("检查文件夹大小和存储空间", CheckUserSizes) }); err != nil {
+		logger.Log().Error("设置检查文件夹大小和存储空间任务失败", err)
+	}
 
 	Cron.Start()
 }
@@ -0,0 +1,181 @@
+package test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/disk"
+	"go-cloud-disk/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Setup 为服务测试准备内存SQLite数据库、内存Redis和内存云盘，替换全局实例并返回内存云盘，
+// 测试结束后关闭数据库和Redis
+func Setup(t *testing.T) *disk.MemoryCloudDisk {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	// 内存数据库每个连接各自独立，只保留一个连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取测试数据库连接失败: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	// 物化路径使用MySQL的字符集声明，SQLite不支持，迁移前改为普通类型
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&model.FileFolder{}); err != nil {
+		t.Fatalf("解析文件夹模型失败: %v", err)
+	}
+	stmt.Schema.LookUpField("TreePath").DataType = "varchar(2400)"
+
+	if err := db.AutoMigrate(
+		&model.User{}, &model.File{}, &model.FileFolder{}, &model.FileStore{}, &model.Share{},
+		&model.Tag{}, &model.FileTag{}, &model.RecycleBin{}, &model.RecycleBinConfig{},
+		&model.UploadReservation{}, &model.FileVersion{}, &model.FileVersionConfig{}, &model.CopyJob{},
+		&model.ObjectCleanup{}, &model.ReconcileJob{}, &model.ReconcileIssue{}, &model.UploadJob{},
+	); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+	model.DB = db
+
+	redisServer := miniredis.RunT(t)
+	cache.RedisClient = redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+
+	t.Cleanup(func() {
+		_ = cache.RedisClient.Close()
+		_ = sqlDB.Close()
+	})
+	// 内存云盘只在测试中注册，不能通过配置在生产环境中启用
+	disk.NewCloudDiskMap["MEMORY"] = disk.NewMemoryCloudDisk
+	return disk.UseMemoryCloudDisk()
+}
+
+// CreateUser 创建激活用户及其存储空间和主目录，maxSize为存储空间上限
+func CreateUser(t *testing.T, maxSize int64) model.User {
+	t.Helper()
+	user := model.User{UserName: "tester", NickName: "tester", Status: model.StatusActiveUser}
+	if err := user.CreateUser(); err != nil {
+		t.Fatalf("创建测试用户失败: %v", err)
+	}
+	if err := model.DB.Model(&model.FileStore{}).Where("uuid = ?", user.UserFileStoreID).
+		Update("max_size", maxSize).Error; err != nil {
+		t.Fatalf("设置存储空间上限失败: %v", err)
+	}
+	return user
+}
+
+// FileHeader 构建表单上传的文件头，用于调用接收上传文件的服务
+func FileHeader(t *testing.T, fileName string, data []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(int64(len(data)) + 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = form.RemoveAll() })
+	return form.File["file"][0]
+}
+
+// Store 读取用户的存储空间
+func Store(t *testing.T, userId string) model.FileStore {
+	t.Helper()
+	var store model.FileStore
+	if err := model.DB.Where("owner_id = ?", userId).First(&store).Error; err != nil {
+		t.Fatalf("读取存储空间失败: %v", err)
+	}
+	return store
+}
+
+// Folder 读取文件夹
+func Folder(t *testing.T, folderId string) model.FileFolder {
+	t.Helper()
+	var folder model.FileFolder
+	if err := model.DB.Where("uuid = ?", folderId).First(&folder).Error; err != nil {
+		t.Fatalf("读取文件夹失败: %v", err)
+	}
+	return folder
+}
+
+// Files 读取文件夹中的文件
+func Files(t *testing.T, folderId string) []model.File {
+	t.Helper()
+	var files []model.File
+	if err := model.DB.Where("parent_folder_id = ?", folderId).Order("file_name").Find(&files).Error; err != nil {
+		t.Fatalf("读取文件失败: %v", err)
+	}
+	return files
+}
+
+// CreateFolder 在父文件夹下创建空文件夹
+func CreateFolder(t *testing.T, parent model.FileFolder, name string) model.FileFolder {
+	t.Helper()
+	folder := model.FileFolder{
+		FileFolderName: name,
+		ParentFolderID: parent.Uuid,
+		FileStoreID:    parent.FileStoreID,
+		OwnerID:        parent.OwnerID,
+	}
+	if err := model.DB.Create(&folder).Error; err != nil {
+		t.Fatalf("创建文件夹失败: %v", err)
+	}
+	return folder
+}
+
+// CreateFile 在文件夹中创建文件记录，并计入各级文件夹大小和存储空间，不写入云端对象
+func CreateFile(t *testing.T, parent model.FileFolder, fileName string, size int64) model.File {
+	t.Helper()
+	file := model.File{
+		Owner:          parent.OwnerID,
+		FileName:       fileName,
+		FilePostfix:    "txt",
+		FileUuid:       uuid.New().String(),
+		FilePath:       parent.OwnerID,
+		ParentFolderId: parent.Uuid,
+		Size:           size,
+	}
+	if err := model.DB.Create(&file).Error; err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if err := model.AddFileFoldersSize(model.DB, map[string]int64{parent.Uuid: size}); err != nil {
+		t.Fatalf("更新文件夹大小失败: %v", err)
+	}
+	if err := model.DB.Model(&model.FileStore{}).Where("uuid = ?", parent.FileStoreID).
+		Update("current_size", gorm.Expr("current_size + ?", size)).Error; err != nil {
+		t.Fatalf("更新存储空间失败: %v", err)
+	}
+	return file
+}
+
+// CheckSizes 重新计算用户的文件夹大小和存储空间已用大小，与记录不符时测试失败
+func CheckSizes(t *testing.T, userId string) {
+	t.Helper()
+	check, err := model.CheckUserSizes(model.DB, userId, false)
+	if err != nil {
+		t.Fatalf("检查文件夹大小失败: %v", err)
+	}
+	if !check.Consistent() {
+		t.Fatalf("文件夹大小或存储空间与实际不符: %+v, %+v", check.FolderDiffs, check.StoreDiff)
+	}
+}
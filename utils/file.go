@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"io"
 	"os"
@@ -9,15 +10,6 @@ import (
 	"strings"
 )
 
-// FastBuildFileName 快速构建文件名，将文件名和文件后缀拼接
-func FastBuildFileName(fileName string, filePostfix string) string {
-	var res strings.Builder
-	res.Write([]byte(fileName))
-	res.Write([]byte("."))
-	res.Write([]byte(filePostfix))
-	return res.String()
-}
-
 // FastBuildString 快速构建字符串，将多个字符串拼接
 func FastBuildString(str ...string) string {
 	var res strings.Builder
@@ -44,6 +36,25 @@ func GetFileMD5(filePath string) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
+// GetReaderSHA256 读取数据流并计算内容的SHA-256，用于秒传去重
+func GetReaderSHA256(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetFileSHA256 获取文件内容的SHA-256
+func GetFileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return GetReaderSHA256(file)
+}
+
 // SplitFilename 分割文件名，将file.filename拆分为文件名和扩展名
 func SplitFilename(str string) (filename string, extend string) {
 	for i := len(str) - 1; i >= 0 && str[i] != '/'; i-- {
@@ -0,0 +1,21 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// HmacSign 使用HMAC-SHA256对多个字段进行签名，字段之间使用换行符分隔
+func HmacSign(secret string, fields ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckHmacSign 检查签名是否与字段匹配，使用常量时间比较防止时序攻击
+func CheckHmacSign(secret string, sign string, fields ...string) bool {
+	expected := HmacSign(secret, fields...)
+	return hmac.Equal([]byte(expected), []byte(sign))
+}
@@ -0,0 +1,239 @@
+package throttle
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// leaseDivisor 每次从共享令牌桶预取1/leaseDivisor秒的令牌，减少访问Redis的次数
+const leaseDivisor = 20
+
+// takeScript 按GCRA算法从所有实例共享的令牌桶取出令牌，桶容量为一秒的传输量。
+// 键保存理论到达时间（微秒），使用Redis服务器时间避免各实例时钟不一致，返回需要等待的微秒数
+var takeScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local tat = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tat < now then
+	tat = now
+end
+tat = tat + tonumber(ARGV[1])
+redis.call("SET", KEYS[1], tat, "PX", math.ceil((tat - now) / 1000) + 1000)
+local wait = tat - now - 1000000
+if wait < 0 then
+	return 0
+end
+return wait
+`)
+
+// bucket 令牌桶，同一实例中同一用户同一方向的并发传输共享，令牌从Redis中所有实例共享的令牌桶预取。
+// Redis不可用时退化为只在本实例内限速
+type bucket struct {
+	mu     sync.Mutex
+	key    string    // 共享令牌桶的Redis键
+	rate   int64     // 每秒生成的令牌数
+	leased int64     // 已从共享令牌桶预取、尚未使用的令牌数
+	tokens float64   // 本实例令牌数，可以为负数表示欠下的令牌，仅在Redis不可用时使用
+	last   time.Time // 上次补充本实例令牌的时间
+	users  int       // 正在使用此桶的传输数
+}
+
+// take 取出n个令牌，返回需要等待的时间
+func (b *bucket) take(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.leased >= int64(n) {
+		b.leased -= int64(n)
+		return 0
+	}
+
+	grant := max(int64(n)-b.leased, b.rate/leaseDivisor)
+	cost := grant * int64(time.Second/time.Microsecond) / b.rate
+	wait, err := takeScript.Run(context.Background(), cache.RedisClient, []string{b.key}, cost).Int64()
+	if err != nil {
+		logger.Log().Error("[throttle.take] 获取共享令牌失败: ", err)
+		return b.takeLocal(n)
+	}
+	b.leased += grant - int64(n)
+	return time.Duration(wait) * time.Microsecond
+}
+
+// takeLocal 从本实例的令牌桶取出n个令牌，返回需要等待的时间
+func (b *bucket) takeLocal(n int) time.Duration {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > float64(b.rate) {
+		b.tokens = float64(b.rate)
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+var (
+	bucketsMu sync.Mutex
+	buckets   = make(map[string]*bucket)
+)
+
+// acquireBucket 获取用户的令牌桶，限速配置变化时使用新的速率
+func acquireBucket(userId string, direction Direction, rate int64) *bucket {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	key := string(direction) + ":" + userId
+	b, ok := buckets[key]
+	if !ok {
+		b = &bucket{key: cache.TransferRateKey(userId, string(direction)), tokens: float64(rate), last: time.Now()}
+		buckets[key] = b
+	}
+	b.rate = rate
+	b.users++
+	return b
+}
+
+// releaseBucket 释放令牌桶，没有传输使用时删除
+func releaseBucket(userId string, direction Direction, b *bucket) {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	b.users--
+	if b.users == 0 {
+		delete(buckets, string(direction)+":"+userId)
+	}
+}
+
+// transfer 一次传输的限速和计数
+type transfer struct {
+	userId    string
+	direction Direction
+	bucket    *bucket // 不限速时为空
+	bytes     int64
+	once      sync.Once
+}
+
+// newTransfer 创建一次传输
+func newTransfer(userId string, limit Limit, direction Direction) *transfer {
+	t := &transfer{userId: userId, direction: direction}
+	if limit.Rate > 0 {
+		t.bucket = acquireBucket(userId, direction, limit.Rate)
+	}
+	return t
+}
+
+// wait 传输n字节前等待令牌
+func (t *transfer) wait(n int) {
+	if t.bucket == nil {
+		return
+	}
+	if delay := t.bucket.take(n); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// maxChunk 单次读写的最大字节数，避免一次等待过长
+func (t *transfer) maxChunk(n int) int {
+	if t.bucket != nil && int64(n) > t.bucket.rate {
+		return int(t.bucket.rate)
+	}
+	return n
+}
+
+// Done 结束传输，释放令牌桶并将实际传输的字节数计入每日流量，可多次调用
+func (t *transfer) Done() {
+	t.once.Do(func() {
+		if t.bucket != nil {
+			releaseBucket(t.userId, t.direction, t.bucket)
+		}
+		if err := Consume(t.userId, t.direction, t.bytes); err != nil {
+			logger.Log().Error("[throttle.Done] 记录传输流量失败: ", err)
+		}
+	})
+}
+
+// Writer 限速并统计流量的Writer
+type Writer struct {
+	*transfer
+	w io.Writer
+}
+
+// NewWriter 创建限速Writer，写入完成后需要调用Done
+func NewWriter(w io.Writer, userId string, limit Limit, direction Direction) *Writer {
+	return &Writer{transfer: newTransfer(userId, limit, direction), w: w}
+}
+
+// Write 按速率限制写入数据
+func (writer *Writer) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written : written+writer.maxChunk(len(p)-written)]
+		writer.wait(len(chunk))
+		n, err := writer.w.Write(chunk)
+		written += n
+		writer.bytes += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ResponseWriter 通过限速Writer写出响应体的ResponseWriter，用于限速下载
+type ResponseWriter struct {
+	gin.ResponseWriter
+	writer *Writer
+}
+
+// NewResponseWriter 创建限速ResponseWriter，写出完成后需要调用Done
+func NewResponseWriter(w gin.ResponseWriter, userId string, limit Limit, direction Direction) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, writer: NewWriter(w, userId, limit, direction)}
+}
+
+// Write 通过限速Writer写出响应体
+func (w *ResponseWriter) Write(data []byte) (int, error) {
+	return w.writer.Write(data)
+}
+
+// WriteString 通过限速Writer写出响应体
+func (w *ResponseWriter) WriteString(s string) (int, error) {
+	return w.writer.Write([]byte(s))
+}
+
+// Done 释放令牌桶并记录传输流量
+func (w *ResponseWriter) Done() {
+	w.writer.Done()
+}
+
+// Reader 限速并统计流量的ReadCloser
+type Reader struct {
+	*transfer
+	r io.ReadCloser
+}
+
+// NewReader 创建限速Reader，读取完成后需要调用Done
+func NewReader(r io.ReadCloser, userId string, limit Limit, direction Direction) *Reader {
+	return &Reader{transfer: newTransfer(userId, limit, direction), r: r}
+}
+
+// Read 按速率限制读取数据
+func (reader *Reader) Read(p []byte) (int, error) {
+	p = p[:reader.maxChunk(len(p))]
+	n, err := reader.r.Read(p)
+	reader.bytes += int64(n)
+	reader.wait(n)
+	return n, err
+}
+
+// Close 关闭底层数据流并结束传输
+func (reader *Reader) Close() error {
+	reader.Done()
+	return reader.r.Close()
+}
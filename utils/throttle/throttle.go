@@ -0,0 +1,204 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go-cloud-disk/cache"
+	"go-cloud-disk/conf"
+	"go-cloud-disk/model"
+	"go-cloud-disk/utils/logger"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Direction 传输方向
+type Direction string
+
+const (
+	// Download 下载
+	Download Direction = "download"
+	// Upload 上传
+	Upload Direction = "upload"
+)
+
+const (
+	defaultRateInactive  = 1 << 20  // 未激活用户默认1MB/s
+	defaultRateActive    = 10 << 20 // 激活用户默认10MB/s
+	defaultQuotaInactive = 1 << 30  // 未激活用户默认每日1GB
+	defaultQuotaActive   = 20 << 30 // 激活用户默认每日20GB
+
+	// usageExpire 每日流量计数的过期时间，跨天后保留一天便于排查
+	usageExpire = 48 * time.Hour
+)
+
+// ErrDailyQuotaExceeded 超过每日流量限制
+var ErrDailyQuotaExceeded = errors.New("超过今日传输流量限制")
+
+// reserveScript 检查加上size后不超过每日限制再扣除流量，检查和扣除在同一脚本中执行，并发签发时不会超额。
+// 超过限制时返回-1，否则返回扣除后的已用字节数
+var reserveScript = redis.NewScript(`
+local used = tonumber(redis.call("GET", KEYS[1]) or "0")
+if used + tonumber(ARGV[1]) > tonumber(ARGV[2]) then
+	return -1
+end
+used = redis.call("INCRBY", KEYS[1], ARGV[1])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return used
+`)
+
+// Limit 用户的传输限制，0表示不限制
+type Limit struct {
+	Rate       int64 // 每秒传输字节数
+	DailyQuota int64 // 每个方向每日传输字节数
+}
+
+// Unlimited 是否不做任何限制
+func (limit Limit) Unlimited() bool {
+	return limit.Rate == 0 && limit.DailyQuota == 0
+}
+
+// parseSize 解析配置中的字节数，未配置或格式错误时使用默认值
+func parseSize(value string, defaultSize int64) int64 {
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return defaultSize
+	}
+	return size
+}
+
+// GetLimit 根据用户状态获取传输限制，管理员不限制
+func GetLimit(status string) Limit {
+	switch status {
+	case model.StatusSuperAdmin, model.StatusAdmin:
+		return Limit{}
+	case model.StatusActiveUser:
+		return Limit{
+			Rate:       parseSize(conf.TransferRateActive, defaultRateActive),
+			DailyQuota: parseSize(conf.TransferQuotaActive, defaultQuotaActive),
+		}
+	default:
+		return Limit{
+			Rate:       parseSize(conf.TransferRateInactive, defaultRateInactive),
+			DailyQuota: parseSize(conf.TransferQuotaInactive, defaultQuotaInactive),
+		}
+	}
+}
+
+// GetUserLimit 查询用户状态并获取传输限制，用于无法从JWT获取状态的场景，例如分享下载
+func GetUserLimit(userId string) (Limit, error) {
+	var user model.User
+	if err := model.DB.Select("status").Where("uuid = ?", userId).First(&user).Error; err != nil {
+		return Limit{}, err
+	}
+	return GetLimit(user.Status), nil
+}
+
+// Usage 用户当日已传输的字节数
+type Usage struct {
+	Downloaded int64 // 已下载字节数
+	Uploaded   int64 // 已上传字节数
+}
+
+// GetUserUsage 获取用户当日上传和下载的字节数
+func GetUserUsage(userId string) (Usage, error) {
+	downloaded, err := GetUsage(userId, Download)
+	if err != nil {
+		return Usage{}, err
+	}
+	uploaded, err := GetUsage(userId, Upload)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Downloaded: downloaded, Uploaded: uploaded}, nil
+}
+
+// usageKey 用户当日流量计数键
+func usageKey(userId string, direction Direction) string {
+	return cache.TransferDailyKey(userId, string(direction), time.Now().Format("20060102"))
+}
+
+// GetUsage 获取用户当日已传输的字节数
+func GetUsage(userId string, direction Direction) (int64, error) {
+	used, err := cache.RedisClient.Get(context.Background(), usageKey(userId, direction)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	return used, nil
+}
+
+// CheckQuota 检查再传输size字节是否超过每日流量限制
+func CheckQuota(userId string, limit Limit, direction Direction, size int64) error {
+	if limit.DailyQuota == 0 {
+		return nil
+	}
+	used, err := GetUsage(userId, direction)
+	if err != nil {
+		return err
+	}
+	// 已用完时即使size为0也拒绝，用于无法预知大小的传输
+	if used >= limit.DailyQuota || used+size > limit.DailyQuota {
+		return ErrDailyQuotaExceeded
+	}
+	return nil
+}
+
+// Consume 记录用户传输的字节数
+func Consume(userId string, direction Direction, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	key := usageKey(userId, direction)
+	pipe := cache.RedisClient.TxPipeline()
+	pipe.IncrBy(context.Background(), key, size)
+	pipe.Expire(context.Background(), key, usageExpire)
+	_, err := pipe.Exec(context.Background())
+	return err
+}
+
+// Reserve 预先扣除size字节的流量，超过每日限制时不扣除并返回ErrDailyQuotaExceeded，
+// 用于签发预签名URL等无法统计实际传输字节数的场景
+func Reserve(userId string, limit Limit, direction Direction, size int64) error {
+	if limit.DailyQuota == 0 {
+		return Consume(userId, direction, size)
+	}
+	used, err := reserveScript.Run(context.Background(), cache.RedisClient, []string{usageKey(userId, direction)},
+		size, limit.DailyQuota, int64(usageExpire/time.Second)).Int64()
+	if err != nil {
+		return err
+	}
+	if used < 0 {
+		return ErrDailyQuotaExceeded
+	}
+	return nil
+}
+
+// Refund 退还预先扣除的流量，用于扣除后签发URL失败的场景
+func Refund(userId string, direction Direction, size int64) {
+	if size <= 0 {
+		return
+	}
+	if err := cache.RedisClient.DecrBy(context.Background(), usageKey(userId, direction), size).Err(); err != nil {
+		logger.Log().Error("[throttle.Refund] 退还传输流量失败: ", err)
+	}
+}
+
+// CheckUserQuota 查询用户的传输限制并检查再传输size字节是否超过每日流量限制
+func CheckUserQuota(userId string, direction Direction, size int64) error {
+	limit, err := GetUserLimit(userId)
+	if err != nil {
+		return err
+	}
+	return CheckQuota(userId, limit, direction, size)
+}
+
+// ReserveUserQuota 查询用户的传输限制并预先扣除size字节的流量
+func ReserveUserQuota(userId string, direction Direction, size int64) error {
+	limit, err := GetUserLimit(userId)
+	if err != nil {
+		return err
+	}
+	return Reserve(userId, limit, direction, size)
+}
@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go-cloud-disk/test"
+)
+
+func TestReserve(t *testing.T) {
+	test.Setup(t)
+	limit := Limit{DailyQuota: 100}
+
+	// 并发签发时已用流量不会超过每日限制
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Reserve("user", limit, Download, 30)
+			if err == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrDailyQuotaExceeded) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if used, err := GetUsage("user", Download); err != nil || reserved != 3 || used != 90 {
+		t.Fatalf("预留成功%d次，已用%d，期望3次和90，err=%v", reserved, used, err)
+	}
+
+	// 超过限制时不扣除，退还后可以继续预留
+	if err := Reserve("user", limit, Download, 20); !errors.Is(err, ErrDailyQuotaExceeded) {
+		t.Fatalf("超过限制时应返回ErrDailyQuotaExceeded: %v", err)
+	}
+	Refund("user", Download, 30)
+	if err := Reserve("user", limit, Download, 20); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := GetUsage("user", Download); used != 80 {
+		t.Fatalf("已用%d，期望80", used)
+	}
+}
+
+func TestSharedBucket(t *testing.T) {
+	test.Setup(t)
+
+	// 不同实例的令牌桶通过Redis共享令牌，这里用两个桶模拟两个实例
+	first := &bucket{key: "transfer:rate:test", rate: 1000, last: time.Now()}
+	second := &bucket{key: "transfer:rate:test", rate: 1000, last: time.Now()}
+	if wait := first.take(1000); wait != 0 {
+		t.Fatalf("桶容量内取令牌不应等待: %v", wait)
+	}
+	// 不足预取量时按预取量取令牌，等待预取量对应的时间
+	wait := second.take(10)
+	if wait < 40*time.Millisecond || wait > 60*time.Millisecond {
+		t.Fatalf("共享令牌用完后应等待约50ms，实际%v", wait)
+	}
+	// 预取的令牌用完前不访问Redis，也不需要等待
+	if second.leased != 40 {
+		t.Fatalf("预取剩余%d个令牌，期望40", second.leased)
+	}
+	if wait := second.take(40); wait != 0 {
+		t.Fatalf("使用预取的令牌不应等待: %v", wait)
+	}
+	if wait := first.take(500); wait < 500*time.Millisecond {
+		t.Fatalf("共享令牌用完后应等待约550ms，实际%v", wait)
+	}
+}